@@ -0,0 +1,82 @@
+package cldpd
+
+import "strings"
+
+const (
+	esc = 0x1b // introduces every escape sequence
+	bel = 0x07 // terminates an OSC string, as well as ESC \
+)
+
+// stripANSI returns line without terminal escape sequences: CSI sequences
+// (colors, cursor movement, erasing), OSC strings (window titles, hyperlinks),
+// DCS, SOS, PM, and APC strings, and bare two-byte ESC codes such as ESC 7.
+// Only bytes that belong to a sequence introduced by ESC are removed, so
+// brackets and other text are left alone. A sequence cut off by the end of
+// line is dropped.
+func stripANSI(line string) string {
+	if strings.IndexByte(line, esc) < 0 {
+		return line
+	}
+	var b strings.Builder
+	b.Grow(len(line))
+	for i := 0; i < len(line); {
+		if line[i] != esc {
+			b.WriteByte(line[i])
+			i++
+			continue
+		}
+		i = skipEscape(line, i)
+	}
+	return b.String()
+}
+
+// skipEscape returns the index just past the escape sequence that begins with
+// the ESC at line[i], or len(line) if the sequence is unterminated.
+func skipEscape(line string, i int) int {
+	i++ // ESC
+	if i >= len(line) {
+		return i
+	}
+	switch c := line[i]; {
+	case c == '[':
+		// CSI: parameter bytes 0x30-0x3F, intermediate bytes 0x20-0x2F, then
+		// one final byte 0x40-0x7E.
+		for i++; i < len(line); i++ {
+			if line[i] >= 0x40 && line[i] <= 0x7e {
+				return i + 1
+			}
+			if line[i] < 0x20 || line[i] > 0x3f {
+				// Not a valid CSI byte; end the sequence here and keep it.
+				return i
+			}
+		}
+		return i
+	case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+		// OSC, DCS, SOS, PM, or APC: a string ended by BEL or ST (ESC \).
+		for i++; i < len(line); i++ {
+			if line[i] == bel {
+				return i + 1
+			}
+			if line[i] == esc && i+1 < len(line) && line[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return i
+	case c >= 0x20 && c <= 0x2f:
+		// nF escape, such as ESC ( B selecting a character set: intermediate
+		// bytes, then one final byte.
+		for i++; i < len(line); i++ {
+			if line[i] < 0x20 || line[i] > 0x2f {
+				return i + 1
+			}
+		}
+		return i
+	case c >= 0x30 && c <= 0x7e:
+		// Bare two-byte escape, such as ESC 7 or ESC M.
+		return i + 1
+	default:
+		// ESC followed by a control character or non-ASCII byte: drop the ESC
+		// alone.
+		return i
+	}
+}
@@ -0,0 +1,42 @@
+//go:build testing
+
+package cldpd
+
+import "testing"
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"plain", "Running go test ./...", "Running go test ./..."},
+		{"brackets kept", "[1/3] map[a:1] arr[0] ]", "[1/3] map[a:1] arr[0] ]"},
+		{"empty", "", ""},
+		{"sgr color", "\x1b[32m✓\x1b[0m tests passed", "✓ tests passed"},
+		{"sgr bold and 256 color", "\x1b[1;38;5;208mWarning:\x1b[22;39m disk low", "Warning: disk low"},
+		{"sgr truecolor", "\x1b[38;2;215;119;87m●\x1b[39m Bash(go build)", "● Bash(go build)"},
+		{"erase line and cursor up", "\x1b[2K\x1b[1A\x1b[2K\x1b[G> thinking", "> thinking"},
+		{"private mode", "\x1b[?25l\x1b[?2004hprompt\x1b[?25h", "prompt"},
+		{"osc title bel", "\x1b]0;✳ Claude Code\x07ready", "ready"},
+		{"osc title st", "\x1b]2;claude\x1b\\ready", "ready"},
+		{"osc hyperlink", "see \x1b]8;;https://example.com\x1b\\docs\x1b]8;;\x1b\\ here", "see docs here"},
+		{"dcs", "\x1bP+q544e\x1b\\done", "done"},
+		{"bare save and restore cursor", "\x1b7saved\x1b8", "saved"},
+		{"keypad mode", "\x1b=\x1b>text", "text"},
+		{"charset select", "\x1b(Bplain", "plain"},
+		{"escape then bracket text", "\x1b[0m[INFO] started", "[INFO] started"},
+		{"trailing escape", "text\x1b", "text"},
+		{"unterminated csi", "text\x1b[3", "text"},
+		{"unterminated osc", "text\x1b]0;title", "text"},
+		{"double escape", "\x1b\x1b[31mred", "red"},
+		{"control inside csi", "\x1b[3\tx", "\tx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripANSI(tt.line); got != tt.want {
+				t.Errorf("stripANSI(%q): got %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package cldpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Builder is the interface over image build operations. It is separate from
+// Runner so that the build backend can be swapped independently of the
+// backend that runs containers (e.g. buildah or nerdctl builds paired with
+// docker run).
+type Builder interface {
+	// Build builds an image tagged with tag from the Dockerfile in dir.
+	// Returns ErrBuildFailed if the build exits with a non-zero status.
+	Build(ctx context.Context, tag string, dir string, opts BuildOptions) error
+}
+
+// BuildOptions configures an image build.
+type BuildOptions struct {
+	Output     io.Writer         // receives the build's progress output as plain text (--progress=plain); nil discards it
+	Tags       []string          // further tags given the image alongside the build's tag (-t each)
+	BuildArgs  map[string]string // build arguments (--build-arg K=V)
+	Secrets    []BuildSecret     // BuildKit secrets (--secret id=ID,src=SRC); the build runs with DOCKER_BUILDKIT=1
+	Dockerfile string            // path to the Dockerfile (-f); empty uses dir/Dockerfile
+	Target     string            // multi-stage build stage to build (--target)
+	Platform   string            // target platform, e.g. linux/arm64 (--platform)
+	NoCache    bool              // build without the layer cache (--no-cache)
+	Pull       bool              // always pull newer versions of base images (--pull)
+}
+
+// DockerBuilder implements Builder using the Docker CLI via os/exec.
+type DockerBuilder struct{}
+
+// buildCmdArgs returns the docker CLI arguments for a build invocation. When
+// the output is captured, BuildKit is asked for plain progress, since its
+// default TTY display collapses steps into escape sequences that are
+// unreadable as lines.
+func buildCmdArgs(tag string, dir string, opts BuildOptions) []string {
+	args := []string{"build", "-t", tag}
+	for _, t := range opts.Tags {
+		args = append(args, "-t", t)
+	}
+	if opts.Dockerfile != "" {
+		args = append(args, "-f", opts.Dockerfile)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if opts.Pull {
+		args = append(args, "--pull")
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+	if opts.Output != nil {
+		args = append(args, "--progress=plain")
+	}
+	for k, v := range opts.BuildArgs {
+		args = append(args, "--build-arg", k+"="+v)
+	}
+	for _, s := range opts.Secrets {
+		args = append(args, "--secret", "id="+s.ID+",src="+s.Src)
+	}
+	args = append(args, dir)
+	return args
+}
+
+// Build builds a Docker image tagged with tag from the Dockerfile in dir.
+func (b *DockerBuilder) Build(ctx context.Context, tag string, dir string, opts BuildOptions) error {
+	args := buildCmdArgs(tag, dir, opts)
+
+	cmd := dockerCommand(ctx, args...)
+	if len(opts.Secrets) > 0 || opts.Output != nil {
+		// --secret and --progress need BuildKit, which older daemons do not
+		// use by default.
+		cmd.Env = append(cmd.Env, "DOCKER_BUILDKIT=1")
+	}
+	cmd.Stdout = io.Discard
+	// Only the tail is kept for the error: with Output set, the whole build
+	// log has already been streamed there.
+	stderr := &tailBuffer{limit: runStderrLimit}
+	cmd.Stderr = stderr
+	if opts.Output != nil {
+		// The classic builder writes steps to stdout, BuildKit to stderr.
+		cmd.Stdout = opts.Output
+		cmd.Stderr = io.MultiWriter(stderr, opts.Output)
+	}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: exit code %d: %s", ErrBuildFailed, exitErr.ExitCode(), stderr.String())
+		}
+		return fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+	return nil
+}
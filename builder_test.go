@@ -0,0 +1,209 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeBuilder is a test double for Builder that records its last invocation.
+type fakeBuilder struct {
+	err   error
+	tag   string
+	dir   string
+	opts  BuildOptions
+	calls int
+}
+
+func (f *fakeBuilder) Build(_ context.Context, tag string, dir string, opts BuildOptions) error {
+	f.calls++
+	f.tag = tag
+	f.dir = dir
+	f.opts = opts
+	return f.err
+}
+
+// builderFunc adapts a function to the Builder interface.
+type builderFunc func(ctx context.Context, tag string, dir string, opts BuildOptions) error
+
+func (f builderFunc) Build(ctx context.Context, tag string, dir string, opts BuildOptions) error {
+	return f(ctx, tag, dir, opts)
+}
+
+// Compile-time interface assertions.
+var _ Builder = (*DockerBuilder)(nil)
+var _ Builder = (*fakeBuilder)(nil)
+var _ Builder = Runner(nil)
+var _ Builder = builderFunc(nil)
+
+func TestBuildCmdArgs_Minimal(t *testing.T) {
+	args := buildCmdArgs("myimage:latest", "/some/dir", BuildOptions{})
+	want := []string{"build", "-t", "myimage:latest", "/some/dir"}
+	if len(args) != len(want) {
+		t.Fatalf("args: got %v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("args[%d]: got %q, want %q", i, args[i], want[i])
+		}
+	}
+}
+
+func TestBuildCmdArgs_NoCache(t *testing.T) {
+	args := buildCmdArgs("img", "/dir", BuildOptions{NoCache: true})
+	want := []string{"build", "-t", "img", "--no-cache", "/dir"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+}
+
+func TestBuildCmdArgs_Options(t *testing.T) {
+	tests := []struct {
+		name string
+		opts BuildOptions
+		want []string
+	}{
+		{"pull", BuildOptions{Pull: true}, []string{"build", "-t", "img", "--pull", "/dir"}},
+		{"dockerfile", BuildOptions{Dockerfile: "/dir/Containerfile"}, []string{"build", "-t", "img", "-f", "/dir/Containerfile", "/dir"}},
+		{"target", BuildOptions{Target: "dev"}, []string{"build", "-t", "img", "--target", "dev", "/dir"}},
+		{"platform", BuildOptions{Platform: "linux/arm64"}, []string{"build", "-t", "img", "--platform", "linux/arm64", "/dir"}},
+		{"tags", BuildOptions{Tags: []string{"img:a", "img:b"}}, []string{"build", "-t", "img", "-t", "img:a", "-t", "img:b", "/dir"}},
+		{
+			"all",
+			BuildOptions{NoCache: true, Pull: true, Target: "prod", Platform: "linux/amd64", BuildArgs: map[string]string{"K": "v"}},
+			[]string{"build", "-t", "img", "--no-cache", "--pull", "--target", "prod", "--platform", "linux/amd64", "--build-arg", "K=v", "/dir"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildCmdArgs("img", "/dir", tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("args: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCmdArgs_ProgressPlain(t *testing.T) {
+	if args := buildCmdArgs("img", "/dir", BuildOptions{}); slices.ContainsFunc(args, func(a string) bool { return strings.HasPrefix(a, "--progress") }) {
+		t.Errorf("--progress should not be present without Output: %v", args)
+	}
+	args := buildCmdArgs("img", "/dir", BuildOptions{Output: io.Discard})
+	want := []string{"build", "-t", "img", "--progress=plain", "/dir"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+}
+
+func TestBuildCmdArgs_Secrets(t *testing.T) {
+	args := buildCmdArgs("img", "/dir", BuildOptions{Secrets: []BuildSecret{
+		{ID: "npmrc", Src: "/home/me/.npmrc"},
+		{ID: "gh_token", Src: "/run/secrets/gh"},
+	}})
+	want := []string{"build", "-t", "img", "--secret", "id=npmrc,src=/home/me/.npmrc", "--secret", "id=gh_token,src=/run/secrets/gh", "/dir"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+}
+
+func TestDockerBuilder_Build_EnablesBuildKit(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     BuildOptions
+		buildKit bool
+	}{
+		{"default", BuildOptions{}, false},
+		{"secrets", BuildOptions{Secrets: []BuildSecret{{ID: "npmrc", Src: "/home/me/.npmrc"}}}, true},
+		{"output", BuildOptions{Output: io.Discard}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := fakeDocker(t, `env > "$OUT"`)
+			t.Setenv("DOCKER_BUILDKIT", "")
+			if err := (&DockerBuilder{}).Build(context.Background(), "img", t.TempDir(), tt.opts); err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			env, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("docker was not run: %v", err)
+			}
+			if got := strings.Contains(string(env), "DOCKER_BUILDKIT=1\n"); got != tt.buildKit {
+				t.Errorf("DOCKER_BUILDKIT=1 set: got %t, want %t", got, tt.buildKit)
+			}
+		})
+	}
+}
+
+func TestDockerBuilder_Build_BoundsErrorOutput(t *testing.T) {
+	// A failing build writes far more than runStderrLimit to stderr, ending
+	// in the line that says what went wrong.
+	fakeDocker(t, `i=0; while [ $i -lt 2000 ]; do echo "#5 step output line $i" >&2; i=$((i+1)); done; echo "ERROR: failed to solve" >&2; exit 1`)
+
+	var streamed strings.Builder
+	err := (&DockerBuilder{}).Build(context.Background(), "img", t.TempDir(), BuildOptions{Output: &streamed})
+	if !errors.Is(err, ErrBuildFailed) {
+		t.Fatalf("got %v, want ErrBuildFailed", err)
+	}
+	if !strings.Contains(err.Error(), "ERROR: failed to solve") {
+		t.Errorf("error lost the tail of stderr: %q", err)
+	}
+	if len(err.Error()) > runStderrLimit+100 {
+		t.Errorf("error is %d bytes, want at most about %d", len(err.Error()), runStderrLimit)
+	}
+	if !strings.Contains(streamed.String(), "step output line 0\n") {
+		t.Error("Output did not receive the full build log")
+	}
+}
+
+func TestBuildCmdArgs_WithBuildArgs(t *testing.T) {
+	args := buildCmdArgs("img", "/dir", BuildOptions{BuildArgs: map[string]string{"KEY": "val"}})
+	// Must contain --build-arg KEY=val before the dir.
+	var foundBuildArg bool
+	for i, a := range args {
+		if a == "--build-arg" && i+1 < len(args) && args[i+1] == "KEY=val" {
+			foundBuildArg = true
+		}
+	}
+	if !foundBuildArg {
+		t.Errorf("args missing --build-arg KEY=val: %v", args)
+	}
+	if args[len(args)-1] != "/dir" {
+		t.Errorf("last arg should be dir, got %q", args[len(args)-1])
+	}
+}
+
+func TestDockerRunner_Build_DelegatesToBuilder(t *testing.T) {
+	fb := &fakeBuilder{}
+	r := &DockerRunner{Builder: fb}
+
+	var out bytes.Buffer
+	err := r.Build(context.Background(), "img:tag", "/ctx", BuildOptions{BuildArgs: map[string]string{"K": "v"}, NoCache: true, Target: "dev", Output: &out})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fb.calls != 1 {
+		t.Fatalf("builder called %d times, want 1", fb.calls)
+	}
+	if fb.tag != "img:tag" || fb.dir != "/ctx" {
+		t.Errorf("builder got tag=%q dir=%q, want img:tag /ctx", fb.tag, fb.dir)
+	}
+	if fb.opts.BuildArgs["K"] != "v" || !fb.opts.NoCache || fb.opts.Target != "dev" || fb.opts.Output != &out {
+		t.Errorf("opts: got %+v, want every option passed through", fb.opts)
+	}
+}
+
+func TestDockerRunner_Build_BuilderError(t *testing.T) {
+	fb := &fakeBuilder{err: ErrBuildFailed}
+	r := &DockerRunner{Builder: fb}
+
+	err := r.Build(context.Background(), "img", "/ctx", BuildOptions{})
+	if !errors.Is(err, ErrBuildFailed) {
+		t.Errorf("got %v, want ErrBuildFailed", err)
+	}
+}
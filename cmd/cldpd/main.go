@@ -2,8 +2,17 @@
 //
 // Usage:
 //
-//	cldpd start <pod> --issue <url>
-//	cldpd resume <pod> --prompt <text>
+//	cldpd start <pod> --issue <url>|--task <text>|--task-file <path> [--output text|json] [--timestamps] [--no-cache] [--pull] [--keep-container] [--detach] [--force] [--strip-ansi] [--fetch-issue]
+//	cldpd resume <pod> --prompt <text>|--prompt-file <path> [--output text|json] [--timestamps]
+//	cldpd shell <pod> [cmd...]
+//	cldpd build <pod> [--no-cache] [--pull]
+//	cldpd init <pod> [--from <pod>] [--force]
+//	cldpd ps [--all] [--json]
+//	cldpd list [--json]
+//	cldpd clean [--pods] [--images] [--dry-run]
+//	cldpd image prune [--keep <n>]
+//	cldpd doctor
+//	cldpd version
 //
 // Pods are defined as directories under ~/.cldpd/pods/<name>/ containing
 // a Dockerfile and an optional pod.json configuration file.
@@ -11,14 +20,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/zoobzio/cldpd"
 )
 
+// version is the cldpd release, set at build time with
+// -ldflags "-X main.version=v1.2.3". When empty, versionString falls back to
+// the module version in the binary's build info, which go install records.
+var version string
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	code := run(ctx)
@@ -38,6 +60,25 @@ func run(ctx context.Context) int {
 		return runStart(ctx, os.Args[2:])
 	case "resume":
 		return runResume(ctx, os.Args[2:])
+	case "shell":
+		return runShell(ctx, os.Args[2:])
+	case "build":
+		return runBuild(ctx, os.Args[2:])
+	case "init":
+		return runInit(os.Args[2:])
+	case "ps":
+		return runPs(ctx, os.Args[2:])
+	case "list":
+		return runList(os.Args[2:])
+	case "clean":
+		return runClean(ctx, os.Args[2:])
+	case "image":
+		return runImage(ctx, os.Args[2:])
+	case "doctor":
+		return runDoctor(ctx, os.Args[2:])
+	case "version", "--version":
+		fmt.Println(versionString())
+		return 0
 	case "help", "--help":
 		printUsage()
 		return 0
@@ -51,18 +92,45 @@ func run(ctx context.Context) int {
 func runStart(ctx context.Context, args []string) int {
 	fs := flag.NewFlagSet("start", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	issue := fs.String("issue", "", "GitHub issue URL (required)")
+	issue := fs.String("issue", "", "GitHub issue URL (this, --task, or --task-file is required)")
+	task := fs.String("task", "", "Freeform task for the pod, in place of an issue")
+	taskFile := fs.String("task-file", "", "Read the task from a file, or from stdin if -")
+	output := fs.String("output", outputText, "Event output format: text or json")
+	timestamps := fs.Bool("timestamps", false, "Prefix printed lines with the event time (RFC 3339) and print lifecycle events")
+	noCache := fs.Bool("no-cache", false, "Build without the Docker layer cache")
+	pull := fs.Bool("pull", false, "Pull newer versions of base images while building")
+	keep := fs.Bool("keep-container", false, "Leave the container in place after it exits, for debugging")
+	detach := fs.Bool("detach", false, "Exit once the container has started, leaving it running")
+	force := fs.Bool("force", false, "Remove a running container that already holds the pod's container name")
+	fetchIssue := fs.Bool("fetch-issue", false, "Put the issue's title, body, and labels in the prompt, fetched with gh")
+	stripANSI := fs.Bool("strip-ansi", false, "Remove terminal escape sequences (colors, cursor movement) from output")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
+	if !validOutput(*output) {
+		fmt.Fprintf(os.Stderr, "cldpd start: --output must be %s or %s\n", outputText, outputJSON)
+		return 1
+	}
 	if fs.NArg() < 1 {
 		fmt.Fprintln(os.Stderr, "cldpd start: pod name required")
 		return 1
 	}
-	if *issue == "" {
-		fmt.Fprintln(os.Stderr, "cldpd start: --issue is required")
+	switch set := countSet(*issue, *task, *taskFile); {
+	case set > 1:
+		fmt.Fprintln(os.Stderr, "cldpd start: --issue, --task, and --task-file are mutually exclusive")
+		return 1
+	case set == 0 || *issue == "" && *taskFile == "" && strings.TrimSpace(*task) == "":
+		fmt.Fprintln(os.Stderr, "cldpd start: --issue, --task, or --task-file is required")
 		return 1
 	}
+	if *taskFile != "" {
+		text, err := readPromptFile(*taskFile, os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd start: --task-file: %v\n", err)
+			return 1
+		}
+		*task = text
+	}
 	podName := fs.Arg(0)
 
 	runner := &cldpd.DockerRunner{}
@@ -77,30 +145,64 @@ func runStart(ctx context.Context, args []string) int {
 		return 1
 	}
 
-	d := cldpd.NewDispatcher(podsDir, runner)
-	session, err := d.Start(ctx, podName, *issue)
+	policy, err := loadPolicy()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
 		return 1
 	}
 
-	return consumeSession(ctx, session)
+	d := cldpd.NewDispatcher(podsDir, runner, cldpd.WithPolicy(policy))
+	startOpts := cldpd.StartOptions{NoCache: *noCache, Pull: *pull, KeepContainer: *keep, Detach: *detach, Force: *force, StripANSI: *stripANSI, FetchIssue: *fetchIssue}
+	var session *cldpd.Session
+	if *task != "" {
+		session, err = d.StartTaskWith(ctx, podName, *task, startOpts)
+	} else {
+		session, err = d.StartWith(ctx, podName, *issue, startOpts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	if *detach {
+		return detachSession(ctx, session, *output, *timestamps)
+	}
+	return consumeSession(ctx, session, *output, *timestamps)
 }
 
 func runResume(ctx context.Context, args []string) int {
 	fs := flag.NewFlagSet("resume", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	prompt := fs.String("prompt", "", "Follow-up guidance for the running pod (required)")
+	prompt := fs.String("prompt", "", "Follow-up guidance for the running pod (this or --prompt-file is required)")
+	promptFile := fs.String("prompt-file", "", "Read the guidance from a file, or from stdin if -")
+	output := fs.String("output", outputText, "Event output format: text or json")
+	timestamps := fs.Bool("timestamps", false, "Prefix printed lines with the event time (RFC 3339) and print lifecycle events")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
+	if !validOutput(*output) {
+		fmt.Fprintf(os.Stderr, "cldpd resume: --output must be %s or %s\n", outputText, outputJSON)
+		return 1
+	}
 	if fs.NArg() < 1 {
 		fmt.Fprintln(os.Stderr, "cldpd resume: pod name required")
 		return 1
 	}
-	if *prompt == "" {
-		fmt.Fprintln(os.Stderr, "cldpd resume: --prompt is required")
+	switch set := countSet(*prompt, *promptFile); {
+	case set > 1:
+		fmt.Fprintln(os.Stderr, "cldpd resume: --prompt and --prompt-file are mutually exclusive")
 		return 1
+	case set == 0 || *promptFile == "" && strings.TrimSpace(*prompt) == "":
+		fmt.Fprintln(os.Stderr, "cldpd resume: --prompt or --prompt-file is required")
+		return 1
+	}
+	if *promptFile != "" {
+		text, err := readPromptFile(*promptFile, os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd resume: --prompt-file: %v\n", err)
+			return 1
+		}
+		*prompt = text
 	}
 	podName := fs.Arg(0)
 
@@ -118,34 +220,642 @@ func runResume(ctx context.Context, args []string) int {
 		return 1
 	}
 
-	return consumeSession(ctx, session)
+	return consumeSession(ctx, session, *output, *timestamps)
+}
+
+func runShell(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "cldpd shell: pod name required")
+		return 1
+	}
+	podName := fs.Arg(0)
+
+	runner := &cldpd.DockerRunner{}
+	if err := runner.Preflight(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	return shell(ctx, cldpd.NewDispatcher(podsDir, runner), podName, fs.Args()[1:])
+}
+
+// shell runs cmd interactively in podName's container on the process's own
+// stdin, stdout, and stderr, and returns its exit code.
+func shell(ctx context.Context, d *cldpd.Dispatcher, podName string, cmd []string) int {
+	code, err := d.Shell(ctx, podName, cmd, os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return sessionExitCode(err)
+	}
+	return code
+}
+
+func runBuild(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	noCache := fs.Bool("no-cache", false, "Build without the Docker layer cache")
+	pull := fs.Bool("pull", false, "Pull newer versions of base images")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "cldpd build: pod name required")
+		return 1
+	}
+	podName := fs.Arg(0)
+
+	runner := &cldpd.DockerRunner{}
+	if err := runner.Preflight(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	policy, err := loadPolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	opts := cldpd.BuildOptions{Output: os.Stdout, NoCache: *noCache, Pull: *pull}
+	return build(ctx, cldpd.NewDispatcher(podsDir, runner, cldpd.WithPolicy(policy)), podName, opts)
+}
+
+// loadPolicy loads the policy at the default path, or nil if none is installed.
+func loadPolicy() (*cldpd.Policy, error) {
+	path, err := cldpd.DefaultPolicyPath()
+	if err != nil {
+		return nil, err
+	}
+	return cldpd.LoadPolicy(path)
+}
+
+// build builds podName's image with opts, which sets where build output goes.
+func build(ctx context.Context, d *cldpd.Dispatcher, podName string, opts cldpd.BuildOptions) int {
+	if err := d.Build(ctx, podName, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	from := fs.String("from", "", "Existing pod to copy as a starting point")
+	force := fs.Bool("force", false, "Overwrite an existing pod")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "cldpd init: pod name required")
+		return 1
+	}
+	podName := fs.Arg(0)
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	pod, err := cldpd.ScaffoldPod(podsDir, podName, cldpd.ScaffoldOptions{From: *from, Force: *force})
+	if err != nil {
+		if errors.Is(err, cldpd.ErrPodExists) {
+			fmt.Fprintf(os.Stderr, "cldpd: %v (use --force to overwrite)\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(pod.Dir)
+	return 0
+}
+
+func runPs(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	all := fs.Bool("all", false, "Include exited containers")
+	jsonOut := fs.Bool("json", false, "Print a JSON array instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	return ps(ctx, &cldpd.DockerRunner{}, os.Stdout, *all, *jsonOut)
+}
+
+// psEntry is the JSON form of one row of cldpd ps.
+type psEntry struct {
+	Container string `json:"container"`
+	Pod       string `json:"pod"`
+	Image     string `json:"image"`
+	Status    string `json:"status"`
+	Running   bool   `json:"running"`
+}
+
+// ps lists cldpd containers to w as an aligned table, or as a JSON array when
+// jsonOut is set. An empty listing prints "no pods running" (or [] as JSON) and
+// is not an error.
+func ps(ctx context.Context, runner cldpd.Runner, w io.Writer, all, jsonOut bool) int {
+	list, err := runner.List(ctx, all)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	if jsonOut {
+		entries := make([]psEntry, 0, len(list))
+		for _, c := range list {
+			entries = append(entries, psEntry{
+				Container: c.Name,
+				Pod:       c.Pod,
+				Image:     c.Image,
+				Status:    c.Status,
+				Running:   c.Running,
+			})
+		}
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd: encode: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(list) == 0 {
+		fmt.Fprintln(w, "no pods running")
+		return 0
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tPOD\tIMAGE\tSTATUS")
+	for _, c := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.Pod, c.Image, c.Status)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := fs.Bool("json", false, "Print a JSON array of the resolved pods instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	return list(cldpd.NewDispatcher(podsDir, &cldpd.DockerRunner{}), os.Stdout, *jsonOut)
+}
+
+// listEntry is the JSON form of one pod in cldpd list: the pod as Start
+// resolves it, plus its effective image tag and whether it has a template.
+type listEntry struct {
+	cldpd.Pod
+	Image       string `json:"image"`
+	HasTemplate bool   `json:"hasTemplate"`
+}
+
+// list prints the pods defined in d's pods directory to w as an aligned table,
+// or as a JSON array of listEntry when jsonOut is set. No pods prints
+// "no pods defined" (or [] as JSON) and is not an error.
+func list(d *cldpd.Dispatcher, w io.Writer, jsonOut bool) int {
+	pods, err := d.Pods()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	if jsonOut {
+		entries := make([]listEntry, 0, len(pods))
+		for _, p := range pods {
+			entries = append(entries, listEntry{Pod: p, Image: p.ImageTag(), HasTemplate: p.Template != ""})
+		}
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd: encode: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(pods) == 0 {
+		fmt.Fprintln(w, "no pods defined")
+		return 0
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tIMAGE\tTEMPLATE\tDIR")
+	for _, p := range pods {
+		template := "no"
+		if p.Template != "" {
+			template = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name, p.ImageTag(), template, p.Dir)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runClean(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	pods := fs.Bool("pods", false, "Remove exited pod containers")
+	images := fs.Bool("images", false, "Remove images of pods no longer in the pods directory")
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing it")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	runner := &cldpd.DockerRunner{}
+	if err := runner.Preflight(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	opts := cldpd.CleanupOptions{Containers: *pods, Images: *images, DryRun: *dryRun}
+	return clean(ctx, cldpd.NewDispatcher(podsDir, runner), os.Stdout, opts)
+}
+
+// clean removes orphaned containers and images selected by opts, printing one
+// line per container or image to w, prefixed "would remove" on a dry run.
+// Nothing to remove prints "nothing to clean". Returns 1 if any removal failed.
+func clean(ctx context.Context, d *cldpd.Dispatcher, w io.Writer, opts cldpd.CleanupOptions) int {
+	report, err := d.Cleanup(ctx, opts)
+	verb := "removed"
+	if opts.DryRun {
+		verb = "would remove"
+	}
+	for _, c := range report.Containers {
+		fmt.Fprintf(w, "%s container %s\n", verb, c)
+	}
+	for _, tag := range report.Images {
+		fmt.Fprintf(w, "%s image %s\n", verb, tag)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	if len(report.Containers) == 0 && len(report.Images) == 0 {
+		fmt.Fprintln(w, "nothing to clean")
+	}
+	return 0
+}
+
+// defaultKeepImages is how many builds per pod cldpd image prune keeps by default.
+const defaultKeepImages = 3
+
+func runImage(ctx context.Context, args []string) int {
+	if len(args) < 1 || args[0] != "prune" {
+		fmt.Fprintln(os.Stderr, "cldpd image: subcommand required: prune")
+		return 1
+	}
+	fs := flag.NewFlagSet("image prune", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	keep := fs.Int("keep", defaultKeepImages, "Number of most recent builds to keep per pod")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+	if *keep < 0 {
+		fmt.Fprintln(os.Stderr, "cldpd image prune: --keep must not be negative")
+		return 1
+	}
+
+	runner := &cldpd.DockerRunner{}
+	if err := runner.Preflight(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+
+	podsDir, err := cldpd.DefaultPodsDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	return pruneImages(ctx, cldpd.NewDispatcher(podsDir, runner), os.Stdout, *keep)
+}
+
+// pruneImages removes all but the keep most recent builds of each pod's image,
+// printing one line per removed tag to w. Nothing to remove prints "nothing to
+// prune". Returns 1 if any removal failed.
+func pruneImages(ctx context.Context, d *cldpd.Dispatcher, w io.Writer, keep int) int {
+	removed, err := d.PruneImages(ctx, keep)
+	for _, tag := range removed {
+		fmt.Fprintf(w, "removed image %s\n", tag)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		return 1
+	}
+	if len(removed) == 0 {
+		fmt.Fprintln(w, "nothing to prune")
+	}
+	return 0
+}
+
+func runDoctor(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	return doctor(ctx, &cldpd.DockerRunner{}, os.Stdout)
+}
+
+// doctor checks Docker availability and free disk space, printing one line per
+// check to w. Returns 1 if any check fails.
+func doctor(ctx context.Context, runner cldpd.Runner, w io.Writer) int {
+	code := 0
+	if err := runner.Preflight(ctx); err != nil {
+		fmt.Fprintf(w, "docker: FAIL: %v\n", err)
+		code = 1
+	} else {
+		fmt.Fprintln(w, "docker: ok")
+	}
+
+	report, err := cldpd.CheckDisk(ctx, runner, "", cldpd.DefaultDiskThresholds)
+	for _, s := range report.Spaces {
+		fmt.Fprintf(w, "disk: %s: %.1f GiB available\n", s.Path, float64(s.Available)/(1<<30))
+	}
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(w, "disk: WARN: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "disk: FAIL: %v\n", err)
+		code = 1
+	}
+	return code
+}
+
+// Values of the --output flag accepted by start and resume.
+const (
+	outputText = "text" // container output to stdout, errors and warnings to stderr
+	outputJSON = "json" // every event as one JSON object per line on stdout
+)
+
+// validOutput reports whether output is a supported --output value.
+func validOutput(output string) bool {
+	return output == outputText || output == outputJSON
+}
+
+// maxPromptFileBytes bounds a prompt read by --prompt-file or --task-file. It
+// is passed to the container as a single argument.
+const maxPromptFileBytes = 256 << 10
+
+// countSet returns how many of values are non-empty, for mutually exclusive flags.
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// readPromptFile returns the prompt in the file at path, or read from stdin
+// until EOF if path is "-", without a single trailing newline, so a file
+// written by an editor sends what was typed. It fails if the prompt is over
+// maxPromptFileBytes or blank.
+func readPromptFile(path string, stdin io.Reader) (string, error) {
+	r := stdin
+	if path != "-" {
+		//nolint:gosec // path is the user's own file, named on the command line
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxPromptFileBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxPromptFileBytes {
+		return "", fmt.Errorf("prompt is over %d KiB", maxPromptFileBytes>>10)
+	}
+	prompt := strings.TrimSuffix(string(data), "\n")
+	prompt = strings.TrimSuffix(prompt, "\r")
+	if strings.TrimSpace(prompt) == "" {
+		return "", cldpd.ErrEmptyPrompt
+	}
+	return prompt, nil
 }
 
-// consumeSession ranges over session events, printing output to stdout and
-// errors to stderr. On interrupt (ctx cancellation), it calls session.Stop
-// for graceful shutdown. Returns the container's exit code.
-func consumeSession(ctx context.Context, session *cldpd.Session) int {
+// Exit codes for sessions that end with an error rather than a container exit
+// code. Container exit codes are passed through unchanged, so these sit just
+// below the 125-127 docker itself reserves, where container commands rarely
+// exit, rather than among the small codes they commonly use.
+const (
+	exitSessionFailed = 1   // any other session error
+	exitNoContainer   = 123 // resume or shell found no running container
+	exitBuildFailed   = 124 // the image build failed
+	exitInterrupted   = 130 // interrupted before the container started
+)
+
+// sessionExitCode maps an error returned by Session.Wait to an exit code.
+func sessionExitCode(err error) int {
+	switch {
+	case errors.Is(err, cldpd.ErrBuildFailed):
+		return exitBuildFailed
+	case errors.Is(err, cldpd.ErrSessionNotFound):
+		return exitNoContainer
+	case errors.Is(err, cldpd.ErrStoppedBeforeStart):
+		return exitInterrupted
+	}
+	return exitSessionFailed
+}
+
+// consumeSession ranges over session events, printing them in the given output
+// format, with timestamps if set (text only; JSON events always carry their
+// time). On interrupt (ctx cancellation), it calls session.Stop for graceful
+// shutdown and reports the container's exit code on stderr once it has
+// stopped. Returns the container's exit code, or, if the session ended with an
+// error, the code sessionExitCode maps it to, after saying so on stderr.
+func consumeSession(ctx context.Context, session *cldpd.Session, output string, timestamps bool) int {
 	// Handle interrupt: stop the session gracefully.
 	go func() {
 		<-ctx.Done()
-		_ = session.Stop(context.Background())
+		if err := session.Stop(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+		}
 	}()
 
+	enc := json.NewEncoder(os.Stdout)
 	for event := range session.Events() {
-		switch event.Type {
-		case cldpd.EventOutput:
-			fmt.Println(event.Data)
-		case cldpd.EventError:
-			fmt.Fprintf(os.Stderr, "cldpd: %s\n", event.Data)
+		writeEvent(enc, event, output, timestamps)
+	}
+	return sessionExit(ctx, session)
+}
+
+// detachSession prints session events as consumeSession does until the
+// container has started, then prints its name and the session ID on stdout
+// and returns 0 without waiting, leaving the container running. In JSON
+// output they are printed as {"container":...,"session":...}. If the session
+// ends before the container starts, detachSession returns as consumeSession
+// would. An interrupt before the container starts stops the session.
+func detachSession(ctx context.Context, session *cldpd.Session, output string, timestamps bool) int {
+	detached := make(chan struct{})
+	defer close(detached)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := session.Stop(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "cldpd: %v\n", err)
+			}
+		case <-detached:
 		}
+	}()
+
+	enc := json.NewEncoder(os.Stdout)
+	for event := range session.Events() {
+		writeEvent(enc, event, output, timestamps)
+		if event.Type != cldpd.EventContainerStarted {
+			continue
+		}
+		if output == outputJSON {
+			detach := struct {
+				Container string `json:"container"`
+				Session   string `json:"session"`
+			}{event.Data, session.ID()}
+			if err := enc.Encode(detach); err != nil {
+				fmt.Fprintf(os.Stderr, "cldpd: encode event: %v\n", err)
+			}
+		} else {
+			fmt.Println(event.Data, session.ID())
+		}
+		return 0
 	}
+	return sessionExit(ctx, session)
+}
 
-	code, _ := session.Wait()
+// writeEvent writes event to enc in JSON output, and prints it with
+// printEvent otherwise.
+func writeEvent(enc *json.Encoder, event cldpd.Event, output string, timestamps bool) {
+	if output == outputJSON {
+		if err := enc.Encode(event); err != nil {
+			fmt.Fprintf(os.Stderr, "cldpd: encode event: %v\n", err)
+		}
+		return
+	}
+	printEvent(event, timestamps)
+}
+
+// sessionExit waits for session to end and returns the exit code consumeSession
+// reports, saying on stderr how it ended if it failed or was interrupted.
+func sessionExit(ctx context.Context, session *cldpd.Session) int {
+	code, err := session.Wait()
+	if err != nil {
+		code = sessionExitCode(err)
+		if code == exitInterrupted {
+			fmt.Fprintf(os.Stderr, "cldpd: stopped before the container started (exit code %d)\n", code)
+		} else {
+			fmt.Fprintf(os.Stderr, "cldpd: session failed (exit code %d)\n", code)
+		}
+		return code
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "cldpd: stopped (exit code %d)\n", code)
+	}
 	return code
 }
 
+// printEvent prints an event in text form: container output to stdout, errors
+// and warnings to stderr. Lifecycle events are printed to stderr only with
+// timestamps, which prefix every line with the event time in RFC 3339 form.
+// Build output is not printed.
+func printEvent(event cldpd.Event, timestamps bool) {
+	prefix := ""
+	if timestamps {
+		prefix = event.Time.Format(time.RFC3339) + " "
+	}
+	switch event.Type {
+	case cldpd.EventOutput:
+		fmt.Println(prefix + event.Data)
+	case cldpd.EventMessage:
+		if event.Message.Text != "" {
+			fmt.Println(prefix + event.Message.Text)
+		}
+	case cldpd.EventError:
+		fmt.Fprintf(os.Stderr, "%scldpd: %s\n", prefix, event.Data)
+	case cldpd.EventWarning:
+		fmt.Fprintf(os.Stderr, "%scldpd: warning: %s\n", prefix, event.Data)
+	case cldpd.EventBuildOutput:
+	default:
+		if timestamps {
+			fmt.Fprintf(os.Stderr, "%scldpd: %s\n", prefix, lifecycleText(event))
+		}
+	}
+}
+
+// lifecycleText describes a lifecycle event for text output, e.g.
+// "container_started cldpd-myrepo" or "container_exited (code 0)".
+func lifecycleText(event cldpd.Event) string {
+	switch event.Type {
+	case cldpd.EventContainerExited, cldpd.EventContainerKilled:
+		return fmt.Sprintf("%s (code %d)", event.Type, event.Code)
+	case cldpd.EventRestart:
+		return fmt.Sprintf("%s %s (code %d)", event.Type, event.Data, event.Code)
+	}
+	if event.Data == "" {
+		return event.Type.String()
+	}
+	return event.Type.String() + " " + event.Data
+}
+
+// versionString returns the version line printed by cldpd version, e.g.
+// "cldpd v1.2.3 (go1.24.1 linux/amd64)".
+func versionString() string {
+	v := version
+	if v == "" {
+		v = "dev"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+	}
+	return fmt.Sprintf("cldpd %s (%s %s/%s)", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
 func printUsage() {
 	fmt.Fprintln(os.Stderr, "Usage:")
-	fmt.Fprintln(os.Stderr, "  cldpd start <pod> --issue <url>")
-	fmt.Fprintln(os.Stderr, "  cldpd resume <pod> --prompt <text>")
+	fmt.Fprintln(os.Stderr, "  cldpd start <pod> --issue <url>|--task <text>|--task-file <path> [--output text|json] [--timestamps] [--no-cache] [--pull] [--keep-container] [--detach] [--force] [--strip-ansi] [--fetch-issue]")
+	fmt.Fprintln(os.Stderr, "  cldpd resume <pod> --prompt <text>|--prompt-file <path> [--output text|json] [--timestamps]")
+	fmt.Fprintln(os.Stderr, "  cldpd shell <pod> [cmd...]")
+	fmt.Fprintln(os.Stderr, "  cldpd build <pod> [--no-cache] [--pull]")
+	fmt.Fprintln(os.Stderr, "  cldpd init <pod> [--from <pod>] [--force]")
+	fmt.Fprintln(os.Stderr, "  cldpd ps [--all] [--json]")
+	fmt.Fprintln(os.Stderr, "  cldpd list [--json]")
+	fmt.Fprintln(os.Stderr, "  cldpd clean [--pods] [--images] [--dry-run]")
+	fmt.Fprintln(os.Stderr, "  cldpd image prune [--keep <n>]")
+	fmt.Fprintln(os.Stderr, "  cldpd doctor")
+	fmt.Fprintln(os.Stderr, "  cldpd version")
 }
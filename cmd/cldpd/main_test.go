@@ -5,11 +5,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -20,10 +24,25 @@ import (
 // testRunner implements cldpd.Runner for use in CLI tests.
 type testRunner struct {
 	preflightFn func(ctx context.Context) error
-	buildFn     func(ctx context.Context, tag string, dir string, buildArgs map[string]string) error
+	buildFn     func(ctx context.Context, tag string, dir string, opts cldpd.BuildOptions) error
+	pullFn      func(ctx context.Context, image string, stdout io.Writer) error
 	runFn       func(ctx context.Context, opts cldpd.RunOptions, stdout io.Writer) (int, error)
 	execFn      func(ctx context.Context, container string, cmd []string, stdout io.Writer) (int, error)
-	stopFn      func(ctx context.Context, container string, timeout time.Duration) error
+	attachFn    func(ctx context.Context, container string, stdout io.Writer) (int, error)
+	shellFn     func(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+	detachedFn  func(ctx context.Context, opts cldpd.RunOptions) (string, error)
+	waitFn      func(ctx context.Context, container string) (int, error)
+	stopFn      func(ctx context.Context, container string, timeout time.Duration, signal string) error
+	killFn      func(ctx context.Context, container string) error
+	removeFn    func(ctx context.Context, container string, force bool) error
+	healthFn    func(ctx context.Context, container string) (string, error)
+	inspectFn   func(ctx context.Context, container string) (cldpd.ContainerState, error)
+	listFn      func(ctx context.Context, all bool) ([]cldpd.ContainerSummary, error)
+	dataRootFn  func(ctx context.Context) (string, error)
+	runtimesFn  func(ctx context.Context) ([]string, error)
+	imageFn     func(ctx context.Context, tag string) (time.Time, error)
+	rmImageFn   func(ctx context.Context, tag string) error
+	imagesFn    func(ctx context.Context) ([]string, error)
 }
 
 func (r *testRunner) Preflight(ctx context.Context) error {
@@ -33,9 +52,16 @@ func (r *testRunner) Preflight(ctx context.Context) error {
 	return nil
 }
 
-func (r *testRunner) Build(ctx context.Context, tag string, dir string, buildArgs map[string]string) error {
+func (r *testRunner) Build(ctx context.Context, tag string, dir string, opts cldpd.BuildOptions) error {
 	if r.buildFn != nil {
-		return r.buildFn(ctx, tag, dir, buildArgs)
+		return r.buildFn(ctx, tag, dir, opts)
+	}
+	return nil
+}
+
+func (r *testRunner) Pull(ctx context.Context, image string, stdout io.Writer) error {
+	if r.pullFn != nil {
+		return r.pullFn(ctx, image, stdout)
 	}
 	return nil
 }
@@ -54,13 +80,111 @@ func (r *testRunner) Exec(ctx context.Context, container string, cmd []string, s
 	return 0, nil
 }
 
-func (r *testRunner) Stop(ctx context.Context, container string, timeout time.Duration) error {
+func (r *testRunner) ExecInteractive(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if r.shellFn != nil {
+		return r.shellFn(ctx, container, cmd, stdin, stdout, stderr)
+	}
+	return 0, nil
+}
+
+func (r *testRunner) Attach(ctx context.Context, container string, stdout io.Writer) (int, error) {
+	if r.attachFn != nil {
+		return r.attachFn(ctx, container, stdout)
+	}
+	return 0, nil
+}
+
+func (r *testRunner) RunDetached(ctx context.Context, opts cldpd.RunOptions) (string, error) {
+	if r.detachedFn != nil {
+		return r.detachedFn(ctx, opts)
+	}
+	return "0123456789ab", nil
+}
+
+func (r *testRunner) WaitContainer(ctx context.Context, container string) (int, error) {
+	if r.waitFn != nil {
+		return r.waitFn(ctx, container)
+	}
+	return 0, nil
+}
+
+func (r *testRunner) Stop(ctx context.Context, container string, timeout time.Duration, signal string) error {
 	if r.stopFn != nil {
-		return r.stopFn(ctx, container, timeout)
+		return r.stopFn(ctx, container, timeout, signal)
+	}
+	return nil
+}
+
+func (r *testRunner) Kill(ctx context.Context, container string) error {
+	if r.killFn != nil {
+		return r.killFn(ctx, container)
+	}
+	return nil
+}
+
+func (r *testRunner) Remove(ctx context.Context, container string, force bool) error {
+	if r.removeFn != nil {
+		return r.removeFn(ctx, container, force)
+	}
+	return nil
+}
+
+func (r *testRunner) Health(ctx context.Context, container string) (string, error) {
+	if r.healthFn != nil {
+		return r.healthFn(ctx, container)
+	}
+	return "", nil
+}
+
+func (r *testRunner) Inspect(ctx context.Context, container string) (cldpd.ContainerState, error) {
+	if r.inspectFn != nil {
+		return r.inspectFn(ctx, container)
+	}
+	return cldpd.ContainerState{}, nil
+}
+
+func (r *testRunner) List(ctx context.Context, all bool) ([]cldpd.ContainerSummary, error) {
+	if r.listFn != nil {
+		return r.listFn(ctx, all)
+	}
+	return nil, nil
+}
+
+func (r *testRunner) DataRoot(ctx context.Context) (string, error) {
+	if r.dataRootFn != nil {
+		return r.dataRootFn(ctx)
+	}
+	return "", nil
+}
+
+func (r *testRunner) Runtimes(ctx context.Context) ([]string, error) {
+	if r.runtimesFn != nil {
+		return r.runtimesFn(ctx)
+	}
+	return nil, nil
+}
+
+func (r *testRunner) ImageCreated(ctx context.Context, tag string) (time.Time, error) {
+	if r.imageFn != nil {
+		return r.imageFn(ctx, tag)
+	}
+	return time.Time{}, nil
+}
+
+func (r *testRunner) RemoveImage(ctx context.Context, tag string) error {
+	if r.rmImageFn != nil {
+		return r.rmImageFn(ctx, tag)
 	}
 	return nil
 }
 
+func (r *testRunner) Images(ctx context.Context) ([]string, error) {
+	if r.imagesFn != nil {
+		return r.imagesFn(ctx)
+	}
+	return nil, nil
+}
+
 // makeSessionPod creates a minimal valid pod directory and returns a Dispatcher backed by runner.
 func makeSessionPod(t *testing.T, runner cldpd.Runner) (*cldpd.Dispatcher, string) {
 	t.Helper()
@@ -129,6 +253,31 @@ func TestCLI_UnknownSubcommand(t *testing.T) {
 	}
 }
 
+func TestCLI_Version(t *testing.T) {
+	bin := buildCLI(t)
+	for _, arg := range []string{"version", "--version"} {
+		stdout, _, code := runCLI(t, bin, arg)
+		if code != 0 {
+			t.Errorf("%s: exit code: got %d, want 0", arg, code)
+		}
+		line := strings.TrimSpace(stdout)
+		if !strings.HasPrefix(line, "cldpd ") || strings.Contains(line, "\n") {
+			t.Errorf("%s: got %q, want a single cldpd version line", arg, stdout)
+		}
+	}
+}
+
+func TestVersionString_Ldflags(t *testing.T) {
+	old := version
+	version = "v1.2.3"
+	defer func() { version = old }()
+
+	want := "cldpd v1.2.3 (" + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH + ")"
+	if got := versionString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestCLI_Start_MissingPodName(t *testing.T) {
 	bin := buildCLI(t)
 	_, stderr, code := runCLI(t, bin, "start", "--issue", "https://github.com/org/repo/issues/1")
@@ -146,8 +295,19 @@ func TestCLI_Start_MissingIssueFlag(t *testing.T) {
 	if code != 1 {
 		t.Errorf("exit code: got %d, want 1", code)
 	}
-	if !strings.Contains(stderr, "--issue is required") {
-		t.Errorf("stderr should mention --issue required, got: %q", stderr)
+	if !strings.Contains(stderr, "--issue, --task, or --task-file is required") {
+		t.Errorf("stderr should mention --issue, --task, or --task-file required, got: %q", stderr)
+	}
+}
+
+func TestCLI_Start_IssueAndTask(t *testing.T) {
+	bin := buildCLI(t)
+	_, stderr, code := runCLI(t, bin, "start", "--issue", "https://github.com/org/repo/issues/1", "--task", "update dependencies", "myrepo")
+	if code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if !strings.Contains(stderr, "--issue, --task, and --task-file are mutually exclusive") {
+		t.Errorf("stderr should say the flags are mutually exclusive, got: %q", stderr)
 	}
 }
 
@@ -168,8 +328,111 @@ func TestCLI_Resume_MissingPromptFlag(t *testing.T) {
 	if code != 1 {
 		t.Errorf("exit code: got %d, want 1", code)
 	}
-	if !strings.Contains(stderr, "--prompt is required") {
-		t.Errorf("stderr should mention --prompt required, got: %q", stderr)
+	if !strings.Contains(stderr, "--prompt or --prompt-file is required") {
+		t.Errorf("stderr should mention --prompt or --prompt-file required, got: %q", stderr)
+	}
+}
+
+func TestCLI_Resume_PromptAndPromptFile(t *testing.T) {
+	bin := buildCLI(t)
+	_, stderr, code := runCLI(t, bin, "resume", "--prompt", "do more", "--prompt-file", "-", "myrepo")
+	if code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if !strings.Contains(stderr, "--prompt and --prompt-file are mutually exclusive") {
+		t.Errorf("stderr should say the flags are mutually exclusive, got: %q", stderr)
+	}
+}
+
+// runCLIStdin runs the CLI binary as runCLI does, with stdin as its input.
+func runCLIStdin(t *testing.T, bin, stdin string, args ...string) (stderr string, code int) {
+	t.Helper()
+	var errBuf bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("run CLI: %v", err)
+		}
+		code = exitErr.ExitCode()
+	}
+	return errBuf.String(), code
+}
+
+func TestCLI_PromptFile_Stdin(t *testing.T) {
+	bin := buildCLI(t)
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		wantErr string
+	}{
+		{"resume oversized", []string{"resume", "--prompt-file", "-", "myrepo"}, strings.Repeat("x", maxPromptFileBytes+1), "--prompt-file: prompt is over 256 KiB"},
+		{"resume empty", []string{"resume", "--prompt-file", "-", "myrepo"}, "\n", "--prompt-file: prompt is empty"},
+		{"start oversized", []string{"start", "--task-file", "-", "myrepo"}, strings.Repeat("x", maxPromptFileBytes+1), "--task-file: prompt is over 256 KiB"},
+		{"start with issue", []string{"start", "--issue", "org/repo#1", "--task-file", "-", "myrepo"}, "task", "mutually exclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := runCLIStdin(t, bin, tt.stdin, tt.args...)
+			if code != 1 {
+				t.Errorf("exit code: got %d, want 1", code)
+			}
+			if !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("stderr: got %q, want it to mention %q", stderr, tt.wantErr)
+			}
+		})
+	}
+
+	// A prompt within the limit is accepted; resume then fails only because
+	// no container is running.
+	stderr, _ := runCLIStdin(t, bin, "Line one.\n\n```go\nfmt.Println(\"hi\")\n```\n", "resume", "--prompt-file", "-", "cldpd-test-no-such-pod")
+	if strings.Contains(stderr, "--prompt-file") {
+		t.Errorf("stderr: got %q, want the prompt accepted", stderr)
+	}
+}
+
+func TestReadPromptFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		path    string
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{"file", write("plain", "Fix the tests.\n\nThen push."), "", "Fix the tests.\n\nThen push.", ""},
+		{"single trailing newline stripped", write("newline", "Fix it.\n\n"), "", "Fix it.\n", ""},
+		{"crlf", write("crlf", "Fix it.\r\n"), "", "Fix it.", ""},
+		{"stdin", "-", "From stdin.\n", "From stdin.", ""},
+		{"at the limit", "-", strings.Repeat("x", maxPromptFileBytes), strings.Repeat("x", maxPromptFileBytes), ""},
+		{"over the limit", "-", strings.Repeat("x", maxPromptFileBytes+1), "", "over 256 KiB"},
+		{"blank", write("blank", " \n"), "", "", "empty"},
+		{"missing", filepath.Join(dir, "missing"), "", "", "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPromptFile(tt.path, strings.NewReader(tt.stdin))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readPromptFile: got %q, %v; want an error mentioning %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readPromptFile: got %q, %v; want %q", got, err, tt.want)
+			}
+		})
 	}
 }
 
@@ -181,6 +444,9 @@ func TestRunStart_MissingArgs(t *testing.T) {
 	}{
 		{"no args", []string{}},
 		{"no issue flag", []string{"myrepo"}},
+		{"blank task", []string{"--task", "  ", "myrepo"}},
+		{"issue and task", []string{"--issue", "https://github.com/org/repo/issues/1", "--task", "update dependencies", "myrepo"}},
+		{"bad output", []string{"--issue", "https://github.com/org/repo/issues/1", "--output", "yaml", "myrepo"}},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -205,6 +471,8 @@ func TestRunResume_MissingArgs(t *testing.T) {
 	}{
 		{"no args", []string{}},
 		{"no prompt flag", []string{"myrepo"}},
+		{"blank prompt", []string{"--prompt", "   ", "myrepo"}},
+		{"bad output", []string{"--prompt", "more", "--output", "yaml", "myrepo"}},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -326,7 +594,7 @@ func TestConsumeSession_OutputToStdout(t *testing.T) {
 	oldStdout := os.Stdout
 	os.Stdout = pw
 
-	code := consumeSession(context.Background(), session)
+	code := consumeSession(context.Background(), session, outputText, false)
 
 	pw.Close()
 	os.Stdout = oldStdout
@@ -365,7 +633,7 @@ func TestConsumeSession_ErrorToStderr(t *testing.T) {
 	oldStderr := os.Stderr
 	os.Stderr = pw
 
-	consumeSession(context.Background(), session)
+	consumeSession(context.Background(), session, outputText, false)
 
 	pw.Close()
 	os.Stderr = oldStderr
@@ -397,12 +665,309 @@ func TestConsumeSession_ReturnsExitCode(t *testing.T) {
 	os.Stderr, _ = os.Open(os.DevNull)
 	defer func() { os.Stderr = oldStderr }()
 
-	code := consumeSession(context.Background(), session)
+	code := consumeSession(context.Background(), session, outputText, false)
 	if code != 5 {
 		t.Errorf("exit code: got %d, want 5", code)
 	}
 }
 
+func TestSessionExitCodes_Stable(t *testing.T) {
+	// These values are documented in the README; scripts depend on them.
+	codes := map[string]int{
+		"session failed": exitSessionFailed,
+		"no container":   exitNoContainer,
+		"build failed":   exitBuildFailed,
+		"interrupted":    exitInterrupted,
+	}
+	want := map[string]int{
+		"session failed": 1,
+		"no container":   123,
+		"build failed":   124,
+		"interrupted":    130,
+	}
+	for name, code := range codes {
+		if code != want[name] {
+			t.Errorf("%s: got %d, want %d", name, code, want[name])
+		}
+	}
+}
+
+func TestConsumeSession_SessionErrorExitCode(t *testing.T) {
+	cases := []struct {
+		name  string
+		start func(d *cldpd.Dispatcher, pod string) (*cldpd.Session, error)
+		r     *testRunner
+		want  int
+	}{
+		{
+			name: "run error",
+			r: &testRunner{
+				runFn: func(_ context.Context, _ cldpd.RunOptions, _ io.Writer) (int, error) {
+					return -1, errors.New("container process error")
+				},
+			},
+			want: exitSessionFailed,
+		},
+		{
+			name: "build failed",
+			r: &testRunner{
+				buildFn: func(_ context.Context, _ string, _ string, _ cldpd.BuildOptions) error {
+					return fmt.Errorf("%w: exit code 1", cldpd.ErrBuildFailed)
+				},
+			},
+			want: exitBuildFailed,
+		},
+		{
+			name: "resume without container",
+			start: func(d *cldpd.Dispatcher, pod string) (*cldpd.Session, error) {
+				return d.Resume(context.Background(), pod, "do more")
+			},
+			r: &testRunner{
+				execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+					return -1, fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+				},
+			},
+			want: exitNoContainer,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, pod := makeSessionPod(t, tc.r)
+			start := tc.start
+			if start == nil {
+				start = func(d *cldpd.Dispatcher, pod string) (*cldpd.Session, error) {
+					return d.Start(context.Background(), pod, "https://github.com/org/repo/issues/1")
+				}
+			}
+			session, err := start(d, pod)
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+
+			pr, pw, _ := os.Pipe()
+			oldStderr := os.Stderr
+			os.Stderr = pw
+
+			code := consumeSession(context.Background(), session, outputJSON, false)
+
+			pw.Close()
+			os.Stderr = oldStderr
+
+			var buf bytes.Buffer
+			io.Copy(&buf, pr) //nolint:errcheck
+			pr.Close()
+
+			if code != tc.want {
+				t.Errorf("exit code: got %d, want %d", code, tc.want)
+			}
+			if want := fmt.Sprintf("session failed (exit code %d)", tc.want); !strings.Contains(buf.String(), want) {
+				t.Errorf("stderr: got %q, want it to contain %q", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestDetachSession_ExitsOnceStarted(t *testing.T) {
+	released := make(chan struct{})
+	defer close(released)
+	r := &testRunner{
+		runFn: func(context.Context, cldpd.RunOptions, io.Writer) (int, error) {
+			t.Error("blocking Run called for a detached start")
+			return 0, nil
+		},
+		// The container outlives the CLI; the attach never ends during the test.
+		attachFn: func(context.Context, string, io.Writer) (int, error) {
+			<-released
+			return 0, nil
+		},
+	}
+	d, pod := makeSessionPod(t, r)
+	session, err := d.StartWith(context.Background(), pod, "https://github.com/org/repo/issues/1", cldpd.StartOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("StartWith: %v", err)
+	}
+
+	pr, pw, _ := os.Pipe()
+	oldStdout := os.Stdout
+	os.Stdout = pw
+
+	done := make(chan int, 1)
+	go func() { done <- detachSession(context.Background(), session, outputText, false) }()
+	var code int
+	select {
+	case code = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("detachSession did not return once the container started")
+	}
+
+	pw.Close()
+	os.Stdout = oldStdout
+
+	var buf bytes.Buffer
+	io.Copy(&buf, pr) //nolint:errcheck
+	pr.Close()
+
+	if code != 0 {
+		t.Errorf("exit code: got %d, want 0", code)
+	}
+	if want := "cldpd-" + pod + " " + session.ID() + "\n"; buf.String() != want {
+		t.Errorf("stdout: got %q, want %q", buf.String(), want)
+	}
+	if _, ended := session.Result(); ended {
+		t.Error("session ended; the container must keep running")
+	}
+}
+
+func TestDetachSession_BuildFailed(t *testing.T) {
+	r := &testRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ cldpd.BuildOptions) error {
+			return fmt.Errorf("%w: exit code 1", cldpd.ErrBuildFailed)
+		},
+	}
+	d, pod := makeSessionPod(t, r)
+	session, err := d.StartWith(context.Background(), pod, "https://github.com/org/repo/issues/1", cldpd.StartOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("StartWith: %v", err)
+	}
+
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = oldStderr }()
+
+	if code := detachSession(context.Background(), session, outputText, false); code != exitBuildFailed {
+		t.Errorf("exit code: got %d, want %d", code, exitBuildFailed)
+	}
+}
+
+func TestConsumeSession_Timestamps(t *testing.T) {
+	r := &testRunner{
+		runFn: func(_ context.Context, _ cldpd.RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, "output line")
+			return 0, nil
+		},
+	}
+	d, pod := makeSessionPod(t, r)
+	session, err := d.Start(context.Background(), pod, "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	outR, outW, _ := os.Pipe()
+	errR, errW, _ := os.Pipe()
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outW, errW
+
+	code := consumeSession(context.Background(), session, outputText, true)
+
+	outW.Close()
+	errW.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+
+	var stdout, stderr bytes.Buffer
+	io.Copy(&stdout, outR) //nolint:errcheck
+	io.Copy(&stderr, errR) //nolint:errcheck
+	outR.Close()
+	errR.Close()
+
+	if code != 0 {
+		t.Errorf("exit code: got %d, want 0", code)
+	}
+	const stamp = `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2}) `
+	if !regexp.MustCompile(`^` + stamp + `output line\n$`).MatchString(stdout.String()) {
+		t.Errorf("stdout: got %q, want RFC 3339 timestamp then output line", stdout.String())
+	}
+	for _, want := range []string{"cldpd: build_started ", "cldpd: container_started cldpd-" + pod, "cldpd: container_exited (code 0)"} {
+		if !regexp.MustCompile(`(?m)^` + stamp + regexp.QuoteMeta(want)).MatchString(stderr.String()) {
+			t.Errorf("stderr missing timestamped %q: %q", want, stderr.String())
+		}
+	}
+}
+
+func TestLifecycleText(t *testing.T) {
+	cases := []struct {
+		event cldpd.Event
+		want  string
+	}{
+		{cldpd.Event{Type: cldpd.EventContainerStarted, Data: "cldpd-api"}, "container_started cldpd-api"},
+		{cldpd.Event{Type: cldpd.EventContainerExited, Code: 3}, "container_exited (code 3)"},
+		{cldpd.Event{Type: cldpd.EventHealthChanged, Data: "healthy"}, "health_changed healthy"},
+		{cldpd.Event{Type: cldpd.EventRestart, Data: "cldpd-api", Code: 1}, "restart cldpd-api (code 1)"},
+	}
+	for _, tc := range cases {
+		if got := lifecycleText(tc.event); got != tc.want {
+			t.Errorf("lifecycleText(%v): got %q, want %q", tc.event.Type, got, tc.want)
+		}
+	}
+}
+
+func TestConsumeSession_JSONOutput(t *testing.T) {
+	r := &testRunner{
+		runFn: func(_ context.Context, _ cldpd.RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, `line with "quotes"`)
+			return 3, nil
+		},
+	}
+	d, pod := makeSessionPod(t, r)
+	session, err := d.Start(context.Background(), pod, "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	pr, pw, _ := os.Pipe()
+	oldStdout := os.Stdout
+	os.Stdout = pw
+
+	code := consumeSession(context.Background(), session, outputJSON, false)
+
+	pw.Close()
+	os.Stdout = oldStdout
+
+	var buf bytes.Buffer
+	io.Copy(&buf, pr) //nolint:errcheck
+	pr.Close()
+
+	if code != 3 {
+		t.Errorf("exit code: got %d, want 3", code)
+	}
+
+	type line struct {
+		Code *int   `json:"code"`
+		Type string `json:"type"`
+		Data string `json:"data"`
+		Time string `json:"time"`
+	}
+	var got []line
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var l line
+		if err := json.Unmarshal([]byte(raw), &l); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", raw, err)
+		}
+		if l.Time == "" {
+			t.Errorf("line %q has no time", raw)
+		}
+		got = append(got, l)
+	}
+
+	want := []string{"build_started", "build_complete", "container_started", "output", "container_exited"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines %+v, want types %v", len(got), got, want)
+	}
+	for i, typ := range want {
+		if got[i].Type != typ {
+			t.Errorf("line %d: got type %q, want %q", i, got[i].Type, typ)
+		}
+	}
+	if got[3].Data != `line with "quotes"` {
+		t.Errorf("output data: got %q", got[3].Data)
+	}
+	if got[4].Code == nil || *got[4].Code != 3 {
+		t.Errorf("container_exited code: got %v, want 3", got[4].Code)
+	}
+	if got[3].Code != nil {
+		t.Errorf("output line carries a code: %v", *got[3].Code)
+	}
+}
+
 func TestConsumeSession_InterruptCallsStop(t *testing.T) {
 	stopCalled := make(chan struct{})
 	unblock := make(chan struct{})
@@ -412,7 +977,7 @@ func TestConsumeSession_InterruptCallsStop(t *testing.T) {
 			<-unblock
 			return 0, nil
 		},
-		stopFn: func(_ context.Context, _ string, _ time.Duration) error {
+		stopFn: func(_ context.Context, _ string, _ time.Duration, _ string) error {
 			close(stopCalled)
 			close(unblock)
 			return nil
@@ -428,7 +993,7 @@ func TestConsumeSession_InterruptCallsStop(t *testing.T) {
 
 	done := make(chan int, 1)
 	go func() {
-		done <- consumeSession(ctx, session)
+		done <- consumeSession(ctx, session, outputText, false)
 	}()
 
 	// Cancel context to simulate interrupt.
@@ -449,9 +1014,58 @@ func TestConsumeSession_InterruptCallsStop(t *testing.T) {
 	}
 }
 
-func TestRun_Dispatch(t *testing.T) {
-	// run() reads os.Args directly. We restore it after each subtest.
-	origArgs := os.Args
+func TestConsumeSession_InterruptReportsExitCode(t *testing.T) {
+	for _, code := range []int{143, 137} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			running := make(chan struct{})
+			unblock := make(chan struct{})
+			r := &testRunner{
+				runFn: func(_ context.Context, _ cldpd.RunOptions, _ io.Writer) (int, error) {
+					close(running)
+					<-unblock
+					return code, nil
+				},
+				stopFn: func(_ context.Context, _ string, _ time.Duration, _ string) error {
+					close(unblock)
+					return nil
+				},
+			}
+			d, pod := makeSessionPod(t, r)
+			session, err := d.Start(context.Background(), pod, "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+
+			pr, pw, _ := os.Pipe()
+			oldStderr := os.Stderr
+			os.Stderr = pw
+
+			// Interrupt once the container is running.
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-running
+				cancel()
+			}()
+			got := consumeSession(ctx, session, outputText, false)
+
+			pw.Close()
+			os.Stderr = oldStderr
+			stderr, _ := io.ReadAll(pr)
+
+			if got != code {
+				t.Errorf("exit code: got %d, want %d", got, code)
+			}
+			want := fmt.Sprintf("cldpd: stopped (exit code %d)", code)
+			if !strings.Contains(string(stderr), want) {
+				t.Errorf("stderr: got %q, want it to contain %q", stderr, want)
+			}
+		})
+	}
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	// run() reads os.Args directly. We restore it after each subtest.
+	origArgs := os.Args
 	defer func() { os.Args = origArgs }()
 
 	// Redirect stderr to suppress noise from run() calls.
@@ -534,3 +1148,538 @@ func TestPrintUsage(t *testing.T) {
 		t.Errorf("printUsage output missing 'Usage:': %q", buf.String())
 	}
 }
+
+func TestRunInit_CreatesPod(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open devnull: %v", err)
+	}
+	defer devnull.Close()
+	oldOut := os.Stdout
+	os.Stdout = devnull
+	defer func() { os.Stdout = oldOut }()
+
+	if code := runInit([]string{"newpod"}); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+
+	podsDir := filepath.Join(home, ".cldpd", "pods")
+	if _, err := cldpd.DiscoverPod(podsDir, "newpod"); err != nil {
+		t.Errorf("DiscoverPod after init: %v", err)
+	}
+}
+
+func TestRunInit_ExistingRefusedWithoutForce(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open devnull: %v", err)
+	}
+	defer devnull.Close()
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = devnull, devnull
+	defer func() { os.Stdout, os.Stderr = oldOut, oldErr }()
+
+	if code := runInit([]string{"newpod"}); code != 0 {
+		t.Fatalf("first init: got %d, want 0", code)
+	}
+	if code := runInit([]string{"newpod"}); code != 1 {
+		t.Errorf("second init without --force: got %d, want 1", code)
+	}
+	if code := runInit([]string{"--force", "newpod"}); code != 0 {
+		t.Errorf("init with --force: got %d, want 0", code)
+	}
+}
+
+func TestRunInit_MissingPodName(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	if code := runInit([]string{}); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+}
+
+func TestDoctor_DockerAvailable(t *testing.T) {
+	var buf bytes.Buffer
+	code := doctor(context.Background(), &testRunner{}, &buf)
+	if code != 0 {
+		t.Errorf("exit code: got %d, want 0; output: %s", code, buf.String())
+	}
+	if !strings.Contains(buf.String(), "docker: ok") {
+		t.Errorf("output missing docker status: %q", buf.String())
+	}
+}
+
+func TestDoctor_DockerUnavailable(t *testing.T) {
+	r := &testRunner{
+		preflightFn: func(_ context.Context) error { return cldpd.ErrDockerUnavailable },
+	}
+	var buf bytes.Buffer
+	code := doctor(context.Background(), r, &buf)
+	if code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if !strings.Contains(buf.String(), "docker: FAIL") {
+		t.Errorf("output missing docker failure: %q", buf.String())
+	}
+}
+
+func TestPs_Table(t *testing.T) {
+	r := &testRunner{
+		listFn: func(_ context.Context, _ bool) ([]cldpd.ContainerSummary, error) {
+			return []cldpd.ContainerSummary{
+				{Name: "cldpd-api", Pod: "api", Image: "cldpd-api", Status: "Up 5 minutes", Running: true},
+				{Name: "cldpd-frontend", Pod: "frontend", Image: "node:22", Status: "Up 2 hours", Running: true},
+			}, nil
+		},
+	}
+	var buf bytes.Buffer
+	if code := ps(context.Background(), r, &buf, false, false); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	want := "CONTAINER       POD       IMAGE      STATUS\n" +
+		"cldpd-api       api       cldpd-api  Up 5 minutes\n" +
+		"cldpd-frontend  frontend  node:22    Up 2 hours\n"
+	if buf.String() != want {
+		t.Errorf("output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestPs_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if code := ps(context.Background(), &testRunner{}, &buf, false, false); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "no pods running\n" {
+		t.Errorf("output: got %q, want %q", buf.String(), "no pods running\n")
+	}
+}
+
+func TestPs_JSON(t *testing.T) {
+	var gotAll bool
+	r := &testRunner{
+		listFn: func(_ context.Context, all bool) ([]cldpd.ContainerSummary, error) {
+			gotAll = all
+			return []cldpd.ContainerSummary{
+				{Name: "cldpd-api", Pod: "api", Image: "cldpd-api", Status: "Exited (0) 1 minute ago"},
+			}, nil
+		},
+	}
+	var buf bytes.Buffer
+	if code := ps(context.Background(), r, &buf, true, true); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if !gotAll {
+		t.Error("List not called with all")
+	}
+	var entries []psEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	want := psEntry{Container: "cldpd-api", Pod: "api", Image: "cldpd-api", Status: "Exited (0) 1 minute ago"}
+	if len(entries) != 1 || entries[0] != want {
+		t.Errorf("entries: got %+v, want [%+v]", entries, want)
+	}
+}
+
+func TestPs_JSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if code := ps(context.Background(), &testRunner{}, &buf, false, true); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("output: got %q, want []", buf.String())
+	}
+}
+
+func TestPs_ListError(t *testing.T) {
+	r := &testRunner{
+		listFn: func(_ context.Context, _ bool) ([]cldpd.ContainerSummary, error) {
+			return nil, cldpd.ErrDockerUnavailable
+		},
+	}
+	var buf bytes.Buffer
+	if code := ps(context.Background(), r, &buf, false, false); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+}
+
+// makeListPods creates a pods directory holding a bare pod "api" and a pod
+// "web" with a template and a pod.json.
+func makeListPods(t *testing.T) string {
+	t.Helper()
+	podsDir := t.TempDir()
+	files := map[string]string{
+		"api/Dockerfile":  "FROM scratch\n",
+		"web/Dockerfile":  "FROM scratch\n",
+		"web/template.md": "Follow the style guide.\n",
+		"web/pod.json": `{"image": "web:dev", "workdir": "/src", "env": {"MODE": "ci"},
+			"mounts": [{"source": "/data", "target": "/data", "readOnly": true}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(podsDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return podsDir
+}
+
+func TestList_Table(t *testing.T) {
+	podsDir := makeListPods(t)
+	var buf bytes.Buffer
+	if code := list(cldpd.NewDispatcher(podsDir, &testRunner{}), &buf, false); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	want := "POD  IMAGE      TEMPLATE  DIR\n" +
+		"api  cldpd-api  no        " + filepath.Join(podsDir, "api") + "\n" +
+		"web  web:dev    yes       " + filepath.Join(podsDir, "web") + "\n"
+	if buf.String() != want {
+		t.Errorf("output:\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestList_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if code := list(cldpd.NewDispatcher(t.TempDir(), &testRunner{}), &buf, false); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "no pods defined\n" {
+		t.Errorf("output: got %q, want %q", buf.String(), "no pods defined\n")
+	}
+}
+
+func TestList_JSON(t *testing.T) {
+	podsDir := makeListPods(t)
+	d := cldpd.NewDispatcher(podsDir, &testRunner{}, cldpd.WithDefaultConfig(cldpd.PodConfig{StopTimeout: "30s"}))
+	var buf bytes.Buffer
+	if code := list(d, &buf, true); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+
+	var entries []listEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries: got %d, want 2", len(entries))
+	}
+	api, web := entries[0], entries[1]
+	if api.Name != "api" || api.Image != "cldpd-api" || api.HasTemplate {
+		t.Errorf("api: got %+v", api)
+	}
+	if web.Name != "web" || web.Image != "web:dev" || !web.HasTemplate {
+		t.Errorf("web: got %+v", web)
+	}
+	if web.Dir != filepath.Join(podsDir, "web") || web.Dockerfile != filepath.Join(podsDir, "web", "Dockerfile") {
+		t.Errorf("web paths: got dir %q, dockerfile %q", web.Dir, web.Dockerfile)
+	}
+	if !filepath.IsAbs(web.Dir) || !filepath.IsAbs(web.Dockerfile) {
+		t.Errorf("web paths not absolute: %q, %q", web.Dir, web.Dockerfile)
+	}
+	cfg := web.Config
+	if cfg.Image != "web:dev" || cfg.Workdir != "/src" || cfg.Env["MODE"] != "ci" || cfg.StopTimeout != "30s" {
+		t.Errorf("web config: got %+v", cfg)
+	}
+	wantMount := cldpd.Mount{Source: "/data", Target: "/data", ReadOnly: true}
+	if len(cfg.Mounts) != 1 || cfg.Mounts[0] != wantMount {
+		t.Errorf("web mounts: got %+v, want [%+v]", cfg.Mounts, wantMount)
+	}
+	if !strings.Contains(buf.String(), `"readOnly":true`) {
+		t.Errorf("mount not marshaled with pod.json keys: %s", buf.String())
+	}
+}
+
+func TestList_JSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if code := list(cldpd.NewDispatcher(t.TempDir(), &testRunner{}), &buf, true); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("output: got %q, want []", buf.String())
+	}
+}
+
+func TestList_MissingPodsDir(t *testing.T) {
+	var buf bytes.Buffer
+	d := cldpd.NewDispatcher(filepath.Join(t.TempDir(), "missing"), &testRunner{})
+	if code := list(d, &buf, false); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+}
+
+// cleanRunner returns a testRunner with one running and one exited container,
+// and an image for a pod that no longer exists, counting removals into n.
+func cleanRunner(n *int) *testRunner {
+	return &testRunner{
+		listFn: func(context.Context, bool) ([]cldpd.ContainerSummary, error) {
+			return []cldpd.ContainerSummary{
+				{Name: "cldpd-api", Pod: "api", Running: true},
+				{Name: "cldpd-web", Pod: "web"},
+			}, nil
+		},
+		removeFn: func(context.Context, string, bool) error {
+			*n++
+			return nil
+		},
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{"cldpd-gone:latest"}, nil
+		},
+		rmImageFn: func(context.Context, string) error {
+			*n++
+			return nil
+		},
+	}
+}
+
+func TestClean(t *testing.T) {
+	var n int
+	d := cldpd.NewDispatcher(t.TempDir(), cleanRunner(&n))
+	var buf bytes.Buffer
+	if code := clean(context.Background(), d, &buf, cldpd.CleanupOptions{}); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	want := "removed container cldpd-web\nremoved image cldpd-gone:latest\n"
+	if buf.String() != want {
+		t.Errorf("output: got %q, want %q", buf.String(), want)
+	}
+	if n != 2 {
+		t.Errorf("removals: got %d, want 2", n)
+	}
+}
+
+func TestClean_DryRun(t *testing.T) {
+	var n int
+	d := cldpd.NewDispatcher(t.TempDir(), cleanRunner(&n))
+	var buf bytes.Buffer
+	if code := clean(context.Background(), d, &buf, cldpd.CleanupOptions{Containers: true, DryRun: true}); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "would remove container cldpd-web\n" {
+		t.Errorf("output: got %q", buf.String())
+	}
+	if n != 0 {
+		t.Errorf("dry run removed %d objects", n)
+	}
+}
+
+func TestClean_Nothing(t *testing.T) {
+	d := cldpd.NewDispatcher(t.TempDir(), &testRunner{})
+	var buf bytes.Buffer
+	if code := clean(context.Background(), d, &buf, cldpd.CleanupOptions{}); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "nothing to clean\n" {
+		t.Errorf("output: got %q, want %q", buf.String(), "nothing to clean\n")
+	}
+}
+
+func TestClean_RemoveFailed(t *testing.T) {
+	var n int
+	r := cleanRunner(&n)
+	r.removeFn = func(context.Context, string, bool) error { return cldpd.ErrRemoveFailed }
+	var buf bytes.Buffer
+	if code := clean(context.Background(), cldpd.NewDispatcher(t.TempDir(), r), &buf, cldpd.CleanupOptions{}); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if buf.String() != "removed image cldpd-gone:latest\n" {
+		t.Errorf("output: got %q, want only the image removed", buf.String())
+	}
+}
+
+func TestRunImage_Usage(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	for _, args := range [][]string{nil, {"list"}, {"prune", "--keep", "-1"}} {
+		if code := runImage(context.Background(), args); code != 1 {
+			t.Errorf("runImage(%q): exit code %d, want 1", args, code)
+		}
+	}
+}
+
+func TestPruneImages(t *testing.T) {
+	var removed []string
+	r := &testRunner{
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{"cldpd-api:latest", "cldpd-api:build-2", "cldpd-api:build-1", "cldpd-api:build-3"}, nil
+		},
+		rmImageFn: func(_ context.Context, tag string) error {
+			removed = append(removed, tag)
+			return nil
+		},
+	}
+	var buf bytes.Buffer
+	if code := pruneImages(context.Background(), cldpd.NewDispatcher(t.TempDir(), r), &buf, 2); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "removed image cldpd-api:build-1\n" {
+		t.Errorf("output: got %q", buf.String())
+	}
+	if len(removed) != 1 {
+		t.Errorf("removed: got %v, want only the oldest build", removed)
+	}
+
+	buf.Reset()
+	if code := pruneImages(context.Background(), cldpd.NewDispatcher(t.TempDir(), &testRunner{}), &buf, 2); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if buf.String() != "nothing to prune\n" {
+		t.Errorf("output: got %q, want %q", buf.String(), "nothing to prune\n")
+	}
+}
+
+func TestPruneImages_RemoveFailed(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	r := &testRunner{
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{"cldpd-api:build-1", "cldpd-api:build-2"}, nil
+		},
+		rmImageFn: func(context.Context, string) error { return cldpd.ErrImageRemoveFailed },
+	}
+	var buf bytes.Buffer
+	if code := pruneImages(context.Background(), cldpd.NewDispatcher(t.TempDir(), r), &buf, 0); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("output: got %q, want nothing", buf.String())
+	}
+}
+
+func TestRunShell_MissingPodName(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	if code := runShell(context.Background(), nil); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+}
+
+func TestShell(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	tests := []struct {
+		name     string
+		cmd      []string
+		shellErr error
+		wantCmd  []string
+		wantCode int
+	}{
+		{name: "default shell", wantCmd: []string{"/bin/bash"}, wantCode: 7},
+		{name: "command", cmd: []string{"ls", "-la"}, wantCmd: []string{"ls", "-la"}, wantCode: 7},
+		{name: "no container", shellErr: cldpd.ErrSessionNotFound, wantCmd: []string{"/bin/bash"}, wantCode: exitNoContainer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotContainer string
+			var gotCmd []string
+			r := &testRunner{
+				shellFn: func(_ context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+					gotContainer, gotCmd = container, cmd
+					if stdin != os.Stdin || stdout != os.Stdout || stderr != os.Stderr {
+						t.Error("shell must pass the process's own streams")
+					}
+					if tt.shellErr != nil {
+						return -1, tt.shellErr
+					}
+					return 7, nil
+				},
+			}
+			if code := shell(context.Background(), cldpd.NewDispatcher(t.TempDir(), r), "api", tt.cmd); code != tt.wantCode {
+				t.Errorf("exit code: got %d, want %d", code, tt.wantCode)
+			}
+			if gotContainer != "cldpd-api" {
+				t.Errorf("container: got %q, want cldpd-api", gotContainer)
+			}
+			if strings.Join(gotCmd, " ") != strings.Join(tt.wantCmd, " ") {
+				t.Errorf("cmd: got %v, want %v", gotCmd, tt.wantCmd)
+			}
+		})
+	}
+}
+
+func TestRunBuild_MissingPodName(t *testing.T) {
+	old := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = old }()
+
+	if code := runBuild(context.Background(), []string{"--no-cache"}); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+}
+
+func TestBuild_PodNotFound(t *testing.T) {
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatalf("create temp: %v", err)
+	}
+	defer stderr.Close()
+	old := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = old }()
+
+	var built bool
+	r := &testRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ cldpd.BuildOptions) error {
+			built = true
+			return nil
+		},
+	}
+	var buf bytes.Buffer
+	d := cldpd.NewDispatcher(t.TempDir(), r)
+	if code := build(context.Background(), d, "__nonexistent_test_pod__", cldpd.BuildOptions{Output: &buf}); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if built {
+		t.Error("runner.Build was called for a missing pod")
+	}
+	msg, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatalf("read stderr: %v", err)
+	}
+	if !strings.Contains(string(msg), cldpd.ErrPodNotFound.Error()) {
+		t.Errorf("stderr: got %q, want it to mention %q", msg, cldpd.ErrPodNotFound)
+	}
+}
+
+func TestBuild_Success(t *testing.T) {
+	podsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(podsDir, "api"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(podsDir, "api", "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("write Dockerfile: %v", err)
+	}
+
+	var gotTag string
+	r := &testRunner{
+		buildFn: func(_ context.Context, tag string, _ string, _ cldpd.BuildOptions) error {
+			gotTag = tag
+			return nil
+		},
+	}
+	var buf bytes.Buffer
+	if code := build(context.Background(), cldpd.NewDispatcher(podsDir, r), "api", cldpd.BuildOptions{Output: &buf}); code != 0 {
+		t.Fatalf("exit code: got %d, want 0", code)
+	}
+	if gotTag != "cldpd-api" {
+		t.Errorf("tag: got %q, want %q", gotTag, "cldpd-api")
+	}
+}
@@ -0,0 +1,101 @@
+package cldpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DiskThresholds configures the free-space check run before each build.
+// Free space below Warn emits EventWarning; below Floor the build is refused
+// with ErrInsufficientDisk. A zero value disables the check.
+type DiskThresholds struct {
+	Warn  uint64 // bytes; warn when available space is below this
+	Floor uint64 // bytes; fail when available space is below this
+}
+
+// DefaultDiskThresholds warns below 5 GiB and fails below 1 GiB free.
+var DefaultDiskThresholds = DiskThresholds{Warn: 5 << 30, Floor: 1 << 30}
+
+// DiskSpace reports the available space on the filesystem holding Path.
+type DiskSpace struct {
+	Path      string
+	Available uint64 // bytes available to unprivileged users
+}
+
+// DiskReport is the result of CheckDisk.
+type DiskReport struct {
+	Spaces   []DiskSpace // filesystems that could be measured
+	Warnings []string    // one message per filesystem below the warning threshold
+}
+
+// errDiskCheckUnsupported is returned by diskAvailable on platforms without statfs.
+var errDiskCheckUnsupported = errors.New("disk space check not supported on this platform")
+
+// CheckDisk measures free space on the runner's data root, the build context
+// directory, and the temp directory, and evaluates it against th.
+//
+// Filesystems that cannot be measured are skipped: the data root may live in a
+// VM (Docker Desktop) or the platform may lack statfs. Returns the report and
+// an error wrapping ErrInsufficientDisk if any filesystem is below th.Floor.
+func CheckDisk(ctx context.Context, runner Runner, contextDir string, th DiskThresholds) (DiskReport, error) {
+	var paths []string
+	if root, err := runner.DataRoot(ctx); err == nil && root != "" {
+		paths = append(paths, root)
+	}
+	if contextDir != "" {
+		paths = append(paths, contextDir)
+	}
+	paths = append(paths, os.TempDir())
+
+	var report DiskReport
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		avail, err := diskAvailable(p)
+		if err != nil {
+			continue
+		}
+		report.Spaces = append(report.Spaces, DiskSpace{Path: p, Available: avail})
+	}
+
+	warnings, err := evaluateDisk(report.Spaces, th)
+	report.Warnings = warnings
+	return report, err
+}
+
+// evaluateDisk applies th to spaces. It returns a warning for each filesystem
+// below th.Warn, and an error wrapping ErrInsufficientDisk for the first
+// filesystem below th.Floor.
+func evaluateDisk(spaces []DiskSpace, th DiskThresholds) ([]string, error) {
+	var warnings []string
+	for _, s := range spaces {
+		if s.Available < th.Floor {
+			return warnings, fmt.Errorf("%w: %s has %s available, %s required",
+				ErrInsufficientDisk, s.Path, formatBytes(s.Available), formatBytes(th.Floor))
+		}
+		if s.Available < th.Warn {
+			warnings = append(warnings, fmt.Sprintf("low disk space: %s has %s available (warning below %s)",
+				s.Path, formatBytes(s.Available), formatBytes(th.Warn)))
+		}
+	}
+	return warnings, nil
+}
+
+// formatBytes renders n in binary units with one decimal place, e.g. "2.5 GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package cldpd
+
+// diskAvailable is not implemented on this platform; CheckDisk skips every filesystem.
+func diskAvailable(_ string) (uint64, error) {
+	return 0, errDiskCheckUnsupported
+}
@@ -0,0 +1,144 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateDisk_AboveWarn(t *testing.T) {
+	th := DiskThresholds{Warn: 5 << 30, Floor: 1 << 30}
+	warnings, err := evaluateDisk([]DiskSpace{{Path: "/var/lib/docker", Available: 80 << 30}}, th)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings: got %v, want none", warnings)
+	}
+}
+
+func TestEvaluateDisk_BelowWarn(t *testing.T) {
+	th := DiskThresholds{Warn: 5 << 30, Floor: 1 << 30}
+	warnings, err := evaluateDisk([]DiskSpace{
+		{Path: "/var/lib/docker", Available: 3 << 30},
+		{Path: "/tmp", Available: 50 << 30},
+	}, th)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warnings: got %v, want 1", warnings)
+	}
+	for _, want := range []string{"/var/lib/docker", "3.0 GiB", "5.0 GiB"} {
+		if !strings.Contains(warnings[0], want) {
+			t.Errorf("warning %q missing %q", warnings[0], want)
+		}
+	}
+}
+
+func TestEvaluateDisk_BelowFloor(t *testing.T) {
+	th := DiskThresholds{Warn: 5 << 30, Floor: 1 << 30}
+	_, err := evaluateDisk([]DiskSpace{{Path: "/var/lib/docker", Available: 512 << 20}}, th)
+	if !errors.Is(err, ErrInsufficientDisk) {
+		t.Fatalf("got %v, want ErrInsufficientDisk", err)
+	}
+	for _, want := range []string{"/var/lib/docker", "512.0 MiB", "1.0 GiB"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestEvaluateDisk_ZeroThresholds(t *testing.T) {
+	warnings, err := evaluateDisk([]DiskSpace{{Path: "/", Available: 0}}, DiskThresholds{})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("got (%v, %v), want no warnings and nil error", warnings, err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536 << 20, "1.5 GiB"},
+		{2 << 40, "2.0 TiB"},
+	}
+	for _, tc := range cases {
+		if got := formatBytes(tc.n); got != tc.want {
+			t.Errorf("formatBytes(%d): got %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestDiskAvailable(t *testing.T) {
+	avail, err := diskAvailable(t.TempDir())
+	switch runtime.GOOS {
+	case "linux", "darwin":
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if avail == 0 {
+			t.Error("available: got 0, want > 0")
+		}
+	default:
+		if !errors.Is(err, errDiskCheckUnsupported) {
+			t.Errorf("got %v, want errDiskCheckUnsupported", err)
+		}
+	}
+}
+
+func TestCheckDisk_IncludesDataRootAndContextDir(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("statfs not supported on this platform")
+	}
+	root := t.TempDir()
+	contextDir := t.TempDir()
+	r := &mockRunner{
+		dataRootFn: func(_ context.Context) (string, error) { return root, nil },
+	}
+	report, err := CheckDisk(context.Background(), r, contextDir, DiskThresholds{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paths := make([]string, 0, len(report.Spaces))
+	for _, s := range report.Spaces {
+		paths = append(paths, s.Path)
+	}
+	if len(paths) < 2 || paths[0] != root || paths[1] != contextDir {
+		t.Errorf("paths: got %v, want data root then context dir first", paths)
+	}
+}
+
+func TestCheckDisk_SkipsUnmeasurableDataRoot(t *testing.T) {
+	r := &mockRunner{
+		dataRootFn: func(_ context.Context) (string, error) { return "/nonexistent/docker/root", nil },
+	}
+	report, err := CheckDisk(context.Background(), r, "", DiskThresholds{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range report.Spaces {
+		if s.Path == "/nonexistent/docker/root" {
+			t.Error("unmeasurable data root should be skipped")
+		}
+	}
+}
+
+func TestCheckDisk_FloorFailsFast(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("statfs not supported on this platform")
+	}
+	// No real filesystem has this much free space.
+	_, err := CheckDisk(context.Background(), &mockRunner{}, t.TempDir(), DiskThresholds{Floor: 1 << 62})
+	if !errors.Is(err, ErrInsufficientDisk) {
+		t.Errorf("got %v, want ErrInsufficientDisk", err)
+	}
+}
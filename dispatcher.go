@@ -1,33 +1,277 @@
 package cldpd
 
 import (
+	"bufio"
 	"context"
-	"crypto/rand"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Dispatcher coordinates pod discovery, image building, and container lifecycle.
 // Use NewDispatcher to create one.
 //
-// Dispatcher is stateless — it does not track running sessions. Each returned
-// *Session is self-contained. The caller is responsible for calling Stop or Wait.
+// Each returned *Session is self-contained and the caller is responsible for
+// calling Stop or Wait. The Dispatcher also tracks the sessions it has created
+// until they end, so StopAll can shut them down together.
 type Dispatcher struct {
-	runner  Runner
-	podsDir string
+	runner         Runner
+	builder        Builder
+	issueFetcher   IssueFetcher
+	sessionStore   *SessionStore
+	podsDir        string
+	defaultConfig  PodConfig
+	policy         *Policy
+	diskThresholds DiskThresholds
+	podLimits      PodLimits
+	metrics        MetricsCollector
+	logger         *slog.Logger
+	detachedRun    bool
+	sessions       map[string]*Session // tracked sessions by ID, guarded by mu
+	names          map[string]bool     // container names held by started sessions, guarded by mu
+	healthInterval time.Duration
+	idleTimeout    time.Duration
+	maxRuntime     time.Duration
+	restartMax     int
+	restartBackoff time.Duration
+	mu             sync.Mutex
+	maxLineLength  int
+	maxLineSize    int
+	captureOutput  bool
+	modTimeRebuild bool
+}
+
+// Option configures a Dispatcher. Pass options to NewDispatcher.
+type Option func(*Dispatcher)
+
+// WithBuilder sets the Builder used to build pod images. By default the
+// Dispatcher builds through its Runner, which is itself a Builder.
+func WithBuilder(b Builder) Option {
+	return func(d *Dispatcher) {
+		d.builder = b
+	}
+}
+
+// WithIssueFetcher sets the IssueFetcher used by Start for pods that set
+// fetchIssue. By default the Dispatcher uses GHIssueFetcher.
+func WithIssueFetcher(f IssueFetcher) Option {
+	return func(d *Dispatcher) {
+		d.issueFetcher = f
+	}
+}
+
+// WithSessionStore makes Start record each session it creates in st, and
+// remove the record once the container has exited, so a restarted
+// orchestrator can find the containers of sessions it never saw end with
+// LoadSessions, and follow those still running with Attach. Start fails if
+// the record cannot be saved. By default nothing is recorded.
+func WithSessionStore(st *SessionStore) Option {
+	return func(d *Dispatcher) {
+		d.sessionStore = st
+	}
+}
+
+// WithHealthMonitor enables container health monitoring for sessions created by
+// Start. Each session polls the container's healthcheck status every interval
+// and emits EventHealthChanged when it changes. Pods without a Dockerfile
+// HEALTHCHECK emit no health events. A non-positive interval disables monitoring.
+func WithHealthMonitor(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.healthInterval = interval
+	}
+}
+
+// WithIdleTimeout makes every session stop its container, as Session.Stop
+// does, once it has written no output line for timeout, so a hung agent does
+// not hold resources indefinitely. The session first emits an EventError
+// wrapping ErrIdleTimeout; the terminal event follows as for any stop. The
+// clock starts when the container starts, so builds are not counted. A
+// non-positive timeout disables the check, which is the default.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.idleTimeout = timeout
+	}
+}
+
+// WithMaxRuntime caps how long the container of a session created by Start
+// may run, for pods that do not set maxRuntime in pod.json. Once the cap is
+// exceeded, the session emits an EventError wrapping ErrMaxRuntimeExceeded and
+// stops the container as Session.Stop does. The clock starts when the
+// container starts, so builds are not counted. A non-positive limit sets no
+// default, which is the default.
+func WithMaxRuntime(limit time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxRuntime = limit
+	}
+}
+
+// WithDefaultConfig sets a PodConfig merged under every pod's own pod.json at
+// Start, for policy that should apply to all pods (e.g. always inheriting
+// ANTHROPIC_API_KEY). The pod's config wins wherever it sets a value; maps and
+// lists are combined rather than replaced. Paths in cfg are used as given,
+// without ~ expansion.
+func WithDefaultConfig(cfg PodConfig) Option {
+	return func(d *Dispatcher) {
+		d.defaultConfig = cfg
+	}
+}
+
+// WithPolicy enforces p on every pod at Start, Build, and Prefetch, after the
+// pod's config has been merged with the default config. A pod that violates
+// the policy fails with ErrPolicyViolation before anything is built or
+// pulled, and each violation is logged at Warn to the logger set with
+// WithLogger. A nil Policy disables enforcement.
+func WithPolicy(p *Policy) Option {
+	return func(d *Dispatcher) {
+		d.policy = p
+	}
+}
+
+// WithPodLimits sets the mount and environment variable limits every pod is
+// held to, in place of DefaultPodLimits, after the default config is merged
+// under it. A pod over them fails with ErrInvalidPod and is skipped by Pods.
+func WithPodLimits(l PodLimits) Option {
+	return func(d *Dispatcher) {
+		d.podLimits = l
+	}
+}
+
+// WithDiskThresholds sets the free-space thresholds checked before each build.
+// The default is DefaultDiskThresholds; a zero DiskThresholds disables the check.
+func WithDiskThresholds(th DiskThresholds) Option {
+	return func(d *Dispatcher) {
+		d.diskThresholds = th
+	}
+}
+
+// WithRestartPolicy makes sessions created by Start re-run the container, up
+// to maxRestarts times, when it exits with a non-zero code, waiting backoff
+// before each run. The image is not rebuilt. Each restart emits EventRestart; the Session's
+// terminal event and Wait report the last run. A container ended by Stop or
+// Kill is not restarted, and neither is one whose run failed with an error.
+func WithRestartPolicy(maxRestarts int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.restartMax = maxRestarts
+		d.restartBackoff = backoff
+	}
+}
+
+// WithMetrics reports session lifecycle measurements to c: sessions started
+// and exited, build durations, and exit codes. The default discards them.
+func WithMetrics(c MetricsCollector) Option {
+	return func(d *Dispatcher) {
+		d.metrics = c
+	}
+}
+
+// WithDetachedRun makes sessions created by Start run their containers as
+// StartOptions.Detach does, with Runner.RunDetached followed by Attach and
+// WaitContainer instead of the blocking Runner.Run, so containers survive the
+// process that started them. The events are the same as for a blocking run.
+func WithDetachedRun() Option {
+	return func(d *Dispatcher) {
+		d.detachedRun = true
+	}
+}
+
+// WithLogger sets the logger for internal diagnostics that have no place on a
+// Session's events, which may be full or unconsumed: lifecycle transitions at
+// Debug (pod discovery, environment resolution by variable name only, build,
+// container start and exit, stop requests) and anomalies at Warn
+// (dropped output lines, unreadable output, failed container removal). Every
+// entry about a session carries pod, session, and container attributes. The
+// default discards them.
+func WithLogger(l *slog.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger = l
+	}
+}
+
+// WithFullOutputCapture makes every session keep all of its output lines, so
+// Session.Output can return them after the session ends, e.g. for synchronous
+// callers or post-mortem inspection. Capture is bounded; see Session.Output.
+func WithFullOutputCapture() Option {
+	return func(d *Dispatcher) {
+		d.captureOutput = true
+	}
+}
+
+// WithMaxLineLength bounds the Data of each output event to n bytes, so a
+// single enormous line (e.g. base64 from a tool call) is not held by every
+// consumer. A longer line is cut and suffixed with "… [truncated, N bytes
+// total]"; EventMessage parsing and Session.Output still see the whole line,
+// and SessionResult.TruncatedLines counts the cuts. The default is 16 KiB; a
+// non-positive n disables truncation. Lines longer than WithMaxLineSize are not
+// read at all.
+func WithMaxLineLength(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxLineLength = n
+	}
+}
+
+// WithMaxLineSize bounds the longest line of container output a session can
+// read to n bytes; reading a line needs a buffer as large as the line. A
+// longer line cannot be delivered: the session emits EventWarning and
+// discards the rest of the output, so the container still runs to its exit,
+// and then ends with an error wrapping bufio.ErrTooLong. The default is
+// 16 MiB; a non-positive n keeps it.
+func WithMaxLineSize(n int) Option {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.maxLineSize = n
+		}
+	}
+}
+
+// WithModTimeRebuild makes Start skip the image build when the image was
+// created after the pod's Dockerfile was last modified, a cheap stand-in for
+// detecting Dockerfile changes. Only the Dockerfile's modification time is
+// compared: edits to other files in the pod directory, changed build args,
+// a newer base image, or a Dockerfile restored with an old modification time
+// do not trigger a rebuild. Starts that set NoCache or Pull always build, as
+// does Dispatcher.Build.
+func WithModTimeRebuild() Option {
+	return func(d *Dispatcher) {
+		d.modTimeRebuild = true
+	}
 }
 
 // NewDispatcher returns a Dispatcher that discovers pods from podsDir and
 // executes Docker operations via runner.
-func NewDispatcher(podsDir string, runner Runner) *Dispatcher {
-	return &Dispatcher{
-		podsDir: podsDir,
-		runner:  runner,
+func NewDispatcher(podsDir string, runner Runner, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		podsDir:        podsDir,
+		runner:         runner,
+		diskThresholds: DefaultDiskThresholds,
+		podLimits:      DefaultPodLimits,
+		maxLineLength:  defaultMaxLineLength,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.builder == nil {
+		d.builder = runner
+	}
+	if d.issueFetcher == nil {
+		d.issueFetcher = GHIssueFetcher{}
+	}
+	if d.metrics == nil {
+		d.metrics = NopMetrics{}
 	}
+	if d.logger == nil {
+		d.logger = slog.New(slog.DiscardHandler)
+	}
+	return d
 }
 
 // DefaultPodsDir returns the conventional pods directory: ~/.cldpd/pods/.
@@ -39,58 +283,234 @@ func DefaultPodsDir() (string, error) {
 	return filepath.Join(home, ".cldpd", "pods"), nil
 }
 
-// Start builds the pod's Docker image synchronously, then returns a *Session
-// representing the running container. The image build completes before Start
-// returns — if the build fails, Start returns an error and no Session is created.
+// Start validates the named pod and returns a *Session that builds its Docker
+// image and then runs it. Start returns as soon as the pod is validated; the
+// build happens inside the Session, so build progress streams live on Events.
+// If the build fails, the Session ends with an Error event and Wait returns the
+// error, which wraps ErrBuildFailed. If a running container already holds the
+// name cldpd-<podName>, Start returns ErrContainerNameInUse without building;
+// StartOptions.Force removes that container instead. An exited one is removed
+// before the run. A session this Dispatcher started under the same name, even
+// one still building, also fails Start with ErrContainerNameInUse until it
+// ends; Force does not override it.
+//
+// issueURL is parsed with ParseIssueURL: a github.com issue URL or the
+// owner/repo#123 shorthand. Anything else, including a pull request URL,
+// fails with ErrInvalidIssueURL before the pod is read. The prompt carries
+// the issue's canonical URL.
 //
 // If the pod's template.md is non-empty, its contents are prepended to the
-// prompt passed to Claude Code: template + "\n\n" + "Work on this GitHub issue: " + issueURL.
+// prompt passed to Claude Code: template + "\n\n" + "Work on this GitHub issue: " + URL.
 // When template.md is absent, the prompt is the issue URL directive alone.
+// A pod's promptPrefix replaces "Work on this GitHub issue: ", with the URL
+// appended or put in place of {{url}}.
+// If the pod sets fetchIssue, or StartOptions.FetchIssue is set, the issue's
+// title, labels, and body are fetched with the Dispatcher's IssueFetcher
+// before the build and follow the directive. A failed fetch emits
+// EventWarning after BuildStarted and leaves the directive alone.
 //
 // The Session emits events in the following order:
 //
-//	BuildStarted → BuildComplete → ContainerStarted → Output* → ContainerExited
+//	BuildStarted → BuildOutput* → BuildComplete → ContainerStarted → Output* → ContainerExited
+//
+// Start fails with ErrInvalidPod if the pod's Dockerfile has an unknown
+// instruction or no FROM, before anything is built.
 //
-// On build failure: BuildStarted → Error (no Session returned).
+// Before building, the Session checks free disk space (see WithDiskThresholds).
+// Low space adds EventWarning events after BuildStarted; space below the floor
+// ends the Session with an error wrapping ErrInsufficientDisk before anything is built.
+// A pod that sets gpus also gets an EventWarning if the daemon has no nvidia
+// runtime registered; the container is still run.
+//
+// On build failure: BuildStarted → BuildOutput* → Error.
 // On runtime failure: events up to ContainerStarted, then Output*, then Error.
 //
+// ctx governs only the build. The container runs under a context owned by the
+// Session, so cancelling ctx once the build is done does not end it; only
+// session.Stop and session.Kill do, unless StartOptions.StopOnCancel is set.
 // The caller is responsible for calling session.Stop or session.Wait.
 func (d *Dispatcher) Start(ctx context.Context, podName string, issueURL string) (*Session, error) {
-	pod, err := DiscoverPod(d.podsDir, podName)
+	return d.StartWith(ctx, podName, issueURL, StartOptions{})
+}
+
+// StartOptions configures a single Dispatcher.StartWith call, overriding the
+// pod's configuration for that run only.
+type StartOptions struct {
+	// OutputFormat selects Claude Code's output format for this run: "text"
+	// or "stream-json", as for PodConfig.OutputFormat. Empty uses the pod's.
+	OutputFormat string
+
+	// NoCache and Pull set the matching build flags for this run, in addition
+	// to any the pod sets in pod.json.
+	NoCache bool
+	Pull    bool
+
+	// KeepContainer leaves the container in place after it exits, in addition
+	// to the pod's keepContainer setting.
+	KeepContainer bool
+
+	// Detach starts the container with Runner.RunDetached and then follows it
+	// as Attach would, as WithDetachedRun does for every Start. The container
+	// does not depend on the calling process: a caller may stop reading once
+	// EventContainerStarted arrives, and even exit, and the container keeps
+	// running. The event is emitted once the container is running, not when
+	// the build completes. As with Attach, output written before following
+	// begins is not streamed; docker logs has it. Unless KeepContainer is
+	// set, the container runs with docker run --rm, so it is removed when it
+	// exits even if the caller has gone.
+	Detach bool
+
+	// StripANSI removes terminal escape sequences from output lines, in
+	// addition to the pod's stripAnsi setting.
+	StripANSI bool
+
+	// FetchIssue fetches the issue's title, body, and labels into the prompt,
+	// in addition to the pod's fetchIssue setting.
+	FetchIssue bool
+
+	// Force removes a running container that already holds the pod's
+	// container name, such as one left by a crashed run, instead of failing
+	// with ErrContainerNameInUse. It does not override a live session of
+	// the same Dispatcher.
+	Force bool
+
+	// Annotations are the session's initial annotations, as if set with
+	// Session.SetAnnotation before StartWith returned, so they are in the
+	// session's first SessionRecord. They are held to the same bounds;
+	// exceeding one fails StartWith with ErrAnnotationLimit.
+	Annotations map[string]string
+
+	// StopOnCancel ties the container to the ctx passed to StartWith: if ctx
+	// is done before the session ends, the session is stopped as by
+	// Session.Stop, so the container gets its stop signal and is killed only
+	// after the pod's stopTimeout. By default ctx governs only the build.
+	StopOnCancel bool
+}
+
+// StartWith is Start with per-invocation options, so the same pod can be run
+// differently from one call to the next. Zero-value fields in opts fall back
+// to the pod's configuration.
+func (d *Dispatcher) StartWith(ctx context.Context, podName string, issueURL string, startOpts StartOptions) (*Session, error) {
+	issue, err := ParseIssueURL(issueURL)
 	if err != nil {
 		return nil, err
 	}
+	if issue.Kind != IssueKindIssue {
+		return nil, fmt.Errorf("%w: %s is a pull request, not an issue", ErrInvalidIssueURL, issue.URL)
+	}
+	return d.start(ctx, podName, issue, "", startOpts)
+}
 
-	tag := pod.Config.Image
-	if tag == "" {
-		tag = "cldpd-" + podName
+// StartTask is Start for work that is not a GitHub issue: prompt replaces the
+// "Work on this GitHub issue: <url>" directive entirely, and the pod's
+// template.md, if non-empty, is still prepended. fetchIssue does not apply.
+// The container is cldpd-<podName>, as for Start. A blank prompt returns an
+// error wrapping ErrEmptyPrompt.
+func (d *Dispatcher) StartTask(ctx context.Context, podName string, prompt string) (*Session, error) {
+	return d.StartTaskWith(ctx, podName, prompt, StartOptions{})
+}
+
+// StartTaskWith is StartTask with per-invocation options, as StartWith is for
+// Start. StartOptions.FetchIssue is ignored.
+func (d *Dispatcher) StartTaskWith(ctx context.Context, podName string, prompt string, startOpts StartOptions) (*Session, error) {
+	if strings.TrimSpace(prompt) == "" {
+		return nil, fmt.Errorf("%s: task %w", podName, ErrEmptyPrompt)
 	}
+	return d.start(ctx, podName, IssueRef{}, prompt, startOpts)
+}
 
-	// Build phase: synchronous. Emit build events to a temporary channel so
-	// callers who consume Events() see them in order. We emit these as preamble
-	// inside newSession.
-	buildStarted := Event{
-		Type: EventBuildStarted,
-		Data: tag,
-		Time: time.Now(),
+// StartReview is Start for a review pod: it dispatches podName against a pull
+// request rather than an issue. prURL must be a github.com pull request URL;
+// anything else, including an issue URL or the owner/repo#123 shorthand, fails
+// with ErrInvalidIssueURL before the pod is read.
+//
+// The prompt's directive is "Review this pull request: <url>. Leave review
+// comments and an approval decision.", and the pod's review.md, if non-empty,
+// is prepended in place of template.md. fetchIssue does not apply.
+//
+// The image is the pod's, but the container is named cldpd-<podName>-review,
+// so a review can run alongside an issue session of the same pod. Resume,
+// Attach, Status, and Shell reach it as the pod <podName>-review.
+func (d *Dispatcher) StartReview(ctx context.Context, podName string, prURL string) (*Session, error) {
+	return d.StartReviewWith(ctx, podName, prURL, StartOptions{})
+}
+
+// StartReviewWith is StartReview with per-invocation options, as StartWith is
+// for Start. StartOptions.FetchIssue is ignored.
+func (d *Dispatcher) StartReviewWith(ctx context.Context, podName string, prURL string, startOpts StartOptions) (*Session, error) {
+	pr, err := ParseIssueURL(prURL)
+	if err != nil {
+		return nil, err
+	}
+	if pr.Kind != IssueKindPullRequest {
+		return nil, fmt.Errorf("%w: %s is an issue, not a pull request", ErrInvalidIssueURL, pr.URL)
+	}
+	return d.start(ctx, podName, pr, "", startOpts)
+}
+
+// start validates podName and returns the Session that builds and runs it
+// against ref: an issue for Start, a pull request for StartReview, or nothing
+// for StartTask, whose task is the prompt's directive.
+func (d *Dispatcher) start(ctx context.Context, podName string, ref IssueRef, task string, startOpts StartOptions) (*Session, error) {
+	if err := checkAnnotations(startOpts.Annotations); err != nil {
+		return nil, err
+	}
+	pod, err := d.loadPod(podName)
+	if err != nil {
+		return nil, err
+	}
+	if startOpts.OutputFormat != "" {
+		pod.Config.OutputFormat = startOpts.OutputFormat
+		if err := validateConfig(pod.Config); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, podName, err)
+		}
+	}
+	user, err := resolveUser(pod.Config.User)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := d.runner.Build(ctx, tag, pod.Dir, pod.Config.BuildArgs); err != nil {
-		// Build failed: no session. Return a synthetic error event sequence via
-		// a closed-channel session so callers using Events() still see BuildStarted
-		// and Error. We emit this via a dedicated helper rather than newSession
-		// to keep the failure path simple and goroutine-free.
-		return nil, fmt.Errorf("%w", err)
+	tag := pod.ImageTag()
+
+	buildArgs, secrets, err := resolveBuildArgs(pod.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, podName, err)
 	}
 
-	buildComplete := Event{
-		Type: EventBuildComplete,
-		Data: tag,
-		Time: time.Now(),
+	// A review runs under its own name, so it does not contend with an issue
+	// session of the same pod.
+	name, template := podName, pod.Template
+	directive := issueDirective(pod.Config.PromptPrefix, ref)
+	fetchIssue := pod.Config.FetchIssue || startOpts.FetchIssue
+	switch ref.Kind {
+	case IssueKindPullRequest:
+		name, directive, fetchIssue = reviewName(podName), reviewPrompt(ref), false
+		if pod.ReviewTemplate != "" {
+			template = pod.ReviewTemplate
+		}
+	case "":
+		directive, fetchIssue = task, false
 	}
 
-	sessionID := newSessionID(podName)
-	container := containerName(podName)
+	sessionID := newSessionID(name)
+	container := containerName(name)
+	logger := d.sessionLogger(podName, sessionID, container)
+	logger.Debug("pod discovered", "dir", pod.Dir, "dockerfile", pod.Dockerfile, "image", tag, "template", template != "")
+
+	// The name is held from here until the session ends, so a second Start
+	// fails while this one is still building, before docker run ever sees it.
+	if err := d.reserveName(container); err != nil {
+		return nil, err
+	}
+	reserved := true
+	defer func() {
+		if reserved {
+			d.releaseName(container)
+		}
+	}()
+	if err := d.claimName(ctx, container, startOpts.Force); err != nil {
+		return nil, err
+	}
 
 	// Resolve InheritEnv two ways: names whose values are present on the host
 	// are eagerly resolved into Env (passed as -e K=V). Names not set on the
@@ -108,39 +528,470 @@ func (d *Dispatcher) Start(ctx context.Context, podName string, issueURL string)
 			inheritEnv = append(inheritEnv, name)
 		}
 	}
+	// Names only: values may be secrets.
+	logger.Debug("environment resolved", "env", slices.Sorted(maps.Keys(env)), "inherit", inheritEnv)
 
-	prompt := "Work on this GitHub issue: " + issueURL
-	if pod.Template != "" {
-		prompt = pod.Template + "\n\n" + prompt
+	// promptIdx records where the prompt sits in cmd, so that the fetched
+	// issue can replace it once the build phase runs.
+	cmd := []string{"claude", "-p"}
+	promptIdx := len(cmd)
+	cmd = append(cmd, templatePrompt(template, directive))
+	streamJSON := pod.Config.OutputFormat == OutputFormatStreamJSON
+	switch pod.Config.OutputFormat {
+	case OutputFormatStreamJSON:
+		// Claude Code requires --verbose for stream-json in print mode.
+		cmd = append(cmd, "--output-format", OutputFormatStreamJSON, "--verbose")
+	case OutputFormatText:
+		cmd = append(cmd, "--output-format", OutputFormatText)
 	}
+	cmd = append(cmd, pod.Config.claudeArgs()...)
 
 	opts := RunOptions{
 		Image:      tag,
 		Name:       container,
-		Cmd:        []string{"claude", "-p", prompt},
+		Cmd:        cmd,
 		Env:        env,
 		InheritEnv: inheritEnv,
 		Workdir:    pod.Config.Workdir,
-		Remove:     true,
+		Hostname:   pod.Config.Hostname,
 		Mounts:     pod.Config.Mounts,
+		Tmpfs:      pod.Config.Tmpfs,
+		ExtraHosts: pod.Config.ExtraHosts,
+		Ports:      pod.Config.Ports,
+		User:       user,
+		GPUs:       pod.Config.GPUs,
+		Pull:       pod.Config.pullPolicy(),
+
+		SecurityOpts: securityOpts(pod.Config),
+		CapAdd:       pod.Config.CapAdd,
+		Privileged:   pod.Config.Privileged,
 	}
 
-	containerStarted := Event{
-		Type: EventContainerStarted,
-		Data: container,
-		Time: time.Now(),
+	buildOpts := BuildOptions{
+		BuildArgs:  buildArgs,
+		Dockerfile: podDockerfile(pod),
+		Target:     pod.Config.BuildTarget,
+		Secrets:    pod.Config.BuildSecrets,
+		NoCache:    pod.Config.Build.NoCache || startOpts.NoCache,
+		Pull:       pod.Config.Build.Pull || startOpts.Pull,
+	}
+
+	// Build phase: runs inside the session before the container, emitting its
+	// events live so callers see build progress as it happens.
+	detach := startOpts.Detach || d.detachedRun
+	keep := pod.Config.KeepContainer || startOpts.KeepContainer
+	if detach && !keep {
+		// A detached caller may exit as soon as the container starts, taking
+		// the session's own removal with it, so docker removes it instead.
+		opts.Remove = true
+	}
+	var emitStarted func(Event)
+	prepare := func(emit func(Event)) error {
+		emit(Event{Type: EventBuildStarted, Data: tag, Time: time.Now()})
+
+		if d.diskThresholds != (DiskThresholds{}) {
+			report, err := CheckDisk(ctx, d.runner, pod.Dir, d.diskThresholds)
+			if err != nil {
+				return err
+			}
+			for _, w := range report.Warnings {
+				emit(Event{Type: EventWarning, Data: w, Time: time.Now()})
+			}
+		}
+
+		if opts.GPUs != "" {
+			if w := d.checkGPURuntime(ctx); w != "" {
+				emit(Event{Type: EventWarning, Data: w, Time: time.Now()})
+			}
+		}
+
+		if fetchIssue {
+			fetchCtx, cancel := context.WithTimeout(ctx, issueFetchTimeout)
+			content, err := d.issueFetcher.FetchIssue(fetchCtx, ref)
+			cancel()
+			if err != nil {
+				logger.Warn("issue fetch failed", "issue", ref.URL, "error", err)
+				emit(Event{Type: EventWarning, Data: fmt.Sprintf("fetch issue %s: %v; the prompt carries its URL alone", ref.URL, err), Time: time.Now()})
+			} else {
+				opts.Cmd[promptIdx] = templatePrompt(template, issuePrompt(directive, content))
+			}
+		}
+
+		// NoCache and Pull ask for a fresh build, so they always build, except
+		// for an external image, which docker run pulls instead.
+		switch {
+		case pod.Config.externalImage() != "":
+			emit(Event{Type: EventBuildOutput, Data: "pod runs an external image; skipping build", Time: time.Now()})
+		case d.modTimeRebuild && !buildOpts.NoCache && !buildOpts.Pull && d.imageNewer(ctx, tag, pod.Dockerfile):
+			emit(Event{Type: EventBuildOutput, Data: "image is newer than the Dockerfile; skipping build", Time: time.Now()})
+		default:
+			buildStart := time.Now()
+			logger.Debug("build started", "image", tag)
+			err := d.build(ctx, tag, pod.Dir, buildOpts, secrets, emit)
+			buildDuration := time.Since(buildStart)
+			d.metrics.BuildFinished(podName, buildDuration, err)
+			if err != nil {
+				logger.Debug("build failed", "image", tag, "error", err, "duration", buildDuration)
+				return err
+			}
+			logger.Debug("build finished", "image", tag, "duration", buildDuration)
+		}
+
+		emit(Event{Type: EventBuildComplete, Data: tag, Time: time.Now()})
+		if detach {
+			// runFn reports the start once the detached run has returned.
+			emitStarted = emit
+			return nil
+		}
+		emit(Event{Type: EventContainerStarted, Data: container, Time: time.Now()})
+		return nil
 	}
 
 	runner := d.runner
-	runFn := func(pw io.WriteCloser) (int, error) {
+	runFn := func(ctx context.Context, pw io.WriteCloser) (int, error) {
+		// An exited container left by KeepContainer, or by the previous run
+		// when restarting, holds the name.
+		clearExited(ctx, runner, container)
 		return runner.Run(ctx, opts, pw)
 	}
+	if detach {
+		started := false
+		runFn = func(ctx context.Context, pw io.WriteCloser) (int, error) {
+			clearExited(ctx, runner, container)
+			if _, err := runner.RunDetached(ctx, opts); err != nil {
+				return -1, err
+			}
+			if !started {
+				started = true
+				emitStarted(Event{Type: EventContainerStarted, Data: container, Time: time.Now()})
+			}
+			return followDetached(ctx, runner, container, pw)
+		}
+	}
+
+	onExit := d.onExit(podName)
+	var onAnnotate func(map[string]string)
+	if d.sessionStore != nil {
+		rec := SessionRecord{
+			StartedAt:   time.Now(),
+			ID:          sessionID,
+			Pod:         podName,
+			Container:   container,
+			IssueURL:    ref.URL,
+			Annotations: maps.Clone(startOpts.Annotations),
+		}
+		if err := d.sessionStore.Save(rec); err != nil {
+			return nil, err
+		}
+		// recMu orders annotation saves against the removal, so a late
+		// SetAnnotation cannot bring back the record of an ended session.
+		var recMu sync.Mutex
+		removed := false
+		onAnnotate = func(annotations map[string]string) {
+			recMu.Lock()
+			defer recMu.Unlock()
+			if removed {
+				return
+			}
+			rec.Annotations = annotations
+			if err := d.sessionStore.Save(rec); err != nil {
+				logger.Warn("session record save failed", "error", err)
+			}
+		}
+		exited := onExit
+		onExit = func(code int, err error, runDuration time.Duration) {
+			exited(code, err, runDuration)
+			recMu.Lock()
+			defer recMu.Unlock()
+			removed = true
+			if err := d.sessionStore.Remove(sessionID); err != nil {
+				logger.Warn("session record remove failed", "error", err)
+			}
+		}
+	}
+
+	d.metrics.SessionStarted(podName)
+	s := d.track(newSession(sessionID, container, d.runner, runFn, nil, sessionConfig{
+		prepare:        prepare,
+		onExit:         onExit,
+		onRun:          func() { d.metrics.ContainerStarted(podName) },
+		onOutputEnd:    d.onOutputEnd(podName),
+		annotations:    startOpts.Annotations,
+		onAnnotate:     onAnnotate,
+		logger:         logger,
+		healthInterval: d.healthInterval,
+		idleTimeout:    d.idleTimeout,
+		maxRuntime:     d.runtimeLimit(pod.Config),
+		restartMax:     d.restartMax,
+		restartBackoff: d.restartBackoff,
+		stopTimeout:    pod.Config.stopTimeout(),
+		parseStream:    streamJSON,
+		claudeArgs:     pod.Config.claudeArgs(),
+		stripANSI:      pod.Config.StripANSI || startOpts.StripANSI,
+		maxLineLength:  d.maxLineLength,
+		maxLineSize:    d.maxLineSize,
+		captureOutput:  d.captureOutput,
+		removeOnExit:   !keep,
+	}))
+	reserved = false
+	go func() {
+		<-s.done
+		d.releaseName(container)
+	}()
+	if startOpts.StopOnCancel {
+		go stopOnCancel(ctx, s)
+	}
+	return s, nil
+}
+
+// stopOnCancel stops s when ctx is done before s ends.
+func stopOnCancel(ctx context.Context, s *Session) {
+	select {
+	case <-ctx.Done():
+	case <-s.done:
+		return
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		s.logger.Warn("stop on context cancellation failed", "error", err)
+	}
+}
+
+// Build builds the named pod's image without starting a container, tagged as
+// Start would tag it, so a later Start reuses its layers. Use it to pre-warm
+// images before dispatching a batch of pods, or to iterate on a Dockerfile.
+//
+// Build uses the pod's build args, with inheritBuildArgs resolved from the
+// host as at Start; any opts.BuildArgs are added, replacing pod values with the
+// same name. opts.Secrets are likewise added to the pod's buildSecrets. The
+// NoCache and Pull flags apply if set in opts or in the pod's build config,
+// and opts.Target defaults to the pod's buildTarget. The pod's dockerfilePath
+// replaces any opts.Dockerfile. Build output is written to opts.Output, one
+// line at a time, with inherited build arg values redacted. A failed build
+// returns an error wrapping ErrBuildFailed.
+func (d *Dispatcher) Build(ctx context.Context, podName string, opts BuildOptions) error {
+	pod, err := d.loadPod(podName)
+	if err != nil {
+		return err
+	}
+	return d.buildPod(ctx, pod, opts)
+}
+
+// buildPod builds pod, loaded by loadPod, as Build describes.
+func (d *Dispatcher) buildPod(ctx context.Context, pod Pod, opts BuildOptions) error {
+	buildArgs, secrets, err := resolveBuildArgs(pod.Config)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, pod.Name, err)
+	}
+	if len(opts.BuildArgs) > 0 {
+		merged := make(map[string]string, len(buildArgs)+len(opts.BuildArgs))
+		maps.Copy(merged, buildArgs)
+		maps.Copy(merged, opts.BuildArgs)
+		buildArgs = merged
+	}
+
+	out := opts.Output
+	emit := func(e Event) {
+		if out != nil {
+			fmt.Fprintln(out, e.Data)
+		}
+	}
+	tag := pod.ImageTag()
+	buildStart := time.Now()
+	opts.BuildArgs = buildArgs
+	opts.Dockerfile = podDockerfile(pod)
+	if opts.Target == "" {
+		opts.Target = pod.Config.BuildTarget
+	}
+	opts.NoCache = opts.NoCache || pod.Config.Build.NoCache
+	opts.Pull = opts.Pull || pod.Config.Build.Pull
+	opts.Secrets = mergeBuildSecrets(pod.Config.BuildSecrets, opts.Secrets)
+	err = d.build(ctx, tag, pod.Dir, opts, secrets, emit)
+	d.metrics.BuildFinished(pod.Name, time.Since(buildStart), err)
+	return err
+}
+
+// Prefetch readies the named pod's image ahead of its first Start. A pod that
+// runs an external image (one that sets both Image and PullPolicy) has it
+// pulled with Runner.Pull, so the registry round trip is paid before
+// dispatch; a failed pull returns an error wrapping ErrPullFailed. Any other
+// pod has the tag Start would build, Image or cldpd-<pod>, built as by Build
+// with zero BuildOptions.
+func (d *Dispatcher) Prefetch(ctx context.Context, podName string) error {
+	pod, err := d.loadPod(podName)
+	if err != nil {
+		return err
+	}
+	if image := pod.Config.externalImage(); image != "" {
+		return d.runner.Pull(ctx, image, io.Discard)
+	}
+	return d.buildPod(ctx, pod, BuildOptions{})
+}
+
+// loadPod discovers the named pod, merges the Dispatcher's defaults beneath
+// its config, and validates the result against the config rules and the
+// policy, as Start, Build, and Prefetch all need the same view of a pod.
+func (d *Dispatcher) loadPod(podName string) (Pod, error) {
+	pod, err := discoverPod(d.podsDir, podName, d.podLimits)
+	if err != nil {
+		return Pod{}, err
+	}
+	if err := checkDockerfile(podName, pod.Dockerfile); err != nil {
+		return Pod{}, err
+	}
+	pod.Config = mergePodConfig(d.defaultConfig, pod.Config)
+	if err := validateConfig(pod.Config); err != nil {
+		return Pod{}, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, podName, err)
+	}
+	if err := d.podLimits.check(pod.Config); err != nil {
+		return Pod{}, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, podName, err)
+	}
+	if violations := d.policy.violations(pod.Config); len(violations) > 0 {
+		// An audit trail for the administrator: each denial is logged, not
+		// just the error returned to the caller.
+		for _, v := range violations {
+			d.logger.Warn("policy denied pod", "pod", podName, "violation", v)
+		}
+		return Pod{}, fmt.Errorf("%s: %w", podName, violationError(violations))
+	}
+	return pod, nil
+}
+
+// podDockerfile returns the Dockerfile to pass to the builder for pod: its
+// absolute path if the pod names one with dockerfilePath, or empty so the
+// builder uses the Dockerfile in the build context.
+func podDockerfile(pod Pod) string {
+	if pod.Config.DockerfilePath == "" {
+		return ""
+	}
+	return pod.Dockerfile
+}
+
+// imageNewer reports whether image tag was created after dockerfile was last
+// modified. Any failure to tell, including a missing image, reports false so
+// that the image is built.
+func (d *Dispatcher) imageNewer(ctx context.Context, tag, dockerfile string) bool {
+	info, err := os.Stat(dockerfile)
+	if err != nil {
+		return false
+	}
+	created, err := d.runner.ImageCreated(ctx, tag)
+	if err != nil {
+		return false
+	}
+	return created.After(info.ModTime())
+}
 
-	preamble := []Event{buildStarted, buildComplete, containerStarted}
+// checkGPURuntime returns a warning if the daemon has no nvidia runtime, in
+// which case docker run --gpus is likely to fail. The check is advisory: if the
+// runtimes cannot be listed it returns no warning and Start proceeds.
+func (d *Dispatcher) checkGPURuntime(ctx context.Context) string {
+	runtimes, err := d.runner.Runtimes(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, r := range runtimes {
+		if r == "nvidia" {
+			return ""
+		}
+	}
+	return "pod requests GPUs but Docker has no nvidia runtime registered; --gpus may fail"
+}
 
-	return newSession(sessionID, container, d.runner, runFn, preamble), nil
+// resolveBuildArgs returns cfg's build args with each InheritBuildArgs name
+// resolved from the host environment, and the resolved values, which are
+// secrets to redact. A name unset on the host is skipped, or is an error when
+// cfg.RequireBuildArgs is set.
+func resolveBuildArgs(cfg PodConfig) (map[string]string, []string, error) {
+	if len(cfg.InheritBuildArgs) == 0 {
+		return cfg.BuildArgs, nil, nil
+	}
+	args := make(map[string]string, len(cfg.BuildArgs)+len(cfg.InheritBuildArgs))
+	for k, v := range cfg.BuildArgs {
+		args[k] = v
+	}
+	var secrets []string
+	for _, name := range cfg.InheritBuildArgs {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			if cfg.RequireBuildArgs {
+				return nil, nil, fmt.Errorf("inheritBuildArgs %s is not set on the host", name)
+			}
+			continue
+		}
+		args[name] = v
+		secrets = append(secrets, v)
+	}
+	return args, secrets, nil
 }
 
+// build builds the image in dir as tag, emitting each line of build output as
+// EventBuildOutput in place of opts.Output. A default cldpd-<pod> tag is joined
+// by the build tag PruneImages works from. Every occurrence of a value in
+// secrets is redacted from the output and from the returned error.
+func (d *Dispatcher) build(ctx context.Context, tag, dir string, opts BuildOptions, secrets []string, emit func(Event)) error {
+	if bt, ok := buildTag(tag, time.Now()); ok {
+		opts.Tags = append(slices.Clone(opts.Tags), bt)
+	}
+
+	pr, pw := io.Pipe()
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			emit(Event{Type: EventBuildOutput, Data: redact(scanner.Text(), secrets), Time: time.Now()})
+		}
+		// Drain anything the scanner gave up on (e.g. an overlong line) so the
+		// builder never blocks writing to the pipe.
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	opts.Output = pw
+	err := d.builder.Build(ctx, tag, dir, opts)
+	// PipeWriter.Close always returns nil, but the error is checked to satisfy errcheck.
+	_ = pw.Close()
+	<-scanned
+	if err != nil {
+		return redactError(err, secrets)
+	}
+	return nil
+}
+
+// redacted replaces secret values in build output and errors.
+const redacted = "[redacted]"
+
+// redact returns s with every non-empty value in secrets replaced by redacted.
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+// redactError returns err with secrets redacted from its message. The result
+// still matches the sentinels err matches under errors.Is, but does not unwrap
+// to err, so the unredacted message cannot be recovered from it.
+func redactError(err error, secrets []string) error {
+	msg := redact(err.Error(), secrets)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
+
+// redactedError is an error whose message has had secrets redacted.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+// Is reports whether the original error matches target.
+func (e *redactedError) Is(target error) bool { return errors.Is(e.err, target) }
+
 // Resume returns a *Session wrapping a follow-up exec into an already-running
 // container for the named pod. Resume does not build an image.
 //
@@ -148,16 +999,23 @@ func (d *Dispatcher) Start(ctx context.Context, podName string, issueURL string)
 //
 //	ContainerStarted → Output* → ContainerExited
 //
-// Returns ErrSessionNotFound if no container named cldpd-<podName> is running.
-// The caller is responsible for calling session.Stop or session.Wait.
-func (d *Dispatcher) Resume(ctx context.Context, podName string, prompt string) (*Session, error) {
+// Returns ErrSessionNotFound if no container named cldpd-<podName> is running,
+// and an error wrapping ErrEmptyPrompt if prompt is blank. The claude command gets the same pod-level flags as at Start, such as those
+// for skipPermissions. The exec runs under a context owned by the Session, not
+// the caller's; only session.Stop and session.Kill end it. The caller is
+// responsible for calling session.Stop or session.Wait.
+func (d *Dispatcher) Resume(_ context.Context, podName string, prompt string) (*Session, error) {
+	if strings.TrimSpace(prompt) == "" {
+		return nil, fmt.Errorf("%s: resume %w", podName, ErrEmptyPrompt)
+	}
 	container := containerName(podName)
-	cmd := []string{"claude", "--resume", "-p", prompt}
-
 	sessionID := newSessionID(podName)
+	logger := d.sessionLogger(podName, sessionID, container)
+	cfg := d.runningConfig(podName, logger)
+	cmd := append([]string{"claude", "--resume", "-p", prompt}, cfg.claudeArgs()...)
 
 	runner := d.runner
-	runFn := func(pw io.WriteCloser) (int, error) {
+	runFn := func(ctx context.Context, pw io.WriteCloser) (int, error) {
 		return runner.Exec(ctx, container, cmd, pw)
 	}
 
@@ -169,23 +1027,469 @@ func (d *Dispatcher) Resume(ctx context.Context, podName string, prompt string)
 
 	preamble := []Event{containerStarted}
 
-	return newSession(sessionID, container, d.runner, runFn, preamble), nil
+	d.metrics.SessionStarted(podName)
+	return d.track(newSession(sessionID, container, d.runner, runFn, preamble, sessionConfig{
+		onExit:        d.onExit(podName),
+		onOutputEnd:   d.onOutputEnd(podName),
+		logger:        logger,
+		idleTimeout:   d.idleTimeout,
+		stopTimeout:   cfg.stopTimeout(),
+		claudeArgs:    cfg.claudeArgs(),
+		stripANSI:     cfg.StripANSI,
+		maxLineLength: d.maxLineLength,
+		maxLineSize:   d.maxLineSize,
+		captureOutput: d.captureOutput,
+	})), nil
+}
+
+// defaultShell is the command Shell runs when none is given.
+var defaultShell = []string{"/bin/bash"}
+
+// Shell runs cmd interactively in the named pod's running container, /bin/bash
+// if cmd is empty, with stdin, stdout, and stderr wired straight through; a
+// TTY is allocated when stdout is a terminal. It blocks until the command
+// exits and returns its exit code. Shell deliberately bypasses the Session
+// event model: there are no events, output is not captured, and the
+// container is left running afterwards.
+//
+// Returns ErrSessionNotFound if no container named cldpd-<podName> is running.
+func (d *Dispatcher) Shell(ctx context.Context, podName string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if len(cmd) == 0 {
+		cmd = defaultShell
+	}
+	return d.runner.ExecInteractive(ctx, containerName(podName), cmd, stdin, stdout, stderr)
+}
+
+// Attach returns a *Session for the named pod's already-running container, so a
+// process that restarts after calling Start can resume streaming its output.
+// Attach does not build an image or start a container. Output written before
+// Attach is not replayed.
+//
+// The Session emits events in the following order:
+//
+//	ContainerAttached → Output* → ContainerExited
+//
+// Stop and Kill on the returned Session act on the container as they would for
+// the Session that started it. ctx governs only the initial inspect; the attach
+// runs under a context owned by the Session. Returns ErrSessionNotFound if no
+// container named cldpd-<podName> is running.
+func (d *Dispatcher) Attach(ctx context.Context, podName string) (*Session, error) {
+	container := containerName(podName)
+	state, err := d.runner.Inspect(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Running {
+		return nil, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	}
+
+	sessionID := newSessionID(podName)
+	logger := d.sessionLogger(podName, sessionID, container)
+
+	runner := d.runner
+	runFn := func(ctx context.Context, pw io.WriteCloser) (int, error) {
+		return runner.Attach(ctx, container, pw)
+	}
+
+	containerAttached := Event{
+		Type: EventContainerAttached,
+		Data: container,
+		Time: time.Now(),
+	}
+
+	preamble := []Event{containerAttached}
+
+	cfg := d.runningConfig(podName, logger)
+	d.metrics.SessionStarted(podName)
+	return d.track(newSession(sessionID, container, d.runner, runFn, preamble, sessionConfig{
+		onExit:         d.onExit(podName),
+		onOutputEnd:    d.onOutputEnd(podName),
+		logger:         logger,
+		healthInterval: d.healthInterval,
+		idleTimeout:    d.idleTimeout,
+		stopTimeout:    cfg.stopTimeout(),
+		claudeArgs:     cfg.claudeArgs(),
+		stripANSI:      cfg.StripANSI,
+		maxLineLength:  d.maxLineLength,
+		maxLineSize:    d.maxLineSize,
+		captureOutput:  d.captureOutput,
+		removeOnExit:   !cfg.KeepContainer,
+	})), nil
+}
+
+// followDetached streams a container just started by RunDetached and returns
+// its exit code. One that has already exited, or was stopped, before the
+// attach began is reported by WaitContainer rather than as ErrSessionNotFound.
+func followDetached(ctx context.Context, runner Runner, container string, w io.Writer) (int, error) {
+	code, err := runner.Attach(ctx, container, w)
+	if errors.Is(err, ErrSessionNotFound) {
+		if exited, waitErr := runner.WaitContainer(ctx, container); waitErr == nil {
+			return exited, nil
+		}
+	}
+	return code, err
+}
+
+// track records s as a running session until it ends, and returns it.
+func (d *Dispatcher) track(s *Session) *Session {
+	d.mu.Lock()
+	if d.sessions == nil {
+		d.sessions = make(map[string]*Session)
+	}
+	d.sessions[s.ID()] = s
+	d.mu.Unlock()
+
+	go func() {
+		<-s.done
+		d.mu.Lock()
+		delete(d.sessions, s.ID())
+		d.mu.Unlock()
+	}()
+	return s
+}
+
+// StopAll gracefully stops every session created by this Dispatcher that has
+// not yet ended, concurrently, and returns once each Stop has returned. Errors
+// from individual sessions are joined. It is intended for orchestrator
+// shutdown; sessions that end while StopAll runs are unaffected, since Stop is
+// idempotent.
+func (d *Dispatcher) StopAll(ctx context.Context) error {
+	d.mu.Lock()
+	sessions := make([]*Session, 0, len(d.sessions))
+	for _, s := range d.sessions {
+		sessions = append(sessions, s)
+	}
+	d.mu.Unlock()
+
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.Stop(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sessionLogger returns the Dispatcher's logger with the attributes that
+// identify a session.
+func (d *Dispatcher) sessionLogger(podName, sessionID, container string) *slog.Logger {
+	return d.logger.With("pod", podName, "session", sessionID, "container", container)
+}
+
+// onOutputEnd returns the session hook that reports podName's dropped output
+// lines to the metrics collector.
+func (d *Dispatcher) onOutputEnd(podName string) func(int64) {
+	return func(dropped int64) {
+		d.metrics.OutputDropped(podName, dropped)
+	}
+}
+
+// onExit returns the session exit hook that reports podName's result to the
+// metrics collector.
+func (d *Dispatcher) onExit(podName string) func(int, error, time.Duration) {
+	return func(code int, err error, runDuration time.Duration) {
+		d.metrics.SessionExited(podName, code, err, runDuration)
+	}
+}
+
+// runningConfig returns podName's configuration merged over the default
+// config, or the default config alone if the pod cannot be loaded. The
+// container is already running, so Resume and Attach do not require its pod
+// definition to still exist.
+func (d *Dispatcher) runningConfig(podName string, logger *slog.Logger) PodConfig {
+	pod, err := discoverPod(d.podsDir, podName, d.podLimits)
+	if err != nil {
+		logger.Debug("pod not loaded; using the default config", "error", err)
+		return d.defaultConfig
+	}
+	return mergePodConfig(d.defaultConfig, pod.Config)
+}
+
+// templatePrompt returns directive with the pod's template.md contents, if
+// any, prepended and separated by a blank line.
+func templatePrompt(template, directive string) string {
+	if template == "" {
+		return directive
+	}
+	return template + "\n\n" + directive
+}
+
+// runtimeLimit returns the maximum runtime for a container of a pod with cfg:
+// its maxRuntime if set, or the Dispatcher's default.
+func (d *Dispatcher) runtimeLimit(cfg PodConfig) time.Duration {
+	if limit := cfg.maxRuntime(); limit > 0 {
+		return limit
+	}
+	return d.maxRuntime
+}
+
+// reserveName records container as held by a session this Dispatcher is
+// starting. It returns ErrContainerNameInUse if a live session already holds
+// it, whether or not its container has been created yet.
+func (d *Dispatcher) reserveName(container string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.names[container] {
+		return fmt.Errorf("%w: %s is held by a session this Dispatcher started", ErrContainerNameInUse, container)
+	}
+	if d.names == nil {
+		d.names = make(map[string]bool)
+	}
+	d.names[container] = true
+	return nil
+}
+
+// releaseName frees container for a later Start.
+func (d *Dispatcher) releaseName(container string) {
+	d.mu.Lock()
+	delete(d.names, container)
+	d.mu.Unlock()
+}
+
+// claimName makes sure no running container holds the name container, which
+// docker run would fail on. With force, a running container is removed;
+// without it, ErrContainerNameInUse is returned. An exited container is left
+// for clearExited to remove before the run.
+func (d *Dispatcher) claimName(ctx context.Context, container string, force bool) error {
+	state, err := d.runner.Inspect(ctx, container)
+	if err != nil || !state.Running {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%w: %s is running, perhaps left by an earlier run; stop it with docker rm -f %s, or start with Force", ErrContainerNameInUse, container, container)
+	}
+	if err := d.runner.Remove(ctx, container, true); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrContainerNameInUse, container, err)
+	}
+	return nil
+}
+
+// clearExited removes container if it exists and has exited, so that docker
+// run can reuse its name. A running container is left for docker run to
+// report as a name conflict, as is one that fails to be removed.
+func clearExited(ctx context.Context, runner Runner, container string) {
+	state, err := runner.Inspect(ctx, container)
+	if err != nil || state.Running {
+		return
+	}
+	_ = runner.Remove(ctx, container, false)
+}
+
+// Pods returns every pod in the pods directory, sorted by name, with the
+// default config merged under each pod's own as Start resolves it. Pods
+// without a Dockerfile or over the limits set with WithPodLimits are skipped,
+// as in DiscoverAll.
+func (d *Dispatcher) Pods() ([]Pod, error) {
+	pods, err := discoverAll(d.podsDir, d.podLimits)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		pods[i].Config = mergePodConfig(d.defaultConfig, pods[i].Config)
+	}
+	return pods, nil
+}
+
+// PodStatus reports the live container state for a pod.
+type PodStatus struct {
+	StartedAt     time.Time // when the container last started
+	ContainerName string    // deterministic container name (cldpd-<podName>)
+	Image         string    // image the container was created from
+	ExitCode      int       // exit code; meaningful only when Running is false
+	Running       bool      // whether the container is currently running
+}
+
+// Status reports the state of the named pod's container without requiring the
+// Session that started it, so a restarted orchestrator can still query it.
+//
+// Containers started by Start are removed once they exit, so an exited status
+// is only reported for containers kept with KeepContainer, or not yet removed.
+// Returns ErrSessionNotFound if no container exists for the pod.
+func (d *Dispatcher) Status(ctx context.Context, podName string) (PodStatus, error) {
+	container := containerName(podName)
+	state, err := d.runner.Inspect(ctx, container)
+	if err != nil {
+		return PodStatus{}, err
+	}
+	return PodStatus{
+		StartedAt:     state.StartedAt,
+		ContainerName: container,
+		Image:         state.Image,
+		ExitCode:      state.ExitCode,
+		Running:       state.Running,
+	}, nil
+}
+
+// CleanupOptions selects what Dispatcher.Cleanup removes. With neither
+// Containers nor Images set, Cleanup removes both.
+type CleanupOptions struct {
+	Containers bool // exited cldpd-<pod> containers
+	Images     bool // cldpd-<pod> images whose pod is no longer in the pods directory
+	DryRun     bool // report what would be removed without removing anything
+}
+
+// CleanupReport lists what Cleanup removed, or would remove on a dry run.
+type CleanupReport struct {
+	Containers []string // container names
+	Images     []string // image tags
 }
 
-// containerName returns the deterministic Docker container name for a pod.
-// Used by both Start (to name the new container) and Resume (to target the running one).
-func containerName(podName string) string {
-	return "cldpd-" + podName
+// Cleanup removes what crashed orchestrators and KeepContainer leave behind:
+// exited containers named for pods, and images tagged cldpd-<pod> for pods that
+// no longer exist in the pods directory. Running containers are never touched,
+// and neither are images of pods that still exist or images set with a pod's
+// image field. Containers are removed first, so an exited container does not
+// keep its image in use.
+//
+// A failure to remove one container or image does not stop the rest: the
+// report lists what was removed and the failures are returned joined. An error
+// listing containers or images, or reading the pods directory, returns at once.
+func (d *Dispatcher) Cleanup(ctx context.Context, opts CleanupOptions) (CleanupReport, error) {
+	if !opts.Containers && !opts.Images {
+		opts.Containers, opts.Images = true, true
+	}
+
+	var (
+		report CleanupReport
+		errs   []error
+	)
+	if opts.Containers {
+		list, err := d.runner.List(ctx, true)
+		if err != nil {
+			return report, err
+		}
+		for _, c := range list {
+			if c.Running {
+				continue
+			}
+			if !opts.DryRun {
+				if err := d.runner.Remove(ctx, c.Name, false); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			report.Containers = append(report.Containers, c.Name)
+		}
+	}
+
+	if opts.Images {
+		pods, err := discoverAll(d.podsDir, d.podLimits)
+		if err != nil {
+			return report, errors.Join(append(errs, err)...)
+		}
+		exists := make(map[string]bool, len(pods))
+		for _, p := range pods {
+			exists[p.Name] = true
+		}
+		tags, err := d.runner.Images(ctx)
+		if err != nil {
+			return report, errors.Join(append(errs, err)...)
+		}
+		for _, tag := range tags {
+			if pod, ok := podFromImage(tag); !ok || exists[pod] {
+				continue
+			}
+			if !opts.DryRun {
+				if err := d.runner.RemoveImage(ctx, tag); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			report.Images = append(report.Images, tag)
+		}
+	}
+	return report, errors.Join(errs...)
 }
 
-// newSessionID generates a unique session ID in the format <podName>-<hex8>.
-// Uses crypto/rand for the random suffix.
-func newSessionID(podName string) string {
-	var b [4]byte
-	if _, err := rand.Read(b[:]); err != nil {
-		// crypto/rand failure is extremely unlikely; fall back to a fixed suffix
-		// rather than panicking. The session will still function.
-		return podName + "-00000000"
+// PruneImages removes all but the keepPerPod most recent builds of each pod's
+// image and returns the tags it removed. Every build of a cldpd-<pod> image is
+// also tagged cldpd-<pod>:build-<time>, so the builds a rebuild replaces stay
+// named; PruneImages removes their oldest build tags with Runner.RemoveImage,
+// which deletes an image once its last tag is gone. The cldpd-<pod> tag itself
+// is never removed, so a pod's current image survives any keepPerPod, and
+// images set with a pod's image field carry no build tags to prune.
+//
+// Pods with a running container, issue session or review, are skipped
+// entirely, since the container may run any of their builds. A failure to
+// remove one tag does not stop the rest: the removed tags are returned with
+// the failures joined. An error listing containers or images returns at once.
+func (d *Dispatcher) PruneImages(ctx context.Context, keepPerPod int) ([]string, error) {
+	if keepPerPod < 0 {
+		return nil, fmt.Errorf("keepPerPod %d is negative", keepPerPod)
+	}
+	running, err := d.runner.List(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]bool, len(running))
+	for _, c := range running {
+		inUse[c.Pod] = true
+		if pod, ok := strings.CutSuffix(c.Pod, reviewSuffix); ok {
+			inUse[pod] = true
+		}
+		if pod, ok := podFromImage(c.Image); ok {
+			inUse[pod] = true
+		}
+	}
+
+	tags, err := d.runner.Images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	builds := make(map[string][]string)
+	for _, tag := range tags {
+		if pod, ok := podFromBuildTag(tag); ok && !inUse[pod] {
+			builds[pod] = append(builds[pod], tag)
+		}
+	}
+
+	var (
+		removed []string
+		errs    []error
+	)
+	for _, pod := range slices.Sorted(maps.Keys(builds)) {
+		// Build tags sort oldest first, so the surplus is the head.
+		tags := slices.Sorted(slices.Values(builds[pod]))
+		for _, tag := range tags[:max(len(tags)-keepPerPod, 0)] {
+			if err := d.runner.RemoveImage(ctx, tag); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed = append(removed, tag)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// securityOpts returns the --security-opt values for a pod's seccomp and
+// AppArmor profiles, in that order. Unset profiles are omitted.
+func securityOpts(config PodConfig) []string {
+	var opts []string
+	if config.SeccompProfile != "" {
+		opts = append(opts, "seccomp="+config.SeccompProfile)
+	}
+	if config.ApparmorProfile != "" {
+		opts = append(opts, "apparmor="+config.ApparmorProfile)
+	}
+	return opts
+}
+
+// hostUser is the PodConfig.User value that runs the container as the invoking user.
+const hostUser = "host"
+
+// resolveUser returns the --user value for a pod. The special value "host"
+// resolves to the invoking user's uid:gid, which is unavailable on Windows.
+// Any other value is passed through unchanged.
+func resolveUser(user string) (string, error) {
+	if user != hostUser {
+		return user, nil
+	}
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf(`user %q is not supported on windows: set an explicit uid:gid in pod.json`, hostUser)
 	}
-	return podName + "-" + hex.EncodeToString(b[:])
+	return strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()), nil
 }
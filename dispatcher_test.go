@@ -3,14 +3,20 @@
 package cldpd
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -36,23 +42,6 @@ func drainSession(t *testing.T, s *Session, timeout time.Duration) ([]Event, int
 	return events, code, err
 }
 
-func TestContainerName(t *testing.T) {
-	cases := []struct {
-		podName string
-		want    string
-	}{
-		{"myrepo", "cldpd-myrepo"},
-		{"some-repo", "cldpd-some-repo"},
-		{"a", "cldpd-a"},
-	}
-	for _, tc := range cases {
-		got := containerName(tc.podName)
-		if got != tc.want {
-			t.Errorf("containerName(%q): got %q, want %q", tc.podName, got, tc.want)
-		}
-	}
-}
-
 func TestDefaultPodsDir(t *testing.T) {
 	dir, err := DefaultPodsDir()
 	if err != nil {
@@ -82,22 +71,6 @@ func TestNewDispatcher(t *testing.T) {
 	}
 }
 
-func TestNewSessionID_Format(t *testing.T) {
-	re := regexp.MustCompile(`^myrepo-[0-9a-f]{8}$`)
-	id := newSessionID("myrepo")
-	if !re.MatchString(id) {
-		t.Errorf("newSessionID: got %q, want format myrepo-<8 hex chars>", id)
-	}
-}
-
-func TestNewSessionID_Unique(t *testing.T) {
-	id1 := newSessionID("pod")
-	id2 := newSessionID("pod")
-	if id1 == id2 {
-		t.Errorf("newSessionID: two calls returned same ID %q", id1)
-	}
-}
-
 func TestDispatcher_Start_PodNotFound(t *testing.T) {
 	podsDir := t.TempDir()
 	r := &mockRunner{}
@@ -131,7 +104,7 @@ func TestDispatcher_Start_DefaultImageTag(t *testing.T) {
 
 	var builtTag string
 	r := &mockRunner{
-		buildFn: func(_ context.Context, tag string, _ string, _ map[string]string) error {
+		buildFn: func(_ context.Context, tag string, _ string, _ BuildOptions) error {
 			builtTag = tag
 			return nil
 		},
@@ -159,7 +132,7 @@ func TestDispatcher_Start_CustomImageTag(t *testing.T) {
 
 	var builtTag string
 	r := &mockRunner{
-		buildFn: func(_ context.Context, tag string, _ string, _ map[string]string) error {
+		buildFn: func(_ context.Context, tag string, _ string, _ BuildOptions) error {
 			builtTag = tag
 			return nil
 		},
@@ -177,74 +150,119 @@ func TestDispatcher_Start_CustomImageTag(t *testing.T) {
 	}
 }
 
-func TestDispatcher_Start_BuildFailed(t *testing.T) {
+func TestDispatcher_Start_CallerContextCancelled_ContainerKeepsRunning(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
 
+	running := make(chan context.Context, 1)
+	stopped := make(chan struct{})
 	r := &mockRunner{
-		buildFn: func(_ context.Context, _ string, _ string, _ map[string]string) error {
-			return fmt.Errorf("%w: exit code 1", ErrBuildFailed)
+		runFn: func(ctx context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			running <- ctx
+			select {
+			case <-stopped:
+				return 143, nil
+			case <-ctx.Done():
+				return -1, ctx.Err()
+			}
+		},
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			close(stopped)
+			return nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
-	if !errors.Is(err, ErrBuildFailed) {
-		t.Errorf("got %v, want ErrBuildFailed", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := d.Start(ctx, "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if s != nil {
-		t.Error("session should be nil on build failure")
-		drainSession(t, s, 2*time.Second)
+	runCtx := <-running
+	cancel()
+
+	select {
+	case <-runCtx.Done():
+		t.Fatal("run context cancelled with the caller's context")
+	case <-s.done:
+		t.Fatal("session ended with the caller's context")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer stopCancel()
+	if err := s.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if code, err := waitForDone(t, s, 2*time.Second); code != 143 || err != nil {
+		t.Errorf("result: got (%d, %v), want (143, nil)", code, err)
 	}
+	drainSession(t, s, 2*time.Second)
 }
 
-func TestDispatcher_Start_RunOptions_Image(t *testing.T) {
+func TestDispatcher_StartWith_StopOnCancel(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
 
-	var capturedOpts RunOptions
+	running := make(chan struct{})
+	halt := make(chan struct{})
+	stopped := make(chan string, 1)
 	r := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedOpts = opts
-			return 0, nil
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			close(running)
+			<-halt
+			return 143, nil
+		},
+		stopFn: func(_ context.Context, container string, _ time.Duration, _ string) error {
+			select {
+			case stopped <- container:
+				close(halt)
+			default:
+			}
+			return nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	issueURL := "https://github.com/org/repo/issues/42"
-	s, err := d.Start(context.Background(), "myrepo", issueURL)
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := d.StartWith(ctx, "myrepo", "https://github.com/org/repo/issues/1", StartOptions{StopOnCancel: true})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	drainSession(t, s, 2*time.Second)
+	<-running
+	cancel()
 
-	if capturedOpts.Image != "cldpd-myrepo" {
-		t.Errorf("image: got %q, want %q", capturedOpts.Image, "cldpd-myrepo")
-	}
-	if !capturedOpts.Remove {
-		t.Error("Remove: got false, want true")
-	}
-	if len(capturedOpts.Cmd) < 3 {
-		t.Fatalf("Cmd too short: %v", capturedOpts.Cmd)
-	}
-	if capturedOpts.Cmd[0] != "claude" {
-		t.Errorf("Cmd[0]: got %q, want %q", capturedOpts.Cmd[0], "claude")
+	select {
+	case container := <-stopped:
+		if container != "cldpd-myrepo" {
+			t.Errorf("Stop container: got %q, want cldpd-myrepo", container)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop not called after the context was cancelled")
 	}
-	if !strings.Contains(strings.Join(capturedOpts.Cmd, " "), issueURL) {
-		t.Errorf("Cmd does not contain issue URL %q: %v", issueURL, capturedOpts.Cmd)
+	if _, code, err := drainSession(t, s, 2*time.Second); code != 143 || err != nil {
+		t.Errorf("result: got (%d, %v), want (143, nil)", code, err)
 	}
 }
-
-func TestDispatcher_Start_ContainerName_IsDeterministic(t *testing.T) {
-	// Container name must be the deterministic cldpd-<podName>, not the session ID.
+func TestDispatcher_Start_StopTimeoutReachesRunner(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"stopTimeout":"45s"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
 
-	var capturedName string
+	stopped := make(chan struct{})
+	var gotTimeout time.Duration
 	r := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedName = opts.Name
-			return 0, nil
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			<-stopped
+			return 143, nil
+		},
+		stopFn: func(_ context.Context, _ string, timeout time.Duration, _ string) error {
+			gotTimeout = timeout
+			close(stopped)
+			return nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
@@ -253,267 +271,439 @@ func TestDispatcher_Start_ContainerName_IsDeterministic(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	drainSession(t, s, 2*time.Second)
-
-	if capturedName != "cldpd-myrepo" {
-		t.Errorf("container name: got %q, want %q", capturedName, "cldpd-myrepo")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
 	}
+	if gotTimeout != 45*time.Second {
+		t.Errorf("timeout: got %v, want 45s", gotTimeout)
+	}
+	drainSession(t, s, 2*time.Second)
 }
 
-func TestDispatcher_Start_PreambleEvents(t *testing.T) {
+func TestDispatcher_WithMetrics_StartAndExit(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-
-	r := &mockRunner{}
-	d := NewDispatcher(podsDir, r)
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			return 3, nil
+		},
+	}
+	var m MemoryMetrics
+	d := NewDispatcher(podsDir, r, WithMetrics(&m))
 
 	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	events := collectEvents(t, s.Events(), 2*time.Second)
-	waitForDone(t, s, 2*time.Second)
-
-	typeCount := make(map[EventType]int)
-	for _, e := range events {
-		typeCount[e.Type]++
-	}
-	if typeCount[EventBuildStarted] != 1 {
-		t.Errorf("EventBuildStarted: got %d, want 1", typeCount[EventBuildStarted])
-	}
-	if typeCount[EventBuildComplete] != 1 {
-		t.Errorf("EventBuildComplete: got %d, want 1", typeCount[EventBuildComplete])
-	}
-	if typeCount[EventContainerStarted] != 1 {
-		t.Errorf("EventContainerStarted: got %d, want 1", typeCount[EventContainerStarted])
-	}
-	if typeCount[EventContainerExited] != 1 {
-		t.Errorf("EventContainerExited: got %d, want 1", typeCount[EventContainerExited])
-	}
-	// BuildStarted must come before BuildComplete which must come before ContainerStarted.
-	var order []EventType
-	for _, e := range events {
-		order = append(order, e.Type)
-	}
-	if order[0] != EventBuildStarted {
-		t.Errorf("first event: got %d, want EventBuildStarted", order[0])
+	if snap := m.Snapshot(); snap.Started != 1 {
+		t.Errorf("Started after Start: got %d, want 1", snap.Started)
 	}
-	if order[1] != EventBuildComplete {
-		t.Errorf("second event: got %d, want EventBuildComplete", order[1])
+	drainSession(t, s, 2*time.Second)
+
+	snap := m.Snapshot()
+	if snap.Running != 0 || snap.Builds != 1 || snap.BuildFailures != 0 {
+		t.Errorf("got %+v, want 0 running and 1 successful build", snap)
 	}
-	if order[2] != EventContainerStarted {
-		t.Errorf("third event: got %d, want EventContainerStarted", order[2])
+	if snap.ExitCodes[3] != 1 {
+		t.Errorf("ExitCodes: got %v, want map[3:1]", snap.ExitCodes)
 	}
 }
 
-func TestDispatcher_Start_OutputEvents(t *testing.T) {
+func TestDispatcher_WithMetrics_BuildFailure(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-
 	r := &mockRunner{
-		runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
-			fmt.Fprintln(stdout, "hello from container")
-			return 0, nil
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			return ErrBuildFailed
 		},
 	}
-	d := NewDispatcher(podsDir, r)
+	var m MemoryMetrics
+	d := NewDispatcher(podsDir, r, WithMetrics(&m))
 
 	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	events := collectEvents(t, s.Events(), 2*time.Second)
-	waitForDone(t, s, 2*time.Second)
+	drainSession(t, s, 2*time.Second)
 
-	var outputEvents []Event
-	for _, e := range events {
-		if e.Type == EventOutput {
-			outputEvents = append(outputEvents, e)
-		}
+	snap := m.Snapshot()
+	if snap.BuildFailures != 1 || snap.Failed != 1 || snap.Running != 0 || snap.ExitCodes != nil {
+		t.Errorf("got %+v, want 1 failed build and 1 failed session", snap)
 	}
-	if len(outputEvents) != 1 {
-		t.Fatalf("output events: got %d, want 1", len(outputEvents))
+}
+
+// countingMetrics is a MetricsCollector that counts calls to each hook.
+type countingMetrics struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (m *countingMetrics) count(hook string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
 	}
-	if outputEvents[0].Data != "hello from container" {
-		t.Errorf("output data: got %q, want %q", outputEvents[0].Data, "hello from container")
+	m.calls[hook]++
+}
+
+func (m *countingMetrics) SessionStarted(string)                           { m.count("SessionStarted") }
+func (m *countingMetrics) BuildFinished(string, time.Duration, error)      { m.count("BuildFinished") }
+func (m *countingMetrics) ContainerStarted(string)                         { m.count("ContainerStarted") }
+func (m *countingMetrics) SessionExited(string, int, error, time.Duration) { m.count("SessionExited") }
+func (m *countingMetrics) OutputDropped(string, int64)                     { m.count("OutputDropped") }
+
+func TestDispatcher_WithMetrics_HooksFireOncePerSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		buildFn func(context.Context, string, string, BuildOptions) error
+		runFn   func(context.Context, RunOptions, io.Writer) (int, error)
+	}{
+		{"success", nil, func(_ context.Context, _ RunOptions, w io.Writer) (int, error) {
+			fmt.Fprintln(w, "working")
+			return 0, nil
+		}},
+		{"build failure", func(context.Context, string, string, BuildOptions) error {
+			return ErrBuildFailed
+		}, nil},
+		{"run error", nil, func(context.Context, RunOptions, io.Writer) (int, error) {
+			return -1, ErrDockerRunFailed
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			var m countingMetrics
+			d := NewDispatcher(podsDir, &mockRunner{buildFn: tt.buildFn, runFn: tt.runFn}, WithMetrics(&m))
+
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			for _, hook := range []string{"SessionStarted", "BuildFinished", "SessionExited", "OutputDropped"} {
+				if got := m.calls[hook]; got != 1 {
+					t.Errorf("%s: called %d times, want 1", hook, got)
+				}
+			}
+			// A failed build runs no container.
+			want := 1
+			if tt.runFn == nil {
+				want = 0
+			}
+			if got := m.calls["ContainerStarted"]; got != want {
+				t.Errorf("ContainerStarted: called %d times, want %d", got, want)
+			}
+		})
 	}
 }
 
-func TestDispatcher_Start_NonZeroExit_ViaSession(t *testing.T) {
-	// Non-zero exit code is delivered through the session, not as a Start error.
+// metricsCall is one hook call recorded by recordingMetrics.
+type metricsCall struct {
+	err  error
+	hook string
+	pod  string
+	code int
+	d    time.Duration
+}
+
+// recordingMetrics is a MetricsCollector that records every hook call in order.
+type recordingMetrics struct {
+	mu    sync.Mutex
+	calls []metricsCall
+}
+
+func (m *recordingMetrics) record(c metricsCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, c)
+}
+
+func (m *recordingMetrics) SessionStarted(pod string) {
+	m.record(metricsCall{hook: "SessionStarted", pod: pod})
+}
+
+func (m *recordingMetrics) BuildFinished(pod string, d time.Duration, err error) {
+	m.record(metricsCall{hook: "BuildFinished", pod: pod, d: d, err: err})
+}
+
+func (m *recordingMetrics) ContainerStarted(pod string) {
+	m.record(metricsCall{hook: "ContainerStarted", pod: pod})
+}
+
+func (m *recordingMetrics) SessionExited(pod string, code int, err error, d time.Duration) {
+	m.record(metricsCall{hook: "SessionExited", pod: pod, code: code, d: d, err: err})
+}
+
+func (m *recordingMetrics) OutputDropped(pod string, n int64) {
+	m.record(metricsCall{hook: "OutputDropped", pod: pod, code: int(n)})
+}
+
+func TestDispatcher_WithMetrics_Values(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-
+	runs := 0
 	r := &mockRunner{
-		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
-			return 2, nil
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		},
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			runs++
+			time.Sleep(5 * time.Millisecond)
+			if runs < 3 {
+				return 1, nil
+			}
+			return 4, nil
 		},
 	}
-	d := NewDispatcher(podsDir, r)
-
+	var m recordingMetrics
+	d := NewDispatcher(podsDir, r, WithMetrics(&m), WithRestartPolicy(2, time.Millisecond))
 	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
-		t.Fatalf("Start returned unexpected error: %v", err)
-	}
-
-	events, code, waitErr := drainSession(t, s, 2*time.Second)
-	if waitErr != nil {
-		t.Errorf("Wait error: got %v, want nil", waitErr)
-	}
-	if code != 2 {
-		t.Errorf("exit code: got %d, want 2", code)
+		t.Fatalf("unexpected error: %v", err)
 	}
+	drainSession(t, s, 2*time.Second)
 
-	var exitEvent *Event
-	for i := range events {
-		if events[i].Type == EventContainerExited {
-			exitEvent = &events[i]
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var hooks []string
+	for _, c := range m.calls {
+		hooks = append(hooks, c.hook)
+		if c.pod != "myrepo" {
+			t.Errorf("%s: pod %q, want myrepo", c.hook, c.pod)
 		}
 	}
-	if exitEvent == nil {
-		t.Fatal("no ContainerExited event")
+	want := []string{"SessionStarted", "BuildFinished", "ContainerStarted", "ContainerStarted", "ContainerStarted", "SessionExited", "OutputDropped"}
+	if !slices.Equal(hooks, want) {
+		t.Fatalf("hooks: got %v, want %v", hooks, want)
 	}
-	if exitEvent.Code != 2 {
-		t.Errorf("ContainerExited.Code: got %d, want 2", exitEvent.Code)
+	if build := m.calls[1]; build.err != nil || build.d < 5*time.Millisecond {
+		t.Errorf("BuildFinished: got %v, %v; want nil and at least 5ms", build.d, build.err)
+	}
+	if exit := m.calls[5]; exit.code != 4 || exit.err != nil || exit.d < 15*time.Millisecond {
+		t.Errorf("SessionExited: got code %d, %v, %v; want 4, nil, and at least 15ms", exit.code, exit.err, exit.d)
 	}
 }
 
-func TestDispatcher_Start_InheritEnv_MergedIntoRunOptions(t *testing.T) {
+func TestDispatcher_WithMetrics_OutputDropped(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-	dir := filepath.Join(podsDir, "myrepo")
-	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
-		[]byte(`{"inheritEnv": ["TEST_DISPATCH_VAR"]}`), 0644); err != nil {
-		t.Fatalf("write pod.json: %v", err)
-	}
-
-	t.Setenv("TEST_DISPATCH_VAR", "dispatch-value")
-
-	var capturedOpts RunOptions
+	const lines = eventChannelBuffer + 44
 	r := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedOpts = opts
+		runFn: func(_ context.Context, _ RunOptions, w io.Writer) (int, error) {
+			for i := range lines {
+				fmt.Fprintln(w, i)
+			}
 			return 0, nil
 		},
 	}
-	d := NewDispatcher(podsDir, r)
-
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	var m MemoryMetrics
+	s, err := NewDispatcher(podsDir, r, WithMetrics(&m)).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	drainSession(t, s, 2*time.Second)
+	// Let the buffer fill before reading any events.
+	waitForDone(t, s, 2*time.Second)
+	collectEvents(t, s.Events(), 2*time.Second)
 
-	if capturedOpts.Env["TEST_DISPATCH_VAR"] != "dispatch-value" {
-		t.Errorf("InheritEnv: TEST_DISPATCH_VAR not merged into Env: %v", capturedOpts.Env)
+	res, _ := s.Result()
+	want := res.DroppedLines
+	if want == 0 {
+		t.Fatal("no lines were dropped")
+	}
+	if got := m.Snapshot().DroppedLines; got != want {
+		t.Errorf("DroppedLines: got %d, want %d", got, want)
 	}
 }
 
-func TestDispatcher_Start_InheritEnv_EmptyHostVar_DeferredToDocker(t *testing.T) {
-	// If the host env var is unset, it must NOT appear in Env (eager-resolved),
-	// but MUST appear in InheritEnv (deferred to Docker as bare -e NAME).
+// recordingHandler is a slog.Handler that keeps every record it handles, with
+// the attributes added through WithAttrs folded in.
+type recordingHandler struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{mu: &sync.Mutex{}, records: &[]slog.Record{}}
+}
+
+func (*recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.mu.Lock()
+	*h.records = append(*h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &recordingHandler{mu: h.mu, records: h.records, attrs: append(slices.Clip(h.attrs), attrs...)}
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the first record with the given message, and its attributes.
+func (h *recordingHandler) find(msg string) (slog.Level, map[string]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]string)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value.String()
+			return true
+		})
+		return r.Level, attrs, true
+	}
+	return 0, nil, false
+}
+
+func TestDispatcher_WithLogger_Lifecycle(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-	dir := filepath.Join(podsDir, "myrepo")
-	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
-		[]byte(`{"inheritEnv": ["DEFINITELY_NOT_SET_XYZ123"]}`), 0644); err != nil {
-		t.Fatalf("write pod.json: %v", err)
-	}
-	os.Unsetenv("DEFINITELY_NOT_SET_XYZ123")
-
-	var capturedOpts RunOptions
 	r := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedOpts = opts
-			return 0, nil
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			return 3, nil
 		},
 	}
-	d := NewDispatcher(podsDir, r)
-
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	h := newRecordingHandler()
+	s, err := NewDispatcher(podsDir, r, WithLogger(slog.New(h))).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	if _, ok := capturedOpts.Env["DEFINITELY_NOT_SET_XYZ123"]; ok {
-		t.Error("unset InheritEnv var must not appear in RunOptions.Env")
-	}
-	found := false
-	for _, name := range capturedOpts.InheritEnv {
-		if name == "DEFINITELY_NOT_SET_XYZ123" {
-			found = true
-			break
+	for _, msg := range []string{"build started", "build finished", "container started", "container exited"} {
+		level, attrs, ok := h.find(msg)
+		if !ok {
+			t.Errorf("no %q record", msg)
+			continue
+		}
+		if level != slog.LevelDebug {
+			t.Errorf("%q: level %v, want Debug", msg, level)
+		}
+		if attrs["pod"] != "myrepo" || attrs["session"] != s.ID() || attrs["container"] != "cldpd-myrepo" {
+			t.Errorf("%q: attrs %v, want pod, session, and container", msg, attrs)
 		}
 	}
-	if !found {
-		t.Errorf("unset InheritEnv var must appear in RunOptions.InheritEnv; got %v", capturedOpts.InheritEnv)
+	if _, attrs, _ := h.find("container exited"); attrs["code"] != "3" {
+		t.Errorf("container exited: code %q, want 3", attrs["code"])
 	}
 }
 
-func TestDispatcher_Start_InheritEnv_MixedVars_TwoTierResolution(t *testing.T) {
-	// Set vars go into RunOptions.Env; unset vars go into RunOptions.InheritEnv.
+func TestDispatcher_WithLogger_Discovery(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-	dir := filepath.Join(podsDir, "myrepo")
-	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
-		[]byte(`{"inheritEnv": ["TEST_SET_VAR_ABC", "TEST_UNSET_VAR_XYZ"]}`), 0644); err != nil {
+	podJSON := `{"env":{"API_TOKEN":"s3cret"},"inheritEnv":["CLDPD_TEST_HOST_KEY","CLDPD_TEST_UNSET_KEY"]}`
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(podJSON), 0644); err != nil {
 		t.Fatalf("write pod.json: %v", err)
 	}
-
-	t.Setenv("TEST_SET_VAR_ABC", "hello")
-	os.Unsetenv("TEST_UNSET_VAR_XYZ")
-
-	var capturedOpts RunOptions
+	t.Setenv("CLDPD_TEST_HOST_KEY", "host-secret")
+	r := &mockRunner{}
+	h := newRecordingHandler()
+	s, err := NewDispatcher(podsDir, r, WithLogger(slog.New(h))).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	level, attrs, ok := h.find("pod discovered")
+	if !ok || level != slog.LevelDebug {
+		t.Fatalf("pod discovered: got %v, %v; want a Debug record", level, ok)
+	}
+	if attrs["dir"] != filepath.Join(podsDir, "myrepo") || attrs["image"] != "cldpd-myrepo" || attrs["session"] != s.ID() {
+		t.Errorf("pod discovered: attrs %v", attrs)
+	}
+
+	_, attrs, ok = h.find("environment resolved")
+	if !ok {
+		t.Fatal("no environment resolved record")
+	}
+	if attrs["env"] != "[API_TOKEN CLDPD_TEST_HOST_KEY]" || attrs["inherit"] != "[CLDPD_TEST_UNSET_KEY]" {
+		t.Errorf("environment resolved: attrs %v", attrs)
+	}
+	for k, v := range attrs {
+		if strings.Contains(v, "secret") {
+			t.Errorf("environment resolved: %s=%q carries a value", k, v)
+		}
+	}
+}
+
+func TestDispatcher_WithLogger_Warnings(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
 	r := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedOpts = opts
+		runFn: func(_ context.Context, _ RunOptions, w io.Writer) (int, error) {
+			for i := range eventChannelBuffer + 10 {
+				fmt.Fprintln(w, i)
+			}
 			return 0, nil
 		},
+		removeFn: func(_ context.Context, _ string, _ bool) error {
+			return errors.New("remove failed")
+		},
 	}
-	d := NewDispatcher(podsDir, r)
-
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	h := newRecordingHandler()
+	s, err := NewDispatcher(podsDir, r, WithLogger(slog.New(h))).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	drainSession(t, s, 2*time.Second)
+	// Let the buffer fill before reading any events.
+	waitForDone(t, s, 2*time.Second)
+	collectEvents(t, s.Events(), 2*time.Second)
 
-	// Set var must be eagerly resolved into Env.
-	if capturedOpts.Env["TEST_SET_VAR_ABC"] != "hello" {
-		t.Errorf("set InheritEnv var: Env[TEST_SET_VAR_ABC] = %q, want %q", capturedOpts.Env["TEST_SET_VAR_ABC"], "hello")
-	}
-	// Set var must NOT also appear in InheritEnv.
-	for _, name := range capturedOpts.InheritEnv {
-		if name == "TEST_SET_VAR_ABC" {
-			t.Error("set InheritEnv var must not appear in RunOptions.InheritEnv")
+	for _, msg := range []string{"output lines dropped", "container remove failed"} {
+		level, attrs, ok := h.find(msg)
+		if !ok {
+			t.Errorf("no %q record", msg)
+			continue
+		}
+		if level != slog.LevelWarn {
+			t.Errorf("%q: level %v, want Warn", msg, level)
+		}
+		if attrs["session"] != s.ID() {
+			t.Errorf("%q: session %q, want %q", msg, attrs["session"], s.ID())
 		}
 	}
-	// Unset var must NOT appear in Env.
-	if _, ok := capturedOpts.Env["TEST_UNSET_VAR_XYZ"]; ok {
-		t.Error("unset InheritEnv var must not appear in RunOptions.Env")
+}
+
+func TestDispatcher_Start_BuildFailed(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			return fmt.Errorf("%w: exit code 1", ErrBuildFailed)
+		},
 	}
-	// Unset var must appear in InheritEnv.
-	foundUnset := false
-	for _, name := range capturedOpts.InheritEnv {
-		if name == "TEST_UNSET_VAR_XYZ" {
-			foundUnset = true
-			break
-		}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: unexpected error: %v", err)
 	}
-	if !foundUnset {
-		t.Errorf("unset InheritEnv var must appear in RunOptions.InheritEnv; got %v", capturedOpts.InheritEnv)
+	events, _, err := drainSession(t, s, 2*time.Second)
+	if !errors.Is(err, ErrBuildFailed) {
+		t.Errorf("Wait: got %v, want ErrBuildFailed", err)
+	}
+	if len(events) != 2 || events[0].Type != EventBuildStarted || events[1].Type != EventError {
+		t.Errorf("events: got %v, want BuildStarted then Error", events)
 	}
 }
 
-func TestDispatcher_Start_Mounts_PassedThrough(t *testing.T) {
+func TestDispatcher_Start_RunOptions_Image(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
-	dir := filepath.Join(podsDir, "myrepo")
-	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
-		[]byte(`{"mounts": [{"source": "/host/keys", "target": "/root/.ssh", "readOnly": true}]}`), 0644); err != nil {
-		t.Fatalf("write pod.json: %v", err)
-	}
 
 	var capturedOpts RunOptions
 	r := &mockRunner{
@@ -524,176 +714,344 @@ func TestDispatcher_Start_Mounts_PassedThrough(t *testing.T) {
 	}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	issueURL := "https://github.com/org/repo/issues/42"
+	s, err := d.Start(context.Background(), "myrepo", issueURL)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	if len(capturedOpts.Mounts) != 1 {
-		t.Fatalf("Mounts: got %d, want 1", len(capturedOpts.Mounts))
+	if capturedOpts.Image != "cldpd-myrepo" {
+		t.Errorf("image: got %q, want %q", capturedOpts.Image, "cldpd-myrepo")
 	}
-	if capturedOpts.Mounts[0].Source != "/host/keys" {
-		t.Errorf("Mount.Source: got %q, want %q", capturedOpts.Mounts[0].Source, "/host/keys")
+	if capturedOpts.Remove {
+		t.Error("Remove: got true, want false; the session removes the container")
 	}
-	if !capturedOpts.Mounts[0].ReadOnly {
-		t.Error("Mount.ReadOnly: got false, want true")
+	if len(capturedOpts.Cmd) < 3 {
+		t.Fatalf("Cmd too short: %v", capturedOpts.Cmd)
+	}
+	if capturedOpts.Cmd[0] != "claude" {
+		t.Errorf("Cmd[0]: got %q, want %q", capturedOpts.Cmd[0], "claude")
+	}
+	if !strings.Contains(strings.Join(capturedOpts.Cmd, " "), issueURL) {
+		t.Errorf("Cmd does not contain issue URL %q: %v", issueURL, capturedOpts.Cmd)
 	}
 }
 
-func TestDispatcher_Start_ConcurrentCalls_DeterministicContainerNames(t *testing.T) {
-	// Two Start calls for the same pod must produce the same deterministic container name.
-	// Session IDs remain unique; the container name does not.
+func TestDispatcher_Start_IssueShorthand(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
 
-	var names []string
-	var sessionIDs []string
+	var capturedCmd []string
 	r := &mockRunner{
 		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			names = append(names, opts.Name)
+			capturedCmd = opts.Cmd
 			return 0, nil
 		},
 	}
-	d := NewDispatcher(podsDir, r)
-
-	s1, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "org/repo#42")
 	if err != nil {
-		t.Fatalf("first Start: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
-	sessionIDs = append(sessionIDs, s1.ID())
-	drainSession(t, s1, 2*time.Second)
+	drainSession(t, s, 2*time.Second)
 
-	s2, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
-	if err != nil {
-		t.Fatalf("second Start: %v", err)
+	want := "Work on this GitHub issue: https://github.com/org/repo/issues/42"
+	if len(capturedCmd) < 3 || capturedCmd[2] != want {
+		t.Errorf("prompt: got %v, want %q", capturedCmd, want)
 	}
-	sessionIDs = append(sessionIDs, s2.ID())
-	drainSession(t, s2, 2*time.Second)
+}
 
-	if len(names) != 2 {
-		t.Fatalf("expected 2 container names, got %d", len(names))
-	}
-	// Container names must be identical (deterministic).
-	if names[0] != names[1] {
-		t.Errorf("container names differ: %q vs %q; want both %q", names[0], names[1], "cldpd-myrepo")
-	}
-	if names[0] != "cldpd-myrepo" {
-		t.Errorf("container name: got %q, want %q", names[0], "cldpd-myrepo")
-	}
-	// Session IDs must remain unique.
-	if sessionIDs[0] == sessionIDs[1] {
-		t.Errorf("session IDs must be unique, both were %q", sessionIDs[0])
+// issueFetcherFunc adapts a function to IssueFetcher.
+type issueFetcherFunc func(ctx context.Context, ref IssueRef) (Issue, error)
+
+func (f issueFetcherFunc) FetchIssue(ctx context.Context, ref IssueRef) (Issue, error) {
+	return f(ctx, ref)
+}
+
+func TestDispatcher_Start_FetchIssue(t *testing.T) {
+	tests := []struct {
+		name        string
+		podJSON     string
+		opts        StartOptions
+		fetchErr    error
+		wantFetch   bool
+		wantPrompt  string
+		wantWarning bool
+	}{
+		{"off", "", StartOptions{}, nil, false,
+			"Standing orders.\n\nWork on this GitHub issue: https://github.com/org/repo/issues/4", false},
+		{"pod", `{"fetchIssue": true}`, StartOptions{}, nil, true,
+			"Standing orders.\n\nWork on this GitHub issue: https://github.com/org/repo/issues/4\n\nTitle: Login fails\nLabels: bug\n\nBroken.", false},
+		{"start option", "", StartOptions{FetchIssue: true}, nil, true,
+			"Standing orders.\n\nWork on this GitHub issue: https://github.com/org/repo/issues/4\n\nTitle: Login fails\nLabels: bug\n\nBroken.", false},
+		{"fetch fails", `{"fetchIssue": true}`, StartOptions{}, errors.New("gh: executable file not found"), true,
+			"Standing orders.\n\nWork on this GitHub issue: https://github.com/org/repo/issues/4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "template.md"), []byte("Standing orders."), 0644); err != nil {
+				t.Fatalf("write template.md: %v", err)
+			}
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			var fetched bool
+			fetcher := issueFetcherFunc(func(_ context.Context, ref IssueRef) (Issue, error) {
+				fetched = true
+				if ref.Number != 4 {
+					t.Errorf("FetchIssue ref: got %+v, want issue 4", ref)
+				}
+				return Issue{Title: "Login fails", Body: "Broken.", Labels: []string{"bug"}}, tt.fetchErr
+			})
+			var capturedCmd []string
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					capturedCmd = opts.Cmd
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithIssueFetcher(fetcher))
+
+			s, err := d.StartWith(context.Background(), "myrepo", "org/repo#4", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, code, _ := drainSession(t, s, 2*time.Second)
+
+			if code != 0 {
+				t.Errorf("exit code: got %d, want 0", code)
+			}
+			if fetched != tt.wantFetch {
+				t.Errorf("fetched: got %v, want %v", fetched, tt.wantFetch)
+			}
+			if len(capturedCmd) < 3 || capturedCmd[2] != tt.wantPrompt {
+				t.Errorf("prompt: got %q, want %q", capturedCmd, tt.wantPrompt)
+			}
+			var warned bool
+			for _, e := range events {
+				if e.Type == EventWarning && strings.Contains(e.Data, "fetch issue") {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarning {
+				t.Errorf("fetch warning: got %v, want %v", warned, tt.wantWarning)
+			}
+		})
 	}
 }
 
-func TestDispatcher_Resume_ContainerName(t *testing.T) {
+func TestDispatcher_Start_SessionStore(t *testing.T) {
 	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	storeDir := filepath.Join(t.TempDir(), "sessions")
 
-	var execContainer string
+	running := make(chan struct{})
+	halt := make(chan struct{})
 	r := &mockRunner{
-		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
-			execContainer = container
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			close(running)
+			<-halt
 			return 0, nil
 		},
 	}
-	d := NewDispatcher(podsDir, r)
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithSessionStore(NewSessionStore(storeDir)))
 
-	s, err := d.Resume(context.Background(), "myrepo", "do more work")
+	s, err := d.Start(context.Background(), "myrepo", "org/repo#4")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	drainSession(t, s, 2*time.Second)
+	<-running
 
-	if execContainer != "cldpd-myrepo" {
-		t.Errorf("container: got %q, want %q", execContainer, "cldpd-myrepo")
+	records, err := LoadSessions(storeDir)
+	if err != nil {
+		t.Fatalf("LoadSessions: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("records while running: got %d, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.ID != s.ID() || rec.Pod != "myrepo" || rec.Container != "cldpd-myrepo" || rec.IssueURL != "https://github.com/org/repo/issues/4" {
+		t.Errorf("record: got %+v", rec)
+	}
+	if rec.StartedAt.IsZero() {
+		t.Error("record StartedAt: got zero time")
+	}
+
+	close(halt)
+	drainSession(t, s, 2*time.Second)
+	records, err = LoadSessions(storeDir)
+	if err != nil || len(records) != 0 {
+		t.Errorf("records after exit: got %+v, %v; want none", records, err)
 	}
 }
 
-func TestDispatcher_Start_Resume_RoundTrip(t *testing.T) {
-	// Start and Resume for the same pod must target the same container name.
-	// This is the round-trip test: proves the naming schemes are compatible.
+func TestDispatcher_StartWith_AnnotationsPersisted(t *testing.T) {
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
+	storeDir := filepath.Join(t.TempDir(), "sessions")
 
-	var startContainer string
-	var resumeContainer string
-
-	startRunner := &mockRunner{
-		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			startContainer = opts.Name
+	running := make(chan struct{})
+	halt := make(chan struct{})
+	r := &mockRunner{
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			close(running)
+			<-halt
 			return 0, nil
 		},
 	}
-	d := NewDispatcher(podsDir, startRunner)
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithSessionStore(NewSessionStore(storeDir)))
 
-	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	initial := map[string]string{"check-run": "42"}
+	s, err := d.StartWith(context.Background(), "myrepo", "org/repo#4", StartOptions{Annotations: initial})
 	if err != nil {
-		t.Fatalf("Start: unexpected error: %v", err)
+		t.Fatalf("unexpected error: %v", err)
+	}
+	initial["check-run"] = "changed by caller"
+	if got := s.Annotations(); !maps.Equal(got, map[string]string{"check-run": "42"}) {
+		t.Errorf("Annotations: got %v, want the initial annotations", got)
+	}
+
+	records, err := LoadSessions(storeDir)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("LoadSessions: got %+v, %v", records, err)
+	}
+	if !maps.Equal(records[0].Annotations, map[string]string{"check-run": "42"}) {
+		t.Errorf("first record annotations: got %v", records[0].Annotations)
+	}
+
+	<-running
+	if err := s.SetAnnotation("panel", "left"); err != nil {
+		t.Fatalf("SetAnnotation: %v", err)
 	}
+	records, err = LoadSessions(storeDir)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("LoadSessions: got %+v, %v", records, err)
+	}
+	if want := map[string]string{"check-run": "42", "panel": "left"}; !maps.Equal(records[0].Annotations, want) {
+		t.Errorf("record annotations after SetAnnotation: got %v, want %v", records[0].Annotations, want)
+	}
+
+	close(halt)
 	drainSession(t, s, 2*time.Second)
+	// An annotation set after the session ended must not bring its record back.
+	if err := s.SetAnnotation("late", "x"); err != nil {
+		t.Fatalf("SetAnnotation after exit: %v", err)
+	}
+	if records, err := LoadSessions(storeDir); err != nil || len(records) != 0 {
+		t.Errorf("records after exit: got %+v, %v; want none", records, err)
+	}
+}
 
-	resumeRunner := &mockRunner{
-		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
-			resumeContainer = container
-			return 0, nil
-		},
+func TestDispatcher_StartWith_AnnotationsBounded(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	d := NewDispatcher(podsDir, &mockRunner{})
+
+	tooMany := make(map[string]string, maxAnnotations+1)
+	for i := range maxAnnotations + 1 {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	for name, annotations := range map[string]map[string]string{
+		"too many":   tooMany,
+		"empty key":  {"": "v"},
+		"long value": {"k": strings.Repeat("x", maxAnnotationValueLen+1)},
+	} {
+		_, err := d.StartWith(context.Background(), "myrepo", "org/repo#4", StartOptions{Annotations: annotations})
+		if !errors.Is(err, ErrAnnotationLimit) {
+			t.Errorf("%s: got %v, want ErrAnnotationLimit", name, err)
+		}
 	}
-	d2 := NewDispatcher(podsDir, resumeRunner)
+}
 
-	r, err := d2.Resume(context.Background(), "myrepo", "continue")
-	if err != nil {
-		t.Fatalf("Resume: unexpected error: %v", err)
+func TestDispatcher_Start_SessionStoreSaveFails(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("write file: %v", err)
 	}
-	drainSession(t, r, 2*time.Second)
 
-	if startContainer == "" {
-		t.Fatal("Start did not capture container name")
+	var ran bool
+	r := &mockRunner{
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			ran = true
+			return 0, nil
+		},
 	}
-	if resumeContainer == "" {
-		t.Fatal("Resume did not capture container name")
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithSessionStore(NewSessionStore(filepath.Join(file, "sessions"))))
+
+	if _, err := d.Start(context.Background(), "myrepo", "org/repo#4"); err == nil {
+		t.Fatal("Start: got nil error, want the save error")
 	}
-	if startContainer != resumeContainer {
-		t.Errorf("container name mismatch: Start used %q, Resume used %q", startContainer, resumeContainer)
+	if ran {
+		t.Error("container run although the session record could not be saved")
 	}
 }
 
-func TestDispatcher_Resume_Command(t *testing.T) {
+func TestDispatcher_Start_InvalidIssueURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		issueURL string
+	}{
+		{"typo", "https://github.com/org/repo/isues/42"},
+		{"not a URL", "fix the login bug"},
+		{"pull request", "https://github.com/org/repo/pull/42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			r := &mockRunner{
+				buildFn: func(context.Context, string, string, BuildOptions) error {
+					t.Error("Build called for an invalid issue URL")
+					return nil
+				},
+			}
+			_, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", tt.issueURL)
+			if !errors.Is(err, ErrInvalidIssueURL) {
+				t.Errorf("Start(%q): got %v, want ErrInvalidIssueURL", tt.issueURL, err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_ContainerName_IsDeterministic(t *testing.T) {
+	// Container name must be the deterministic cldpd-<podName>, not the session ID.
 	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
 
-	var execCmd []string
+	var capturedName string
 	r := &mockRunner{
-		execFn: func(_ context.Context, _ string, cmd []string, _ io.Writer) (int, error) {
-			execCmd = cmd
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedName = opts.Name
 			return 0, nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Resume(context.Background(), "myrepo", "do more work")
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	want := []string{"claude", "--resume", "-p", "do more work"}
-	if len(execCmd) != len(want) {
-		t.Fatalf("cmd: got %v, want %v", execCmd, want)
-	}
-	for i := range want {
-		if execCmd[i] != want[i] {
-			t.Errorf("cmd[%d]: got %q, want %q", i, execCmd[i], want[i])
-		}
+	if capturedName != "cldpd-myrepo" {
+		t.Errorf("container name: got %q, want %q", capturedName, "cldpd-myrepo")
 	}
 }
 
-func TestDispatcher_Resume_PreambleIsContainerStartedOnly(t *testing.T) {
+func TestDispatcher_Start_PreambleEvents(t *testing.T) {
 	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
 
 	r := &mockRunner{}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Resume(context.Background(), "myrepo", "prompt")
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -704,63 +1062,47 @@ func TestDispatcher_Resume_PreambleIsContainerStartedOnly(t *testing.T) {
 	for _, e := range events {
 		typeCount[e.Type]++
 	}
-	if typeCount[EventBuildStarted] != 0 {
-		t.Errorf("EventBuildStarted: got %d, want 0 (Resume does not build)", typeCount[EventBuildStarted])
+	if typeCount[EventBuildStarted] != 1 {
+		t.Errorf("EventBuildStarted: got %d, want 1", typeCount[EventBuildStarted])
 	}
-	if typeCount[EventBuildComplete] != 0 {
-		t.Errorf("EventBuildComplete: got %d, want 0", typeCount[EventBuildComplete])
+	if typeCount[EventBuildComplete] != 1 {
+		t.Errorf("EventBuildComplete: got %d, want 1", typeCount[EventBuildComplete])
 	}
 	if typeCount[EventContainerStarted] != 1 {
 		t.Errorf("EventContainerStarted: got %d, want 1", typeCount[EventContainerStarted])
 	}
-}
-
-func TestDispatcher_Resume_ExecError_ViaSession(t *testing.T) {
-	// ErrSessionNotFound from runner.Exec comes through the session event stream.
-	podsDir := t.TempDir()
-
-	r := &mockRunner{
-		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
-			return -1, fmt.Errorf("%w: %s", ErrSessionNotFound, container)
-		},
+	if typeCount[EventContainerExited] != 1 {
+		t.Errorf("EventContainerExited: got %d, want 1", typeCount[EventContainerExited])
 	}
-	d := NewDispatcher(podsDir, r)
-
-	s, err := d.Resume(context.Background(), "ghost", "guidance")
-	if err != nil {
-		t.Fatalf("Resume returned unexpected error: %v", err)
+	// BuildStarted must come before BuildComplete which must come before ContainerStarted.
+	var order []EventType
+	for _, e := range events {
+		order = append(order, e.Type)
 	}
-
-	events := collectEvents(t, s.Events(), 2*time.Second)
-	_, waitErr := waitForDone(t, s, 2*time.Second)
-
-	if !errors.Is(waitErr, ErrSessionNotFound) {
-		t.Errorf("Wait err: got %v, want ErrSessionNotFound", waitErr)
+	if order[0] != EventBuildStarted {
+		t.Errorf("first event: got %d, want EventBuildStarted", order[0])
 	}
-
-	var errEvent *Event
-	for i := range events {
-		if events[i].Type == EventError {
-			errEvent = &events[i]
-		}
+	if order[1] != EventBuildComplete {
+		t.Errorf("second event: got %d, want EventBuildComplete", order[1])
 	}
-	if errEvent == nil {
-		t.Error("no EventError in session stream for exec failure")
+	if order[2] != EventContainerStarted {
+		t.Errorf("third event: got %d, want EventContainerStarted", order[2])
 	}
 }
 
-func TestDispatcher_Resume_OutputEvents(t *testing.T) {
+func TestDispatcher_Start_OutputEvents(t *testing.T) {
 	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
 
 	r := &mockRunner{
-		execFn: func(_ context.Context, _ string, _ []string, stdout io.Writer) (int, error) {
-			fmt.Fprintln(stdout, "resume output line")
+		runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, "hello from container")
 			return 0, nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Resume(context.Background(), "myrepo", "guidance")
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -776,115 +1118,3692 @@ func TestDispatcher_Resume_OutputEvents(t *testing.T) {
 	if len(outputEvents) != 1 {
 		t.Fatalf("output events: got %d, want 1", len(outputEvents))
 	}
-	if outputEvents[0].Data != "resume output line" {
-		t.Errorf("output: got %q, want %q", outputEvents[0].Data, "resume output line")
+	if outputEvents[0].Data != "hello from container" {
+		t.Errorf("output data: got %q, want %q", outputEvents[0].Data, "hello from container")
 	}
 }
 
-// makeTestPodWithTemplate creates a pod directory with a Dockerfile and a template.md.
-func makeTestPodWithTemplate(t *testing.T, podsDir, name, templateContent string) {
-	t.Helper()
-	makeTestPod(t, podsDir, name)
-	dir := filepath.Join(podsDir, name)
-	if err := os.WriteFile(filepath.Join(dir, "template.md"), []byte(templateContent), 0644); err != nil {
-		t.Fatalf("write template.md: %v", err)
+func TestDispatcher_Start_NonZeroExit_ViaSession(t *testing.T) {
+	// Non-zero exit code is delivered through the session, not as a Start error.
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			return 2, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start returned unexpected error: %v", err)
+	}
+
+	events, code, waitErr := drainSession(t, s, 2*time.Second)
+	if waitErr != nil {
+		t.Errorf("Wait error: got %v, want nil", waitErr)
+	}
+	if code != 2 {
+		t.Errorf("exit code: got %d, want 2", code)
+	}
+
+	var exitEvent *Event
+	for i := range events {
+		if events[i].Type == EventContainerExited {
+			exitEvent = &events[i]
+		}
+	}
+	if exitEvent == nil {
+		t.Fatal("no ContainerExited event")
+	}
+	if exitEvent.Code != 2 {
+		t.Errorf("ContainerExited.Code: got %d, want 2", exitEvent.Code)
 	}
 }
 
-func TestDispatcher_Start_Prompt_WithTemplate(t *testing.T) {
+func TestDispatcher_Start_InheritEnv_MergedIntoRunOptions(t *testing.T) {
 	podsDir := t.TempDir()
-	makeTestPodWithTemplate(t, podsDir, "myrepo", "# Standing Orders\n\nEnsure origin is up to date.")
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
+		[]byte(`{"inheritEnv": ["TEST_DISPATCH_VAR"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
 
-	var capturedCmd []string
+	t.Setenv("TEST_DISPATCH_VAR", "dispatch-value")
+
+	var capturedOpts RunOptions
 	r := &mockRunner{
 		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedCmd = opts.Cmd
+			capturedOpts = opts
 			return 0, nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	issueURL := "https://github.com/org/repo/issues/99"
-	s, err := d.Start(context.Background(), "myrepo", issueURL)
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	if len(capturedCmd) < 3 {
-		t.Fatalf("Cmd too short: %v", capturedCmd)
+	if capturedOpts.Env["TEST_DISPATCH_VAR"] != "dispatch-value" {
+		t.Errorf("InheritEnv: TEST_DISPATCH_VAR not merged into Env: %v", capturedOpts.Env)
 	}
-	// The prompt is the last element of the claude -p <prompt> command.
-	prompt := capturedCmd[len(capturedCmd)-1]
-	wantPrefix := "# Standing Orders\n\nEnsure origin is up to date."
-	wantSuffix := "Work on this GitHub issue: " + issueURL
-	if !strings.HasPrefix(prompt, wantPrefix) {
-		t.Errorf("prompt does not start with template:\ngot:  %q\nwant prefix: %q", prompt, wantPrefix)
+}
+
+func TestDispatcher_Start_InheritEnv_EmptyHostVar_DeferredToDocker(t *testing.T) {
+	// If the host env var is unset, it must NOT appear in Env (eager-resolved),
+	// but MUST appear in InheritEnv (deferred to Docker as bare -e NAME).
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
+		[]byte(`{"inheritEnv": ["DEFINITELY_NOT_SET_XYZ123"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
 	}
-	if !strings.HasSuffix(prompt, wantSuffix) {
-		t.Errorf("prompt does not end with base prompt:\ngot:  %q\nwant suffix: %q", prompt, wantSuffix)
+	os.Unsetenv("DEFINITELY_NOT_SET_XYZ123")
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
 	}
-	wantFull := wantPrefix + "\n\n" + wantSuffix
-	if prompt != wantFull {
-		t.Errorf("prompt:\ngot:  %q\nwant: %q", prompt, wantFull)
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if _, ok := capturedOpts.Env["DEFINITELY_NOT_SET_XYZ123"]; ok {
+		t.Error("unset InheritEnv var must not appear in RunOptions.Env")
+	}
+	found := false
+	for _, name := range capturedOpts.InheritEnv {
+		if name == "DEFINITELY_NOT_SET_XYZ123" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("unset InheritEnv var must appear in RunOptions.InheritEnv; got %v", capturedOpts.InheritEnv)
 	}
 }
 
-func TestDispatcher_Start_Prompt_WithoutTemplate(t *testing.T) {
+func TestDispatcher_Start_InheritEnv_MixedVars_TwoTierResolution(t *testing.T) {
+	// Set vars go into RunOptions.Env; unset vars go into RunOptions.InheritEnv.
 	podsDir := t.TempDir()
 	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
+		[]byte(`{"inheritEnv": ["TEST_SET_VAR_ABC", "TEST_UNSET_VAR_XYZ"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
 
-	var capturedCmd []string
+	t.Setenv("TEST_SET_VAR_ABC", "hello")
+	os.Unsetenv("TEST_UNSET_VAR_XYZ")
+
+	var capturedOpts RunOptions
 	r := &mockRunner{
 		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
-			capturedCmd = opts.Cmd
+			capturedOpts = opts
 			return 0, nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	issueURL := "https://github.com/org/repo/issues/7"
-	s, err := d.Start(context.Background(), "myrepo", issueURL)
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	if len(capturedCmd) < 3 {
-		t.Fatalf("Cmd too short: %v", capturedCmd)
+	// Set var must be eagerly resolved into Env.
+	if capturedOpts.Env["TEST_SET_VAR_ABC"] != "hello" {
+		t.Errorf("set InheritEnv var: Env[TEST_SET_VAR_ABC] = %q, want %q", capturedOpts.Env["TEST_SET_VAR_ABC"], "hello")
 	}
-	prompt := capturedCmd[len(capturedCmd)-1]
-	want := "Work on this GitHub issue: " + issueURL
-	if prompt != want {
-		t.Errorf("prompt:\ngot:  %q\nwant: %q", prompt, want)
+	// Set var must NOT also appear in InheritEnv.
+	for _, name := range capturedOpts.InheritEnv {
+		if name == "TEST_SET_VAR_ABC" {
+			t.Error("set InheritEnv var must not appear in RunOptions.InheritEnv")
+		}
+	}
+	// Unset var must NOT appear in Env.
+	if _, ok := capturedOpts.Env["TEST_UNSET_VAR_XYZ"]; ok {
+		t.Error("unset InheritEnv var must not appear in RunOptions.Env")
+	}
+	// Unset var must appear in InheritEnv.
+	foundUnset := false
+	for _, name := range capturedOpts.InheritEnv {
+		if name == "TEST_UNSET_VAR_XYZ" {
+			foundUnset = true
+			break
+		}
+	}
+	if !foundUnset {
+		t.Errorf("unset InheritEnv var must appear in RunOptions.InheritEnv; got %v", capturedOpts.InheritEnv)
 	}
 }
 
-func TestDispatcher_Resume_Prompt_NoTemplateUsed(t *testing.T) {
-	// Resume passes the caller's prompt directly; no template is applied.
+func TestDispatcher_Start_Mounts_PassedThrough(t *testing.T) {
 	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"),
+		[]byte(`{"mounts": [{"source": "/host/keys", "target": "/root/.ssh", "readOnly": true}]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
 
-	var capturedCmd []string
+	var capturedOpts RunOptions
 	r := &mockRunner{
-		execFn: func(_ context.Context, _ string, cmd []string, _ io.Writer) (int, error) {
-			capturedCmd = cmd
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
 			return 0, nil
 		},
 	}
 	d := NewDispatcher(podsDir, r)
 
-	s, err := d.Resume(context.Background(), "myrepo", "continue where you left off")
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	drainSession(t, s, 2*time.Second)
 
-	if len(capturedCmd) < 4 {
-		t.Fatalf("cmd too short: %v", capturedCmd)
+	if len(capturedOpts.Mounts) != 1 {
+		t.Fatalf("Mounts: got %d, want 1", len(capturedOpts.Mounts))
 	}
-	prompt := capturedCmd[len(capturedCmd)-1]
-	want := "continue where you left off"
-	if prompt != want {
-		t.Errorf("resume prompt:\ngot:  %q\nwant: %q", prompt, want)
+	if capturedOpts.Mounts[0].Source != "/host/keys" {
+		t.Errorf("Mount.Source: got %q, want %q", capturedOpts.Mounts[0].Source, "/host/keys")
+	}
+	if !capturedOpts.Mounts[0].ReadOnly {
+		t.Error("Mount.ReadOnly: got false, want true")
+	}
+}
+
+func TestDispatcher_Start_Ports_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"ports": ["8080:80"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if len(capturedOpts.Ports) != 1 || capturedOpts.Ports[0] != "8080:80" {
+		t.Errorf("Ports: got %v, want [8080:80]", capturedOpts.Ports)
+	}
+}
+
+func TestDispatcher_Start_Tmpfs_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"tmpfs": ["/tmp", "/scratch:size=512m"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if want := []string{"/tmp", "/scratch:size=512m"}; !slices.Equal(capturedOpts.Tmpfs, want) {
+		t.Errorf("Tmpfs: got %v, want %v", capturedOpts.Tmpfs, want)
+	}
+}
+
+func TestSecurityOpts(t *testing.T) {
+	cases := []struct {
+		config PodConfig
+		want   []string
+	}{
+		{PodConfig{}, nil},
+		{PodConfig{SeccompProfile: "unconfined"}, []string{"seccomp=unconfined"}},
+		{PodConfig{ApparmorProfile: "cldpd"}, []string{"apparmor=cldpd"}},
+		{
+			PodConfig{SeccompProfile: "/etc/cldpd/seccomp.json", ApparmorProfile: "cldpd"},
+			[]string{"seccomp=/etc/cldpd/seccomp.json", "apparmor=cldpd"},
+		},
+	}
+	for _, tc := range cases {
+		got := securityOpts(tc.config)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("securityOpts(%+v): got %v, want %v", tc.config, got, tc.want)
+		}
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	for _, user := range []string{"", "1000", "1000:1000", "agent"} {
+		got, err := resolveUser(user)
+		if err != nil {
+			t.Fatalf("resolveUser(%q): unexpected error: %v", user, err)
+		}
+		if got != user {
+			t.Errorf("resolveUser(%q): got %q, want unchanged", user, got)
+		}
+	}
+}
+
+func TestResolveUser_Host(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if _, err := resolveUser("host"); err == nil {
+			t.Error("expected error for host user on windows, got nil")
+		}
+		return
+	}
+	got, err := resolveUser("host")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	if got != want {
+		t.Errorf("resolveUser(host): got %q, want %q", got, want)
+	}
+}
+
+func TestDispatcher_Start_ExtraHosts_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"extraHosts": ["api.local:192.168.1.5"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if !slices.Equal(capturedOpts.ExtraHosts, []string{"api.local:192.168.1.5"}) {
+		t.Errorf("ExtraHosts: got %v, want [api.local:192.168.1.5]", capturedOpts.ExtraHosts)
+	}
+}
+
+func TestDispatcher_Start_BuildSecrets_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"buildSecrets": [{"id": "gh", "src": "/run/secrets/gh"}]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	fb := &fakeBuilder{}
+	s, err := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb)).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	want := []BuildSecret{{ID: "gh", Src: "/run/secrets/gh"}}
+	if !slices.Equal(fb.opts.Secrets, want) {
+		t.Errorf("Secrets: got %v, want %v", fb.opts.Secrets, want)
+	}
+}
+
+func TestDispatcher_Start_Hostname_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"hostname": "agent-1"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if capturedOpts.Hostname != "agent-1" {
+		t.Errorf("Hostname: got %q, want agent-1", capturedOpts.Hostname)
+	}
+}
+
+func TestDispatcher_Start_CapAddAndPrivileged_PassedThrough(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"capAdd": ["SYS_ADMIN"], "privileged": true}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if !slices.Equal(capturedOpts.CapAdd, []string{"SYS_ADMIN"}) || !capturedOpts.Privileged {
+		t.Errorf("got CapAdd %v, Privileged %v; want [SYS_ADMIN], true", capturedOpts.CapAdd, capturedOpts.Privileged)
+	}
+}
+
+func TestDispatcher_Start_User_PassedThrough(t *testing.T) {
+	cases := []struct {
+		config string
+		want   string
+	}{
+		{`{}`, ""},
+		{`{"user": "1000:1000"}`, "1000:1000"},
+	}
+	for _, tc := range cases {
+		podsDir := t.TempDir()
+		makeTestPod(t, podsDir, "myrepo")
+		if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tc.config), 0644); err != nil {
+			t.Fatalf("write pod.json: %v", err)
+		}
+
+		var capturedOpts RunOptions
+		r := &mockRunner{
+			runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+				capturedOpts = opts
+				return 0, nil
+			},
+		}
+		s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		drainSession(t, s, 2*time.Second)
+
+		if capturedOpts.User != tc.want {
+			t.Errorf("pod.json %s: User got %q, want %q", tc.config, capturedOpts.User, tc.want)
+		}
+	}
+}
+
+func TestDispatcher_Start_ConcurrentCalls_DeterministicContainerNames(t *testing.T) {
+	// Two Start calls for the same pod must produce the same deterministic container name.
+	// Session IDs remain unique; the container name does not.
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var names []string
+	var sessionIDs []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			names = append(names, opts.Name)
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s1, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("first Start: %v", err)
+	}
+	sessionIDs = append(sessionIDs, s1.ID())
+	drainSession(t, s1, 2*time.Second)
+
+	s2, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("second Start: %v", err)
+	}
+	sessionIDs = append(sessionIDs, s2.ID())
+	drainSession(t, s2, 2*time.Second)
+
+	if len(names) != 2 {
+		t.Fatalf("expected 2 container names, got %d", len(names))
+	}
+	// Container names must be identical (deterministic).
+	if names[0] != names[1] {
+		t.Errorf("container names differ: %q vs %q; want both %q", names[0], names[1], "cldpd-myrepo")
+	}
+	if names[0] != "cldpd-myrepo" {
+		t.Errorf("container name: got %q, want %q", names[0], "cldpd-myrepo")
+	}
+	// Session IDs must remain unique.
+	if sessionIDs[0] == sessionIDs[1] {
+		t.Errorf("session IDs must be unique, both were %q", sessionIDs[0])
+	}
+}
+
+func TestDispatcher_Resume_ContainerName(t *testing.T) {
+	podsDir := t.TempDir()
+
+	var execContainer string
+	r := &mockRunner{
+		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+			execContainer = container
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "do more work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if execContainer != "cldpd-myrepo" {
+		t.Errorf("container: got %q, want %q", execContainer, "cldpd-myrepo")
+	}
+}
+
+func TestDispatcher_Start_Resume_RoundTrip(t *testing.T) {
+	// Start and Resume for the same pod must target the same container name.
+	// This is the round-trip test: proves the naming schemes are compatible.
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var startContainer string
+	var resumeContainer string
+
+	startRunner := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			startContainer = opts.Name
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, startRunner)
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	resumeRunner := &mockRunner{
+		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+			resumeContainer = container
+			return 0, nil
+		},
+	}
+	d2 := NewDispatcher(podsDir, resumeRunner)
+
+	r, err := d2.Resume(context.Background(), "myrepo", "continue")
+	if err != nil {
+		t.Fatalf("Resume: unexpected error: %v", err)
+	}
+	drainSession(t, r, 2*time.Second)
+
+	if startContainer == "" {
+		t.Fatal("Start did not capture container name")
+	}
+	if resumeContainer == "" {
+		t.Fatal("Resume did not capture container name")
+	}
+	if startContainer != resumeContainer {
+		t.Errorf("container name mismatch: Start used %q, Resume used %q", startContainer, resumeContainer)
+	}
+}
+
+func TestDispatcher_Resume_Command(t *testing.T) {
+	podsDir := t.TempDir()
+
+	var execCmd []string
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, cmd []string, _ io.Writer) (int, error) {
+			execCmd = cmd
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "do more work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	want := []string{"claude", "--resume", "-p", "do more work"}
+	if len(execCmd) != len(want) {
+		t.Fatalf("cmd: got %v, want %v", execCmd, want)
+	}
+	for i := range want {
+		if execCmd[i] != want[i] {
+			t.Errorf("cmd[%d]: got %q, want %q", i, execCmd[i], want[i])
+		}
+	}
+}
+
+func TestDispatcher_Resume_BlankPrompt(t *testing.T) {
+	r := &mockRunner{
+		execFn: func(context.Context, string, []string, io.Writer) (int, error) {
+			t.Error("Exec called for a blank prompt")
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+	for _, prompt := range []string{"", "   ", "\n\t"} {
+		if _, err := d.Resume(context.Background(), "myrepo", prompt); !errors.Is(err, ErrEmptyPrompt) {
+			t.Errorf("Resume(%q): got %v, want ErrEmptyPrompt", prompt, err)
+		}
+	}
+}
+
+func TestDispatcher_Resume_PreambleIsContainerStartedOnly(t *testing.T) {
+	podsDir := t.TempDir()
+
+	r := &mockRunner{}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	typeCount := make(map[EventType]int)
+	for _, e := range events {
+		typeCount[e.Type]++
+	}
+	if typeCount[EventBuildStarted] != 0 {
+		t.Errorf("EventBuildStarted: got %d, want 0 (Resume does not build)", typeCount[EventBuildStarted])
+	}
+	if typeCount[EventBuildComplete] != 0 {
+		t.Errorf("EventBuildComplete: got %d, want 0", typeCount[EventBuildComplete])
+	}
+	if typeCount[EventContainerStarted] != 1 {
+		t.Errorf("EventContainerStarted: got %d, want 1", typeCount[EventContainerStarted])
+	}
+}
+
+func TestDispatcher_Resume_ExecError_ViaSession(t *testing.T) {
+	// ErrSessionNotFound from runner.Exec comes through the session event stream.
+	podsDir := t.TempDir()
+
+	r := &mockRunner{
+		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+			return -1, fmt.Errorf("%w: %s", ErrSessionNotFound, container)
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "ghost", "guidance")
+	if err != nil {
+		t.Fatalf("Resume returned unexpected error: %v", err)
+	}
+
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	_, waitErr := waitForDone(t, s, 2*time.Second)
+
+	if !errors.Is(waitErr, ErrSessionNotFound) {
+		t.Errorf("Wait err: got %v, want ErrSessionNotFound", waitErr)
+	}
+
+	var errEvent *Event
+	for i := range events {
+		if events[i].Type == EventError {
+			errEvent = &events[i]
+		}
+	}
+	if errEvent == nil {
+		t.Fatal("no EventError in session stream for exec failure")
+	}
+	if !errors.Is(errEvent.Err, ErrSessionNotFound) {
+		t.Errorf("event Err: got %v, want ErrSessionNotFound", errEvent.Err)
+	}
+	if errEvent.Data != errEvent.Err.Error() {
+		t.Errorf("event Data: got %q, want the error message %q", errEvent.Data, errEvent.Err.Error())
+	}
+}
+
+func TestDispatcher_Resume_OutputEvents(t *testing.T) {
+	podsDir := t.TempDir()
+
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, _ []string, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, "resume output line")
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "guidance")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	var outputEvents []Event
+	for _, e := range events {
+		if e.Type == EventOutput {
+			outputEvents = append(outputEvents, e)
+		}
+	}
+	if len(outputEvents) != 1 {
+		t.Fatalf("output events: got %d, want 1", len(outputEvents))
+	}
+	if outputEvents[0].Data != "resume output line" {
+		t.Errorf("output: got %q, want %q", outputEvents[0].Data, "resume output line")
+	}
+}
+
+// makeTestPodWithTemplate creates a pod directory with a Dockerfile and a template.md.
+func makeTestPodWithTemplate(t *testing.T, podsDir, name, templateContent string) {
+	t.Helper()
+	makeTestPod(t, podsDir, name)
+	dir := filepath.Join(podsDir, name)
+	if err := os.WriteFile(filepath.Join(dir, "template.md"), []byte(templateContent), 0644); err != nil {
+		t.Fatalf("write template.md: %v", err)
+	}
+}
+
+func TestDispatcher_Start_Prompt_WithTemplate(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPodWithTemplate(t, podsDir, "myrepo", "# Standing Orders\n\nEnsure origin is up to date.")
+
+	var capturedCmd []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedCmd = opts.Cmd
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	issueURL := "https://github.com/org/repo/issues/99"
+	s, err := d.Start(context.Background(), "myrepo", issueURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if len(capturedCmd) < 3 {
+		t.Fatalf("Cmd too short: %v", capturedCmd)
+	}
+	// The prompt is the last element of the claude -p <prompt> command.
+	prompt := capturedCmd[len(capturedCmd)-1]
+	wantPrefix := "# Standing Orders\n\nEnsure origin is up to date."
+	wantSuffix := "Work on this GitHub issue: " + issueURL
+	if !strings.HasPrefix(prompt, wantPrefix) {
+		t.Errorf("prompt does not start with template:\ngot:  %q\nwant prefix: %q", prompt, wantPrefix)
+	}
+	if !strings.HasSuffix(prompt, wantSuffix) {
+		t.Errorf("prompt does not end with base prompt:\ngot:  %q\nwant suffix: %q", prompt, wantSuffix)
+	}
+	wantFull := wantPrefix + "\n\n" + wantSuffix
+	if prompt != wantFull {
+		t.Errorf("prompt:\ngot:  %q\nwant: %q", prompt, wantFull)
+	}
+}
+
+func TestDispatcher_Start_Prompt_PromptPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		podJSON  string
+		want     string
+	}{
+		{"appended", "", `{"promptPrefix": "You are the red team lead. Your assignment: "}`,
+			"You are the red team lead. Your assignment: https://github.com/org/repo/issues/7"},
+		{"placeholder", "", `{"promptPrefix": "Reproduce {{url}} before fixing it."}`,
+			"Reproduce https://github.com/org/repo/issues/7 before fixing it."},
+		{"with template", "# Standing Orders", `{"promptPrefix": "Your assignment: "}`,
+			"# Standing Orders\n\nYour assignment: https://github.com/org/repo/issues/7"},
+		{"fetched issue", "", `{"promptPrefix": "Your assignment: ", "fetchIssue": true}`,
+			"Your assignment: https://github.com/org/repo/issues/7\n\nTitle: Login fails"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPodWithTemplate(t, podsDir, "myrepo", tt.template)
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+			fetcher := issueFetcherFunc(func(context.Context, IssueRef) (Issue, error) {
+				return Issue{Title: "Login fails"}, nil
+			})
+			var capturedCmd []string
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					capturedCmd = opts.Cmd
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithIssueFetcher(fetcher))
+
+			s, err := d.Start(context.Background(), "myrepo", "org/repo#7")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			if len(capturedCmd) < 3 || capturedCmd[2] != tt.want {
+				t.Errorf("prompt:\ngot:  %q\nwant: %q", capturedCmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_Prompt_WithoutTemplate(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var capturedCmd []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedCmd = opts.Cmd
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	issueURL := "https://github.com/org/repo/issues/7"
+	s, err := d.Start(context.Background(), "myrepo", issueURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if len(capturedCmd) < 3 {
+		t.Fatalf("Cmd too short: %v", capturedCmd)
+	}
+	prompt := capturedCmd[len(capturedCmd)-1]
+	want := "Work on this GitHub issue: " + issueURL
+	if prompt != want {
+		t.Errorf("prompt:\ngot:  %q\nwant: %q", prompt, want)
+	}
+}
+
+func TestDispatcher_Resume_Prompt_NoTemplateUsed(t *testing.T) {
+	// Resume passes the caller's prompt directly; no template is applied.
+	podsDir := t.TempDir()
+
+	var capturedCmd []string
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, cmd []string, _ io.Writer) (int, error) {
+			capturedCmd = cmd
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "continue where you left off")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if len(capturedCmd) < 4 {
+		t.Fatalf("cmd too short: %v", capturedCmd)
+	}
+	prompt := capturedCmd[len(capturedCmd)-1]
+	want := "continue where you left off"
+	if prompt != want {
+		t.Errorf("resume prompt:\ngot:  %q\nwant: %q", prompt, want)
+	}
+}
+
+func TestDispatcher_StartTask_Prompt(t *testing.T) {
+	const task = "Update all dependencies and open a PR."
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"without template", "", task},
+		{"with template", "# Standing Orders", "# Standing Orders\n\n" + task},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPodWithTemplate(t, podsDir, "myrepo", tt.template)
+			// fetchIssue has no issue to fetch for a task.
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"fetchIssue": true}`), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+			fetcher := issueFetcherFunc(func(context.Context, IssueRef) (Issue, error) {
+				t.Error("a task fetched issue content")
+				return Issue{}, nil
+			})
+			var captured RunOptions
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					captured = opts
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithIssueFetcher(fetcher))
+
+			s, err := d.StartTask(context.Background(), "myrepo", task)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			if len(captured.Cmd) < 3 || captured.Cmd[2] != tt.want {
+				t.Errorf("prompt:\ngot:  %q\nwant: %q", captured.Cmd, tt.want)
+			}
+			if captured.Name != "cldpd-myrepo" {
+				t.Errorf("container: got %q, want cldpd-myrepo", captured.Name)
+			}
+		})
+	}
+}
+
+func TestDispatcher_StartTask_EmptyPrompt(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	d := NewDispatcher(podsDir, &mockRunner{})
+
+	for _, prompt := range []string{"", " \n\t"} {
+		if _, err := d.StartTask(context.Background(), "myrepo", prompt); !errors.Is(err, ErrEmptyPrompt) {
+			t.Errorf("StartTask(%q): got %v, want ErrEmptyPrompt", prompt, err)
+		}
+	}
+}
+
+func TestDispatcher_StartReview_Prompt(t *testing.T) {
+	const directive = "Review this pull request: https://github.com/org/repo/pull/12. Leave review comments and an approval decision."
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   string
+		podCfg string
+	}{
+		{"no templates", nil, directive, ""},
+		{"template.md", map[string]string{"template.md": "Issue orders."}, "Issue orders.\n\n" + directive, ""},
+		{"review.md preferred", map[string]string{"template.md": "Issue orders.", "review.md": "Review orders."}, "Review orders.\n\n" + directive, ""},
+		{"fetchIssue ignored", nil, directive, `{"fetchIssue": true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", name), []byte(content), 0644); err != nil {
+					t.Fatalf("write %s: %v", name, err)
+				}
+			}
+			if tt.podCfg != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podCfg), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			var fetched bool
+			fetcher := issueFetcherFunc(func(context.Context, IssueRef) (Issue, error) {
+				fetched = true
+				return Issue{}, nil
+			})
+			var captured RunOptions
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					captured = opts
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithIssueFetcher(fetcher))
+
+			s, err := d.StartReview(context.Background(), "myrepo", "https://github.com/org/repo/pull/12#discussion_r1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			if len(captured.Cmd) < 3 || captured.Cmd[2] != tt.want {
+				t.Errorf("prompt:\ngot:  %q\nwant: %q", captured.Cmd, tt.want)
+			}
+			if fetched {
+				t.Error("a review fetched issue content")
+			}
+		})
+	}
+}
+
+func TestDispatcher_StartReview_Naming(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var captured RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			captured = opts
+			return 0, nil
+		},
+		// An issue session of the pod is running under the pod's own name.
+		inspectFn: func(_ context.Context, container string) (ContainerState, error) {
+			if container == "cldpd-myrepo" {
+				return ContainerState{Running: true}, nil
+			}
+			return ContainerState{}, ErrSessionNotFound
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.StartReview(context.Background(), "myrepo", "https://github.com/org/repo/pull/12")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if captured.Name != "cldpd-myrepo-review" {
+		t.Errorf("container: got %q, want cldpd-myrepo-review", captured.Name)
+	}
+	if captured.Image != "cldpd-myrepo" {
+		t.Errorf("image: got %q, want the pod's image cldpd-myrepo", captured.Image)
+	}
+	if !strings.HasPrefix(s.ID(), "myrepo-review-") {
+		t.Errorf("session ID: got %q, want prefix myrepo-review-", s.ID())
+	}
+}
+
+func TestDispatcher_StartReview_InvalidURL(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	d := NewDispatcher(podsDir, &mockRunner{})
+
+	for _, u := range []string{"https://github.com/org/repo/issues/12", "org/repo#12", "https://github.com/org/repo/pull/12/files", ""} {
+		if _, err := d.StartReview(context.Background(), "myrepo", u); !errors.Is(err, ErrInvalidIssueURL) {
+			t.Errorf("StartReview(%q): got %v, want ErrInvalidIssueURL", u, err)
+		}
+	}
+}
+
+func TestDispatcher_Start_Timing(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	before := time.Now()
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	timing := s.Timing()
+	if timing.StartedAt.Before(before) {
+		t.Errorf("StartedAt: got %v, want at or after %v", timing.StartedAt, before)
+	}
+	if timing.BuildDuration < 20*time.Millisecond {
+		t.Errorf("BuildDuration: got %v, want >= 20ms", timing.BuildDuration)
+	}
+	if timing.RunDuration < 20*time.Millisecond {
+		t.Errorf("RunDuration: got %v, want >= 20ms", timing.RunDuration)
+	}
+}
+
+func TestDispatcher_Resume_Timing_NoBuild(t *testing.T) {
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, _ []string, _ io.Writer) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	s, err := d.Resume(context.Background(), "myrepo", "keep going")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	timing := s.Timing()
+	if timing.BuildDuration != 0 {
+		t.Errorf("BuildDuration: got %v, want 0", timing.BuildDuration)
+	}
+	if timing.RunDuration < 20*time.Millisecond {
+		t.Errorf("RunDuration: got %v, want >= 20ms", timing.RunDuration)
+	}
+}
+
+func TestNewDispatcher_DefaultBuilderUsesRunner(t *testing.T) {
+	r := &mockRunner{}
+	d := NewDispatcher("/some/path", r)
+	if d.builder != Builder(r) {
+		t.Errorf("default builder: got %T, want the dispatcher's runner", d.builder)
+	}
+}
+
+func TestDispatcher_Start_WithBuilder(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"image":"custom:v1","buildArgs":{"GO_VERSION":"1.24"}}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			t.Error("runner.Build must not be called when a Builder is configured")
+			return nil
+		},
+	}
+	fb := &fakeBuilder{}
+	d := NewDispatcher(podsDir, r, WithBuilder(fb))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if fb.calls != 1 {
+		t.Fatalf("builder called %d times, want 1", fb.calls)
+	}
+	if fb.tag != "custom:v1" {
+		t.Errorf("tag: got %q, want %q", fb.tag, "custom:v1")
+	}
+	absDir, _ := filepath.Abs(dir)
+	if fb.dir != absDir {
+		t.Errorf("dir: got %q, want %q", fb.dir, absDir)
+	}
+	if fb.opts.BuildArgs["GO_VERSION"] != "1.24" {
+		t.Errorf("BuildArgs: got %v, want GO_VERSION=1.24", fb.opts.BuildArgs)
+	}
+}
+
+func TestDispatcher_Start_WithBuilder_Error(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	fb := &fakeBuilder{err: fmt.Errorf("%w: exit code 1", ErrBuildFailed)}
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: unexpected error: %v", err)
+	}
+	if _, err := waitForDone(t, s, 2*time.Second); !errors.Is(err, ErrBuildFailed) {
+		t.Errorf("Wait: got %v, want ErrBuildFailed", err)
+	}
+}
+
+func TestDispatcher_Start_WithHealthMonitor(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		healthFn: func(_ context.Context, container string) (string, error) {
+			if container != "cldpd-myrepo" {
+				t.Errorf("Health container: got %q, want %q", container, "cldpd-myrepo")
+			}
+			select {
+			case <-unblock:
+			default:
+				close(unblock)
+			}
+			return "healthy", nil
+		},
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			<-unblock
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithHealthMonitor(5*time.Millisecond))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	var healthEvents int
+	for _, e := range events {
+		if e.Type == EventHealthChanged {
+			healthEvents++
+			if e.Data != "healthy" {
+				t.Errorf("health Data: got %q, want %q", e.Data, "healthy")
+			}
+		}
+	}
+	if healthEvents != 1 {
+		t.Errorf("health events: got %d, want 1", healthEvents)
+	}
+}
+
+func TestDispatcher_Status_Running(t *testing.T) {
+	started := time.Date(2026, 2, 21, 10, 0, 0, 0, time.UTC)
+	var gotContainer string
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, container string) (ContainerState, error) {
+			gotContainer = container
+			return ContainerState{Running: true, StartedAt: started, Image: "cldpd-redteam"}, nil
+		},
+	}
+	st, err := NewDispatcher(t.TempDir(), r).Status(context.Background(), "redteam")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotContainer != "cldpd-redteam" {
+		t.Errorf("inspected %q, want %q", gotContainer, "cldpd-redteam")
+	}
+	want := PodStatus{Running: true, ContainerName: "cldpd-redteam", StartedAt: started, Image: "cldpd-redteam"}
+	if st != want {
+		t.Errorf("got %+v, want %+v", st, want)
+	}
+}
+
+func TestDispatcher_Status_Exited(t *testing.T) {
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, _ string) (ContainerState, error) {
+			return ContainerState{Running: false, ExitCode: 3, Image: "img"}, nil
+		},
+	}
+	st, err := NewDispatcher(t.TempDir(), r).Status(context.Background(), "redteam")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.Running || st.ExitCode != 3 {
+		t.Errorf("got %+v, want exited with code 3", st)
+	}
+}
+
+func TestDispatcher_Status_Missing(t *testing.T) {
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, container string) (ContainerState, error) {
+			return ContainerState{}, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+		},
+	}
+	_, err := NewDispatcher(t.TempDir(), r).Status(context.Background(), "redteam")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestDispatcher_Start_LowDiskEmitsWarning(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("statfs not supported on this platform")
+	}
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	d := NewDispatcher(podsDir, &mockRunner{}, WithDiskThresholds(DiskThresholds{Warn: 1 << 62}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	if len(events) < 3 || events[0].Type != EventBuildStarted || events[1].Type != EventWarning {
+		t.Fatalf("events: got %v, want BuildStarted then Warning", events)
+	}
+	if !strings.Contains(events[1].Data, "low disk space") {
+		t.Errorf("warning data: got %q", events[1].Data)
+	}
+}
+
+func TestDispatcher_Start_GPUs(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"gpus":"all"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var gotGPUs string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			gotGPUs = opts.GPUs
+			return 0, nil
+		},
+		runtimesFn: func(_ context.Context) ([]string, error) {
+			return []string{"nvidia", "runc"}, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	if gotGPUs != "all" {
+		t.Errorf("GPUs: got %q, want %q", gotGPUs, "all")
+	}
+	for _, e := range events {
+		if e.Type == EventWarning {
+			t.Errorf("unexpected warning: %q", e.Data)
+		}
+	}
+}
+
+func TestDispatcher_StartWith_Detach(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var runOpts RunOptions
+	r := &mockRunner{
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			t.Error("blocking Run called for a detached start")
+			return 0, nil
+		},
+		detachedFn: func(_ context.Context, opts RunOptions) (string, error) {
+			runOpts = opts
+			return "0123456789ab", nil
+		},
+		attachFn: func(_ context.Context, container string, w io.Writer) (int, error) {
+			if container != "cldpd-myrepo" {
+				t.Errorf("attached to %q, want cldpd-myrepo", container)
+			}
+			fmt.Fprintln(w, "attached line")
+			return 3, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, code, err := drainSession(t, s, 2*time.Second)
+	if err != nil || code != 3 {
+		t.Errorf("Wait: got (%d, %v), want (3, nil)", code, err)
+	}
+	if runOpts.Name != "cldpd-myrepo" {
+		t.Errorf("RunDetached name: got %q, want cldpd-myrepo", runOpts.Name)
+	}
+	// The caller may exit once the container starts, so docker must remove it.
+	if !runOpts.Remove {
+		t.Error("RunDetached Remove: got false, want true")
+	}
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []EventType{EventBuildStarted, EventBuildComplete, EventContainerStarted, EventOutput, EventContainerExited}
+	if !slices.Equal(types, want) {
+		t.Errorf("events: got %v, want %v", types, want)
+	}
+}
+
+func TestDispatcher_StartWith_Detach_KeepContainer(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var runOpts RunOptions
+	r := &mockRunner{
+		detachedFn: func(_ context.Context, opts RunOptions) (string, error) {
+			runOpts = opts
+			return "0123456789ab", nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Detach: true, KeepContainer: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+	if runOpts.Remove {
+		t.Error("RunDetached Remove: got true for KeepContainer, want false")
+	}
+}
+
+func TestDispatcher_StartWith_Detach_RunFails(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		detachedFn: func(context.Context, RunOptions) (string, error) {
+			return "", fmt.Errorf("%w: no such image", ErrDockerRunFailed)
+		},
+		attachFn: func(context.Context, string, io.Writer) (int, error) {
+			t.Error("Attach called after a failed run")
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, err := drainSession(t, s, 2*time.Second)
+	if !errors.Is(err, ErrDockerRunFailed) {
+		t.Errorf("Wait: got %v, want ErrDockerRunFailed", err)
+	}
+	if countEvents(events, EventContainerStarted) != 0 {
+		t.Error("ContainerStarted emitted for a container that never started")
+	}
+}
+
+func TestDispatcher_StartWith_Detach_ExitedBeforeAttach(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		attachFn: func(_ context.Context, container string, _ io.Writer) (int, error) {
+			return -1, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+		},
+		waitFn: func(context.Context, string) (int, error) {
+			return 2, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, code, err := drainSession(t, s, 2*time.Second); err != nil || code != 2 {
+		t.Errorf("Wait: got (%d, %v), want (2, nil)", code, err)
+	}
+}
+
+func TestDispatcher_WithDetachedRun_SameEvents(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, w io.Writer) (int, error) {
+			fmt.Fprintln(w, "line")
+			return 1, nil
+		},
+		attachFn: func(_ context.Context, _ string, w io.Writer) (int, error) {
+			fmt.Fprintln(w, "line")
+			return 1, nil
+		},
+	}
+	streams := make(map[bool][]Event)
+	for _, detached := range []bool{false, true} {
+		var opts []Option
+		if detached {
+			opts = append(opts, WithDetachedRun())
+		}
+		s, err := NewDispatcher(podsDir, r, opts...).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		streams[detached], _, _ = drainSession(t, s, 2*time.Second)
+	}
+	blocking, detached := streams[false], streams[true]
+	if len(blocking) != len(detached) {
+		t.Fatalf("events: blocking %v, detached %v", blocking, detached)
+	}
+	for i := range blocking {
+		b, d := blocking[i], detached[i]
+		if b.Type != d.Type || b.Data != d.Data || b.Code != d.Code {
+			t.Errorf("event %d: blocking %v, detached %v", i, b, d)
+		}
+	}
+}
+
+func TestDispatcher_Shell(t *testing.T) {
+	var gotContainer string
+	var gotCmd []string
+	var gotInput string
+	r := &mockRunner{
+		shellFn: func(_ context.Context, container string, cmd []string, stdin io.Reader, stdout, _ io.Writer) (int, error) {
+			gotContainer, gotCmd = container, cmd
+			b, _ := io.ReadAll(stdin)
+			gotInput = string(b)
+			fmt.Fprint(stdout, "reply")
+			return 0, nil
+		},
+	}
+	var stdout bytes.Buffer
+	code, err := NewDispatcher(t.TempDir(), r).Shell(context.Background(), "myrepo", nil, strings.NewReader("hello"), &stdout, io.Discard)
+	if err != nil || code != 0 {
+		t.Fatalf("Shell: got (%d, %v), want (0, nil)", code, err)
+	}
+	if gotContainer != "cldpd-myrepo" {
+		t.Errorf("container: got %q, want cldpd-myrepo", gotContainer)
+	}
+	if !slices.Equal(gotCmd, []string{"/bin/bash"}) {
+		t.Errorf("cmd: got %v, want [/bin/bash]", gotCmd)
+	}
+	if gotInput != "hello" || stdout.String() != "reply" {
+		t.Errorf("streams: got stdin %q, stdout %q", gotInput, stdout.String())
+	}
+}
+
+func TestDispatcher_Start_ContainerNameInUse(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var built, removed bool
+	r := &mockRunner{
+		inspectFn: func(context.Context, string) (ContainerState, error) {
+			return ContainerState{Running: true}, nil
+		},
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			built = true
+			return nil
+		},
+		removeFn: func(context.Context, string, bool) error {
+			removed = true
+			return nil
+		},
+	}
+	_, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if !errors.Is(err, ErrContainerNameInUse) {
+		t.Fatalf("got %v, want ErrContainerNameInUse", err)
+	}
+	if !strings.Contains(err.Error(), "cldpd-myrepo") {
+		t.Errorf("error %q should name the container", err)
+	}
+	if built || removed {
+		t.Errorf("built %v, removed %v; want neither", built, removed)
+	}
+}
+
+func TestDispatcher_Start_ConcurrentStartsOfOnePod(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	release := make(chan struct{})
+	r := &mockRunner{
+		// No container exists yet: the first session is still building.
+		inspectFn: func(_ context.Context, c string) (ContainerState, error) {
+			return ContainerState{}, fmt.Errorf("%s: %w", c, ErrSessionNotFound)
+		},
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			<-release
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+
+	sessions := make([]*Session, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sessions[i], errs[i] = d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Force: true})
+		}()
+	}
+	wg.Wait()
+
+	var started *Session
+	var inUse int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			started = sessions[i]
+		case errors.Is(err, ErrContainerNameInUse):
+			inUse++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if started == nil || inUse != 1 {
+		t.Fatalf("got %v, want one session and one ErrContainerNameInUse", errs)
+	}
+
+	close(release)
+	if _, code, err := drainSession(t, started, 2*time.Second); code != 0 || err != nil {
+		t.Fatalf("result: got (%d, %v), want (0, nil)", code, err)
+	}
+	// The name is freed once the session ends.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+		if err == nil {
+			drainSession(t, s, 2*time.Second)
+			break
+		}
+		if !errors.Is(err, ErrContainerNameInUse) || time.Now().After(deadline) {
+			t.Fatalf("Start after the session ended: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_StartWith_Force_RemovesRunningContainer(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var mu sync.Mutex
+	running := true
+	var removals []string
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, c string) (ContainerState, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !running {
+				return ContainerState{}, fmt.Errorf("%s: %w", c, ErrSessionNotFound)
+			}
+			return ContainerState{Running: true}, nil
+		},
+		removeFn: func(_ context.Context, container string, force bool) error {
+			mu.Lock()
+			defer mu.Unlock()
+			removals = append(removals, fmt.Sprintf("%s force=%v", container, force))
+			running = false
+			return nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Force: true, KeepContainer: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, code, err := drainSession(t, s, 2*time.Second); code != 0 || err != nil {
+		t.Errorf("result: got (%d, %v), want (0, nil)", code, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(removals, []string{"cldpd-myrepo force=true"}) {
+		t.Errorf("removals: got %v, want one forced removal of cldpd-myrepo", removals)
+	}
+}
+
+func TestDispatcher_StartWith_Force_RemoveFails(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		inspectFn: func(context.Context, string) (ContainerState, error) {
+			return ContainerState{Running: true}, nil
+		},
+		removeFn: func(context.Context, string, bool) error {
+			return fmt.Errorf("%w: permission denied", ErrRemoveFailed)
+		},
+	}
+	_, err := NewDispatcher(podsDir, r).StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Force: true})
+	if !errors.Is(err, ErrContainerNameInUse) || !errors.Is(err, ErrRemoveFailed) {
+		t.Errorf("got %v, want ErrContainerNameInUse wrapping ErrRemoveFailed", err)
+	}
+}
+
+func TestDispatcher_Start_RemovesContainer(t *testing.T) {
+	tests := []struct {
+		name        string
+		podJSON     string
+		startOpts   StartOptions
+		wantRemoved bool
+	}{
+		{name: "default", wantRemoved: true},
+		{name: "pod keepContainer", podJSON: `{"keepContainer": true}`, wantRemoved: false},
+		{name: "StartOptions.KeepContainer", startOpts: StartOptions{KeepContainer: true}, wantRemoved: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			var mu sync.Mutex
+			var calls []string
+			record := func(call string) {
+				mu.Lock()
+				calls = append(calls, call)
+				mu.Unlock()
+			}
+			r := &mockRunner{
+				// No container exists before the run.
+				inspectFn: func(_ context.Context, c string) (ContainerState, error) {
+					return ContainerState{}, fmt.Errorf("%s: %w", c, ErrSessionNotFound)
+				},
+				runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+					record("run")
+					return 0, nil
+				},
+				removeFn: func(_ context.Context, container string, _ bool) error {
+					if container != "cldpd-myrepo" {
+						t.Errorf("removed %q, want cldpd-myrepo", container)
+					}
+					record("remove")
+					return nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+			s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", tt.startOpts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			want := []string{"run"}
+			if tt.wantRemoved {
+				want = append(want, "remove")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(calls, want) {
+				t.Errorf("calls: got %v, want %v", calls, want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_ClearsExitedContainer(t *testing.T) {
+	for _, running := range []bool{false, true} {
+		t.Run(fmt.Sprintf("running=%v", running), func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			var mu sync.Mutex
+			var calls []string
+			record := func(call string) {
+				mu.Lock()
+				calls = append(calls, call)
+				mu.Unlock()
+			}
+			var inspections int
+			r := &mockRunner{
+				inspectFn: func(_ context.Context, c string) (ContainerState, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					inspections++
+					if running && inspections == 1 {
+						// The running container appears after Start's check.
+						return ContainerState{}, fmt.Errorf("%s: %w", c, ErrSessionNotFound)
+					}
+					return ContainerState{Running: running}, nil
+				},
+				runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+					record("run")
+					if running {
+						return -1, fmt.Errorf("%w: name already in use", ErrDockerRunFailed)
+					}
+					return 0, nil
+				},
+				removeFn: func(context.Context, string, bool) error {
+					record("remove")
+					return nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			// An exited container is cleared before the run; a running one,
+			// owned by another session, is never removed.
+			want := []string{"remove", "run", "remove"}
+			if running {
+				want = []string{"run"}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(calls, want) {
+				t.Errorf("calls: got %v, want %v", calls, want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_WithModTimeRebuild(t *testing.T) {
+	imageCreated := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		modTime   time.Time
+		startOpts StartOptions
+		wantBuild bool
+	}{
+		{name: "Dockerfile older than image", modTime: imageCreated.Add(-time.Hour), wantBuild: false},
+		{name: "Dockerfile newer than image", modTime: imageCreated.Add(time.Minute), wantBuild: true},
+		{name: "no-cache forces build", modTime: imageCreated.Add(-time.Hour), startOpts: StartOptions{NoCache: true}, wantBuild: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			dockerfile := filepath.Join(podsDir, "myrepo", "Dockerfile")
+			if err := os.Chtimes(dockerfile, tt.modTime, tt.modTime); err != nil {
+				t.Fatalf("set Dockerfile mtime: %v", err)
+			}
+
+			built := false
+			r := &mockRunner{
+				buildFn: func(context.Context, string, string, BuildOptions) error {
+					built = true
+					return nil
+				},
+				imageFn: func(_ context.Context, tag string) (time.Time, error) {
+					if tag != "cldpd-myrepo" {
+						t.Errorf("ImageCreated tag: got %q, want cldpd-myrepo", tag)
+					}
+					return imageCreated, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithModTimeRebuild())
+
+			s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", tt.startOpts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, code, err := drainSession(t, s, 2*time.Second)
+			if err != nil || code != 0 {
+				t.Fatalf("session: got (%d, %v), want (0, nil)", code, err)
+			}
+
+			if built != tt.wantBuild {
+				t.Errorf("built: got %v, want %v", built, tt.wantBuild)
+			}
+			var types []EventType
+			for _, e := range events {
+				types = append(types, e.Type)
+			}
+			if !slices.Contains(types, EventBuildComplete) || !slices.Contains(types, EventContainerStarted) {
+				t.Errorf("events: got %v, want BuildComplete and ContainerStarted", types)
+			}
+		})
+	}
+}
+
+func TestDispatcher_WithModTimeRebuild_MissingImageBuilds(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	built := false
+	r := &mockRunner{
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			built = true
+			return nil
+		},
+		imageFn: func(_ context.Context, tag string) (time.Time, error) {
+			return time.Time{}, errors.New("no such image: " + tag)
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithModTimeRebuild())
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+	if !built {
+		t.Error("image was not built when it does not exist")
+	}
+}
+
+func TestDispatcher_Start_OOMKilled(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			return -1, fmt.Errorf("%w: %s", ErrOOMKilled, opts.Name)
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, err := drainSession(t, s, 2*time.Second)
+
+	if !errors.Is(err, ErrOOMKilled) {
+		t.Errorf("Wait: got %v, want ErrOOMKilled", err)
+	}
+	last := events[len(events)-1]
+	if last.Type != EventError || !strings.Contains(last.Data, "container was OOM killed") {
+		t.Errorf("terminal event: got %v %q, want EventError naming the OOM kill", last.Type, last.Data)
+	}
+}
+
+func TestDispatcher_WithFullOutputCapture(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, "first")
+			fmt.Fprintln(stdout, "second")
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithFullOutputCapture())
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if got := s.Output(); got != "first\nsecond" {
+		t.Errorf("Output: got %q, want %q", got, "first\nsecond")
+	}
+}
+
+func TestDispatcher_WithMaxLineSize(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, strings.Repeat("x", 2048))
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithMaxLineSize(1024))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var tooLong bool
+	for e := range s.Events() {
+		if e.Type == EventOutput {
+			t.Errorf("line over the limit delivered: %d bytes", len(e.Data))
+		}
+		if e.Type == EventError && errors.Is(e.Err, bufio.ErrTooLong) {
+			tooLong = true
+		}
+	}
+	if !tooLong {
+		t.Error("no error event for the line over the limit")
+	}
+}
+
+func TestDispatcher_WithMaxLineLength(t *testing.T) {
+	long := strings.Repeat("x", defaultMaxLineLength+1)
+	tests := []struct {
+		name  string
+		opts  []Option
+		whole bool
+	}{
+		{"default", nil, false},
+		{"raised", []Option{WithMaxLineLength(2 * defaultMaxLineLength)}, true},
+		{"disabled", []Option{WithMaxLineLength(0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			r := &mockRunner{
+				runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+					fmt.Fprintln(stdout, long)
+					return 0, nil
+				},
+			}
+			opts := append([]Option{WithDiskThresholds(DiskThresholds{})}, tt.opts...)
+			d := NewDispatcher(podsDir, r, opts...)
+
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var data string
+			for e := range s.Events() {
+				if e.Type == EventOutput {
+					data = e.Data
+				}
+			}
+			if got := data == long; got != tt.whole {
+				t.Errorf("output Data whole: got %v (%d bytes), want %v", got, len(data), tt.whole)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_PullPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		podJSON   string
+		want      string
+		wantBuild bool
+	}{
+		{"external image", `{"image":"ghcr.io/org/agent:latest","pullPolicy":"missing"}`, PullMissing, false},
+		{"external image always", `{"image":"ghcr.io/org/agent:latest","pullPolicy":"always"}`, PullAlways, false},
+		{"built image always", `{"pullPolicy":"always"}`, "", true},
+		{"built image never", `{"pullPolicy":"never"}`, "", true},
+		{"built named tag", `{"image":"myorg/agent:v1"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+
+			var gotPull string
+			built := false
+			r := &mockRunner{
+				buildFn: func(_ context.Context, _, _ string, _ BuildOptions) error {
+					built = true
+					return nil
+				},
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					gotPull = opts.Pull
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			if gotPull != tt.want {
+				t.Errorf("Pull: got %q, want %q", gotPull, tt.want)
+			}
+			if built != tt.wantBuild {
+				t.Errorf("built: got %v, want %v", built, tt.wantBuild)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_GPUsWithoutNvidiaRuntimeWarns(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"gpus":"device=0"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	ran := false
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			ran = true
+			return 0, nil
+		},
+		runtimesFn: func(_ context.Context) ([]string, error) {
+			return []string{"runc"}, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	if len(events) < 2 || events[1].Type != EventWarning || !strings.Contains(events[1].Data, "nvidia") {
+		t.Fatalf("events: got %v, want BuildStarted then an nvidia runtime Warning", events)
+	}
+	if !ran {
+		t.Error("container did not run; the GPU check must not block Start")
+	}
+}
+
+func TestDispatcher_Start_InsufficientDiskSkipsBuild(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("statfs not supported on this platform")
+	}
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	built := false
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			built = true
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{Floor: 1 << 62}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: unexpected error: %v", err)
+	}
+	if _, _, err := drainSession(t, s, 2*time.Second); !errors.Is(err, ErrInsufficientDisk) {
+		t.Errorf("Wait: got %v, want ErrInsufficientDisk", err)
+	}
+	if built {
+		t.Error("Build called despite insufficient disk")
+	}
+}
+
+func TestDispatcher_Start_DefaultConfig(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "plain")
+	makeTestPod(t, podsDir, "custom")
+	if err := os.WriteFile(filepath.Join(podsDir, "custom", "pod.json"), []byte(`{"user": "2000:2000"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	t.Setenv("CLDPD_TEST_DEFAULT_KEY", "secret")
+	defaults := PodConfig{
+		User:       "1000:1000",
+		InheritEnv: []string{"CLDPD_TEST_DEFAULT_KEY"},
+	}
+
+	cases := []struct {
+		pod      string
+		wantUser string
+	}{
+		{"plain", "1000:1000"},
+		{"custom", "2000:2000"},
+	}
+	for _, tc := range cases {
+		var capturedOpts RunOptions
+		r := &mockRunner{
+			runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+				capturedOpts = opts
+				return 0, nil
+			},
+		}
+		d := NewDispatcher(podsDir, r, WithDefaultConfig(defaults))
+		s, err := d.Start(context.Background(), tc.pod, "https://github.com/org/repo/issues/1")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.pod, err)
+		}
+		drainSession(t, s, 2*time.Second)
+
+		if capturedOpts.User != tc.wantUser {
+			t.Errorf("%s: User got %q, want %q", tc.pod, capturedOpts.User, tc.wantUser)
+		}
+		if capturedOpts.Env["CLDPD_TEST_DEFAULT_KEY"] != "secret" {
+			t.Errorf("%s: default inheritEnv not applied; Env %v", tc.pod, capturedOpts.Env)
+		}
+	}
+}
+
+func TestDispatcher_Start_PodFalseOverridesDefaultConfig(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	// defaults.json is merged first; the pod's false must survive the second
+	// merge beneath WithDefaultConfig too.
+	writeDefaultsJSON(t, podsDir, `{"stripAnsi": true}`)
+	writePodJSON(t, filepath.Join(podsDir, "myrepo"), `{"privileged": false}`)
+
+	var capturedOpts RunOptions
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedOpts = opts
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithDefaultConfig(PodConfig{Privileged: true}))
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if capturedOpts.Privileged {
+		t.Error("Privileged: got true, want the pod's false over the default")
+	}
+}
+
+func TestDispatcher_Pods_MergesDefaultConfig(t *testing.T) {
+	podsDir := t.TempDir()
+	makePodDir(t, podsDir, "plain")
+	writePodJSON(t, makePodDir(t, podsDir, "custom"), `{"image": "custom:v1", "workdir": "/src"}`)
+	d := NewDispatcher(podsDir, &mockRunner{}, WithDefaultConfig(PodConfig{Workdir: "/work", StopTimeout: "30s"}))
+
+	pods, err := d.Pods()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 2 || pods[0].Name != "custom" || pods[1].Name != "plain" {
+		t.Fatalf("pods: got %+v, want custom and plain", pods)
+	}
+	if pods[0].Config.Workdir != "/src" || pods[0].Config.StopTimeout != "30s" {
+		t.Errorf("custom config: got %+v, want pod workdir over defaults", pods[0].Config)
+	}
+	if pods[1].Config.Workdir != "/work" {
+		t.Errorf("plain workdir: got %q, want default %q", pods[1].Config.Workdir, "/work")
+	}
+}
+
+func TestDispatcher_WithPodLimits(t *testing.T) {
+	podsDir := t.TempDir()
+	writePodJSON(t, makePodDir(t, podsDir, "wide"), limitPodJSON(t, DefaultPodLimits.MaxMounts+1, 0, 0))
+	writePodJSON(t, makePodDir(t, podsDir, "small"), limitPodJSON(t, 2, 3, 0))
+
+	// Raised: the pod over the default limit is usable.
+	d := NewDispatcher(podsDir, &mockRunner{}, WithPodLimits(PodLimits{MaxMounts: 200}))
+	if err := d.Build(context.Background(), "wide", BuildOptions{}); err != nil {
+		t.Errorf("raised limit: unexpected error: %v", err)
+	}
+	pods, err := d.Pods()
+	if err != nil {
+		t.Fatalf("Pods: %v", err)
+	}
+	if len(pods) != 2 {
+		t.Errorf("raised limit: got %d pods, want 2", len(pods))
+	}
+
+	// Lowered: a pod within the default limit is rejected and skipped.
+	d = NewDispatcher(podsDir, &mockRunner{}, WithPodLimits(PodLimits{MaxMounts: 1, MaxEnv: 2}))
+	err = d.Build(context.Background(), "small", BuildOptions{})
+	if !errors.Is(err, ErrInvalidPod) || !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("lowered limit: got %v, want ErrInvalidPod and ErrInvalidConfig", err)
+	}
+	if pods, err = d.Pods(); err != nil || len(pods) != 0 {
+		t.Errorf("lowered limit: got %v, %v; want no pods", pods, err)
+	}
+
+	// The default still holds without the option.
+	err = NewDispatcher(podsDir, &mockRunner{}).Build(context.Background(), "wide", BuildOptions{})
+	if !errors.Is(err, ErrInvalidPod) {
+		t.Errorf("default limit: got %v, want ErrInvalidPod", err)
+	}
+}
+
+func TestDispatcher_Pods_InvalidPodsDir(t *testing.T) {
+	d := NewDispatcher(filepath.Join(t.TempDir(), "missing"), &mockRunner{})
+	if _, err := d.Pods(); err == nil {
+		t.Error("expected error for missing pods directory")
+	}
+}
+
+// cleanupRunner returns a mockRunner holding a mixed set of containers and
+// images, recording the containers and images removed into removed.
+func cleanupRunner(removed *[]string) *mockRunner {
+	return &mockRunner{
+		listFn: func(_ context.Context, all bool) ([]ContainerSummary, error) {
+			if !all {
+				return nil, errors.New("List called without all")
+			}
+			return []ContainerSummary{
+				{Name: "cldpd-api", Pod: "api", Running: true},
+				{Name: "cldpd-web", Pod: "web"},
+				{Name: "cldpd-gone", Pod: "gone"},
+			}, nil
+		},
+		removeFn: func(_ context.Context, container string, force bool) error {
+			if force {
+				return fmt.Errorf("%s removed with force", container)
+			}
+			*removed = append(*removed, container)
+			return nil
+		},
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{"cldpd-api:latest", "cldpd-gone:latest", "cldpd-web:v2", "cldpd-old:latest"}, nil
+		},
+		rmImageFn: func(_ context.Context, tag string) error {
+			*removed = append(*removed, tag)
+			return nil
+		},
+	}
+}
+
+func TestDispatcher_Cleanup(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "api")
+	makeTestPod(t, podsDir, "web")
+
+	cases := []struct {
+		name           string
+		opts           CleanupOptions
+		wantContainers []string
+		wantImages     []string
+	}{
+		{
+			name:           "default removes both",
+			wantContainers: []string{"cldpd-web", "cldpd-gone"},
+			wantImages:     []string{"cldpd-gone:latest", "cldpd-old:latest"},
+		},
+		{
+			name:           "containers only",
+			opts:           CleanupOptions{Containers: true},
+			wantContainers: []string{"cldpd-web", "cldpd-gone"},
+		},
+		{
+			name:       "images only",
+			opts:       CleanupOptions{Images: true},
+			wantImages: []string{"cldpd-gone:latest", "cldpd-old:latest"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var removed []string
+			d := NewDispatcher(podsDir, cleanupRunner(&removed))
+			report, err := d.Cleanup(context.Background(), tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(report.Containers, tc.wantContainers) {
+				t.Errorf("Containers: got %v, want %v", report.Containers, tc.wantContainers)
+			}
+			if !slices.Equal(report.Images, tc.wantImages) {
+				t.Errorf("Images: got %v, want %v", report.Images, tc.wantImages)
+			}
+			want := append(slices.Clone(tc.wantContainers), tc.wantImages...)
+			if !slices.Equal(removed, want) {
+				t.Errorf("removed: got %v, want %v", removed, want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Cleanup_DryRun(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "api")
+	makeTestPod(t, podsDir, "web")
+	var removed []string
+	d := NewDispatcher(podsDir, cleanupRunner(&removed))
+
+	report, err := d.Cleanup(context.Background(), CleanupOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("dry run removed %v", removed)
+	}
+	if !slices.Equal(report.Containers, []string{"cldpd-web", "cldpd-gone"}) ||
+		!slices.Equal(report.Images, []string{"cldpd-gone:latest", "cldpd-old:latest"}) {
+		t.Errorf("report: got %+v", report)
+	}
+}
+
+func TestDispatcher_Cleanup_RemoveFailureContinues(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "api")
+	makeTestPod(t, podsDir, "web")
+	var removed []string
+	r := cleanupRunner(&removed)
+	r.removeFn = func(_ context.Context, container string, _ bool) error {
+		if container == "cldpd-web" {
+			return ErrRemoveFailed
+		}
+		removed = append(removed, container)
+		return nil
+	}
+	r.rmImageFn = func(_ context.Context, tag string) error {
+		if tag == "cldpd-gone:latest" {
+			return ErrImageRemoveFailed
+		}
+		removed = append(removed, tag)
+		return nil
+	}
+	d := NewDispatcher(podsDir, r)
+
+	report, err := d.Cleanup(context.Background(), CleanupOptions{})
+	if !errors.Is(err, ErrRemoveFailed) || !errors.Is(err, ErrImageRemoveFailed) {
+		t.Errorf("got %v, want ErrRemoveFailed and ErrImageRemoveFailed", err)
+	}
+	if !slices.Equal(report.Containers, []string{"cldpd-gone"}) || !slices.Equal(report.Images, []string{"cldpd-old:latest"}) {
+		t.Errorf("report: got %+v, want only the successful removals", report)
+	}
+}
+
+func TestDispatcher_Cleanup_ListError(t *testing.T) {
+	r := &mockRunner{
+		listFn: func(context.Context, bool) ([]ContainerSummary, error) {
+			return nil, ErrDockerUnavailable
+		},
+		imagesFn: func(context.Context) ([]string, error) {
+			t.Error("Images called after List failed")
+			return nil, nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+	if _, err := d.Cleanup(context.Background(), CleanupOptions{}); !errors.Is(err, ErrDockerUnavailable) {
+		t.Errorf("got %v, want ErrDockerUnavailable", err)
+	}
+}
+
+func TestDispatcher_Cleanup_MissingPodsDirKeepsImages(t *testing.T) {
+	var removed []string
+	d := NewDispatcher(filepath.Join(t.TempDir(), "missing"), cleanupRunner(&removed))
+	if _, err := d.Cleanup(context.Background(), CleanupOptions{Images: true}); err == nil {
+		t.Error("expected error for missing pods directory")
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed %v with no pods directory to check against", removed)
+	}
+}
+
+func TestDispatcher_PruneImages(t *testing.T) {
+	var removed []string
+	r := &mockRunner{
+		listFn: func(_ context.Context, all bool) ([]ContainerSummary, error) {
+			if all {
+				t.Error("List asked for stopped containers")
+			}
+			return []ContainerSummary{{Name: "cldpd-busy-review", Pod: "busy-review", Image: "cldpd-busy"}}, nil
+		},
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{
+				"cldpd-api:latest",
+				"cldpd-api:build-20260103T000000.000000000Z",
+				"cldpd-api:build-20260101T000000.000000000Z",
+				"cldpd-api:build-20260104T000000.000000000Z",
+				"cldpd-api:build-20260102T000000.000000000Z",
+				"cldpd-web:build-20260101T000000.000000000Z",
+				"cldpd-busy:build-20260101T000000.000000000Z",
+				"cldpd-busy:build-20260102T000000.000000000Z",
+				"cldpd-busy:build-20260103T000000.000000000Z",
+			}, nil
+		},
+		rmImageFn: func(_ context.Context, tag string) error {
+			removed = append(removed, tag)
+			return nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	got, err := d.PruneImages(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"cldpd-api:build-20260101T000000.000000000Z", "cldpd-api:build-20260102T000000.000000000Z"}
+	if !slices.Equal(got, want) {
+		t.Errorf("pruned: got %v, want %v", got, want)
+	}
+	if !slices.Equal(removed, want) {
+		t.Errorf("removed: got %v, want %v", removed, want)
+	}
+
+	removed = nil
+	got, err = d.PruneImages(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("keep 0: unexpected error: %v", err)
+	}
+	want = []string{
+		"cldpd-api:build-20260101T000000.000000000Z",
+		"cldpd-api:build-20260102T000000.000000000Z",
+		"cldpd-api:build-20260103T000000.000000000Z",
+		"cldpd-api:build-20260104T000000.000000000Z",
+		"cldpd-web:build-20260101T000000.000000000Z",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("keep 0: pruned %v, want %v", got, want)
+	}
+}
+
+func TestDispatcher_PruneImages_Errors(t *testing.T) {
+	r := &mockRunner{
+		imagesFn: func(context.Context) ([]string, error) {
+			return []string{"cldpd-api:build-1", "cldpd-api:build-2", "cldpd-api:build-3"}, nil
+		},
+		rmImageFn: func(_ context.Context, tag string) error {
+			if tag == "cldpd-api:build-1" {
+				return ErrImageRemoveFailed
+			}
+			return nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	got, err := d.PruneImages(context.Background(), 1)
+	if !errors.Is(err, ErrImageRemoveFailed) {
+		t.Errorf("got %v, want ErrImageRemoveFailed", err)
+	}
+	if !slices.Equal(got, []string{"cldpd-api:build-2"}) {
+		t.Errorf("pruned: got %v, want only the successful removal", got)
+	}
+
+	if _, err := d.PruneImages(context.Background(), -1); err == nil {
+		t.Error("expected error for negative keepPerPod")
+	}
+
+	r.listFn = func(context.Context, bool) ([]ContainerSummary, error) {
+		return nil, ErrDockerUnavailable
+	}
+	r.rmImageFn = func(context.Context, string) error {
+		t.Error("RemoveImage called after List failed")
+		return nil
+	}
+	if _, err := d.PruneImages(context.Background(), 1); !errors.Is(err, ErrDockerUnavailable) {
+		t.Errorf("list error: got %v, want ErrDockerUnavailable", err)
+	}
+}
+
+func TestDispatcher_Build_BuildTag(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	makeTestPod(t, podsDir, "custom")
+	writePodJSON(t, filepath.Join(podsDir, "custom"), `{"image": "custom"}`)
+	fb := &fakeBuilder{}
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb))
+
+	if err := d.Build(context.Background(), "myrepo", BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fb.opts.Tags) != 1 {
+		t.Fatalf("tags: got %v, want one build tag", fb.opts.Tags)
+	}
+	if pod, ok := podFromBuildTag(fb.opts.Tags[0]); !ok || pod != "myrepo" {
+		t.Errorf("tag %q is not a build tag of myrepo", fb.opts.Tags[0])
+	}
+
+	if err := d.Build(context.Background(), "custom", BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fb.opts.Tags) != 0 {
+		t.Errorf("configured image: got tags %v, want none", fb.opts.Tags)
+	}
+}
+
+func TestDispatcher_Start_DefaultConfigValidated(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	d := NewDispatcher(podsDir, &mockRunner{}, WithDefaultConfig(PodConfig{Ports: []string{"nope"}}))
+
+	_, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDispatcher_Start_SkipPermissions(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		t.Run(fmt.Sprint(skip), func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			podJSON := fmt.Sprintf(`{"skipPermissions": %t}`, skip)
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(podJSON), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+
+			var capturedCmd []string
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					capturedCmd = opts.Cmd
+					return 0, nil
+				},
+			}
+			s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			joined := strings.Join(capturedCmd, " ")
+			if got := strings.Contains(joined, "--permission-mode bypassPermissions"); got != skip {
+				t.Errorf("--permission-mode bypassPermissions present: got %t, want %t in %v", got, skip, capturedCmd)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Resume_SkipPermissions(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"skipPermissions": true}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var execCmd []string
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, cmd []string, _ io.Writer) (int, error) {
+			execCmd = cmd
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Resume(context.Background(), "myrepo", "do more work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	want := []string{"claude", "--resume", "-p", "do more work", "--permission-mode", "bypassPermissions"}
+	if !slices.Equal(execCmd, want) {
+		t.Errorf("cmd: got %v, want %v", execCmd, want)
+	}
+}
+
+func TestDispatcher_Start_SessionResume(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"skipPermissions": true}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	unblock := make(chan struct{})
+	var execCmd []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+			fmt.Fprintln(stdout, "first prompt done")
+			<-unblock
+			return 0, nil
+		},
+		execFn: func(_ context.Context, _ string, cmd []string, stdout io.Writer) (int, error) {
+			execCmd = cmd
+			fmt.Fprintln(stdout, "second prompt done")
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{})).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for e := range s.Events() {
+		if e.Type == EventOutput {
+			break
+		}
+	}
+	if code, err := s.Resume(context.Background(), "do more work"); code != 0 || err != nil {
+		t.Fatalf("Resume: got %d, %v; want 0, nil", code, err)
+	}
+	close(unblock)
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	want := []string{"claude", "--resume", "-p", "do more work", "--permission-mode", "bypassPermissions"}
+	if !slices.Equal(execCmd, want) {
+		t.Errorf("cmd: got %v, want %v", execCmd, want)
+	}
+	if len(events) == 0 || events[0].Type != EventOutput || events[0].Data != "second prompt done" {
+		t.Errorf("events after Resume: got %v, want the exec's output first", events)
+	}
+}
+
+func TestDispatcher_WithIdleTimeout(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	unblock := make(chan struct{})
+	var stopOnce sync.Once
+	r := &mockRunner{
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			<-unblock
+			return 143, nil
+		},
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			stopOnce.Do(func() { close(unblock) })
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithIdleTimeout(50*time.Millisecond))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	var idle bool
+	for _, e := range events {
+		if e.Type == EventError && errors.Is(e.Err, ErrIdleTimeout) {
+			idle = true
+		}
+	}
+	if !idle {
+		t.Errorf("events: got %v, want an EventError wrapping ErrIdleTimeout", events)
+	}
+}
+
+func TestDispatcher_Start_MaxRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		podJSON string
+		opts    []Option
+		want    time.Duration
+	}{
+		{"unset", "", nil, 0},
+		{"dispatcher default", "", []Option{WithMaxRuntime(time.Hour)}, time.Hour},
+		{"pod", `{"maxRuntime": "30m"}`, nil, 30 * time.Minute},
+		{"pod overrides default", `{"maxRuntime": "30m"}`, []Option{WithMaxRuntime(time.Hour)}, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			d := NewDispatcher(podsDir, &mockRunner{}, tt.opts...)
+			pod, err := DiscoverPod(podsDir, "myrepo")
+			if err != nil {
+				t.Fatalf("DiscoverPod: %v", err)
+			}
+			if got := d.runtimeLimit(pod.Config); got != tt.want {
+				t.Errorf("runtimeLimit: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_WithMaxRuntime_StopsContainer(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	unblock := make(chan struct{})
+	var stopOnce sync.Once
+	r := &mockRunner{
+		runFn: func(context.Context, RunOptions, io.Writer) (int, error) {
+			<-unblock
+			return 143, nil
+		},
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			stopOnce.Do(func() { close(unblock) })
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}), WithMaxRuntime(50*time.Millisecond))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, code, _ := drainSession(t, s, 2*time.Second)
+
+	if code != 143 {
+		t.Errorf("exit code: got %d, want 143", code)
+	}
+	var exceeded bool
+	for _, e := range events {
+		if e.Type == EventError && errors.Is(e.Err, ErrMaxRuntimeExceeded) {
+			exceeded = true
+		}
+	}
+	if !exceeded {
+		t.Errorf("events: got %v, want an EventError wrapping ErrMaxRuntimeExceeded", events)
+	}
+}
+
+func TestDispatcher_Start_StreamJSON(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"outputFormat": "stream-json"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var capturedCmd []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, stdout io.Writer) (int, error) {
+			capturedCmd = opts.Cmd
+			fmt.Fprintln(stdout, `{"type":"result","subtype":"success","result":"done"}`)
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, _ := drainSession(t, s, 2*time.Second)
+
+	joined := strings.Join(capturedCmd, " ")
+	if !strings.Contains(joined, "--output-format stream-json") {
+		t.Errorf("Cmd missing --output-format stream-json: %v", capturedCmd)
+	}
+	var found bool
+	for _, e := range events {
+		if e.Type == EventMessage && e.Message.Text == "done" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no result Message event in %v", events)
+	}
+}
+
+func TestDispatcher_Start_TextOutputUnchanged(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var capturedCmd []string
+	r := &mockRunner{
+		runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+			capturedCmd = opts.Cmd
+			return 0, nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+
+	if len(capturedCmd) != 3 {
+		t.Errorf("Cmd: got %v, want claude -p <prompt>", capturedCmd)
+	}
+}
+
+func TestDispatcher_StartWith_OutputFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		podJSON  string
+		format   string
+		wantArgs []string
+		wantMsg  bool
+	}{
+		{"default", "", "", nil, false},
+		{"text", "", "text", []string{"--output-format", "text"}, false},
+		{"stream-json", "", "stream-json", []string{"--output-format", "stream-json", "--verbose"}, true},
+		{"text overrides pod", `{"outputFormat": "stream-json"}`, "text", []string{"--output-format", "text"}, false},
+		{"empty keeps pod", `{"outputFormat": "stream-json"}`, "", []string{"--output-format", "stream-json", "--verbose"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+
+			var capturedCmd []string
+			r := &mockRunner{
+				runFn: func(_ context.Context, opts RunOptions, stdout io.Writer) (int, error) {
+					capturedCmd = opts.Cmd
+					fmt.Fprintln(stdout, `{"type":"result","subtype":"success","result":"done"}`)
+					return 0, nil
+				},
+			}
+			s, err := NewDispatcher(podsDir, r).StartWith(context.Background(), "myrepo",
+				"https://github.com/org/repo/issues/1", StartOptions{OutputFormat: tt.format})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, _, _ := drainSession(t, s, 2*time.Second)
+
+			// Format flags follow claude -p <prompt>.
+			if len(capturedCmd) < 3 || !slices.Equal(capturedCmd[3:], tt.wantArgs) {
+				t.Errorf("Cmd: got %v, want claude -p <prompt> followed by %v", capturedCmd, tt.wantArgs)
+			}
+			var gotMsg bool
+			for _, e := range events {
+				if e.Type == EventMessage {
+					gotMsg = true
+				}
+			}
+			if gotMsg != tt.wantMsg {
+				t.Errorf("EventMessage emitted: got %v, want %v", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDispatcher_StartWith_StripANSI(t *testing.T) {
+	const colored = "\x1b[32m✓\x1b[0m [ok] tests passed"
+	tests := []struct {
+		name    string
+		podJSON string
+		opts    StartOptions
+		want    string
+	}{
+		{"default keeps raw", "", StartOptions{}, colored},
+		{"pod", `{"stripAnsi": true}`, StartOptions{}, "✓ [ok] tests passed"},
+		{"start option", "", StartOptions{StripANSI: true}, "✓ [ok] tests passed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			r := &mockRunner{
+				runFn: func(_ context.Context, _ RunOptions, stdout io.Writer) (int, error) {
+					fmt.Fprintln(stdout, colored)
+					return 0, nil
+				},
+			}
+			s, err := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{})).StartWith(context.Background(), "myrepo",
+				"https://github.com/org/repo/issues/1", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, _, _ := drainSession(t, s, 2*time.Second)
+
+			var got []string
+			for _, e := range events {
+				if e.Type == EventOutput {
+					got = append(got, e.Data)
+				}
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("output: got %q, want [%q]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_StartWith_InvalidOutputFormat(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	_, err := NewDispatcher(podsDir, &mockRunner{}).StartWith(context.Background(), "myrepo",
+		"https://github.com/org/repo/issues/1", StartOptions{OutputFormat: "xml"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDispatcher_Attach_EventSequence(t *testing.T) {
+	var attached string
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, _ string) (ContainerState, error) {
+			return ContainerState{Running: true}, nil
+		},
+		attachFn: func(_ context.Context, container string, stdout io.Writer) (int, error) {
+			attached = container
+			fmt.Fprintln(stdout, "still working")
+			return 3, nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	s, err := d.Attach(context.Background(), "myrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, code, err := drainSession(t, s, 2*time.Second)
+	if err != nil || code != 3 {
+		t.Errorf("Wait: got (%d, %v), want (3, nil)", code, err)
+	}
+	if attached != "cldpd-myrepo" {
+		t.Errorf("attached container: got %q, want %q", attached, "cldpd-myrepo")
+	}
+
+	want := []EventType{EventContainerAttached, EventOutput, EventContainerExited}
+	if len(events) != len(want) {
+		t.Fatalf("events: got %v, want types %v", events, want)
+	}
+	for i, typ := range want {
+		if events[i].Type != typ {
+			t.Errorf("event[%d]: got type %d, want %d", i, events[i].Type, typ)
+		}
+	}
+	if events[0].Data != "cldpd-myrepo" {
+		t.Errorf("ContainerAttached data: got %q, want %q", events[0].Data, "cldpd-myrepo")
+	}
+	if events[1].Data != "still working" {
+		t.Errorf("output: got %q, want %q", events[1].Data, "still working")
+	}
+}
+
+func TestDispatcher_Attach_RemovesContainer(t *testing.T) {
+	tests := []struct {
+		name        string
+		podJSON     string
+		wantRemoved bool
+	}{
+		{"default", "", true},
+		{"keepContainer", `{"keepContainer": true}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if tt.podJSON != "" {
+				if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+					t.Fatalf("write pod.json: %v", err)
+				}
+			}
+			removed := false
+			r := &mockRunner{
+				inspectFn: func(_ context.Context, _ string) (ContainerState, error) {
+					return ContainerState{Running: true}, nil
+				},
+				removeFn: func(context.Context, string, bool) error {
+					removed = true
+					return nil
+				},
+			}
+			d := NewDispatcher(podsDir, r)
+
+			s, err := d.Attach(context.Background(), "myrepo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+			if removed != tt.wantRemoved {
+				t.Errorf("removed: got %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Attach_NotRunning(t *testing.T) {
+	cases := map[string]func(context.Context, string) (ContainerState, error){
+		"missing": func(_ context.Context, c string) (ContainerState, error) {
+			return ContainerState{}, fmt.Errorf("%s: %w", c, ErrSessionNotFound)
+		},
+		"exited": func(_ context.Context, _ string) (ContainerState, error) {
+			return ContainerState{ExitCode: 1}, nil
+		},
+	}
+	for name, inspect := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &mockRunner{
+				inspectFn: inspect,
+				attachFn: func(_ context.Context, _ string, _ io.Writer) (int, error) {
+					t.Error("Attach called for a container that is not running")
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(t.TempDir(), r)
+			if _, err := d.Attach(context.Background(), "myrepo"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("got %v, want ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Attach_StopTargetsContainer(t *testing.T) {
+	stopped := make(chan struct{})
+	var stopContainer string
+	r := &mockRunner{
+		inspectFn: func(_ context.Context, _ string) (ContainerState, error) {
+			return ContainerState{Running: true}, nil
+		},
+		attachFn: func(_ context.Context, _ string, _ io.Writer) (int, error) {
+			<-stopped
+			return 143, nil
+		},
+		stopFn: func(_ context.Context, container string, _ time.Duration, _ string) error {
+			stopContainer = container
+			close(stopped)
+			return nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	s, err := d.Attach(context.Background(), "myrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if stopContainer != "cldpd-myrepo" {
+		t.Errorf("stop container: got %q, want %q", stopContainer, "cldpd-myrepo")
+	}
+	if code, _ := s.Wait(); code != 143 {
+		t.Errorf("exit code: got %d, want 143", code)
+	}
+}
+
+func TestDispatcher_Start_BuildEventsStreamLive(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	wrote := make(chan struct{})
+	release := make(chan struct{})
+	fb := builderFunc(func(_ context.Context, _ string, _ string, opts BuildOptions) error {
+		fmt.Fprintln(opts.Output, "Step 1/2 : FROM scratch")
+		close(wrote)
+		<-release
+		fmt.Fprintln(opts.Output, "Step 2/2 : COPY . .")
+		return nil
+	})
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb), WithDiskThresholds(DiskThresholds{}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("Start: unexpected error: %v", err)
+	}
+
+	// Start has returned while the build is still blocked. The first events
+	// must arrive before the build finishes, not all at once afterwards.
+	<-wrote
+	for _, want := range []EventType{EventBuildStarted, EventBuildOutput} {
+		select {
+		case e := <-s.Events():
+			if e.Type != want {
+				t.Fatalf("got event type %d, want %d", e.Type, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d not delivered while build in progress", want)
+		}
+	}
+	close(release)
+
+	events, _, err := drainSession(t, s, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	want := []EventType{EventBuildOutput, EventBuildComplete, EventContainerStarted, EventContainerExited}
+	if len(events) != len(want) {
+		t.Fatalf("remaining events: got %v, want types %v", events, want)
+	}
+	for i, typ := range want {
+		if events[i].Type != typ {
+			t.Errorf("event[%d]: got type %d, want %d", i, events[i].Type, typ)
+		}
+	}
+	if events[0].Data != "Step 2/2 : COPY . ." {
+		t.Errorf("build output: got %q", events[0].Data)
+	}
+}
+
+func TestResolveBuildArgs(t *testing.T) {
+	t.Setenv("CLDPD_TEST_NPM_TOKEN", "s3cret")
+	t.Setenv("CLDPD_TEST_REGISTRY", "registry.example.com")
+	cfg := PodConfig{
+		BuildArgs:        map[string]string{"REGISTRY": "static", "CLDPD_TEST_REGISTRY": "static"},
+		InheritBuildArgs: []string{"CLDPD_TEST_NPM_TOKEN", "CLDPD_TEST_REGISTRY", "CLDPD_TEST_UNSET"},
+	}
+
+	args, secrets, err := resolveBuildArgs(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"REGISTRY":             "static",
+		"CLDPD_TEST_REGISTRY":  "registry.example.com",
+		"CLDPD_TEST_NPM_TOKEN": "s3cret",
+	}
+	if !maps.Equal(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+	if _, ok := args["CLDPD_TEST_UNSET"]; ok {
+		t.Error("unset name should be skipped")
+	}
+	if len(secrets) != 2 {
+		t.Errorf("secrets: got %d values, want 2", len(secrets))
+	}
+	if len(cfg.BuildArgs) != 2 {
+		t.Errorf("input BuildArgs modified: %v", cfg.BuildArgs)
+	}
+}
+
+func TestDispatcher_Start_RequiredBuildArgUnset(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	cfg := `{"inheritBuildArgs":["CLDPD_TEST_UNSET"],"requireBuildArgs":true}`
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(cfg), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+	d := NewDispatcher(podsDir, &mockRunner{})
+
+	_, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), "CLDPD_TEST_UNSET") {
+		t.Errorf("got %v, want ErrInvalidConfig naming CLDPD_TEST_UNSET", err)
+	}
+}
+
+func TestDispatcher_Start_BuildArgSecretsRedacted(t *testing.T) {
+	t.Setenv("CLDPD_TEST_NPM_TOKEN", "s3cret")
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	dir := filepath.Join(podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(`{"inheritBuildArgs":["CLDPD_TEST_NPM_TOKEN"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var gotArg string
+	fb := builderFunc(func(_ context.Context, _ string, _ string, opts BuildOptions) error {
+		gotArg = opts.BuildArgs["CLDPD_TEST_NPM_TOKEN"]
+		fmt.Fprintln(opts.Output, "npm ERR! 401 token s3cret rejected")
+		return fmt.Errorf("%w: exit code 1: token s3cret rejected", ErrBuildFailed)
+	})
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb), WithDiskThresholds(DiskThresholds{}))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _, waitErr := drainSession(t, s, 2*time.Second)
+
+	if gotArg != "s3cret" {
+		t.Errorf("build arg: got %q, want the host value", gotArg)
+	}
+	if !errors.Is(waitErr, ErrBuildFailed) {
+		t.Errorf("Wait: got %v, want ErrBuildFailed", waitErr)
+	}
+	if strings.Contains(waitErr.Error(), "s3cret") {
+		t.Errorf("Wait error leaks secret: %v", waitErr)
+	}
+	for _, e := range events {
+		if strings.Contains(e.Data, "s3cret") {
+			t.Errorf("%v event leaks secret: %q", e.Type, e.Data)
+		}
+	}
+}
+
+func TestDispatcher_WithRestartPolicy(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var builds, runs int
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			builds++
+			return nil
+		},
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			runs++
+			if runs <= 2 {
+				return 1, nil
+			}
+			return 0, nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithRestartPolicy(3, time.Millisecond))
+
+	s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, code, _ := drainSession(t, s, 2*time.Second)
+
+	if code != 0 {
+		t.Errorf("exit code: got %d, want 0", code)
+	}
+	if builds != 1 || runs != 3 {
+		t.Errorf("builds/runs: got %d/%d, want 1/3", builds, runs)
+	}
+	restarts := 0
+	for _, e := range events {
+		if e.Type == EventRestart {
+			restarts++
+		}
+	}
+	if restarts != 2 {
+		t.Errorf("restart events: got %d, want 2", restarts)
+	}
+}
+
+func TestDispatcher_StopAll(t *testing.T) {
+	pods := []string{"alpha", "beta", "gamma"}
+	var mu sync.Mutex
+	unblock := make(map[string]chan struct{}, len(pods))
+	for _, p := range pods {
+		unblock[containerName(p)] = make(chan struct{})
+	}
+	r := &mockRunner{
+		execFn: func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+			mu.Lock()
+			ch := unblock[container]
+			mu.Unlock()
+			if ch == nil {
+				return 0, nil
+			}
+			<-ch
+			return 143, nil
+		},
+		stopFn: func(_ context.Context, container string, _ time.Duration, _ string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			close(unblock[container])
+			return nil
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+
+	// A session that has already exited must not be stopped.
+	done, err := d.Resume(context.Background(), "finished", "prompt")
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	drainSession(t, done, 2*time.Second)
+
+	var sessions []*Session
+	for _, p := range pods {
+		s, err := d.Resume(context.Background(), p, "prompt")
+		if err != nil {
+			t.Fatalf("Resume %s: %v", p, err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := d.StopAll(context.Background()); err != nil {
+		t.Fatalf("StopAll: %v", err)
+	}
+	for _, s := range sessions {
+		code, err := waitForDone(t, s, 2*time.Second)
+		if err != nil || code != 143 {
+			t.Errorf("%s: Wait got (%d, %v), want (143, nil)", s.ID(), code, err)
+		}
+		collectEvents(t, s.Events(), 2*time.Second)
+	}
+
+	// Every session has ended, so there is nothing left to stop.
+	if err := d.StopAll(context.Background()); err != nil {
+		t.Errorf("second StopAll: %v", err)
+	}
+}
+
+func TestDispatcher_StopAll_JoinsErrors(t *testing.T) {
+	stopErr := errors.New("daemon unavailable")
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		execFn: func(_ context.Context, _ string, _ []string, _ io.Writer) (int, error) {
+			<-unblock
+			return 0, nil
+		},
+		stopFn: func(_ context.Context, _ string, _ time.Duration, _ string) error {
+			return stopErr
+		},
+	}
+	d := NewDispatcher(t.TempDir(), r)
+	var sessions []*Session
+	for _, p := range []string{"alpha", "beta"} {
+		s, err := d.Resume(context.Background(), p, "prompt")
+		if err != nil {
+			t.Fatalf("Resume %s: %v", p, err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	err := d.StopAll(context.Background())
+	if !errors.Is(err, stopErr) {
+		t.Fatalf("StopAll: got %v, want %v", err, stopErr)
+	}
+	for _, s := range sessions {
+		if !strings.Contains(err.Error(), s.ID()) {
+			t.Errorf("StopAll error %q does not name session %s", err, s.ID())
+		}
+	}
+
+	close(unblock)
+	for _, s := range sessions {
+		drainSession(t, s, 2*time.Second)
+	}
+}
+
+func TestDispatcher_Build(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"),
+		[]byte(`{"image": "custom:v1", "buildArgs": {"A": "pod", "B": "pod"}}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+
+	var started bool
+	r := &mockRunner{
+		runFn: func(_ context.Context, _ RunOptions, _ io.Writer) (int, error) {
+			started = true
+			return 0, nil
+		},
+	}
+	fb := &fakeBuilder{}
+	d := NewDispatcher(podsDir, r, WithBuilder(fb))
+
+	err := d.Build(context.Background(), "myrepo", BuildOptions{
+		BuildArgs: map[string]string{"B": "opts"},
+		NoCache:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fb.calls != 1 {
+		t.Fatalf("builder calls: got %d, want 1", fb.calls)
+	}
+	if fb.tag != "custom:v1" {
+		t.Errorf("tag: got %q, want %q", fb.tag, "custom:v1")
+	}
+	if fb.dir != filepath.Join(podsDir, "myrepo") {
+		t.Errorf("dir: got %q, want %q", fb.dir, filepath.Join(podsDir, "myrepo"))
+	}
+	want := map[string]string{"A": "pod", "B": "opts"}
+	if !maps.Equal(fb.opts.BuildArgs, want) {
+		t.Errorf("build args: got %v, want %v", fb.opts.BuildArgs, want)
+	}
+	if !fb.opts.NoCache {
+		t.Error("NoCache: got false, want true")
+	}
+	if started {
+		t.Error("Build started a container")
+	}
+}
+
+func TestDispatcher_Build_ViaRunner(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+
+	var gotTag, gotDir string
+	r := &mockRunner{
+		buildFn: func(_ context.Context, tag, dir string, _ BuildOptions) error {
+			gotTag, gotDir = tag, dir
+			return nil
+		},
+	}
+	if err := NewDispatcher(podsDir, r).Build(context.Background(), "myrepo", BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotTag != imageTag("myrepo", "") {
+		t.Errorf("tag: got %q, want %q", gotTag, imageTag("myrepo", ""))
+	}
+	if gotDir != filepath.Join(podsDir, "myrepo") {
+		t.Errorf("dir: got %q, want %q", gotDir, filepath.Join(podsDir, "myrepo"))
+	}
+}
+
+func TestDispatcher_Start_RunnerGetsBuildOptions(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"buildTarget":"dev","build":{"noCache":true}}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+	var got BuildOptions
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _, _ string, opts BuildOptions) error {
+			got = opts
+			return nil
+		},
+	}
+	s, err := NewDispatcher(podsDir, r).StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Pull: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drainSession(t, s, 2*time.Second)
+	// A custom Runner builds with the same options a Builder would get.
+	if got.Target != "dev" || !got.NoCache || !got.Pull || got.Output == nil {
+		t.Errorf("build options: got %+v, want target, noCache, pull, and output", got)
+	}
+}
+
+func TestDispatcher_Start_BuildOutputKeepsLifecycleEvents(t *testing.T) {
+	for _, detach := range []bool{false, true} {
+		t.Run(fmt.Sprintf("detach=%v", detach), func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			r := &mockRunner{
+				buildFn: func(_ context.Context, _, _ string, opts BuildOptions) error {
+					for i := range 2 * eventChannelBuffer {
+						fmt.Fprintf(opts.Output, "step %d\n", i)
+					}
+					return nil
+				},
+				detachedFn: func(context.Context, RunOptions) (string, error) {
+					return "abc123", nil
+				},
+			}
+			s, err := NewDispatcher(podsDir, r).StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", StartOptions{Detach: detach})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Nobody reads Events until the session has ended, so the build
+			// output overflows the buffer.
+			waitForDone(t, s, 2*time.Second)
+			events := collectEvents(t, s.Events(), 2*time.Second)
+
+			var types []EventType
+			buildLines := 0
+			for _, e := range events {
+				if e.Type == EventBuildOutput {
+					buildLines++
+					continue
+				}
+				types = append(types, e.Type)
+			}
+			want := []EventType{EventBuildStarted, EventBuildComplete, EventContainerStarted, EventContainerExited}
+			if !slices.Equal(types, want) {
+				t.Errorf("events: got %v, want %v", types, want)
+			}
+			if buildLines == 0 || buildLines >= 2*eventChannelBuffer {
+				t.Errorf("build output lines: got %d, want some but not all of %d", buildLines, 2*eventChannelBuffer)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Build_StreamsRedactedOutput(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"),
+		[]byte(`{"inheritBuildArgs": ["CLDPD_TEST_BUILD_TOKEN"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+	t.Setenv("CLDPD_TEST_BUILD_TOKEN", "s3cret")
+
+	fb := builderFunc(func(_ context.Context, _ string, _ string, opts BuildOptions) error {
+		fmt.Fprintln(opts.Output, "step 1")
+		fmt.Fprintln(opts.Output, "token s3cret")
+		return nil
+	})
+	var out strings.Builder
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb))
+	if err := d.Build(context.Background(), "myrepo", BuildOptions{Output: &out}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := out.String(), "step 1\ntoken [redacted]\n"; got != want {
+		t.Errorf("output: got %q, want %q", got, want)
+	}
+}
+
+func TestDispatcher_Build_Errors(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	fb := &fakeBuilder{err: fmt.Errorf("%w: exit code 1", ErrBuildFailed)}
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb))
+
+	if err := d.Build(context.Background(), "missing", BuildOptions{}); !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("missing pod: got %v, want ErrPodNotFound", err)
+	}
+	if err := d.Build(context.Background(), "myrepo", BuildOptions{}); !errors.Is(err, ErrBuildFailed) {
+		t.Errorf("failed build: got %v, want ErrBuildFailed", err)
+	}
+}
+
+func TestDispatcher_Prefetch_PullsImage(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"image":"ghcr.io/org/agent:v1","pullPolicy":"missing"}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+	var pulled []string
+	r := &mockRunner{
+		pullFn: func(_ context.Context, image string, _ io.Writer) error {
+			pulled = append(pulled, image)
+			return nil
+		},
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			t.Error("Prefetch built a pod that runs an external image")
+			return nil
+		},
+	}
+	if err := NewDispatcher(podsDir, r).Prefetch(context.Background(), "myrepo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(pulled, []string{"ghcr.io/org/agent:v1"}) {
+		t.Errorf("pulled: got %v, want [ghcr.io/org/agent:v1]", pulled)
+	}
+
+	r.pullFn = func(context.Context, string, io.Writer) error {
+		return fmt.Errorf("%w: exit code 1: manifest unknown", ErrPullFailed)
+	}
+	if err := NewDispatcher(podsDir, r).Prefetch(context.Background(), "myrepo"); !errors.Is(err, ErrPullFailed) {
+		t.Errorf("failed pull: got %v, want ErrPullFailed", err)
+	}
+}
+
+func TestDispatcher_Prefetch_BuildsLocalTag(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	var built []string
+	r := &mockRunner{
+		buildFn: func(_ context.Context, tag, _ string, _ BuildOptions) error {
+			built = append(built, tag)
+			return nil
+		},
+		pullFn: func(context.Context, string, io.Writer) error {
+			t.Error("Prefetch pulled a locally built image")
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r)
+	if err := d.Prefetch(context.Background(), "myrepo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(built, []string{"cldpd-myrepo"}) {
+		t.Errorf("built: got %v, want [cldpd-myrepo]", built)
+	}
+	if err := d.Prefetch(context.Background(), "absent"); !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("unknown pod: got %v, want ErrPodNotFound", err)
+	}
+}
+
+func TestDispatcher_Prefetch_MatchesStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		podJSON   string
+		defaults  string
+		wantBuild string
+		wantPull  string
+	}{
+		{"named built tag", `{"image":"myorg/agent:v1"}`, "", "myorg/agent:v1", ""},
+		{"policy from defaults", `{"image":"ghcr.io/org/agent:v1"}`, `{"pullPolicy":"always"}`, "", "ghcr.io/org/agent:v1"},
+		{"image from defaults", `{}`, `{"image":"myorg/base:v1"}`, "myorg/base:v1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			writePodJSON(t, filepath.Join(podsDir, "myrepo"), tt.podJSON)
+			if tt.defaults != "" {
+				writeDefaultsJSON(t, podsDir, tt.defaults)
+			}
+
+			var prefetchBuilt, prefetchPulled, startImage string
+			r := &mockRunner{
+				buildFn: func(_ context.Context, tag, _ string, _ BuildOptions) error {
+					prefetchBuilt = tag
+					return nil
+				},
+				pullFn: func(_ context.Context, image string, _ io.Writer) error {
+					prefetchPulled = image
+					return nil
+				},
+				runFn: func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+					startImage = opts.Image
+					return 0, nil
+				},
+			}
+			d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+			if err := d.Prefetch(context.Background(), "myrepo"); err != nil {
+				t.Fatalf("Prefetch: %v", err)
+			}
+			if prefetchBuilt != tt.wantBuild {
+				t.Errorf("built: got %q, want %q", prefetchBuilt, tt.wantBuild)
+			}
+			if prefetchPulled != tt.wantPull {
+				t.Errorf("pulled: got %q, want %q", prefetchPulled, tt.wantPull)
+			}
+
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+			if want := tt.wantBuild + tt.wantPull; startImage != want {
+				t.Errorf("Start ran %q, Prefetch readied %q", startImage, want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_StartWith_BuildFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		podJSON string
+		opts    StartOptions
+		want    BuildOptions
+	}{
+		{"none", `{}`, StartOptions{}, BuildOptions{}},
+		{"pod.json", `{"build": {"pull": true}}`, StartOptions{}, BuildOptions{Pull: true}},
+		{"options", `{}`, StartOptions{NoCache: true, Pull: true}, BuildOptions{NoCache: true, Pull: true}},
+		{"combined", `{"build": {"noCache": true}}`, StartOptions{Pull: true}, BuildOptions{NoCache: true, Pull: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+			fb := &fakeBuilder{}
+			d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb), WithDiskThresholds(DiskThresholds{}))
+			s, err := d.StartWith(context.Background(), "myrepo", "https://github.com/org/repo/issues/1", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			if fb.opts.NoCache != tt.want.NoCache || fb.opts.Pull != tt.want.Pull {
+				t.Errorf("build flags: got NoCache=%v Pull=%v, want NoCache=%v Pull=%v",
+					fb.opts.NoCache, fb.opts.Pull, tt.want.NoCache, tt.want.Pull)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_DockerfileSyntaxError(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "Dockerfile"), []byte("RUN echo hi\n"), 0644); err != nil {
+		t.Fatalf("write Dockerfile: %v", err)
+	}
+	fb := &fakeBuilder{}
+	d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb))
+
+	if _, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1"); !errors.Is(err, ErrInvalidPod) {
+		t.Errorf("Start: got %v, want ErrInvalidPod", err)
+	}
+	if err := d.Build(context.Background(), "myrepo", BuildOptions{}); !errors.Is(err, ErrInvalidPod) {
+		t.Errorf("Build: got %v, want ErrInvalidPod", err)
+	}
+	if fb.calls != 0 {
+		t.Errorf("builder calls: got %d, want 0", fb.calls)
+	}
+}
+
+func TestDispatcher_Start_DockerfilePathAndTarget(t *testing.T) {
+	tests := []struct {
+		name           string
+		podJSON        string
+		wantDockerfile string // relative to the pod directory; empty means no -f
+		wantTarget     string
+	}{
+		{"default", `{}`, "", ""},
+		{"target only", `{"buildTarget": "dev"}`, "", "dev"},
+		{"containerfile", `{"dockerfilePath": "Containerfile", "buildTarget": "review"}`, "Containerfile", "review"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			makeTestPod(t, podsDir, "myrepo")
+			dir := filepath.Join(podsDir, "myrepo")
+			if err := os.WriteFile(filepath.Join(dir, "Containerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+				t.Fatalf("write Containerfile: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "pod.json"), []byte(tt.podJSON), 0644); err != nil {
+				t.Fatalf("write pod.json: %v", err)
+			}
+			fb := &fakeBuilder{}
+			d := NewDispatcher(podsDir, &mockRunner{}, WithBuilder(fb), WithDiskThresholds(DiskThresholds{}))
+			s, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			drainSession(t, s, 2*time.Second)
+
+			var want string
+			if tt.wantDockerfile != "" {
+				abs, err := filepath.Abs(filepath.Join(dir, tt.wantDockerfile))
+				if err != nil {
+					t.Fatalf("abs: %v", err)
+				}
+				want = abs
+			}
+			if fb.opts.Dockerfile != want {
+				t.Errorf("Dockerfile: got %q, want %q", fb.opts.Dockerfile, want)
+			}
+			if fb.opts.Target != tt.wantTarget {
+				t.Errorf("Target: got %q, want %q", fb.opts.Target, tt.wantTarget)
+			}
+		})
 	}
 }
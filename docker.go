@@ -3,20 +3,54 @@ package cldpd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Mount describes a bind mount to pass to the container.
+// Mount describes a bind mount or named volume to pass to the container.
 type Mount struct {
-	Source   string // host path
-	Target   string // container path
-	ReadOnly bool
+	Source   string `json:"source"`   // host path, or volume name when Type is MountTypeVolume
+	Target   string `json:"target"`   // container path
+	Type     string `json:"type"`     // MountTypeBind (the default when empty) or MountTypeVolume
+	ReadOnly bool   `json:"readOnly"` // mount read-only
+}
+
+// Mount types for Mount.Type.
+const (
+	// MountTypeBind mounts a host path. Its source is ~-expanded and subject
+	// to Policy mount source checks.
+	MountTypeBind = "bind"
+
+	// MountTypeVolume mounts a Docker named volume, created on first use,
+	// for state that should outlive containers without living in a host directory.
+	MountTypeVolume = "volume"
+)
+
+// Pull policies for RunOptions.Pull and PodConfig.PullPolicy, passed to
+// docker run --pull.
+const (
+	// PullAlways pulls the image before every run.
+	PullAlways = "always"
+
+	// PullMissing pulls the image only when it is not present locally.
+	PullMissing = "missing"
+
+	// PullNever never pulls; the run fails if the image is not present locally.
+	PullNever = "never"
+)
+
+// isVolume reports whether m mounts a named volume rather than a host path.
+func (m Mount) isVolume() bool {
+	return m.Type == MountTypeVolume
 }
 
 // Runner is the interface over Docker CLI operations.
@@ -27,14 +61,22 @@ type Runner interface {
 	// Returns ErrDockerUnavailable if the daemon cannot be contacted.
 	Preflight(ctx context.Context) error
 
-	// Build builds a Docker image tagged with tag from the Dockerfile in dir.
-	// buildArgs are passed as --build-arg K=V flags.
+	// Build builds a Docker image tagged with tag from the Dockerfile in dir,
+	// honouring every field of opts, as Builder.Build does; a Runner is the
+	// Dispatcher's Builder unless WithBuilder sets another.
 	// Returns ErrBuildFailed if the build exits with a non-zero status.
-	Build(ctx context.Context, tag string, dir string, buildArgs map[string]string) error
+	Build(ctx context.Context, tag string, dir string, opts BuildOptions) error
+
+	// Pull pulls image from its registry, streaming progress to the provided
+	// writer. Returns ErrPullFailed if the pull exits with a non-zero status.
+	Pull(ctx context.Context, image string, stdout io.Writer) error
 
 	// Run starts a container with the given options, streams its stdout to the
 	// provided writer, blocks until the container exits, and returns the exit code.
-	// A non-zero exit code is not itself an error — the caller interprets it.
+	// A non-zero exit code is not itself an error — the caller interprets it —
+	// except the codes docker reserves for its own failures: ErrDockerRunFailed
+	// for 125 and ErrCommandNotFound for 126 and 127. A container the kernel
+	// OOM-killed returns ErrOOMKilled.
 	Run(ctx context.Context, opts RunOptions, stdout io.Writer) (int, error)
 
 	// Exec runs a command in an already-running container, streams its stdout
@@ -42,10 +84,99 @@ type Runner interface {
 	// Returns ErrSessionNotFound if the container is not running.
 	Exec(ctx context.Context, container string, cmd []string, stdout io.Writer) (int, error)
 
-	// Stop sends SIGTERM to the named container via docker stop, waits up to timeout,
-	// then SIGKILL if needed. Returns ErrStopFailed on non-zero exit from docker stop.
-	// If the container is not found (already removed), Stop returns nil.
-	Stop(ctx context.Context, container string, timeout time.Duration) error
+	// ExecInteractive runs a command in an already-running container with the
+	// caller's stdin, stdout, and stderr wired straight through, allocating a
+	// TTY when stdout is a terminal. It blocks until the command exits and
+	// returns its exit code. Returns ErrSessionNotFound if the container is not
+	// running.
+	ExecInteractive(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+
+	// Attach streams the stdout of an already-running container from the moment
+	// of the call to the provided writer, blocks until the container exits, and
+	// returns its exit code. Output written before Attach is not replayed.
+	// Returns ErrSessionNotFound if the container is not running.
+	Attach(ctx context.Context, container string, stdout io.Writer) (int, error)
+
+	// RunDetached starts a container with the given options in the background
+	// and returns its ID once it is running, without waiting for it to exit.
+	// The container outlives ctx and the calling process; follow it with
+	// Attach and WaitContainer. Returns ErrDockerRunFailed or
+	// ErrCommandNotFound when the container cannot be started.
+	RunDetached(ctx context.Context, opts RunOptions) (string, error)
+
+	// WaitContainer blocks until the named container exits and returns its
+	// exit code; for a container that has already exited it returns at once.
+	// Returns ErrSessionNotFound if the container does not exist.
+	WaitContainer(ctx context.Context, container string) (int, error)
+
+	// Stop sends signal to the named container via docker stop, waits up to timeout,
+	// then SIGKILL if needed. An empty signal uses the container's configured stop
+	// signal (SIGTERM unless the image overrides it). Returns ErrStopFailed on non-zero
+	// exit from docker stop. If the container is not found (already removed), Stop returns nil.
+	Stop(ctx context.Context, container string, timeout time.Duration, signal string) error
+
+	// Kill sends SIGKILL to the named container via docker kill, without a grace period.
+	// Returns ErrKillFailed on non-zero exit from docker kill.
+	// If the container is not found (already removed) or has already exited, Kill returns nil.
+	Kill(ctx context.Context, container string) error
+
+	// Remove removes the named container via docker rm. With force, a running
+	// container is stopped first; without it, removing a running container
+	// fails. Returns ErrRemoveFailed on non-zero exit from docker rm.
+	// If the container is not found (already removed), Remove returns nil.
+	Remove(ctx context.Context, container string, force bool) error
+
+	// Health returns the healthcheck status of the named container (starting,
+	// healthy, or unhealthy). Returns an empty string if the container has no
+	// healthcheck. Returns ErrSessionNotFound if the container does not exist.
+	Health(ctx context.Context, container string) (string, error)
+
+	// Inspect returns the state of the named container, whether running or exited.
+	// Returns ErrSessionNotFound if the container does not exist.
+	Inspect(ctx context.Context, container string) (ContainerState, error)
+
+	// List returns the containers named for cldpd pods (cldpd-<pod>), including
+	// exited containers the runtime still holds only when all is set.
+	List(ctx context.Context, all bool) ([]ContainerSummary, error)
+
+	// DataRoot returns the host path where the runtime stores images and
+	// containers, or an empty string if it is unknown.
+	DataRoot(ctx context.Context) (string, error)
+
+	// Runtimes returns the names of the container runtimes registered with the
+	// daemon (e.g. runc, nvidia).
+	Runtimes(ctx context.Context) ([]string, error)
+
+	// ImageCreated returns when the image tag was created. Returns an error if
+	// the image does not exist.
+	ImageCreated(ctx context.Context, tag string) (time.Time, error)
+
+	// RemoveImage removes the image tag via docker image rm. Returns
+	// ErrImageRemoveFailed on non-zero exit, including when a container still
+	// uses the image. If the image is not found, RemoveImage returns nil.
+	RemoveImage(ctx context.Context, tag string) error
+
+	// Images returns the tags of the images named for cldpd pods (cldpd-<pod>),
+	// as repository:tag.
+	Images(ctx context.Context) ([]string, error)
+}
+
+// ContainerState describes a container as reported by the runtime.
+type ContainerState struct {
+	StartedAt time.Time // when the container last started
+	Image     string    // image the container was created from
+	ExitCode  int       // exit code of the last run; meaningful only when Running is false
+	Running   bool      // whether the container is currently running
+	OOMKilled bool      // whether the kernel OOM killer ended the last run
+}
+
+// ContainerSummary describes a cldpd container as reported by List.
+type ContainerSummary struct {
+	Name    string // container name (cldpd-<pod>)
+	Pod     string // pod the container was started for
+	Image   string // image the container was created from
+	Status  string // runtime's description, e.g. "Up 5 minutes" or "Exited (0) 2 hours ago"
+	Running bool   // whether the container is currently running
 }
 
 // RunOptions configures a docker run invocation.
@@ -54,37 +185,71 @@ type RunOptions struct {
 	Image      string            // Docker image to run
 	Name       string            // container name (--name); used for deterministic resume
 	Workdir    string            // working directory inside the container (-w)
+	Hostname   string            // container hostname (--hostname)
 	Cmd        []string          // command and arguments to run inside the container
 	InheritEnv []string          // host env var names to forward as -e NAME=VALUE
 	Mounts     []Mount           // bind mounts (-v source:target[:ro])
-	Remove     bool              // remove the container after it exits (--rm)
+	Ports      []string          // published ports (-p [ip:][host:]container[/proto])
+	User       string            // user to run as (--user uid[:gid] or name)
+	GPUs       string            // GPU devices to expose (--gpus), e.g. "all" or "device=0"
+	Pull       string            // image pull policy (--pull): PullAlways, PullMissing, or PullNever
+	Tmpfs      []string          // tmpfs mounts (--tmpfs path[:options])
+	ExtraHosts []string          // host-to-IP mappings (--add-host host:ip)
+	// SecurityOpts are passed as --security-opt flags (e.g. seccomp=/path, apparmor=name).
+	SecurityOpts []string
+	CapAdd       []string // capabilities to add (--cap-add)
+	Remove       bool     // remove the container after it exits (--rm)
+	Privileged   bool     // run with all capabilities and host devices (--privileged)
 }
 
 // DockerRunner implements Runner using the Docker CLI via os/exec.
-type DockerRunner struct{}
+// The zero value is ready to use.
+type DockerRunner struct {
+	// Builder performs image builds on behalf of Build. When nil, builds use
+	// DockerBuilder. Set it to mix build and run backends (e.g. buildah build
+	// with docker run).
+	Builder Builder
+}
+
+// daemonEnv names the environment variables the docker CLI reads to choose and
+// authenticate to a daemon.
+var daemonEnv = []string{"DOCKER_HOST", "DOCKER_CONTEXT", "DOCKER_TLS_VERIFY", "DOCKER_CERT_PATH", "DOCKER_CONFIG"}
+
+// dockerCommand returns a command running the docker CLI with args. Every
+// docker invocation goes through it, so that the CLI always sees the parent
+// environment: DOCKER_HOST and the rest of daemonEnv select the same daemon
+// for cldpd as for docker run by hand, and bare -e NAME flags resolve against
+// the host. Any future change to the command environment must start from
+// os.Environ for the same reason.
+func dockerCommand(ctx context.Context, args ...string) *exec.Cmd {
+	//nolint:gosec // fixed binary; arguments are built internally from pod config and generated names
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Env = os.Environ()
+	return cmd
+}
 
 // Preflight checks that the Docker daemon is reachable by running docker info.
-// Returns ErrDockerUnavailable if the daemon cannot be contacted.
+// Returns ErrDockerUnavailable if the daemon cannot be contacted. The error
+// lists the daemonEnv variables that are set, since they pick the daemon.
 func (d *DockerRunner) Preflight(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "docker", "info") //nolint:gosec // fixed binary, no user input
+	cmd := dockerCommand(ctx, "info")
 	cmd.Stdout = io.Discard
 	cmd.Stderr = io.Discard
 	if err := cmd.Run(); err != nil {
+		var set []string
+		for _, name := range daemonEnv {
+			if v := os.Getenv(name); v != "" {
+				set = append(set, name+"="+v)
+			}
+		}
+		if len(set) > 0 {
+			return fmt.Errorf("%w: %s: %w", ErrDockerUnavailable, strings.Join(set, " "), err)
+		}
 		return fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
 	}
 	return nil
 }
 
-// buildCmdArgs returns the docker CLI arguments for a build invocation.
-func buildCmdArgs(tag string, dir string, buildArgs map[string]string) []string {
-	args := []string{"build", "-t", tag}
-	for k, v := range buildArgs {
-		args = append(args, "--build-arg", k+"="+v)
-	}
-	args = append(args, dir)
-	return args
-}
-
 // runCmdArgs returns the docker CLI arguments for a run invocation.
 // InheritEnv values must already be resolved into Env by the caller before
 // calling runCmdArgs; InheritEnv in RunOptions is used only for names whose
@@ -97,6 +262,9 @@ func runCmdArgs(opts RunOptions) []string {
 	if opts.Name != "" {
 		args = append(args, "--name", opts.Name)
 	}
+	if opts.Hostname != "" {
+		args = append(args, "--hostname", opts.Hostname)
+	}
 	for k, v := range opts.Env {
 		args = append(args, "-e", k+"="+v)
 	}
@@ -115,6 +283,33 @@ func runCmdArgs(opts RunOptions) []string {
 		}
 		args = append(args, "-v", flag)
 	}
+	for _, t := range opts.Tmpfs {
+		args = append(args, "--tmpfs", t)
+	}
+	for _, p := range opts.Ports {
+		args = append(args, "-p", p)
+	}
+	for _, h := range opts.ExtraHosts {
+		args = append(args, "--add-host", h)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.GPUs != "" {
+		args = append(args, "--gpus", opts.GPUs)
+	}
+	if opts.Pull != "" {
+		args = append(args, "--pull", opts.Pull)
+	}
+	for _, o := range opts.SecurityOpts {
+		args = append(args, "--security-opt", o)
+	}
+	for _, c := range opts.CapAdd {
+		args = append(args, "--cap-add", c)
+	}
+	if opts.Privileged {
+		args = append(args, "--privileged")
+	}
 	if opts.Workdir != "" {
 		args = append(args, "-w", opts.Workdir)
 	}
@@ -128,67 +323,240 @@ func execCmdArgs(container string, cmd []string) []string {
 	return append([]string{"exec", container}, cmd...)
 }
 
-// Build builds a Docker image tagged with tag from the Dockerfile in dir.
-func (d *DockerRunner) Build(ctx context.Context, tag string, dir string, buildArgs map[string]string) error {
-	args := buildCmdArgs(tag, dir, buildArgs)
+// execInteractiveCmdArgs returns the docker CLI arguments for an interactive
+// exec invocation, with -t when tty is set.
+func execInteractiveCmdArgs(container string, cmd []string, tty bool) []string {
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	return append(append(args, container), cmd...)
+}
 
-	//nolint:gosec // args are constructed internally from trusted pod config, not user input
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	cmd.Stdout = io.Discard
+// isTerminal reports whether w is a character device, such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Build builds an image tagged with tag from the Dockerfile in dir. The build is
+// delegated to d.Builder when set, and to DockerBuilder otherwise.
+func (d *DockerRunner) Build(ctx context.Context, tag string, dir string, opts BuildOptions) error {
+	return d.builder().Build(ctx, tag, dir, opts)
+}
+
+// Pull pulls image via docker pull, streaming its progress to stdout, which
+// may be nil to discard it. Returns ErrPullFailed if docker pull exits with a
+// non-zero status, such as for an unknown image or a registry that refuses
+// the credentials.
+func (d *DockerRunner) Pull(ctx context.Context, image string, stdout io.Writer) error {
+	cmd := dockerCommand(ctx, "pull", image)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
+	cmd.Stdout = io.Discard
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
 	if err := cmd.Run(); err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
-			return fmt.Errorf("%w: exit code %d: %s", ErrBuildFailed, exitErr.ExitCode(), stderr.String())
+			return fmt.Errorf("%w: %s: exit code %d: %s", ErrPullFailed, image, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
 		}
-		return fmt.Errorf("%w: %w", ErrBuildFailed, err)
+		return fmt.Errorf("%w: %s: %w", ErrPullFailed, image, err)
 	}
 	return nil
 }
 
+// builder returns d.Builder, or a DockerBuilder when it is nil.
+func (d *DockerRunner) builder() Builder {
+	if d.Builder != nil {
+		return d.Builder
+	}
+	return &DockerBuilder{}
+}
+
 // Run starts a container with the given options, streams stdout, and blocks
-// until the container exits. Returns the container's exit code.
+// until the container exits. Returns the container's exit code, or an error
+// for the exit codes docker reserves for its own failures.
+//
+// A named container is run without --rm so that, when it exits with SIGKILL's
+// 137, Run can inspect it and return ErrOOMKilled if the kernel OOM killer
+// ended it. When opts.Remove is set, Run then removes the container itself;
+// if ctx is cancelled, the container is force-removed along with the docker
+// CLI. Whatever opts.Remove says, a named container is force-removed when the
+// docker CLI itself fails, such as when it is killed, since nothing is left to
+// follow the container and it would hold the name.
 func (d *DockerRunner) Run(ctx context.Context, opts RunOptions, stdout io.Writer) (int, error) {
-	args := runCmdArgs(opts)
+	runOpts := opts
+	if opts.Name != "" {
+		runOpts.Remove = false
+	}
+	args := runCmdArgs(runOpts)
 
-	//nolint:gosec // args are constructed internally from trusted pod config, not user input
-	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd := dockerCommand(ctx, args...)
 	cmd.Stdout = stdout
-	cmd.Stderr = io.Discard
+	code, err := runContainer(cmd)
+	if opts.Name == "" {
+		return code, err
+	}
+
+	// The run is over, or abandoned; inspection and cleanup must still happen.
+	cleanupCtx := context.WithoutCancel(ctx)
+	if err == nil {
+		code, err = checkOOM(cleanupCtx, d.Inspect, opts.Name, code)
+	}
+	// After a 125 the container may never have been created, and the name may
+	// belong to another container, as in a name conflict. A failed removal
+	// leaves the container for docker rm to clean up by hand.
+	clientFailed := err != nil && !errors.Is(err, ErrDockerRunFailed) && !errors.Is(err, ErrCommandNotFound)
+	if clientFailed || (opts.Remove && !errors.Is(err, ErrDockerRunFailed)) {
+		_ = d.Remove(cleanupCtx, opts.Name, true)
+	}
+	return code, err
+}
+
+// RunDetached starts a container via docker run -d and returns the container
+// ID docker prints. opts.Remove is passed through as --rm, so docker removes
+// the container itself when it exits.
+func (d *DockerRunner) RunDetached(ctx context.Context, opts RunOptions) (string, error) {
+	cmd := dockerCommand(ctx, runDetachedCmdArgs(opts)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	code, err := runContainer(cmd)
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		return "", fmt.Errorf("%w: exit code %d", ErrDockerRunFailed, code)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// runDetachedCmdArgs returns the docker CLI arguments for a detached run.
+func runDetachedCmdArgs(opts RunOptions) []string {
+	return slices.Insert(runCmdArgs(opts), 1, "-d")
+}
+
+// WaitContainer blocks until the named container exits via docker wait and
+// returns its exit code. Returns ErrSessionNotFound if the container does not
+// exist.
+func (d *DockerRunner) WaitContainer(ctx context.Context, container string) (int, error) {
+	cmd := dockerCommand(ctx, "wait", container)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
 		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return exitErr.ExitCode(), nil
+		if errors.As(err, &exitErr) && strings.Contains(stderr.String(), "No such container") {
+			return -1, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+		}
+		return -1, fmt.Errorf("docker wait: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseWaitOutput(stdout.String())
+}
+
+// parseWaitOutput parses the exit code docker wait prints.
+func parseWaitOutput(out string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return -1, fmt.Errorf("parse docker wait output %q: %w", out, err)
+	}
+	return code, nil
+}
+
+// exitKilled is the exit code of a container ended by SIGKILL, whether from
+// docker kill or the kernel OOM killer.
+const exitKilled = 137
+
+// checkOOM returns ErrOOMKilled in place of a 137 exit code when inspect
+// reports that the OOM killer ended container. Any other code, or a failed
+// inspection, returns code unchanged.
+func checkOOM(ctx context.Context, inspect func(context.Context, string) (ContainerState, error), container string, code int) (int, error) {
+	if code != exitKilled {
+		return code, nil
+	}
+	state, err := inspect(ctx, container)
+	if err != nil || !state.OOMKilled {
+		return code, nil
+	}
+	return -1, fmt.Errorf("%w: %s", ErrOOMKilled, container)
+}
+
+// Exit codes docker run reserves for its own failures rather than the
+// container's; see the docker run reference.
+const (
+	exitDockerFailed   = 125
+	exitCannotInvoke   = 126
+	exitCommandMissing = 127
+)
+
+// runStderrLimit bounds how much of docker run's and docker build's stderr is
+// kept for error messages. The container's own stderr, or the whole build
+// log, flows through it.
+const runStderrLimit = 4096
+
+// runContainer runs cmd, a docker run invocation, and returns the container's
+// exit code. Exits docker reserves for its own failures return -1 with
+// ErrDockerRunFailed or ErrCommandNotFound, carrying the tail of stderr. A
+// client that fails without an exit code, because it could not be started or
+// was killed by a signal, returns -1 with any other error.
+func runContainer(cmd *exec.Cmd) (int, error) {
+	stderr := &tailBuffer{limit: runStderrLimit}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() == -1 {
+			return -1, fmt.Errorf("docker run: %w", err)
+		}
+		code := exitErr.ExitCode()
+		msg := strings.TrimSpace(stderr.String())
+		switch code {
+		case exitDockerFailed:
+			return -1, fmt.Errorf("%w: %s", ErrDockerRunFailed, msg)
+		case exitCannotInvoke, exitCommandMissing:
+			return -1, fmt.Errorf("%w: exit code %d: %s", ErrCommandNotFound, code, msg)
 		}
-		return -1, fmt.Errorf("docker run: %w", err)
+		return code, nil
 	}
 	return 0, nil
 }
 
+// tailBuffer is an io.Writer that keeps only the last limit bytes written.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
 // Exec runs a command in an already-running container and streams its stdout.
 // Returns ErrSessionNotFound if the container does not exist or is not running.
 // For all other non-zero exits the exit code is returned with a nil error.
 func (d *DockerRunner) Exec(ctx context.Context, container string, cmd []string, stdout io.Writer) (int, error) {
-	// Preflight: verify the container exists and is running.
-	// docker inspect exits non-zero if the container does not exist.
-	//nolint:gosec // container name is generated internally, not from user input
-	inspect := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.State.Running}}", container)
-	out, err := inspect.Output()
-	if err != nil {
-		return -1, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
-	}
-	if strings.TrimSpace(string(out)) != "true" {
-		return -1, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	if err := requireRunning(ctx, container); err != nil {
+		return -1, err
 	}
 
 	args := execCmdArgs(container, cmd)
-	//nolint:gosec // args are constructed internally from trusted pod config, not user input
-	c := exec.CommandContext(ctx, "docker", args...)
+	c := dockerCommand(ctx, args...)
 	c.Stdout = stdout
 	c.Stderr = io.Discard
 
-	err = c.Run()
+	err := c.Run()
 	if err == nil {
 		return 0, nil
 	}
@@ -202,16 +570,95 @@ func (d *DockerRunner) Exec(ctx context.Context, container string, cmd []string,
 	return -1, err
 }
 
-// Stop sends SIGTERM to the named container via docker stop, waits up to timeout,
-// then SIGKILL if needed. If the container is not found (already removed), returns nil.
-// Returns ErrStopFailed if docker stop exits with a non-zero status for any other reason.
-func (d *DockerRunner) Stop(ctx context.Context, container string, timeout time.Duration) error {
+// ExecInteractive runs a command in an already-running container via
+// docker exec -i, adding -t when stdout is a terminal, with stdin, stdout, and
+// stderr passed to the docker CLI as they are. Returns ErrSessionNotFound if
+// the container does not exist or is not running. For all other non-zero
+// exits the exit code is returned with a nil error.
+func (d *DockerRunner) ExecInteractive(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if err := requireRunning(ctx, container); err != nil {
+		return -1, err
+	}
+
+	c := dockerCommand(ctx, execInteractiveCmdArgs(container, cmd, isTerminal(stdout))...)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	err := c.Run()
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return -1, err
+}
+
+// requireRunning returns ErrSessionNotFound unless the named container exists
+// and is running. docker inspect exits non-zero if the container does not exist.
+func requireRunning(ctx context.Context, container string) error {
+	inspect := dockerCommand(ctx, "inspect", "--format", "{{.State.Running}}", container)
+	out, err := inspect.Output()
+	if err != nil || strings.TrimSpace(string(out)) != "true" {
+		return fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	}
+	return nil
+}
+
+// Attach follows the running container's logs from now via docker logs -f and
+// takes the exit code from docker wait, which is started first so that the
+// exit of a --rm container is not missed. Returns ErrSessionNotFound if the
+// container does not exist or is not running.
+func (d *DockerRunner) Attach(ctx context.Context, container string, stdout io.Writer) (int, error) {
+	if err := requireRunning(ctx, container); err != nil {
+		return -1, err
+	}
+	since := time.Now().UTC().Format(time.RFC3339Nano)
+
+	wait := dockerCommand(ctx, "wait", container)
+	var waitOut bytes.Buffer
+	wait.Stdout = &waitOut
+	wait.Stderr = io.Discard
+	if err := wait.Start(); err != nil {
+		return -1, fmt.Errorf("docker wait: %w", err)
+	}
+
+	logs := dockerCommand(ctx, "logs", "--follow", "--since", since, container)
+	logs.Stdout = stdout
+	logs.Stderr = io.Discard
+	// docker logs -f returns once the container stops. Its own status carries
+	// nothing docker wait does not, so only wait's result is reported.
+	_ = logs.Run()
+
+	if err := wait.Wait(); err != nil {
+		return -1, fmt.Errorf("docker wait: %w", err)
+	}
+	return parseWaitOutput(waitOut.String())
+}
+
+// stopCmdArgs returns the docker CLI arguments for a stop invocation.
+// The timeout is rounded down to whole seconds with a floor of 1 second.
+// An empty signal omits --signal so docker uses the container's stop signal.
+func stopCmdArgs(container string, timeout time.Duration, signal string) []string {
 	secs := int(timeout.Seconds())
 	if secs < 1 {
 		secs = 1
 	}
-	//nolint:gosec // container name is generated internally, not from user input
-	cmd := exec.CommandContext(ctx, "docker", "stop", "-t", strconv.Itoa(secs), container)
+	args := []string{"stop", "-t", strconv.Itoa(secs)}
+	if signal != "" {
+		args = append(args, "--signal", signal)
+	}
+	return append(args, container)
+}
+
+// Stop sends signal to the named container via docker stop, waits up to timeout,
+// then SIGKILL if needed. If the container is not found (already removed), returns nil.
+// Returns ErrStopFailed if docker stop exits with a non-zero status for any other reason.
+func (d *DockerRunner) Stop(ctx context.Context, container string, timeout time.Duration, signal string) error {
+	args := stopCmdArgs(container, timeout, signal)
+	cmd := dockerCommand(ctx, args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	cmd.Stdout = io.Discard
@@ -229,3 +676,251 @@ func (d *DockerRunner) Stop(ctx context.Context, container string, timeout time.
 	}
 	return nil
 }
+
+// Kill sends SIGKILL to the named container via docker kill. If the container is
+// not found (already removed) or not running (already exited), returns nil.
+// Returns ErrKillFailed if docker kill exits with a non-zero status for any
+// other reason.
+func (d *DockerRunner) Kill(ctx context.Context, container string) error {
+	cmd := dockerCommand(ctx, "kill", container)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = io.Discard
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := stderr.String()
+			// "No such container" and "is not running" are not errors — the
+			// container was already removed or has already exited.
+			if strings.Contains(msg, "No such container") || strings.Contains(msg, "is not running") {
+				return nil
+			}
+			return fmt.Errorf("%w: exit code %d: %s", ErrKillFailed, exitErr.ExitCode(), msg)
+		}
+		return fmt.Errorf("%w: %w", ErrKillFailed, err)
+	}
+	return nil
+}
+
+// Remove removes the named container via docker rm, with -f when force is set.
+// If the container is not found (already removed), returns nil. Returns
+// ErrRemoveFailed if docker rm exits with a non-zero status for any other reason.
+func (d *DockerRunner) Remove(ctx context.Context, container string, force bool) error {
+	args := []string{"rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, container)
+	cmd := dockerCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = io.Discard
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := stderr.String()
+			if strings.Contains(msg, "No such container") {
+				return nil
+			}
+			return fmt.Errorf("%w: exit code %d: %s", ErrRemoveFailed, exitErr.ExitCode(), msg)
+		}
+		return fmt.Errorf("%w: %w", ErrRemoveFailed, err)
+	}
+	return nil
+}
+
+// healthFormat is the docker inspect template for a container's health status.
+// It renders empty rather than failing when the container has no healthcheck.
+const healthFormat = "{{if .State.Health}}{{.State.Health.Status}}{{end}}"
+
+// Health returns the healthcheck status of the named container via docker inspect.
+// Returns an empty string if the container defines no healthcheck.
+// Returns ErrSessionNotFound if the container does not exist.
+func (d *DockerRunner) Health(ctx context.Context, container string) (string, error) {
+	cmd := dockerCommand(ctx, "inspect", "--format", healthFormat, container)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// inspectFormat is the docker inspect template for Inspect. Fields are
+// separated by "|", which cannot appear in any of them.
+const inspectFormat = "{{.State.Running}}|{{.State.StartedAt}}|{{.State.ExitCode}}|{{.State.OOMKilled}}|{{.Config.Image}}"
+
+// Inspect returns the state of the named container via docker inspect.
+// Returns ErrSessionNotFound if the container does not exist.
+func (d *DockerRunner) Inspect(ctx context.Context, container string) (ContainerState, error) {
+	cmd := dockerCommand(ctx, "inspect", "--format", inspectFormat, container)
+	out, err := cmd.Output()
+	if err != nil {
+		return ContainerState{}, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	}
+	return parseInspect(strings.TrimSpace(string(out)))
+}
+
+// parseInspect parses docker inspect output rendered with inspectFormat.
+func parseInspect(out string) (ContainerState, error) {
+	fields := strings.SplitN(out, "|", 5)
+	if len(fields) != 5 {
+		return ContainerState{}, fmt.Errorf("parse inspect output %q: expected 5 fields", out)
+	}
+	code, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return ContainerState{}, fmt.Errorf("parse inspect exit code %q: %w", fields[2], err)
+	}
+	startedAt, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		return ContainerState{}, fmt.Errorf("parse inspect start time %q: %w", fields[1], err)
+	}
+	return ContainerState{
+		Running:   fields[0] == "true",
+		StartedAt: startedAt,
+		ExitCode:  code,
+		OOMKilled: fields[3] == "true",
+		Image:     fields[4],
+	}, nil
+}
+
+// listFormat is the docker ps template for List. Fields are separated by "|",
+// which cannot appear in any of them.
+const listFormat = "{{.Names}}|{{.Image}}|{{.State}}|{{.Status}}"
+
+// List returns cldpd containers via docker ps, filtered by name prefix.
+func (d *DockerRunner) List(ctx context.Context, all bool) ([]ContainerSummary, error) {
+	args := []string{"ps", "--filter", "name=^" + namePrefix, "--format", listFormat}
+	if all {
+		args = append(args, "--all")
+	}
+	cmd := dockerCommand(ctx, args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
+	}
+	return parseList(string(out))
+}
+
+// parseList parses docker ps output rendered with listFormat, skipping any
+// container whose name cldpd did not derive from a pod.
+func parseList(out string) ([]ContainerSummary, error) {
+	var list []ContainerSummary
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "|", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("parse ps output %q: expected 4 fields", line)
+		}
+		pod, ok := podFromContainer(fields[0])
+		if !ok {
+			continue
+		}
+		list = append(list, ContainerSummary{
+			Name:    fields[0],
+			Pod:     pod,
+			Image:   fields[1],
+			Status:  fields[3],
+			Running: fields[2] == "running",
+		})
+	}
+	return list, nil
+}
+
+// DataRoot returns the Docker daemon's data root (DockerRootDir) via docker info.
+// With Docker Desktop the path is inside a VM and may not exist on the host.
+func (d *DockerRunner) DataRoot(ctx context.Context) (string, error) {
+	cmd := dockerCommand(ctx, "info", "--format", "{{.DockerRootDir}}")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Runtimes returns the runtimes registered with the Docker daemon via docker info.
+func (d *DockerRunner) Runtimes(ctx context.Context) ([]string, error) {
+	cmd := dockerCommand(ctx, "info", "--format", "{{json .Runtimes}}")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
+	}
+	return parseRuntimes(out)
+}
+
+// ImageCreated returns the creation time of the image tag via docker image inspect.
+func (d *DockerRunner) ImageCreated(ctx context.Context, tag string) (time.Time, error) {
+	cmd := dockerCommand(ctx, "image", "inspect", "--format", "{{.Created}}", tag)
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("inspect image %s: %w", tag, err)
+	}
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse image creation time %q: %w", strings.TrimSpace(string(out)), err)
+	}
+	return created, nil
+}
+
+// RemoveImage removes the image tag via docker image rm. If the image is not
+// found, returns nil. Returns ErrImageRemoveFailed if docker image rm exits with
+// a non-zero status for any other reason.
+func (d *DockerRunner) RemoveImage(ctx context.Context, tag string) error {
+	cmd := dockerCommand(ctx, "image", "rm", tag)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = io.Discard
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := stderr.String()
+			if strings.Contains(msg, "No such image") {
+				return nil
+			}
+			return fmt.Errorf("%w: exit code %d: %s", ErrImageRemoveFailed, exitErr.ExitCode(), msg)
+		}
+		return fmt.Errorf("%w: %w", ErrImageRemoveFailed, err)
+	}
+	return nil
+}
+
+// Images returns the tags of cldpd images via docker image ls, filtered by
+// repository name prefix.
+func (d *DockerRunner) Images(ctx context.Context) ([]string, error) {
+	cmd := dockerCommand(ctx, "image", "ls",
+		"--filter", "reference="+namePrefix+"*", "--format", "{{.Repository}}:{{.Tag}}")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
+	}
+	return parseImages(string(out)), nil
+}
+
+// parseImages parses docker image ls output, one repository:tag per line,
+// skipping untagged images and any whose repository cldpd did not derive from
+// a pod.
+func parseImages(out string) []string {
+	var tags []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if _, ok := podFromImage(line); ok {
+			tags = append(tags, line)
+		}
+	}
+	return tags
+}
+
+// parseRuntimes returns the sorted runtime names from the JSON object docker
+// info renders for .Runtimes, which is keyed by runtime name.
+func parseRuntimes(out []byte) ([]string, error) {
+	var runtimes map[string]json.RawMessage
+	if err := json.Unmarshal(out, &runtimes); err != nil {
+		return nil, fmt.Errorf("parse runtimes: %w", err)
+	}
+	names := make([]string, 0, len(runtimes))
+	for name := range runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -6,8 +6,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -16,10 +21,25 @@ import (
 // mockRunner is a test double for Runner.
 type mockRunner struct {
 	preflightFn func(ctx context.Context) error
-	buildFn     func(ctx context.Context, tag string, dir string, buildArgs map[string]string) error
+	buildFn     func(ctx context.Context, tag string, dir string, opts BuildOptions) error
+	pullFn      func(ctx context.Context, image string, stdout io.Writer) error
 	runFn       func(ctx context.Context, opts RunOptions, stdout io.Writer) (int, error)
 	execFn      func(ctx context.Context, container string, cmd []string, stdout io.Writer) (int, error)
-	stopFn      func(ctx context.Context, container string, timeout time.Duration) error
+	attachFn    func(ctx context.Context, container string, stdout io.Writer) (int, error)
+	shellFn     func(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+	detachedFn  func(ctx context.Context, opts RunOptions) (string, error)
+	waitFn      func(ctx context.Context, container string) (int, error)
+	stopFn      func(ctx context.Context, container string, timeout time.Duration, signal string) error
+	killFn      func(ctx context.Context, container string) error
+	removeFn    func(ctx context.Context, container string, force bool) error
+	healthFn    func(ctx context.Context, container string) (string, error)
+	inspectFn   func(ctx context.Context, container string) (ContainerState, error)
+	listFn      func(ctx context.Context, all bool) ([]ContainerSummary, error)
+	dataRootFn  func(ctx context.Context) (string, error)
+	runtimesFn  func(ctx context.Context) ([]string, error)
+	imageFn     func(ctx context.Context, tag string) (time.Time, error)
+	rmImageFn   func(ctx context.Context, tag string) error
+	imagesFn    func(ctx context.Context) ([]string, error)
 }
 
 func (m *mockRunner) Preflight(ctx context.Context) error {
@@ -29,9 +49,16 @@ func (m *mockRunner) Preflight(ctx context.Context) error {
 	return nil
 }
 
-func (m *mockRunner) Build(ctx context.Context, tag string, dir string, buildArgs map[string]string) error {
+func (m *mockRunner) Build(ctx context.Context, tag string, dir string, opts BuildOptions) error {
 	if m.buildFn != nil {
-		return m.buildFn(ctx, tag, dir, buildArgs)
+		return m.buildFn(ctx, tag, dir, opts)
+	}
+	return nil
+}
+
+func (m *mockRunner) Pull(ctx context.Context, image string, stdout io.Writer) error {
+	if m.pullFn != nil {
+		return m.pullFn(ctx, image, stdout)
 	}
 	return nil
 }
@@ -50,45 +77,138 @@ func (m *mockRunner) Exec(ctx context.Context, container string, cmd []string, s
 	return 0, nil
 }
 
-func (m *mockRunner) Stop(ctx context.Context, container string, timeout time.Duration) error {
+func (m *mockRunner) ExecInteractive(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if m.shellFn != nil {
+		return m.shellFn(ctx, container, cmd, stdin, stdout, stderr)
+	}
+	return 0, nil
+}
+
+func (m *mockRunner) Attach(ctx context.Context, container string, stdout io.Writer) (int, error) {
+	if m.attachFn != nil {
+		return m.attachFn(ctx, container, stdout)
+	}
+	return 0, nil
+}
+
+func (m *mockRunner) RunDetached(ctx context.Context, opts RunOptions) (string, error) {
+	if m.detachedFn != nil {
+		return m.detachedFn(ctx, opts)
+	}
+	return "0123456789ab", nil
+}
+
+func (m *mockRunner) WaitContainer(ctx context.Context, container string) (int, error) {
+	if m.waitFn != nil {
+		return m.waitFn(ctx, container)
+	}
+	return 0, nil
+}
+
+func (m *mockRunner) Stop(ctx context.Context, container string, timeout time.Duration, signal string) error {
 	if m.stopFn != nil {
-		return m.stopFn(ctx, container, timeout)
+		return m.stopFn(ctx, container, timeout, signal)
+	}
+	return nil
+}
+
+func (m *mockRunner) Kill(ctx context.Context, container string) error {
+	if m.killFn != nil {
+		return m.killFn(ctx, container)
+	}
+	return nil
+}
+
+func (m *mockRunner) Remove(ctx context.Context, container string, force bool) error {
+	if m.removeFn != nil {
+		return m.removeFn(ctx, container, force)
+	}
+	return nil
+}
+
+func (m *mockRunner) Health(ctx context.Context, container string) (string, error) {
+	if m.healthFn != nil {
+		return m.healthFn(ctx, container)
+	}
+	return "", nil
+}
+
+func (m *mockRunner) Inspect(ctx context.Context, container string) (ContainerState, error) {
+	if m.inspectFn != nil {
+		return m.inspectFn(ctx, container)
+	}
+	return ContainerState{}, nil
+}
+
+func (m *mockRunner) List(ctx context.Context, all bool) ([]ContainerSummary, error) {
+	if m.listFn != nil {
+		return m.listFn(ctx, all)
+	}
+	return nil, nil
+}
+
+func (m *mockRunner) DataRoot(ctx context.Context) (string, error) {
+	if m.dataRootFn != nil {
+		return m.dataRootFn(ctx)
+	}
+	return "", nil
+}
+
+func (m *mockRunner) Runtimes(ctx context.Context) ([]string, error) {
+	if m.runtimesFn != nil {
+		return m.runtimesFn(ctx)
+	}
+	return nil, nil
+}
+
+func (m *mockRunner) ImageCreated(ctx context.Context, tag string) (time.Time, error) {
+	if m.imageFn != nil {
+		return m.imageFn(ctx, tag)
+	}
+	return time.Time{}, nil
+}
+
+func (m *mockRunner) RemoveImage(ctx context.Context, tag string) error {
+	if m.rmImageFn != nil {
+		return m.rmImageFn(ctx, tag)
 	}
 	return nil
 }
 
+func (m *mockRunner) Images(ctx context.Context) ([]string, error) {
+	if m.imagesFn != nil {
+		return m.imagesFn(ctx)
+	}
+	return nil, nil
+}
+
 // Compile-time interface assertions.
 var _ Runner = (*DockerRunner)(nil)
 var _ Runner = (*mockRunner)(nil)
 
-func TestBuildCmdArgs_Minimal(t *testing.T) {
-	args := buildCmdArgs("myimage:latest", "/some/dir", nil)
-	want := []string{"build", "-t", "myimage:latest", "/some/dir"}
-	if len(args) != len(want) {
-		t.Fatalf("args: got %v, want %v", args, want)
+func TestStopCmdArgs_DefaultSignal(t *testing.T) {
+	args := stopCmdArgs("ctn", 10*time.Second, "")
+	want := []string{"stop", "-t", "10", "ctn"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Errorf("args: got %v, want %v", args, want)
 	}
-	for i := range want {
-		if args[i] != want[i] {
-			t.Errorf("args[%d]: got %q, want %q", i, args[i], want[i])
-		}
+}
+
+func TestStopCmdArgs_WithSignal(t *testing.T) {
+	args := stopCmdArgs("ctn", 30*time.Second, "SIGINT")
+	want := []string{"stop", "-t", "30", "--signal", "SIGINT", "ctn"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Errorf("args: got %v, want %v", args, want)
 	}
 }
 
-func TestBuildCmdArgs_WithBuildArgs(t *testing.T) {
-	args := buildCmdArgs("img", "/dir", map[string]string{"KEY": "val"})
-	// Must contain --build-arg KEY=val before the dir.
-	var foundBuildArg bool
-	for i, a := range args {
-		if a == "--build-arg" && i+1 < len(args) && args[i+1] == "KEY=val" {
-			foundBuildArg = true
+func TestStopCmdArgs_ZeroTimeout_ClampsToOne(t *testing.T) {
+	for _, timeout := range []time.Duration{0, 500 * time.Millisecond, -time.Second} {
+		args := stopCmdArgs("ctn", timeout, "")
+		if args[1] != "-t" || args[2] != "1" {
+			t.Errorf("timeout %v: got %v, want -t 1", timeout, args)
 		}
 	}
-	if !foundBuildArg {
-		t.Errorf("args missing --build-arg KEY=val: %v", args)
-	}
-	if args[len(args)-1] != "/dir" {
-		t.Errorf("last arg should be dir, got %q", args[len(args)-1])
-	}
 }
 
 func TestRunCmdArgs_Minimal(t *testing.T) {
@@ -174,6 +294,56 @@ func TestExecCmdArgs(t *testing.T) {
 	}
 }
 
+func TestExecInteractiveCmdArgs(t *testing.T) {
+	tests := []struct {
+		tty  bool
+		want []string
+	}{
+		{tty: false, want: []string{"exec", "-i", "cldpd-myrepo", "/bin/bash"}},
+		{tty: true, want: []string{"exec", "-i", "-t", "cldpd-myrepo", "/bin/bash"}},
+	}
+	for _, tt := range tests {
+		if got := execInteractiveCmdArgs("cldpd-myrepo", []string{"/bin/bash"}, tt.tty); !slices.Equal(got, tt.want) {
+			t.Errorf("tty=%v: got %v, want %v", tt.tty, got, tt.want)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer file.Close()
+
+	for name, w := range map[string]io.Writer{"pipe": pw, "file": file, "buffer": &bytes.Buffer{}} {
+		if isTerminal(w) {
+			t.Errorf("%s: got terminal", name)
+		}
+	}
+}
+
+func TestDockerRunner_ExecInteractive_TTY(t *testing.T) {
+	out := fakeDocker(t, `case "$1" in
+inspect) echo true ;;
+exec) echo "$@" > "$OUT"; exit 4 ;;
+esac`)
+	code, err := (&DockerRunner{}).ExecInteractive(context.Background(), "cldpd-myrepo", []string{"cat"}, strings.NewReader(""), &bytes.Buffer{}, io.Discard)
+	if err != nil || code != 4 {
+		t.Fatalf("got (%d, %v), want (4, nil)", code, err)
+	}
+	// A buffer is not a terminal, so no TTY is requested.
+	if got, _ := os.ReadFile(out); strings.TrimSpace(string(got)) != "exec -i cldpd-myrepo cat" {
+		t.Errorf("args: got %q", got)
+	}
+}
+
 func TestRunCmdArgs_NoRemove(t *testing.T) {
 	opts := RunOptions{Image: "img", Remove: false}
 	args := runCmdArgs(opts)
@@ -184,6 +354,38 @@ func TestRunCmdArgs_NoRemove(t *testing.T) {
 	}
 }
 
+func TestRunDetachedCmdArgs(t *testing.T) {
+	opts := RunOptions{Image: "img", Name: "cldpd-test", Cmd: []string{"sleep", "1"}}
+	args := runDetachedCmdArgs(opts)
+	want := append([]string{"run", "-d"}, runCmdArgs(opts)[1:]...)
+	if !slices.Equal(args, want) {
+		t.Errorf("args: got %v, want %v", args, want)
+	}
+	if slices.Contains(runCmdArgs(opts), "-d") {
+		t.Error("-d should not be present for a blocking run")
+	}
+}
+
+func TestParseWaitOutput(t *testing.T) {
+	tests := []struct {
+		out     string
+		want    int
+		wantErr bool
+	}{
+		{out: "0\n", want: 0},
+		{out: "137\n", want: 137},
+		{out: "  2 ", want: 2},
+		{out: "", want: -1, wantErr: true},
+		{out: "Error response from daemon\n", want: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		code, err := parseWaitOutput(tt.out)
+		if code != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseWaitOutput(%q): got (%d, %v), want %d (error: %v)", tt.out, code, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
 func TestRunCmdArgs_NoName(t *testing.T) {
 	opts := RunOptions{Image: "img"}
 	args := runCmdArgs(opts)
@@ -274,6 +476,29 @@ func TestRunCmdArgs_Mounts_ReadWrite(t *testing.T) {
 	}
 }
 
+func TestRunCmdArgs_Mounts_Types(t *testing.T) {
+	opts := RunOptions{
+		Image: "img",
+		Mounts: []Mount{
+			{Source: "/host/path", Target: "/src", Type: MountTypeBind},
+			{Source: "claude-cache", Target: "/root/.cache/claude", Type: MountTypeVolume},
+			{Source: "models", Target: "/models", Type: MountTypeVolume, ReadOnly: true},
+		},
+	}
+	args := runCmdArgs(opts)
+
+	var got []string
+	for i, a := range args {
+		if a == "-v" && i+1 < len(args) {
+			got = append(got, args[i+1])
+		}
+	}
+	want := []string{"/host/path:/src", "claude-cache:/root/.cache/claude", "models:/models:ro"}
+	if !slices.Equal(got, want) {
+		t.Errorf("-v flags: got %v, want %v", got, want)
+	}
+}
+
 func TestRunCmdArgs_Mounts_ReadOnly(t *testing.T) {
 	opts := RunOptions{
 		Image: "img",
@@ -333,6 +558,210 @@ func TestRunCmdArgs_NoMounts(t *testing.T) {
 	}
 }
 
+func TestRunCmdArgs_Tmpfs(t *testing.T) {
+	tests := []struct {
+		name  string
+		tmpfs []string
+	}{
+		{"single", []string{"/tmp"}},
+		{"multiple", []string{"/tmp", "/scratch:size=512m,mode=1777"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := runCmdArgs(RunOptions{Image: "img", Tmpfs: tt.tmpfs})
+			var got []string
+			for i, a := range args {
+				if a == "--tmpfs" && i+1 < len(args) {
+					got = append(got, args[i+1])
+				}
+			}
+			if !slices.Equal(got, tt.tmpfs) {
+				t.Errorf("--tmpfs flags: got %v, want %v", got, tt.tmpfs)
+			}
+		})
+	}
+}
+
+func TestRunCmdArgs_NoTmpfs(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img"})
+	for i, a := range args {
+		if a == "--tmpfs" {
+			t.Errorf("--tmpfs should not be present when Tmpfs is empty, found at %d", i)
+		}
+	}
+}
+
+func TestRunCmdArgs_Ports(t *testing.T) {
+	opts := RunOptions{Image: "img", Ports: []string{"8080:80", ":3000/udp"}}
+	args := runCmdArgs(opts)
+
+	var got []string
+	for i, a := range args {
+		if a == "-p" && i+1 < len(args) {
+			got = append(got, args[i+1])
+		}
+	}
+	if len(got) != 2 || got[0] != "8080:80" || got[1] != ":3000/udp" {
+		t.Errorf("-p flags: got %v, want [8080:80 :3000/udp]", got)
+	}
+}
+
+func TestRunCmdArgs_NoPorts(t *testing.T) {
+	opts := RunOptions{Image: "img"}
+	args := runCmdArgs(opts)
+	for i, a := range args {
+		if a == "-p" {
+			t.Errorf("-p should not be present when Ports is empty, found at %d", i)
+		}
+	}
+}
+
+func TestRunCmdArgs_User(t *testing.T) {
+	for _, user := range []string{"1000", "1000:1000", "agent"} {
+		args := runCmdArgs(RunOptions{Image: "img", User: user})
+		var got string
+		for i, a := range args {
+			if a == "--user" && i+1 < len(args) {
+				got = args[i+1]
+			}
+		}
+		if got != user {
+			t.Errorf("--user: got %q, want %q in %v", got, user, args)
+		}
+	}
+}
+
+func TestRunCmdArgs_NoUser(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img"})
+	for i, a := range args {
+		if a == "--user" {
+			t.Errorf("--user should not be present when User is empty, found at %d", i)
+		}
+	}
+}
+
+func TestRunCmdArgs_ExtraHosts(t *testing.T) {
+	hosts := []string{"api.local:192.168.1.5", "host.docker.internal:host-gateway", "db.local:10.0.0.7"}
+	args := runCmdArgs(RunOptions{Image: "img", ExtraHosts: hosts})
+	var got []string
+	for i, a := range args {
+		if a == "--add-host" && i+1 < len(args) {
+			got = append(got, args[i+1])
+		}
+	}
+	if !slices.Equal(got, hosts) {
+		t.Errorf("--add-host: got %v, want %v in order", got, hosts)
+	}
+}
+
+func TestRunCmdArgs_NoExtraHosts(t *testing.T) {
+	if args := runCmdArgs(RunOptions{Image: "img"}); slices.Contains(args, "--add-host") {
+		t.Errorf("--add-host should not be present when ExtraHosts is empty: %v", args)
+	}
+}
+
+func TestRunCmdArgs_Hostname(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img", Hostname: "agent-1.pods.local"})
+	i := slices.Index(args, "--hostname")
+	if i < 0 || i+1 >= len(args) || args[i+1] != "agent-1.pods.local" {
+		t.Errorf("--hostname agent-1.pods.local not found in %v", args)
+	}
+	if img := slices.Index(args, "img"); i > img {
+		t.Errorf("--hostname must precede the image: %v", args)
+	}
+}
+
+func TestRunCmdArgs_NoHostname(t *testing.T) {
+	if args := runCmdArgs(RunOptions{Image: "img"}); slices.Contains(args, "--hostname") {
+		t.Errorf("--hostname should not be present when Hostname is empty: %v", args)
+	}
+}
+
+func TestRunCmdArgs_CapAddAndPrivileged(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img", CapAdd: []string{"NET_ADMIN", "SYS_PTRACE"}, Privileged: true})
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"--cap-add NET_ADMIN", "--cap-add SYS_PTRACE", "--privileged"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q in %v", want, args)
+		}
+	}
+	if img := slices.Index(args, "img"); img < slices.Index(args, "--privileged") {
+		t.Errorf("--privileged must precede the image: %v", args)
+	}
+}
+
+func TestRunCmdArgs_NoCapAddOrPrivileged(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img"})
+	for i, a := range args {
+		if a == "--cap-add" || a == "--privileged" {
+			t.Errorf("%s should not be present when unset, found at %d", a, i)
+		}
+	}
+}
+
+func TestRunCmdArgs_GPUs(t *testing.T) {
+	for _, gpus := range []string{"all", "device=0"} {
+		args := runCmdArgs(RunOptions{Image: "img", GPUs: gpus})
+		var got string
+		for i, a := range args {
+			if a == "--gpus" && i+1 < len(args) {
+				got = args[i+1]
+			}
+		}
+		if got != gpus {
+			t.Errorf("--gpus: got %q, want %q in %v", got, gpus, args)
+		}
+	}
+}
+
+func TestRunCmdArgs_NoGPUs(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img"})
+	for i, a := range args {
+		if a == "--gpus" {
+			t.Errorf("--gpus should not be present when GPUs is empty, found at %d", i)
+		}
+	}
+}
+
+func TestRunCmdArgs_Pull(t *testing.T) {
+	for _, policy := range []string{PullAlways, PullMissing, PullNever} {
+		args := runCmdArgs(RunOptions{Image: "img", Pull: policy})
+		var got string
+		for i, a := range args {
+			if a == "--pull" && i+1 < len(args) {
+				got = args[i+1]
+			}
+		}
+		if got != policy {
+			t.Errorf("--pull: got %q, want %q in %v", got, policy, args)
+		}
+	}
+}
+
+func TestRunCmdArgs_NoPull(t *testing.T) {
+	args := runCmdArgs(RunOptions{Image: "img"})
+	for i, a := range args {
+		if a == "--pull" {
+			t.Errorf("--pull should not be present when Pull is empty, found at %d", i)
+		}
+	}
+}
+
+func TestRunCmdArgs_SecurityOpts(t *testing.T) {
+	opts := RunOptions{Image: "img", SecurityOpts: []string{"seccomp=unconfined", "apparmor=cldpd"}}
+	args := runCmdArgs(opts)
+
+	var got []string
+	for i, a := range args {
+		if a == "--security-opt" && i+1 < len(args) {
+			got = append(got, args[i+1])
+		}
+	}
+	if len(got) != 2 || got[0] != "seccomp=unconfined" || got[1] != "apparmor=cldpd" {
+		t.Errorf("--security-opt flags: got %v, want [seccomp=unconfined apparmor=cldpd]", got)
+	}
+}
+
 func TestRunCmdArgs_NoInheritEnv(t *testing.T) {
 	// With no InheritEnv, only Env entries appear.
 	opts := RunOptions{Image: "img", Env: map[string]string{"FOO": "bar"}}
@@ -377,6 +806,75 @@ func TestDockerRunner_Preflight_Available(t *testing.T) {
 	}
 }
 
+// fakeDocker puts a docker script on PATH that runs body, and returns the path
+// of a file body can write to.
+func fakeDocker(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\nOUT=" + out + "\n" + body + "\n"
+	//nolint:gosec // test-only: the script must be executable
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatalf("write fake docker: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return out
+}
+
+func TestDockerRunner_PassesDaemonEnv(t *testing.T) {
+	daemon := map[string]string{
+		"DOCKER_HOST":       "tcp://remote.example:2376",
+		"DOCKER_TLS_VERIFY": "1",
+		"DOCKER_CERT_PATH":  "/certs/remote",
+	}
+	calls := map[string]func(r *DockerRunner) error{
+		"Preflight": func(r *DockerRunner) error { return r.Preflight(context.Background()) },
+		"Run": func(r *DockerRunner) error {
+			// Bare -e NAME inheritance must not displace the daemon variables.
+			_, err := r.Run(context.Background(), RunOptions{Image: "img", InheritEnv: []string{"CLDPD_TEST_INHERIT"}}, io.Discard)
+			return err
+		},
+		"Build": func(r *DockerRunner) error {
+			return r.Build(context.Background(), "cldpd-test", t.TempDir(), BuildOptions{})
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			out := fakeDocker(t, `env > "$OUT"`)
+			for k, v := range daemon {
+				t.Setenv(k, v)
+			}
+			if err := call(&DockerRunner{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			env, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("docker was not run: %v", err)
+			}
+			for k, v := range daemon {
+				if !strings.Contains(string(env), k+"="+v+"\n") {
+					t.Errorf("%s=%s did not reach docker; env:\n%s", k, v, env)
+				}
+			}
+		})
+	}
+}
+
+func TestDockerRunner_Preflight_NamesDockerHost(t *testing.T) {
+	fakeDocker(t, "exit 1")
+	t.Setenv("DOCKER_HOST", "tcp://remote.example:2376")
+	err := (&DockerRunner{}).Preflight(context.Background())
+	if !errors.Is(err, ErrDockerUnavailable) {
+		t.Fatalf("got %v, want ErrDockerUnavailable", err)
+	}
+	if !strings.Contains(err.Error(), "DOCKER_HOST=tcp://remote.example:2376") {
+		t.Errorf("error %q does not name DOCKER_HOST", err)
+	}
+}
+
 func TestDockerRunner_Preflight_ContextCancelled(t *testing.T) {
 	if !dockerAvailable() {
 		t.Skip("Docker not available")
@@ -399,7 +897,7 @@ func TestDockerRunner_Build_InvalidDir(t *testing.T) {
 		t.Skip("Docker not available")
 	}
 	r := &DockerRunner{}
-	err := r.Build(context.Background(), "cldpd-test-build-invalid", "/nonexistent/path/that/does/not/exist", nil)
+	err := r.Build(context.Background(), "cldpd-test-build-invalid", "/nonexistent/path/that/does/not/exist", BuildOptions{})
 	if err == nil {
 		t.Error("expected error building from nonexistent dir, got nil")
 	}
@@ -408,6 +906,153 @@ func TestDockerRunner_Build_InvalidDir(t *testing.T) {
 	}
 }
 
+func TestRunContainer_ExitCodes(t *testing.T) {
+	tests := []struct {
+		wantErr  error
+		script   string
+		wantCode int
+	}{
+		{script: "exit 0", wantCode: 0},
+		{script: "exit 2", wantCode: 2},
+		{script: "echo 'docker: unknown flag: --bogus' >&2; exit 125", wantCode: -1, wantErr: ErrDockerRunFailed},
+		{script: "echo 'permission denied' >&2; exit 126", wantCode: -1, wantErr: ErrCommandNotFound},
+		{script: "echo 'exec: \"claude\": executable file not found' >&2; exit 127", wantCode: -1, wantErr: ErrCommandNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			code, err := runContainer(exec.Command("sh", "-c", tt.script))
+			if code != tt.wantCode {
+				t.Errorf("code: got %d, want %d", code, tt.wantCode)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunContainer_ClientKilled(t *testing.T) {
+	code, err := runContainer(exec.Command("sh", "-c", "kill -9 $$"))
+	if code != -1 || err == nil {
+		t.Fatalf("got (%d, %v), want (-1, error)", code, err)
+	}
+	if errors.Is(err, ErrDockerRunFailed) || errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("err: got %v, want a client failure", err)
+	}
+}
+
+func TestDockerRunner_Run_ClientFailureRemovesContainer(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        string
+		opts       RunOptions
+		wantRemove bool
+	}{
+		{name: "client killed", run: "kill -9 $$", opts: RunOptions{Image: "img", Name: "cldpd-test"}, wantRemove: true},
+		{name: "client killed with Remove", run: "kill -9 $$", opts: RunOptions{Image: "img", Name: "cldpd-test", Remove: true}, wantRemove: true},
+		{name: "unnamed", run: "kill -9 $$", opts: RunOptions{Image: "img"}},
+		{name: "container exit", run: "exit 3", opts: RunOptions{Image: "img", Name: "cldpd-test"}},
+		{name: "docker failure", run: "exit 125", opts: RunOptions{Image: "img", Name: "cldpd-test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := fakeDocker(t, `case "$1" in
+run) `+tt.run+` ;;
+rm) echo "$@" >> "$OUT" ;;
+esac`)
+			if _, err := (&DockerRunner{}).Run(context.Background(), tt.opts, io.Discard); err == nil && tt.wantRemove {
+				t.Error("Run: got nil error for a failed client")
+			}
+			got, _ := os.ReadFile(out)
+			removed := strings.Contains(string(got), "rm -f cldpd-test")
+			if removed != tt.wantRemove {
+				t.Errorf("removed: got %v (%q), want %v", removed, got, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestRunContainer_ErrorIncludesStderr(t *testing.T) {
+	_, err := runContainer(exec.Command("sh", "-c", "echo 'claude: not found' >&2; exit 127"))
+	if err == nil || !strings.Contains(err.Error(), "claude: not found") {
+		t.Errorf("error should carry stderr, got %v", err)
+	}
+}
+
+func TestRunContainer_StderrNotReturnedOnContainerExit(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo out; echo noise >&2; exit 3")
+	cmd.Stdout = &stdout
+	code, err := runContainer(cmd)
+	if err != nil || code != 3 {
+		t.Fatalf("got (%d, %v), want (3, nil)", code, err)
+	}
+	if stdout.String() != "out\n" {
+		t.Errorf("stdout: got %q", stdout.String())
+	}
+}
+
+func TestCheckOOM(t *testing.T) {
+	oom := func(context.Context, string) (ContainerState, error) {
+		return ContainerState{ExitCode: 137, OOMKilled: true}, nil
+	}
+	killed := func(context.Context, string) (ContainerState, error) {
+		return ContainerState{ExitCode: 137}, nil
+	}
+	gone := func(_ context.Context, container string) (ContainerState, error) {
+		return ContainerState{}, fmt.Errorf("%s: %w", container, ErrSessionNotFound)
+	}
+	tests := []struct {
+		inspect  func(context.Context, string) (ContainerState, error)
+		wantErr  error
+		name     string
+		code     int
+		wantCode int
+	}{
+		{name: "oom killed", inspect: oom, code: 137, wantCode: -1, wantErr: ErrOOMKilled},
+		{name: "docker kill", inspect: killed, code: 137, wantCode: 137},
+		{name: "inspect fails", inspect: gone, code: 137, wantCode: 137},
+		{name: "other exit", inspect: oom, code: 1, wantCode: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := checkOOM(context.Background(), tt.inspect, "cldpd-myrepo", tt.code)
+			if code != tt.wantCode {
+				t.Errorf("code: got %d, want %d", code, tt.wantCode)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckOOM_InspectsOnlyKilled(t *testing.T) {
+	inspected := false
+	inspect := func(context.Context, string) (ContainerState, error) {
+		inspected = true
+		return ContainerState{}, nil
+	}
+	if _, err := checkOOM(context.Background(), inspect, "cldpd-myrepo", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inspected {
+		t.Error("container inspected after a clean exit")
+	}
+}
+
+func TestTailBuffer_KeepsLastBytes(t *testing.T) {
+	b := &tailBuffer{limit: 5}
+	for _, s := range []string{"abc", "defg", "h"} {
+		if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = (%d, %v)", s, n, err)
+		}
+	}
+	if got := b.String(); got != "defgh" {
+		t.Errorf("got %q, want %q", got, "defgh")
+	}
+}
+
 func TestDockerRunner_Run_HelloWorld(t *testing.T) {
 	if !dockerAvailable() {
 		t.Skip("Docker not available")
@@ -528,7 +1173,7 @@ func TestDockerRunner_Stop_RunningContainer(t *testing.T) {
 	defer exec.Command("docker", "rm", "-f", containerName).Run() //nolint:errcheck
 
 	r := &DockerRunner{}
-	err := r.Stop(context.Background(), containerName, 5*time.Second)
+	err := r.Stop(context.Background(), containerName, 5*time.Second, "")
 	if err != nil {
 		t.Errorf("Stop running container: got %v, want nil", err)
 	}
@@ -550,7 +1195,7 @@ func TestDockerRunner_Stop_NoSuchContainer(t *testing.T) {
 	}
 	// Stopping a nonexistent container must return nil, not ErrStopFailed.
 	r := &DockerRunner{}
-	err := r.Stop(context.Background(), "cldpd-test-unit-stop-nonexistent", 5*time.Second)
+	err := r.Stop(context.Background(), "cldpd-test-unit-stop-nonexistent", 5*time.Second, "")
 	if err != nil {
 		t.Errorf("Stop nonexistent container: got %v, want nil", err)
 	}
@@ -564,7 +1209,7 @@ func TestDockerRunner_Stop_ZeroTimeout_UsesFloor(t *testing.T) {
 	// We test this by stopping a nonexistent container with 0 timeout —
 	// the call must complete (not hang) and return nil.
 	r := &DockerRunner{}
-	err := r.Stop(context.Background(), "cldpd-test-unit-stop-zero-timeout", 0)
+	err := r.Stop(context.Background(), "cldpd-test-unit-stop-zero-timeout", 0, "")
 	if err != nil {
 		t.Errorf("Stop with zero timeout: got %v, want nil (nonexistent container)", err)
 	}
@@ -579,8 +1224,302 @@ func TestDockerRunner_Stop_ContextCancelled(t *testing.T) {
 	r := &DockerRunner{}
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
-	err := r.Stop(ctx, "cldpd-test-unit-stop-cancelled", 10*time.Second)
+	err := r.Stop(ctx, "cldpd-test-unit-stop-cancelled", 10*time.Second, "")
 	if !errors.Is(err, ErrStopFailed) {
 		t.Errorf("Stop with cancelled context: got %v, want ErrStopFailed", err)
 	}
 }
+
+func TestDockerRunner_Kill_RunningContainer(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	containerName := "cldpd-test-unit-kill-running"
+	start := exec.Command("docker", "run", "-d", "--name", containerName, "alpine:latest", "sleep", "60")
+	start.Stdout = io.Discard
+	start.Stderr = io.Discard
+	if err := start.Run(); err != nil {
+		t.Skipf("could not start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", containerName).Run() //nolint:errcheck
+
+	r := &DockerRunner{}
+	if err := r.Kill(context.Background(), containerName); err != nil {
+		t.Errorf("Kill running container: got %v, want nil", err)
+	}
+
+	out, inspectErr := exec.Command("docker", "inspect", "--format", "{{.State.Running}}", containerName).Output()
+	if inspectErr != nil {
+		return
+	}
+	if strings.TrimSpace(string(out)) != "false" {
+		t.Errorf("container still running after Kill; State.Running = %q", strings.TrimSpace(string(out)))
+	}
+}
+
+func TestDockerRunner_Kill_NoSuchContainer(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	// Killing a nonexistent container must return nil, not ErrKillFailed.
+	r := &DockerRunner{}
+	err := r.Kill(context.Background(), "cldpd-test-unit-kill-nonexistent")
+	if err != nil {
+		t.Errorf("Kill nonexistent container: got %v, want nil", err)
+	}
+}
+
+func TestDockerRunner_Kill_Stderr(t *testing.T) {
+	fakeDocker(t, `case "$2" in
+cldpd-gone) echo "Error response from daemon: No such container: cldpd-gone" >&2 ;;
+cldpd-exited) echo "Error response from daemon: cannot kill container: cldpd-exited: container 0123abcd is not running" >&2 ;;
+*) echo "Error response from daemon: permission denied" >&2 ;;
+esac
+exit 1`)
+	r := &DockerRunner{}
+	for _, container := range []string{"cldpd-gone", "cldpd-exited"} {
+		if err := r.Kill(context.Background(), container); err != nil {
+			t.Errorf("Kill(%s): got %v, want nil", container, err)
+		}
+	}
+	err := r.Kill(context.Background(), "cldpd-denied")
+	if !errors.Is(err, ErrKillFailed) {
+		t.Fatalf("got %v, want ErrKillFailed", err)
+	}
+	if !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("error %q does not carry docker's message", err)
+	}
+}
+
+func TestDockerRunner_Remove_NoSuchContainer(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	// Removing a nonexistent container must return nil, not ErrRemoveFailed.
+	r := &DockerRunner{}
+	err := r.Remove(context.Background(), "cldpd-test-unit-remove-nonexistent", true)
+	if err != nil {
+		t.Errorf("Remove nonexistent container: got %v, want nil", err)
+	}
+}
+
+func TestDockerRunner_Remove_RunningWithoutForce(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	containerName := "cldpd-test-unit-remove-running"
+	//nolint:gosec // test-only: fixed container name
+	start := exec.Command("docker", "run", "-d", "--name", containerName, "alpine", "sleep", "30")
+	start.Stdout = io.Discard
+	start.Stderr = io.Discard
+	if err := start.Run(); err != nil {
+		t.Skipf("could not start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", containerName).Run() //nolint:errcheck
+
+	r := &DockerRunner{}
+	if err := r.Remove(context.Background(), containerName, false); !errors.Is(err, ErrRemoveFailed) {
+		t.Errorf("Remove running container without force: got %v, want ErrRemoveFailed", err)
+	}
+	if err := r.Remove(context.Background(), containerName, true); err != nil {
+		t.Errorf("Remove running container with force: got %v, want nil", err)
+	}
+}
+
+func TestDockerRunner_Pull(t *testing.T) {
+	out := fakeDocker(t, `echo "$@" > "$OUT"
+case "$2" in
+ghcr.io/org/missing:v1) echo "manifest unknown" >&2; exit 1 ;;
+esac
+echo "Status: Downloaded newer image for $2"`)
+	r := &DockerRunner{}
+
+	var progress bytes.Buffer
+	if err := r.Pull(context.Background(), "ghcr.io/org/agent:v1", &progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	args, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("docker was not run: %v", err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "pull ghcr.io/org/agent:v1" {
+		t.Errorf("args: got %q, want %q", got, "pull ghcr.io/org/agent:v1")
+	}
+	if !strings.Contains(progress.String(), "Downloaded newer image for ghcr.io/org/agent:v1") {
+		t.Errorf("progress: got %q, want docker pull's output", progress.String())
+	}
+
+	err = r.Pull(context.Background(), "ghcr.io/org/missing:v1", nil)
+	if !errors.Is(err, ErrPullFailed) {
+		t.Fatalf("got %v, want ErrPullFailed", err)
+	}
+	if !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("error %q does not carry docker's message", err)
+	}
+}
+
+func TestDockerRunner_RemoveImage_NoSuchImage(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	// Removing a nonexistent image must return nil, not ErrImageRemoveFailed.
+	r := &DockerRunner{}
+	if err := r.RemoveImage(context.Background(), "cldpd-test-unit-rmi-nonexistent:latest"); err != nil {
+		t.Errorf("RemoveImage nonexistent image: got %v, want nil", err)
+	}
+}
+
+func TestDockerRunner_Remove_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := &DockerRunner{}
+	err := r.Remove(ctx, "cldpd-test-unit-remove-cancelled", true)
+	if !errors.Is(err, ErrRemoveFailed) {
+		t.Errorf("got %v, want ErrRemoveFailed", err)
+	}
+}
+
+func TestDockerRunner_Kill_ContextCancelled(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	r := &DockerRunner{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := r.Kill(ctx, "cldpd-test-unit-kill-cancelled")
+	if !errors.Is(err, ErrKillFailed) {
+		t.Errorf("Kill with cancelled context: got %v, want ErrKillFailed", err)
+	}
+}
+
+func TestDockerRunner_Health_NoSuchContainer(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	r := &DockerRunner{}
+	_, err := r.Health(context.Background(), "cldpd-test-unit-health-nonexistent")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestDockerRunner_Health_NoHealthcheck(t *testing.T) {
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+	containerName := "cldpd-test-unit-health-none"
+	start := exec.Command("docker", "run", "-d", "--name", containerName, "alpine:latest", "sleep", "60")
+	start.Stdout = io.Discard
+	start.Stderr = io.Discard
+	if err := start.Run(); err != nil {
+		t.Skipf("could not start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", containerName).Run() //nolint:errcheck
+
+	r := &DockerRunner{}
+	status, err := r.Health(context.Background(), containerName)
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if status != "" {
+		t.Errorf("status: got %q, want empty for a container without a healthcheck", status)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	out := "cldpd-api|cldpd-api|running|Up 5 minutes\n" +
+		"postgres|postgres:16|running|Up 3 days\n" +
+		"cldpd-web|node:22|exited|Exited (1) 2 hours ago\n"
+	list, err := parseList(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ContainerSummary{
+		{Name: "cldpd-api", Pod: "api", Image: "cldpd-api", Status: "Up 5 minutes", Running: true},
+		{Name: "cldpd-web", Pod: "web", Image: "node:22", Status: "Exited (1) 2 hours ago"},
+	}
+	if !slices.Equal(list, want) {
+		t.Errorf("got %+v, want %+v", list, want)
+	}
+}
+
+func TestParseList_Empty(t *testing.T) {
+	list, err := parseList("\n")
+	if err != nil || len(list) != 0 {
+		t.Errorf("got %+v, %v; want empty, nil", list, err)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	out := "cldpd-api:latest\n<none>:<none>\ncldpd-web:v2\ncldpd-:latest\n"
+	want := []string{"cldpd-api:latest", "cldpd-web:v2"}
+	if got := parseImages(out); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := parseImages("\n"); len(got) != 0 {
+		t.Errorf("empty: got %v, want none", got)
+	}
+}
+
+func TestParseList_Malformed(t *testing.T) {
+	if _, err := parseList("cldpd-api|img"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestParseRuntimes(t *testing.T) {
+	out := []byte(`{"runc":{"path":"runc"},"nvidia":{"path":"nvidia-container-runtime"},"io.containerd.runc.v2":{"path":"runc"}}`)
+	got, err := parseRuntimes(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"io.containerd.runc.v2", "nvidia", "runc"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseRuntimes_Malformed(t *testing.T) {
+	if _, err := parseRuntimes([]byte("runc nvidia")); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestParseInspect_Running(t *testing.T) {
+	st, err := parseInspect("true|2026-02-21T10:00:00.123456789Z|0|false|cldpd-myrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Date(2026, 2, 21, 10, 0, 0, 123456789, time.UTC)
+	if !st.Running || st.Image != "cldpd-myrepo" || !st.StartedAt.Equal(want) {
+		t.Errorf("got %+v, want running cldpd-myrepo started %v", st, want)
+	}
+}
+
+func TestParseInspect_Exited(t *testing.T) {
+	st, err := parseInspect("false|2026-02-21T10:00:00Z|137|false|img:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.Running || st.ExitCode != 137 || st.OOMKilled || st.Image != "img:latest" {
+		t.Errorf("got %+v, want exited 137 img:latest", st)
+	}
+}
+
+func TestParseInspect_OOMKilled(t *testing.T) {
+	st, err := parseInspect("false|2026-02-21T10:00:00Z|137|true|img:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !st.OOMKilled {
+		t.Errorf("got %+v, want OOMKilled", st)
+	}
+}
+
+func TestParseInspect_Malformed(t *testing.T) {
+	for _, out := range []string{"", "true|x", "true|2026-02-21T10:00:00Z|0|img", "true|2026-02-21T10:00:00Z|abc|false|img", "true|yesterday|0|false|img"} {
+		if _, err := parseInspect(out); err == nil {
+			t.Errorf("parseInspect(%q): expected error, got nil", out)
+		}
+	}
+}
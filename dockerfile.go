@@ -0,0 +1,129 @@
+package cldpd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// dockerfileInstructions is the set of instructions the Dockerfile reference
+// defines, upper-cased.
+var dockerfileInstructions = map[string]bool{
+	"FROM": true, "RUN": true, "CMD": true, "LABEL": true, "MAINTAINER": true,
+	"EXPOSE": true, "ENV": true, "ADD": true, "COPY": true, "ENTRYPOINT": true,
+	"VOLUME": true, "USER": true, "WORKDIR": true, "ARG": true, "ONBUILD": true,
+	"STOPSIGNAL": true, "HEALTHCHECK": true, "SHELL": true,
+}
+
+// heredocPattern matches a heredoc redirection such as <<EOF, <<-EOF, or <<"EOF",
+// capturing the dash and the delimiter.
+var heredocPattern = regexp.MustCompile(`<<(-?)["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// heredoc is an open heredoc body, ended by a line equal to delim, after
+// leading tabs are stripped if trimTabs is set (<<-).
+type heredoc struct {
+	delim    string
+	trimTabs bool
+}
+
+// escapeDirective matches the parser directive that changes the line
+// continuation character.
+var escapeDirective = regexp.MustCompile(`^#\s*escape\s*=\s*(\S)\s*$`)
+
+// checkDockerfile reads the Dockerfile at path and reports the first problem
+// lintDockerfile finds, wrapping ErrInvalidPod, so that a typo fails Start in
+// milliseconds instead of a build round-trip later.
+func checkDockerfile(name, path string) error {
+	//nolint:gosec // path is constructed from a trusted pods directory, not user input
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read Dockerfile: %w", err)
+	}
+	if err := lintDockerfile(data); err != nil {
+		return fmt.Errorf("%w: %s: Dockerfile %w", ErrInvalidPod, name, err)
+	}
+	return nil
+}
+
+// lintDockerfile checks that data parses as a Dockerfile: every instruction is
+// one Docker knows, and a FROM comes before any instruction other than ARG. It
+// follows line continuations and heredocs but does not check arguments, which
+// are left to docker build.
+func lintDockerfile(data []byte) error {
+	escape := `\`
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		lineNo     int
+		seenFrom   bool
+		directives = true // parser directives are only honored before anything else
+		continued  bool   // the previous line ended with the escape character
+		heredocs   []heredoc
+		pending    []heredoc // heredocs opened by an instruction still being continued
+	)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if len(heredocs) > 0 {
+			end := line
+			if heredocs[0].trimTabs {
+				end = strings.TrimLeft(line, "\t")
+			}
+			if end == heredocs[0].delim {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") {
+			if directives {
+				if m := escapeDirective.FindStringSubmatch(trimmed); m != nil {
+					escape = m[1]
+				}
+			}
+			continue
+		}
+		directives = false
+		if trimmed == "" {
+			continue
+		}
+
+		if !continued {
+			word, _, _ := strings.Cut(trimmed, " ")
+			word, _, _ = strings.Cut(word, "\t")
+			instruction := strings.ToUpper(word)
+			if !dockerfileInstructions[instruction] {
+				return fmt.Errorf("line %d: unknown instruction %q", lineNo, word)
+			}
+			switch {
+			case instruction == "FROM":
+				seenFrom = true
+			case !seenFrom && instruction != "ARG":
+				return fmt.Errorf("line %d: %s before FROM", lineNo, instruction)
+			}
+		}
+
+		for _, m := range heredocPattern.FindAllStringSubmatch(line, -1) {
+			pending = append(pending, heredoc{delim: m[2], trimTabs: m[1] == "-"})
+		}
+		// Heredoc bodies start on the line after the instruction ends.
+		continued = strings.HasSuffix(trimmed, escape)
+		if !continued {
+			heredocs, pending = pending, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", lineNo+1, err)
+	}
+	if !seenFrom {
+		return errors.New("has no FROM instruction")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintDockerfile_Valid(t *testing.T) {
+	tests := map[string]string{
+		"minimal":   "FROM scratch\n",
+		"lowercase": "from alpine\nrun echo hi\n",
+		"arg first": "ARG BASE=alpine\nFROM ${BASE}\n",
+		"comments and blanks": "# syntax=docker/dockerfile:1\n\n# base\nFROM alpine\n\n" +
+			"  # indented comment\nRUN true\n",
+		"continuation":               "FROM alpine\nRUN apk add \\\n    git \\\n    # a comment inside\n    curl\n",
+		"escape directive":           "# escape=`\nFROM mcr.microsoft.com/windows\nRUN dir `\n    c:\\\n",
+		"heredoc":                    "FROM alpine\nRUN <<EOF\napk add git\nnot an instruction\nEOF\nCMD [\"sh\"]\n",
+		"heredoc tabs":               "FROM alpine\nRUN <<-EOF\n\techo hi\n\tEOF\nCMD [\"sh\"]\n",
+		"heredoc after continuation": "FROM alpine\nRUN cat <<EOF > /f \\\n    && true\nbody line\nEOF\n",
+		"multi-stage":                "FROM golang AS build\nRUN go build\nFROM alpine\nCOPY --from=build /app /app\n",
+		"scaffold":                   scaffoldDockerfile,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := lintDockerfile([]byte(data)); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLintDockerfile_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", "has no FROM instruction"},
+		{"comments only", "# nothing here\n", "has no FROM instruction"},
+		{"missing FROM", "RUN echo hi\n", "line 1: RUN before FROM"},
+		{"missing FROM after arg", "ARG X=1\nWORKDIR /app\nFROM alpine\n", "line 2: WORKDIR before FROM"},
+		{"unknown instruction", "FROM alpine\n\nRUNN echo hi\n", `line 3: unknown instruction "RUNN"`},
+		{"unknown after continuation", "FROM alpine\nRUN a \\\n  b\nCOPPY . .\n", `line 4: unknown instruction "COPPY"`},
+		{"instruction after heredoc", "FROM alpine\nRUN <<EOF\nEOF\nBOGUS\n", `line 4: unknown instruction "BOGUS"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := lintDockerfile([]byte(tt.data))
+			if err == nil {
+				t.Fatal("got nil error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("error: got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\nRUNN true\n"), 0644); err != nil {
+		t.Fatalf("write Dockerfile: %v", err)
+	}
+
+	err := checkDockerfile("mypod", path)
+	if !errors.Is(err, ErrInvalidPod) {
+		t.Fatalf("got %v, want ErrInvalidPod", err)
+	}
+	if want := `mypod: Dockerfile line 2: unknown instruction "RUNN"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not contain %q", err, want)
+	}
+
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("write Dockerfile: %v", err)
+	}
+	if err := checkDockerfile("mypod", path); err != nil {
+		t.Errorf("valid Dockerfile: unexpected error: %v", err)
+	}
+}
@@ -1,19 +1,41 @@
 package cldpd
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // ErrPodNotFound is returned when a pod directory does not exist.
 var ErrPodNotFound = errors.New("pod not found")
 
-// ErrInvalidPod is returned when a pod directory exists but contains no Dockerfile.
-var ErrInvalidPod = errors.New("invalid pod: Dockerfile not found")
+// ErrInvalidPod is returned when a pod directory exists but contains no
+// Dockerfile, or a Dockerfile that does not parse.
+var ErrInvalidPod = errors.New("invalid pod")
 
 // ErrBuildFailed is returned when the Docker image build exits with a non-zero status.
 var ErrBuildFailed = errors.New("image build failed")
 
-// ErrContainerFailed is returned when a container exits with a non-zero status.
+// ErrContainerFailed is wrapped by ExitError, which reports a container that
+// exited with a non-zero status.
 var ErrContainerFailed = errors.New("container exited with error")
 
+// ExitError reports a container or exec that exited with a non-zero code. It is
+// the Err of a terminal EventContainerExited or EventContainerKilled event with
+// a non-zero Code, so that consumers can match failed runs with
+// errors.Is(e.Err, ErrContainerFailed) and recover the code with errors.As.
+// Wait is unaffected: it returns the code with a nil error, as a non-zero
+// exit is not itself a process-level error.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s: code %d", ErrContainerFailed, e.Code)
+}
+
+// Unwrap returns ErrContainerFailed.
+func (e *ExitError) Unwrap() error { return ErrContainerFailed }
+
 // ErrSessionNotFound is returned when no running session exists for the given pod name.
 var ErrSessionNotFound = errors.New("no running session for pod")
 
@@ -22,3 +44,66 @@ var ErrDockerUnavailable = errors.New("docker is not available")
 
 // ErrStopFailed is returned when docker stop exits with a non-zero status.
 var ErrStopFailed = errors.New("container stop failed")
+
+// ErrKillFailed is returned when docker kill exits with a non-zero status.
+var ErrKillFailed = errors.New("container kill failed")
+
+// ErrRemoveFailed is returned when docker rm exits with a non-zero status.
+var ErrRemoveFailed = errors.New("container remove failed")
+
+// ErrImageRemoveFailed is returned when docker image rm exits with a non-zero status.
+var ErrImageRemoveFailed = errors.New("image remove failed")
+
+// ErrPullFailed is returned when docker pull exits with a non-zero status.
+var ErrPullFailed = errors.New("image pull failed")
+
+// ErrStoppedBeforeStart is returned by Session.Wait when Stop or Kill was called
+// before the container started, so it was never run.
+var ErrStoppedBeforeStart = errors.New("session stopped before the container started")
+
+// ErrContainerNameInUse is returned by Dispatcher.Start when a running
+// container, or a live session of the same Dispatcher, already holds the
+// pod's container name.
+var ErrContainerNameInUse = errors.New("container name already in use")
+
+// ErrIdleTimeout is carried by the EventError a session emits when it stops a
+// container that has written no output for the idle timeout.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// ErrMaxRuntimeExceeded is carried by the EventError a session emits when it
+// stops a container that has run for longer than its maximum runtime.
+var ErrMaxRuntimeExceeded = errors.New("max runtime exceeded")
+
+// ErrInvalidIssueURL is returned by ParseIssueURL, and by Dispatcher.Start,
+// when a string is not a GitHub issue or pull request reference.
+var ErrInvalidIssueURL = errors.New("invalid issue URL")
+
+// ErrEmptyPrompt is returned by Dispatcher.StartTask and Dispatcher.Resume
+// when the prompt is blank.
+var ErrEmptyPrompt = errors.New("prompt is empty")
+
+// ErrAnnotationLimit is returned when a session annotation exceeds the count or size bounds.
+var ErrAnnotationLimit = errors.New("annotation limit exceeded")
+
+// ErrPodExists is returned when scaffolding a pod whose directory already exists.
+var ErrPodExists = errors.New("pod already exists")
+
+// ErrInvalidConfig is returned when pod.json parses but contains an invalid value.
+var ErrInvalidConfig = errors.New("invalid pod configuration")
+
+// ErrInsufficientDisk is returned when a filesystem needed for a build is below the free-space floor.
+var ErrInsufficientDisk = errors.New("insufficient disk space")
+
+// ErrDockerRunFailed is returned when docker run itself fails (exit 125), for
+// example on an unknown flag or an image that cannot be pulled.
+var ErrDockerRunFailed = errors.New("docker run failed")
+
+// ErrCommandNotFound is returned when the container command is missing from the
+// image or cannot be invoked (docker run exit 127 or 126).
+var ErrCommandNotFound = errors.New("container command not found")
+
+// ErrOOMKilled is returned when the kernel OOM killer ended a container.
+var ErrOOMKilled = errors.New("container was OOM killed")
+
+// ErrPolicyViolation is returned when a pod's configuration requests host state the policy forbids.
+var ErrPolicyViolation = errors.New("pod violates policy")
@@ -17,6 +17,24 @@ func TestSentinelErrors_NonNil(t *testing.T) {
 		ErrSessionNotFound,
 		ErrDockerUnavailable,
 		ErrStopFailed,
+		ErrKillFailed,
+		ErrAnnotationLimit,
+		ErrPodExists,
+		ErrInvalidConfig,
+		ErrInsufficientDisk,
+		ErrDockerRunFailed,
+		ErrCommandNotFound,
+		ErrOOMKilled,
+		ErrPolicyViolation,
+		ErrRemoveFailed,
+		ErrImageRemoveFailed,
+		ErrPullFailed,
+		ErrStoppedBeforeStart,
+		ErrContainerNameInUse,
+		ErrIdleTimeout,
+		ErrMaxRuntimeExceeded,
+		ErrInvalidIssueURL,
+		ErrEmptyPrompt,
 	}
 	for _, err := range sentinels {
 		if err == nil {
@@ -31,12 +49,30 @@ func TestSentinelErrors_Messages(t *testing.T) {
 		want string
 	}{
 		{ErrPodNotFound, "pod not found"},
-		{ErrInvalidPod, "invalid pod: Dockerfile not found"},
+		{ErrInvalidPod, "invalid pod"},
 		{ErrBuildFailed, "image build failed"},
 		{ErrContainerFailed, "container exited with error"},
 		{ErrSessionNotFound, "no running session for pod"},
 		{ErrDockerUnavailable, "docker is not available"},
 		{ErrStopFailed, "container stop failed"},
+		{ErrKillFailed, "container kill failed"},
+		{ErrAnnotationLimit, "annotation limit exceeded"},
+		{ErrPodExists, "pod already exists"},
+		{ErrInvalidConfig, "invalid pod configuration"},
+		{ErrInsufficientDisk, "insufficient disk space"},
+		{ErrDockerRunFailed, "docker run failed"},
+		{ErrCommandNotFound, "container command not found"},
+		{ErrOOMKilled, "container was OOM killed"},
+		{ErrPolicyViolation, "pod violates policy"},
+		{ErrRemoveFailed, "container remove failed"},
+		{ErrImageRemoveFailed, "image remove failed"},
+		{ErrPullFailed, "image pull failed"},
+		{ErrStoppedBeforeStart, "session stopped before the container started"},
+		{ErrContainerNameInUse, "container name already in use"},
+		{ErrIdleTimeout, "idle timeout"},
+		{ErrMaxRuntimeExceeded, "max runtime exceeded"},
+		{ErrInvalidIssueURL, "invalid issue URL"},
+		{ErrEmptyPrompt, "prompt is empty"},
 	}
 	for _, tc := range cases {
 		if tc.err.Error() != tc.want {
@@ -54,6 +90,24 @@ func TestSentinelErrors_Distinct(t *testing.T) {
 		ErrSessionNotFound,
 		ErrDockerUnavailable,
 		ErrStopFailed,
+		ErrKillFailed,
+		ErrAnnotationLimit,
+		ErrPodExists,
+		ErrInvalidConfig,
+		ErrInsufficientDisk,
+		ErrDockerRunFailed,
+		ErrCommandNotFound,
+		ErrOOMKilled,
+		ErrPolicyViolation,
+		ErrRemoveFailed,
+		ErrImageRemoveFailed,
+		ErrPullFailed,
+		ErrStoppedBeforeStart,
+		ErrContainerNameInUse,
+		ErrIdleTimeout,
+		ErrMaxRuntimeExceeded,
+		ErrInvalidIssueURL,
+		ErrEmptyPrompt,
 	}
 	for i, a := range sentinels {
 		for j, b := range sentinels {
@@ -73,6 +127,24 @@ func TestSentinelErrors_WrappedIs(t *testing.T) {
 		ErrSessionNotFound,
 		ErrDockerUnavailable,
 		ErrStopFailed,
+		ErrKillFailed,
+		ErrAnnotationLimit,
+		ErrPodExists,
+		ErrInvalidConfig,
+		ErrInsufficientDisk,
+		ErrDockerRunFailed,
+		ErrCommandNotFound,
+		ErrOOMKilled,
+		ErrPolicyViolation,
+		ErrRemoveFailed,
+		ErrImageRemoveFailed,
+		ErrPullFailed,
+		ErrStoppedBeforeStart,
+		ErrContainerNameInUse,
+		ErrIdleTimeout,
+		ErrMaxRuntimeExceeded,
+		ErrInvalidIssueURL,
+		ErrEmptyPrompt,
 	}
 	for _, sentinel := range cases {
 		wrapped := fmt.Errorf("some context: %w", sentinel)
@@ -81,3 +153,22 @@ func TestSentinelErrors_WrappedIs(t *testing.T) {
 		}
 	}
 }
+
+func TestExitError(t *testing.T) {
+	for _, code := range []int{1, 2, 137} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			err := fmt.Errorf("session: %w", &ExitError{Code: code})
+			if !errors.Is(err, ErrContainerFailed) {
+				t.Errorf("errors.Is(%v, ErrContainerFailed) = false", err)
+			}
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != code {
+				t.Errorf("errors.As: got %v, want code %d", exitErr, code)
+			}
+			want := fmt.Sprintf("container exited with error: code %d", code)
+			if got := (&ExitError{Code: code}).Error(); got != want {
+				t.Errorf("Error: got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package cldpd
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // EventType identifies the kind of event emitted by a Session.
 type EventType int
@@ -26,22 +32,187 @@ const (
 	// Code contains the container's exit code.
 	EventContainerExited
 
-	// EventError is emitted when a fatal error terminates the session.
+	// EventError is emitted when a fatal error terminates the session, and
+	// non-terminally when the exited container cannot be removed.
 	// Data contains the error message.
 	EventError
+
+	// EventHealthChanged is emitted when the container's healthcheck status
+	// changes, when health monitoring is enabled via WithHealthMonitor.
+	// Data contains the new status (starting, healthy, or unhealthy).
+	EventHealthChanged
+
+	// EventWarning is emitted for a non-fatal condition the caller should know
+	// about, such as low disk space before a build. Data contains the message.
+	EventWarning
+
+	// EventMessage is emitted for each parsed line of Claude Code stream-json
+	// output, when the pod sets outputFormat to stream-json. Data contains the
+	// raw JSON line and Message its parsed fields.
+	EventMessage
+
+	// EventContainerAttached is emitted by Dispatcher.Attach in place of
+	// EventContainerStarted, when the session joins a container that was
+	// already running. Data contains the container name.
+	EventContainerAttached
+
+	// EventBuildOutput is emitted for each line of image build output, between
+	// BuildStarted and BuildComplete. Data contains the line content.
+	EventBuildOutput
+
+	// EventRestart is emitted when a container that exited with a non-zero
+	// code is about to be run again under WithRestartPolicy. Data contains the
+	// container name and Code the exit code of the failed run.
+	EventRestart
+
+	// EventContainerKilled is emitted in place of EventContainerExited when
+	// Stop had to escalate to SIGKILL because the container did not exit
+	// within the stop timeout after the stop signal, which means the agent
+	// ignores SIGTERM. Code contains the exit code (137).
+	EventContainerKilled
 )
 
 // Event is a lifecycle or output event emitted by a Session.
 //
 // Temporal ordering guarantees:
-//   - Successful start: BuildStarted → BuildComplete → ContainerStarted → Output* → ContainerExited
-//   - Build failure:    BuildStarted → Error
-//   - Runtime failure:  BuildStarted → BuildComplete → ContainerStarted → Output* → Error
+//   - Successful start: BuildStarted → BuildOutput* → BuildComplete → ContainerStarted → Output* → ContainerExited
+//   - Build failure:    BuildStarted → BuildOutput* → Error
+//   - Runtime failure:  BuildStarted → BuildOutput* → BuildComplete → ContainerStarted → Output* → Error
+//   - Attach:           ContainerAttached → Output* → ContainerExited
+//   - With restarts:    ... → ContainerStarted → Output* → (Restart → Output*)* → ContainerExited
+//   - Stop escalated:   ... → ContainerStarted → Output* → ContainerKilled
+//
+// HealthChanged events, when enabled, interleave with Output events between
+// ContainerStarted and the terminal event. With stream-json output, Message
+// events take the place of Output events for lines that parse as JSON.
 //
-// After the terminal event (ContainerExited or Error), the channel is closed.
+// After the terminal event (ContainerExited, ContainerKilled, or Error), the
+// channel is closed.
+//
+// For EventError, Err holds the error itself, wrapping intact, so consumers can
+// match it with errors.Is rather than parsing Data, which holds its message.
+// For EventContainerExited and EventContainerKilled with a non-zero Code, Err
+// is an *ExitError, which wraps ErrContainerFailed.
 type Event struct {
-	Time time.Time
-	Data string
-	Type EventType
-	Code int
+	Time    time.Time
+	Err     error          // the error; set for EventError and for a non-zero exit
+	Message *StreamMessage // parsed stream-json fields; set only for EventMessage
+	Data    string
+	Type    EventType
+	Code    int
+}
+
+// eventTypeNames maps each EventType to its String name, which is also used
+// when an Event is rendered as JSON. Names are stable; new types are appended.
+var eventTypeNames = [...]string{
+	EventBuildStarted:      "build_started",
+	EventBuildComplete:     "build_complete",
+	EventContainerStarted:  "container_started",
+	EventOutput:            "output",
+	EventContainerExited:   "container_exited",
+	EventError:             "error",
+	EventHealthChanged:     "health_changed",
+	EventWarning:           "warning",
+	EventMessage:           "message",
+	EventContainerAttached: "container_attached",
+	EventBuildOutput:       "build_output",
+	EventRestart:           "restart",
+	EventContainerKilled:   "container_killed",
+}
+
+// String returns the stable lowercase name of t, e.g. "output", or
+// "unknown(N)" for a value that is not a defined EventType.
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return "unknown(" + strconv.Itoa(int(t)) + ")"
+}
+
+// wireName returns the name of t used in JSON: its String name, or its
+// decimal value if t is unknown, so that types added by a newer cldpd survive
+// a round trip through an older one.
+func (t EventType) wireName() string {
+	if t >= 0 && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return strconv.Itoa(int(t))
+}
+
+// parseEventType is the inverse of wireName.
+func parseEventType(name string) (EventType, error) {
+	for t, n := range eventTypeNames {
+		if n == name {
+			return EventType(t), nil
+		}
+	}
+	n, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown event type %q", name)
+	}
+	return EventType(n), nil
+}
+
+// eventJSON is the wire form of an Event.
+type eventJSON struct {
+	Time time.Time `json:"time"`
+	Code *int      `json:"code,omitempty"` // set only for container_exited, container_killed, and restart, where 0 is meaningful
+	Type string    `json:"type"`
+	Data string    `json:"data,omitempty"`
+}
+
+// MarshalJSON renders e as an object with the event type as a string name, e.g.
+// {"time":"...","type":"output","data":"..."}. Time is RFC 3339. An unknown
+// type is written as its decimal value, e.g. "type":"42". Code is included only
+// for EventContainerExited, EventContainerKilled, and EventRestart. For
+// EventMessage, Data carries the raw stream-json line. For EventError, Err is
+// rendered as its message in Data, which already holds it for events emitted
+// by a Session; an exit's ExitError is implied by its code.
+func (e Event) MarshalJSON() ([]byte, error) {
+	out := eventJSON{
+		Time: e.Time,
+		Type: e.Type.wireName(),
+		Data: e.Data,
+	}
+	if e.Type == EventError && out.Data == "" && e.Err != nil {
+		out.Data = e.Err.Error()
+	}
+	if e.Type == EventContainerExited || e.Type == EventContainerKilled || e.Type == EventRestart {
+		code := e.Code
+		out.Code = &code
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON parses the form written by MarshalJSON. The type may be a name
+// or a decimal value; other strings are an error. For EventMessage, Message is
+// parsed again from Data. For EventError, Err is an error with Data as its
+// message; the original error's wrapping does not survive JSON. A non-zero
+// exit gets its ExitError back.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var in eventJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	t, err := parseEventType(in.Type)
+	if err != nil {
+		return err
+	}
+	*e = Event{Time: in.Time, Type: t, Data: in.Data}
+	if in.Code != nil {
+		e.Code = *in.Code
+	}
+	switch t {
+	case EventMessage:
+		if msg, ok := parseStreamLine(in.Data); ok {
+			e.Message = &msg
+		}
+	case EventError:
+		e.Err = errors.New(in.Data)
+	case EventContainerExited, EventContainerKilled:
+		if e.Code != 0 {
+			e.Err = &ExitError{Code: e.Code}
+		}
+	}
+	return nil
 }
@@ -3,12 +3,15 @@
 package cldpd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
 
 func TestEventType_Constants(t *testing.T) {
-	// All six event types must be distinct.
+	// All event types must be distinct.
 	types := []EventType{
 		EventBuildStarted,
 		EventBuildComplete,
@@ -16,6 +19,13 @@ func TestEventType_Constants(t *testing.T) {
 		EventOutput,
 		EventContainerExited,
 		EventError,
+		EventHealthChanged,
+		EventWarning,
+		EventMessage,
+		EventContainerAttached,
+		EventBuildOutput,
+		EventRestart,
+		EventContainerKilled,
 	}
 	seen := make(map[EventType]bool)
 	for _, et := range types {
@@ -92,3 +102,135 @@ func TestEventType_BuildSequence(t *testing.T) {
 		}
 	}
 }
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		event Event
+		want  string
+	}{
+		{
+			Event{Type: EventOutput, Data: "hello", Time: at},
+			`{"time":"2026-01-02T03:04:05Z","type":"output","data":"hello"}`,
+		},
+		{
+			Event{Type: EventContainerExited, Code: 0, Time: at},
+			`{"time":"2026-01-02T03:04:05Z","code":0,"type":"container_exited"}`,
+		},
+		{
+			Event{Type: EventContainerKilled, Code: 137, Time: at},
+			`{"time":"2026-01-02T03:04:05Z","code":137,"type":"container_killed"}`,
+		},
+		{
+			Event{Type: EventType(99), Time: at},
+			`{"time":"2026-01-02T03:04:05Z","type":"99"}`,
+		},
+	}
+	for _, tc := range cases {
+		got, err := json.Marshal(tc.event)
+		if err != nil {
+			t.Fatalf("Marshal(%+v): %v", tc.event, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("Marshal(%+v):\n got %s\nwant %s", tc.event, got, tc.want)
+		}
+	}
+}
+
+func TestEventTypeNames_CoverAllTypes(t *testing.T) {
+	for et := EventBuildStarted; et <= EventContainerKilled; et++ {
+		if int(et) >= len(eventTypeNames) || eventTypeNames[et] == "" {
+			t.Errorf("EventType %d has no name", et)
+		}
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	seen := make(map[string]EventType)
+	for et := EventBuildStarted; et <= EventContainerKilled; et++ {
+		name := et.String()
+		if name == "" {
+			t.Errorf("EventType %d: empty name", et)
+			continue
+		}
+		if prev, ok := seen[name]; ok {
+			t.Errorf("EventType %d and %d share name %q", prev, et, name)
+		}
+		seen[name] = et
+	}
+	if got := EventOutput.String(); got != "output" {
+		t.Errorf("EventOutput.String(): got %q, want %q", got, "output")
+	}
+}
+
+func TestEventType_StringUnknown(t *testing.T) {
+	for et, want := range map[EventType]string{99: "unknown(99)", -1: "unknown(-1)"} {
+		if got := et.String(); got != want {
+			t.Errorf("EventType(%d).String(): got %q, want %q", int(et), got, want)
+		}
+	}
+}
+
+func TestEvent_JSONRoundTrip(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	line := `{"type":"assistant","message":{"content":[{"type":"text","text":"hi"}]}}`
+	msg, ok := parseStreamLine(line)
+	if !ok {
+		t.Fatalf("parseStreamLine(%q) failed", line)
+	}
+	cases := []Event{
+		{Type: EventBuildStarted, Data: "cldpd-api", Time: at},
+		{Type: EventBuildComplete, Data: "cldpd-api", Time: at},
+		{Type: EventContainerStarted, Data: "cldpd-api", Time: at},
+		{Type: EventOutput, Data: "hello", Time: at},
+		{Type: EventContainerExited, Code: 0, Time: at},
+		{Type: EventContainerExited, Code: 137, Err: &ExitError{Code: 137}, Time: at},
+		{Type: EventError, Data: "boom", Err: errors.New("boom"), Time: at},
+		{Type: EventHealthChanged, Data: "healthy", Time: at},
+		{Type: EventWarning, Data: "low disk space", Time: at},
+		{Type: EventMessage, Data: line, Message: &msg, Time: at},
+		{Type: EventContainerAttached, Data: "cldpd-api", Time: at},
+		{Type: EventBuildOutput, Data: "Step 1/2", Time: at},
+		{Type: EventRestart, Data: "cldpd-api", Code: 1, Time: at},
+		{Type: EventContainerKilled, Code: 137, Err: &ExitError{Code: 137}, Time: at},
+		{Type: EventType(99), Data: "from the future", Time: at},
+	}
+	for _, want := range cases {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", want.Type, err)
+		}
+		var got Event
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got.Type != want.Type || got.Data != want.Data || got.Code != want.Code || !got.Time.Equal(want.Time) {
+			t.Errorf("round trip of %s: got %+v, want %+v", data, got, want)
+		}
+		if (got.Message == nil) != (want.Message == nil) || (got.Message != nil && got.Message.Text != want.Message.Text) {
+			t.Errorf("round trip of %s: Message got %+v, want %+v", data, got.Message, want.Message)
+		}
+		if (got.Err == nil) != (want.Err == nil) || (got.Err != nil && got.Err.Error() != want.Err.Error()) {
+			t.Errorf("round trip of %s: Err got %v, want %v", data, got.Err, want.Err)
+		}
+	}
+}
+
+func TestEvent_MarshalJSON_ErrWithoutData(t *testing.T) {
+	e := Event{Type: EventError, Err: fmt.Errorf("%w: cldpd-api", ErrSessionNotFound), Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	got, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"time":"2026-01-02T03:04:05Z","type":"error","data":"no running session for pod: cldpd-api"}`
+	if string(got) != want {
+		t.Errorf("Marshal:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestEvent_UnmarshalJSON_UnknownName(t *testing.T) {
+	var e Event
+	if err := json.Unmarshal([]byte(`{"time":"2026-01-02T03:04:05Z","type":"exploded"}`), &e); err == nil {
+		t.Error("expected error for unknown type name, got nil")
+	}
+}
@@ -0,0 +1,231 @@
+package cldpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of GitHub reference for IssueRef.Kind.
+const (
+	// IssueKindIssue is a GitHub issue, or an owner/repo#123 shorthand.
+	IssueKindIssue = "issue"
+
+	// IssueKindPullRequest is a GitHub pull request.
+	IssueKindPullRequest = "pull"
+)
+
+const (
+	// issueFetchTimeout bounds how long Start waits for an issue's content.
+	issueFetchTimeout = 30 * time.Second
+
+	// maxIssueBodyBytes bounds the issue body carried in the prompt, which is
+	// passed to the container as a single argument.
+	maxIssueBodyBytes = 32 << 10
+
+	// defaultPromptPrefix precedes the issue URL in Start's directive unless
+	// the pod sets promptPrefix.
+	defaultPromptPrefix = "Work on this GitHub issue: "
+
+	// urlPlaceholder marks where a pod's promptPrefix places the issue URL.
+	urlPlaceholder = "{{url}}"
+)
+
+var (
+	// githubOwnerPattern matches a GitHub user or organization name.
+	githubOwnerPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})$`)
+
+	// githubRepoPattern matches a GitHub repository name.
+	githubRepoPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+)
+
+// IssueRef identifies a GitHub issue or pull request, as parsed by ParseIssueURL.
+type IssueRef struct {
+	Owner  string // repository owner, e.g. zoobzio
+	Repo   string // repository name, e.g. cldpd
+	Kind   string // IssueKindIssue or IssueKindPullRequest
+	URL    string // canonical https://github.com URL for the issue or pull request
+	Number int    // issue or pull request number
+}
+
+// ParseIssueURL parses s as a reference to a GitHub issue or pull request. It
+// accepts https://github.com/<owner>/<repo>/issues/<n> and .../pull/<n> URLs,
+// with an optional trailing slash, query, or fragment, and the
+// <owner>/<repo>#<n> shorthand, which is taken to be an issue. Surrounding
+// whitespace is ignored. The returned URL is canonical, without any query or
+// fragment.
+//
+// Anything else returns an error wrapping ErrInvalidIssueURL that says what
+// is wrong with s.
+func ParseIssueURL(s string) (IssueRef, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return IssueRef{}, fmt.Errorf("%w: empty", ErrInvalidIssueURL)
+	}
+
+	var ref IssueRef
+	var number string
+	if owner, rest, ok := strings.Cut(s, "/"); ok && !strings.Contains(s, "://") && strings.Contains(rest, "#") {
+		repo, n, _ := strings.Cut(rest, "#")
+		ref = IssueRef{Owner: owner, Repo: repo, Kind: IssueKindIssue}
+		number = n
+	} else {
+		var err error
+		ref, number, err = parseGitHubURL(s)
+		if err != nil {
+			return IssueRef{}, fmt.Errorf("%w: %q: %w", ErrInvalidIssueURL, s, err)
+		}
+	}
+
+	if !githubOwnerPattern.MatchString(ref.Owner) {
+		return IssueRef{}, fmt.Errorf("%w: %q: invalid owner %q", ErrInvalidIssueURL, s, ref.Owner)
+	}
+	if !githubRepoPattern.MatchString(ref.Repo) || ref.Repo == "." || ref.Repo == ".." {
+		return IssueRef{}, fmt.Errorf("%w: %q: invalid repository %q", ErrInvalidIssueURL, s, ref.Repo)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 || strings.HasPrefix(number, "+") {
+		return IssueRef{}, fmt.Errorf("%w: %q: number %q is not a positive integer", ErrInvalidIssueURL, s, number)
+	}
+	ref.Number = n
+
+	path := "issues"
+	if ref.Kind == IssueKindPullRequest {
+		path = "pull"
+	}
+	ref.URL = fmt.Sprintf("https://github.com/%s/%s/%s/%d", ref.Owner, ref.Repo, path, n)
+	return ref, nil
+}
+
+// parseGitHubURL splits a github.com issue or pull request URL into a
+// reference, without its number, and the number as written.
+func parseGitHubURL(s string) (IssueRef, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return IssueRef{}, "", fmt.Errorf("not a URL or owner/repo#number: %w", err)
+	}
+	if u.Scheme != "https" {
+		if u.Scheme == "" {
+			return IssueRef{}, "", errors.New("not a URL or owner/repo#number")
+		}
+		return IssueRef{}, "", fmt.Errorf("scheme %q is not https", u.Scheme)
+	}
+	if host := strings.ToLower(u.Host); host != "github.com" && host != "www.github.com" {
+		return IssueRef{}, "", fmt.Errorf("host %q is not github.com", u.Host)
+	}
+	if u.User != nil {
+		return IssueRef{}, "", errors.New("URL must not carry credentials")
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(u.Path, "/"), "/"), "/")
+	if len(parts) != 4 {
+		return IssueRef{}, "", fmt.Errorf("path %q is not /<owner>/<repo>/issues/<number> or /<owner>/<repo>/pull/<number>", u.Path)
+	}
+	ref := IssueRef{Owner: parts[0], Repo: parts[1]}
+	switch parts[2] {
+	case "issues":
+		ref.Kind = IssueKindIssue
+	case "pull":
+		ref.Kind = IssueKindPullRequest
+	default:
+		return IssueRef{}, "", fmt.Errorf("path %q is not /<owner>/<repo>/issues/<number> or /<owner>/<repo>/pull/<number>", u.Path)
+	}
+	return ref, parts[3], nil
+}
+
+// Issue is the content of a GitHub issue, as fetched by an IssueFetcher.
+type Issue struct {
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// IssueFetcher fetches the content of a GitHub issue, so Start can hand it to
+// the agent in the prompt when the pod sets fetchIssue. Use WithIssueFetcher
+// to replace the default, GHIssueFetcher.
+type IssueFetcher interface {
+	// FetchIssue returns the title, body, and labels of the issue ref names.
+	FetchIssue(ctx context.Context, ref IssueRef) (Issue, error)
+}
+
+// GHIssueFetcher implements IssueFetcher with the GitHub CLI on the host,
+// running gh issue view with whatever authentication gh has.
+type GHIssueFetcher struct{}
+
+// FetchIssue runs gh issue view <url> --json title,body,labels. It fails if
+// gh is not installed, or exits with a non-zero status, e.g. when it is not
+// logged in or the issue does not exist.
+func (GHIssueFetcher) FetchIssue(ctx context.Context, ref IssueRef) (Issue, error) {
+	//nolint:gosec // fixed binary; the URL has been validated by ParseIssueURL
+	cmd := exec.CommandContext(ctx, "gh", "issue", "view", ref.URL, "--json", "title,body,labels")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return Issue{}, fmt.Errorf("gh issue view: exit code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		return Issue{}, fmt.Errorf("gh issue view: %w", err)
+	}
+
+	var view struct {
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+	if err := json.Unmarshal(out, &view); err != nil {
+		return Issue{}, fmt.Errorf("gh issue view: parse output: %w", err)
+	}
+	issue := Issue{Title: view.Title, Body: view.Body}
+	for _, l := range view.Labels {
+		issue.Labels = append(issue.Labels, l.Name)
+	}
+	return issue, nil
+}
+
+// reviewPrompt returns the directive for a review of the pull request ref.
+func reviewPrompt(ref IssueRef) string {
+	return "Review this pull request: " + ref.URL + ". Leave review comments and an approval decision."
+}
+
+// issueDirective returns Start's directive for ref: prefix, or
+// defaultPromptPrefix if it is empty, followed by the issue URL. A prefix
+// containing urlPlaceholder has the URL substituted there instead.
+func issueDirective(prefix string, ref IssueRef) string {
+	if prefix == "" {
+		prefix = defaultPromptPrefix
+	}
+	if strings.Contains(prefix, urlPlaceholder) {
+		return strings.ReplaceAll(prefix, urlPlaceholder, ref.URL)
+	}
+	return prefix + ref.URL
+}
+
+// issuePrompt returns directive followed by issue's title, labels, and body.
+// The body is cut at maxIssueBodyBytes.
+func issuePrompt(directive string, issue Issue) string {
+	var b strings.Builder
+	b.WriteString(directive + "\n\n")
+	b.WriteString("Title: " + issue.Title + "\n")
+	if len(issue.Labels) > 0 {
+		b.WriteString("Labels: " + strings.Join(issue.Labels, ", ") + "\n")
+	}
+	body := strings.TrimSpace(issue.Body)
+	if body == "" {
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	body, _ = truncateLine(body, maxIssueBodyBytes)
+	b.WriteString("\n" + body)
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package cldpd
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives session lifecycle measurements from a Dispatcher,
+// for export to a metrics backend such as Prometheus. Implementations adapt
+// these calls to their own counters and histograms. Methods are called from
+// session goroutines, so implementations must be safe for concurrent use and
+// should return quickly.
+//
+// Methods are added as cldpd reports new measurements, as ContainerStarted
+// and OutputDropped were. An implementation that embeds NopMetrics keeps
+// compiling when they are, receiving no calls for the methods it lacks.
+type MetricsCollector interface {
+	// SessionStarted is called when Start, Resume, or Attach returns a Session.
+	SessionStarted(pod string)
+
+	// BuildFinished is called when an image build ends, with the time spent
+	// building and the build error, or nil if it succeeded.
+	BuildFinished(pod string, d time.Duration, err error)
+
+	// ContainerStarted is called each time a Session started by Start runs its
+	// pod's container: once after the build, and again for each restart under
+	// WithRestartPolicy. Resume and Attach start no container.
+	ContainerStarted(pod string)
+
+	// SessionExited is called once when a Session ends, with its exit code, its
+	// error (nil when the container exited on its own), and the time spent in
+	// the container or exec. A Session that fails before running reports code -1.
+	SessionExited(pod string, code int, err error, d time.Duration)
+
+	// OutputDropped is called once when a Session's output ends, with the
+	// number of output lines not delivered on Events because its buffer was
+	// full; n is often zero. It matches the Session's
+	// SessionResult.DroppedLines.
+	OutputDropped(pod string, n int64)
+}
+
+// NopMetrics is a MetricsCollector that discards every measurement. It is the
+// Dispatcher's default, and can be embedded to implement only some methods.
+type NopMetrics struct{}
+
+// SessionStarted does nothing.
+func (NopMetrics) SessionStarted(string) {}
+
+// BuildFinished does nothing.
+func (NopMetrics) BuildFinished(string, time.Duration, error) {}
+
+// ContainerStarted does nothing.
+func (NopMetrics) ContainerStarted(string) {}
+
+// SessionExited does nothing.
+func (NopMetrics) SessionExited(string, int, error, time.Duration) {}
+
+// OutputDropped does nothing.
+func (NopMetrics) OutputDropped(string, int64) {}
+
+// MetricsSnapshot is a point-in-time copy of the totals held by MemoryMetrics.
+type MetricsSnapshot struct {
+	ExitCodes     map[int]int   // sessions that exited, by exit code
+	BuildTime     time.Duration // total time spent in builds
+	RunTime       time.Duration // total time spent in containers and execs
+	DroppedLines  int64         // output lines dropped from full event buffers
+	Started       int           // sessions started
+	Running       int           // sessions started but not yet exited
+	Failed        int           // sessions that ended with an error
+	Builds        int           // builds finished, successful or not
+	BuildFailures int           // builds that failed
+	Containers    int           // containers run by Start, including restarts
+}
+
+// MemoryMetrics is a MetricsCollector that keeps running totals in memory, for
+// tests and for services that expose their own metrics endpoint. The zero
+// value is ready to use.
+type MemoryMetrics struct {
+	snap MetricsSnapshot
+	mu   sync.Mutex
+}
+
+// SessionStarted counts a started, running session.
+func (m *MemoryMetrics) SessionStarted(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap.Started++
+	m.snap.Running++
+}
+
+// BuildFinished counts a build and adds its duration to BuildTime.
+func (m *MemoryMetrics) BuildFinished(_ string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap.Builds++
+	m.snap.BuildTime += d
+	if err != nil {
+		m.snap.BuildFailures++
+	}
+}
+
+// ContainerStarted counts a container run.
+func (m *MemoryMetrics) ContainerStarted(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap.Containers++
+}
+
+// SessionExited counts an exit by code, or a failure if err is non-nil, and
+// adds the run duration to RunTime.
+func (m *MemoryMetrics) SessionExited(_ string, code int, err error, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap.Running--
+	m.snap.RunTime += d
+	if err != nil {
+		m.snap.Failed++
+		return
+	}
+	if m.snap.ExitCodes == nil {
+		m.snap.ExitCodes = make(map[int]int)
+	}
+	m.snap.ExitCodes[code]++
+}
+
+// OutputDropped adds n to DroppedLines.
+func (m *MemoryMetrics) OutputDropped(_ string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snap.DroppedLines += n
+}
+
+// Snapshot returns a copy of the current totals.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := m.snap
+	if m.snap.ExitCodes != nil {
+		snap.ExitCodes = make(map[int]int, len(m.snap.ExitCodes))
+		for code, n := range m.snap.ExitCodes {
+			snap.ExitCodes[code] = n
+		}
+	}
+	return snap
+}
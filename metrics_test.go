@@ -0,0 +1,63 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetrics_ZeroValue(t *testing.T) {
+	var m MemoryMetrics
+	snap := m.Snapshot()
+	if snap.Started != 0 || snap.Running != 0 || snap.ExitCodes != nil {
+		t.Errorf("got %+v, want zero snapshot", snap)
+	}
+}
+
+func TestMemoryMetrics_Totals(t *testing.T) {
+	var m MemoryMetrics
+	m.SessionStarted("a")
+	m.SessionStarted("b")
+	m.SessionStarted("c")
+	m.BuildFinished("a", 2*time.Second, nil)
+	m.BuildFinished("b", 3*time.Second, errors.New("boom"))
+	m.ContainerStarted("a")
+	m.ContainerStarted("a")
+	m.SessionExited("a", 0, nil, 5*time.Second)
+	m.SessionExited("b", -1, errors.New("boom"), 0)
+	m.OutputDropped("a", 7)
+	m.OutputDropped("b", 0)
+
+	snap := m.Snapshot()
+	if snap.Started != 3 || snap.Running != 1 {
+		t.Errorf("Started/Running: got %d/%d, want 3/1", snap.Started, snap.Running)
+	}
+	if snap.Builds != 2 || snap.BuildFailures != 1 || snap.BuildTime != 5*time.Second {
+		t.Errorf("builds: got %d (%d failed, %v), want 2 (1 failed, 5s)", snap.Builds, snap.BuildFailures, snap.BuildTime)
+	}
+	if snap.Containers != 2 {
+		t.Errorf("Containers: got %d, want 2", snap.Containers)
+	}
+	if snap.Failed != 1 || snap.RunTime != 5*time.Second {
+		t.Errorf("Failed/RunTime: got %d/%v, want 1/5s", snap.Failed, snap.RunTime)
+	}
+	if len(snap.ExitCodes) != 1 || snap.ExitCodes[0] != 1 {
+		t.Errorf("ExitCodes: got %v, want map[0:1]", snap.ExitCodes)
+	}
+	if snap.DroppedLines != 7 {
+		t.Errorf("DroppedLines: got %d, want 7", snap.DroppedLines)
+	}
+}
+
+func TestMemoryMetrics_SnapshotIsCopy(t *testing.T) {
+	var m MemoryMetrics
+	m.SessionStarted("a")
+	m.SessionExited("a", 3, nil, 0)
+	snap := m.Snapshot()
+	snap.ExitCodes[3] = 99
+	if got := m.Snapshot().ExitCodes[3]; got != 1 {
+		t.Errorf("ExitCodes[3] after modifying snapshot: got %d, want 1", got)
+	}
+}
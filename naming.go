@@ -0,0 +1,107 @@
+package cldpd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Every name cldpd derives from a pod name is defined in this file, so that the
+// name Start creates is by construction the name Resume, Attach, Status, and
+// the Session's Stop and Kill target. Features that derive a new name from a
+// pod must add it here and register it in the naming invariant tests.
+
+// namePrefix prefixes the Docker objects cldpd names after a pod.
+const namePrefix = "cldpd-"
+
+// containerName returns the deterministic Docker container name for a pod.
+// Used by Start to name the new container and by everything that later targets it.
+func containerName(podName string) string {
+	return namePrefix + podName
+}
+
+// reviewSuffix is appended to a pod name to name its review sessions.
+const reviewSuffix = "-review"
+
+// reviewName returns the name StartReview derives a review session's container
+// and session ID from, so that a review of a pod does not take the container
+// name of the pod's issue session. Name-derived operations reach the review
+// container by passing reviewName(podName) as the pod name.
+func reviewName(podName string) string {
+	return podName + reviewSuffix
+}
+
+// podFromContainer returns the pod name for a container named by containerName.
+// It reports false for containers cldpd did not name.
+func podFromContainer(container string) (string, bool) {
+	pod, ok := strings.CutPrefix(container, namePrefix)
+	if !ok || pod == "" {
+		return "", false
+	}
+	return pod, true
+}
+
+// podFromImage returns the pod name for an image tag (repository[:tag]) named
+// by imageTag's default. It reports false for untagged images and images cldpd
+// did not name.
+func podFromImage(tag string) (string, bool) {
+	repo, _, _ := strings.Cut(tag, ":")
+	if strings.Contains(repo, "/") {
+		return "", false
+	}
+	return podFromContainer(repo)
+}
+
+// imageTag returns the image tag Start builds and runs for a pod: the pod's
+// configured image if set, otherwise cldpd-<podName>.
+func imageTag(podName string, image string) string {
+	if image != "" {
+		return image
+	}
+	return namePrefix + podName
+}
+
+// buildTagPrefix begins the version part of the tags buildTag makes.
+const buildTagPrefix = "build-"
+
+// buildTagLayout formats a build tag's time. It is fixed-width UTC, so the
+// build tags of one image sort oldest first as strings.
+const buildTagLayout = "20060102T150405.000000000Z"
+
+// buildTag returns the tag a build of the image tagged tag is also given,
+// <tag>:build-<time>, so that the builds a rebuild replaces stay tagged rather
+// than left dangling, and PruneImages can tell them apart by age. It reports
+// false for a tag that is not a default cldpd-<pod> name: an image set with a
+// pod's image field is tagged exactly as configured.
+func buildTag(tag string, t time.Time) (string, bool) {
+	if strings.Contains(tag, ":") {
+		return "", false
+	}
+	if _, ok := podFromImage(tag); !ok {
+		return "", false
+	}
+	return tag + ":" + buildTagPrefix + t.UTC().Format(buildTagLayout), true
+}
+
+// podFromBuildTag returns the pod name for a tag made by buildTag. It reports
+// false for every other tag, including the pod's own cldpd-<pod> tag.
+func podFromBuildTag(tag string) (string, bool) {
+	repo, version, ok := strings.Cut(tag, ":")
+	if !ok || !strings.HasPrefix(version, buildTagPrefix) {
+		return "", false
+	}
+	return podFromImage(repo)
+}
+
+// newSessionID generates a unique session ID in the format <podName>-<hex8>.
+// Uses crypto/rand for the random suffix.
+func newSessionID(podName string) string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand failure is extremely unlikely; fall back to a fixed suffix
+		// rather than panicking. The session will still function.
+		return podName + "-00000000"
+	}
+	return podName + "-" + hex.EncodeToString(b[:])
+}
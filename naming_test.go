@@ -0,0 +1,328 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContainerName(t *testing.T) {
+	cases := []struct {
+		podName string
+		want    string
+	}{
+		{"myrepo", "cldpd-myrepo"},
+		{"some-repo", "cldpd-some-repo"},
+		{"a", "cldpd-a"},
+	}
+	for _, tc := range cases {
+		got := containerName(tc.podName)
+		if got != tc.want {
+			t.Errorf("containerName(%q): got %q, want %q", tc.podName, got, tc.want)
+		}
+	}
+}
+
+func TestReviewName(t *testing.T) {
+	if got := containerName(reviewName("myrepo")); got != "cldpd-myrepo-review" {
+		t.Errorf("review container: got %q, want cldpd-myrepo-review", got)
+	}
+	if reviewName("myrepo") == "myrepo" {
+		t.Error("reviewName: review and issue sessions share a name")
+	}
+}
+
+func TestNewSessionID_Format(t *testing.T) {
+	re := regexp.MustCompile(`^myrepo-[0-9a-f]{8}$`)
+	id := newSessionID("myrepo")
+	if !re.MatchString(id) {
+		t.Errorf("newSessionID: got %q, want format myrepo-<8 hex chars>", id)
+	}
+}
+
+func TestNewSessionID_Unique(t *testing.T) {
+	id1 := newSessionID("pod")
+	id2 := newSessionID("pod")
+	if id1 == id2 {
+		t.Errorf("newSessionID: two calls returned same ID %q", id1)
+	}
+}
+
+func TestPodFromContainer(t *testing.T) {
+	cases := []struct {
+		container string
+		want      string
+		ok        bool
+	}{
+		{"cldpd-myrepo", "myrepo", true},
+		{"cldpd-cldpd-x", "cldpd-x", true},
+		{"cldpd-", "", false},
+		{"myrepo", "", false},
+		{"other-cldpd-myrepo", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := podFromContainer(tc.container)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("podFromContainer(%q): got (%q, %v), want (%q, %v)", tc.container, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestPodFromImage(t *testing.T) {
+	cases := []struct {
+		tag  string
+		want string
+		ok   bool
+	}{
+		{"cldpd-myrepo:latest", "myrepo", true},
+		{"cldpd-myrepo", "myrepo", true},
+		{"cldpd-:latest", "", false},
+		{"<none>:<none>", "", false},
+		{"registry.local:5000/cldpd-myrepo:v1", "", false},
+		{"custom:v1", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := podFromImage(tc.tag)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("podFromImage(%q): got (%q, %v), want (%q, %v)", tc.tag, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBuildTag(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("X", 3600))
+	got, ok := buildTag("cldpd-myrepo", at)
+	if !ok || got != "cldpd-myrepo:build-20260102T020405.000000006Z" {
+		t.Errorf("buildTag: got (%q, %v)", got, ok)
+	}
+	if pod, ok := podFromBuildTag(got); !ok || pod != "myrepo" {
+		t.Errorf("podFromBuildTag(%q): got (%q, %v), want (myrepo, true)", got, pod, ok)
+	}
+	later, _ := buildTag("cldpd-myrepo", at.Add(time.Second))
+	if later <= got {
+		t.Errorf("build tags do not sort by time: %q <= %q", later, got)
+	}
+	for _, tag := range []string{"custom", "custom:v1", "cldpd-myrepo:v1", "registry.local/cldpd-myrepo"} {
+		if bt, ok := buildTag(tag, at); ok {
+			t.Errorf("buildTag(%q): got %q, want none", tag, bt)
+		}
+	}
+	for _, tag := range []string{"cldpd-myrepo", "cldpd-myrepo:latest", "custom:build-1", "cldpd-:build-1"} {
+		if pod, ok := podFromBuildTag(tag); ok {
+			t.Errorf("podFromBuildTag(%q): got %q, want none", tag, pod)
+		}
+	}
+}
+
+func TestPod_ImageTag(t *testing.T) {
+	if got := (Pod{Name: "myrepo"}).ImageTag(); got != "cldpd-myrepo" {
+		t.Errorf("default: got %q, want %q", got, "cldpd-myrepo")
+	}
+	if got := (Pod{Name: "myrepo", Config: PodConfig{Image: "custom:v1"}}).ImageTag(); got != "custom:v1" {
+		t.Errorf("configured: got %q, want %q", got, "custom:v1")
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	if got := imageTag("myrepo", ""); got != "cldpd-myrepo" {
+		t.Errorf("default: got %q, want %q", got, "cldpd-myrepo")
+	}
+	if got := imageTag("myrepo", "custom:v1"); got != "custom:v1" {
+		t.Errorf("configured: got %q, want %q", got, "custom:v1")
+	}
+}
+
+// namingRecorder is a Runner that records the name every operation targets,
+// keyed by operation. Runs block until killed and attaches until stopped, so
+// the started and attached sessions can each be ended by a different operation.
+type namingRecorder struct {
+	mockRunner
+	targets map[string][]string
+	mu      sync.Mutex
+}
+
+func newNamingRecorder() *namingRecorder {
+	r := &namingRecorder{targets: make(map[string][]string)}
+	killed := make(chan struct{})
+	stopped := make(chan struct{})
+	var killOnce, stopOnce sync.Once
+	r.buildFn = func(_ context.Context, tag string, _ string, opts BuildOptions) error {
+		r.record("build", tag)
+		for _, t := range opts.Tags {
+			r.record("build.tag", t)
+		}
+		return nil
+	}
+	r.runFn = func(_ context.Context, opts RunOptions, _ io.Writer) (int, error) {
+		r.record("run.image", opts.Image)
+		r.record("run", opts.Name)
+		<-killed
+		return 137, nil
+	}
+	r.execFn = func(_ context.Context, container string, _ []string, _ io.Writer) (int, error) {
+		r.record("exec", container)
+		return 0, nil
+	}
+	r.attachFn = func(_ context.Context, container string, _ io.Writer) (int, error) {
+		r.record("attach", container)
+		<-stopped
+		return 143, nil
+	}
+	r.inspectFn = func(_ context.Context, container string) (ContainerState, error) {
+		r.record("inspect", container)
+		// No container holds the name until Start has run one.
+		return ContainerState{Running: len(r.recorded("run")) > 0}, nil
+	}
+	r.stopFn = func(_ context.Context, container string, _ time.Duration, _ string) error {
+		r.record("stop", container)
+		stopOnce.Do(func() { close(stopped) })
+		return nil
+	}
+	r.killFn = func(_ context.Context, container string) error {
+		r.record("kill", container)
+		killOnce.Do(func() { close(killed) })
+		return nil
+	}
+	return r
+}
+
+func (r *namingRecorder) record(op, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets[op] = append(r.targets[op], name)
+}
+
+// recorded returns the names recorded for op.
+func (r *namingRecorder) recorded(op string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.targets[op]...)
+}
+
+// awaitRecorded polls until op has been recorded at least once.
+func (r *namingRecorder) awaitRecorded(t *testing.T, op string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(r.recorded(op)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was never called", op)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestNaming_RoundTrip is the naming invariant suite. For each pod name and
+// image configuration it drives every operation that derives a name from a
+// pod and asserts that each targets exactly what Start created. A feature that
+// adds a new name-derived artifact must add a row to artifacts.
+func TestNaming_RoundTrip(t *testing.T) {
+	podNames := []string{"myrepo", "some-repo", "a", "repo.with.dots", "Mixed_Case9", "cldpd-nested"}
+	images := []string{"", "custom:v1"}
+
+	// artifacts maps each recorded operation to the name it must target, given
+	// the container Start created and the tag it built.
+	artifacts := []struct {
+		want func(container, tag string) string
+		op   string
+	}{
+		{func(_, tag string) string { return tag }, "run.image"}, // Start runs what it built
+		{func(c, _ string) string { return c }, "exec"},          // Resume
+		{func(c, _ string) string { return c }, "inspect"},       // Status and Attach
+		{func(c, _ string) string { return c }, "attach"},        // Attach
+		{func(c, _ string) string { return c }, "stop"},          // Session.Stop
+		{func(c, _ string) string { return c }, "kill"},          // Session.Kill
+	}
+
+	for _, pod := range podNames {
+		for _, image := range images {
+			t.Run(pod+"/"+image, func(t *testing.T) {
+				podsDir := t.TempDir()
+				makeTestPod(t, podsDir, pod)
+				if image != "" {
+					cfg := []byte(`{"image":"` + image + `"}`)
+					if err := os.WriteFile(filepath.Join(podsDir, pod, "pod.json"), cfg, 0644); err != nil {
+						t.Fatalf("write pod.json: %v", err)
+					}
+				}
+				r := newNamingRecorder()
+				d := NewDispatcher(podsDir, r, WithDiskThresholds(DiskThresholds{}))
+				ctx := context.Background()
+
+				started, err := d.Start(ctx, pod, "https://github.com/org/repo/issues/1")
+				if err != nil {
+					t.Fatalf("Start: %v", err)
+				}
+				r.awaitRecorded(t, "run")
+				created := r.recorded("run")[0]
+				tag := r.recorded("build")[0]
+
+				if created != containerName(pod) {
+					t.Errorf("created container %q, want containerName(%q) = %q", created, pod, containerName(pod))
+				}
+				if tag != imageTag(pod, image) {
+					t.Errorf("built tag %q, want imageTag = %q", tag, imageTag(pod, image))
+				}
+				// PruneImages finds a pod's builds by their build tags.
+				buildTags := r.recorded("build.tag")
+				switch {
+				case image != "" && len(buildTags) != 0:
+					t.Errorf("configured image given build tags %v", buildTags)
+				case image == "" && len(buildTags) != 1:
+					t.Errorf("build tags: got %v, want one", buildTags)
+				case image == "":
+					if got, ok := podFromBuildTag(buildTags[0]); !ok || got != pod || !strings.HasPrefix(buildTags[0], tag+":") {
+						t.Errorf("build tag %q: podFromBuildTag got (%q, %v), want a %s tag of %q", buildTags[0], got, ok, tag, pod)
+					}
+				}
+				if got, ok := podFromContainer(created); !ok || got != pod {
+					t.Errorf("podFromContainer(%q): got (%q, %v), want (%q, true)", created, got, ok, pod)
+				}
+				if !strings.HasPrefix(started.ID(), pod+"-") {
+					t.Errorf("session ID %q does not start with %q", started.ID(), pod+"-")
+				}
+
+				resumed, err := d.Resume(ctx, pod, "more")
+				if err != nil {
+					t.Fatalf("Resume: %v", err)
+				}
+				drainSession(t, resumed, 2*time.Second)
+
+				if _, err := d.Status(ctx, pod); err != nil {
+					t.Fatalf("Status: %v", err)
+				}
+				attached, err := d.Attach(ctx, pod)
+				if err != nil {
+					t.Fatalf("Attach: %v", err)
+				}
+				r.awaitRecorded(t, "attach")
+
+				if err := attached.Stop(ctx); err != nil {
+					t.Fatalf("Stop: %v", err)
+				}
+				if err := started.Kill(ctx); err != nil {
+					t.Fatalf("Kill: %v", err)
+				}
+
+				for _, a := range artifacts {
+					names := r.recorded(a.op)
+					if len(names) == 0 {
+						t.Errorf("%s: never called", a.op)
+					}
+					for _, got := range names {
+						if want := a.want(created, tag); got != want {
+							t.Errorf("%s targets %q, want %q", a.op, got, want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
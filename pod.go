@@ -4,21 +4,35 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Pod is a discovered pod definition. It holds the pod name, the absolute path
 // to its directory, the parsed configuration, the absolute path to its Dockerfile,
-// and the optional template contents loaded from template.md.
+// and the optional template contents loaded from template.md and review.md.
 type Pod struct {
-	Name       string    // directory name, used as the pod identifier
-	Dir        string    // absolute path to the pod directory
-	Dockerfile string    // absolute path to the Dockerfile within Dir
-	Template   string    // contents of template.md; empty string if absent
-	Config     PodConfig // parsed from pod.json; zero-value if pod.json is absent
+	Name           string    `json:"name"`           // directory name, used as the pod identifier
+	Dir            string    `json:"dir"`            // absolute path to the pod directory
+	Dockerfile     string    `json:"dockerfile"`     // absolute path to the Dockerfile within Dir
+	Template       string    `json:"template"`       // contents of template.md; empty string if absent
+	ReviewTemplate string    `json:"reviewTemplate"` // contents of review.md, used by StartReview; empty string if absent
+	Config         PodConfig `json:"config"`         // parsed from pod.json; zero-value if pod.json is absent
+}
+
+// ImageTag returns the image tag Start builds and runs for the pod: the
+// configured image if set, otherwise cldpd-<name>.
+func (p Pod) ImageTag() string {
+	return imageTag(p.Name, p.Config.Image)
 }
 
 // PodConfig holds the optional configuration parsed from a pod's pod.json file.
@@ -26,22 +40,331 @@ type Pod struct {
 type PodConfig struct {
 	Env        map[string]string `json:"env"`        // environment variables passed to the container
 	BuildArgs  map[string]string `json:"buildArgs"`  // --build-arg values passed to docker build
-	Image      string            `json:"image"`      // Docker image tag; defaults to cldpd-<name> if empty
+	Image      string            `json:"image"`      // Docker image tag; defaults to cldpd-<name> if empty; see PullPolicy
 	Workdir    string            `json:"workdir"`    // working directory inside the container
+	Hostname   string            `json:"hostname"`   // container hostname passed to --hostname; Docker picks a random one if empty
 	InheritEnv []string          `json:"inheritEnv"` // host env var names to forward to the container
 	Mounts     []Mount           `json:"mounts"`     // bind mounts to pass to the container
+	Ports      []string          `json:"ports"`      // published ports in [ip:][host:]container[/proto] form
+	User       string            `json:"user"`       // container user: uid, uid:gid, a name, or "host"
+	GPUs       string            `json:"gpus"`       // GPU devices passed to --gpus, e.g. "all" or "device=0"
+	Tmpfs      []string          `json:"tmpfs"`      // tmpfs mounts passed to --tmpfs, e.g. "/tmp" or "/scratch:size=512m"
+	ExtraHosts []string          `json:"extraHosts"` // host:ip entries passed to --add-host, e.g. "api.local:192.168.1.5"
+
+	// SeccompProfile is a path to a seccomp profile JSON file, or "unconfined".
+	// Passed as --security-opt seccomp=<value>.
+	SeccompProfile string `json:"seccompProfile"`
+	// ApparmorProfile is the name of a loaded AppArmor profile.
+	// Passed as --security-opt apparmor=<value>.
+	ApparmorProfile string `json:"apparmorProfile"`
+
+	// CapAdd names Linux capabilities added to the container, e.g. "NET_ADMIN",
+	// each passed as --cap-add.
+	CapAdd []string `json:"capAdd"`
+	// Privileged runs the container with --privileged, for workflows such as
+	// Docker-in-Docker. It gives the container every capability and access to
+	// all host devices, and lifts the seccomp and AppArmor confinement, so the
+	// agent can take over the host: enable it only for pods whose code and
+	// prompts you trust, and prefer CapAdd where a few capabilities suffice.
+	Privileged bool `json:"privileged"`
+
+	// PullPolicy controls whether docker run pulls Image: "always", "missing",
+	// or "never". Setting it together with Image makes Image an external
+	// image: Start runs it as is, skipping the build, and docker run pulls it
+	// under this policy. Without PullPolicy, Image only names the tag Start
+	// builds from the pod's Dockerfile, which is never pulled. PullPolicy has
+	// no effect without Image.
+	PullPolicy string `json:"pullPolicy"`
+
+	// OutputFormat selects Claude Code's output format. "stream-json" adds
+	// --output-format stream-json to the command and parses each output line
+	// into EventMessage. Empty or "text" leaves output as plain EventOutput lines.
+	OutputFormat string `json:"outputFormat"`
+
+	// StripANSI removes terminal escape sequences (colors, cursor movement,
+	// window titles) from each output line before it becomes an event, for
+	// clean logs and transcripts.
+	StripANSI bool `json:"stripAnsi"`
+
+	// ContainerHome is the home directory of the container user, used to expand
+	// ~ in mount targets. Defaults to /root when empty.
+	ContainerHome string `json:"containerHome"`
+
+	// InheritBuildArgs names host environment variables passed to docker build
+	// as build args, for values such as registry tokens that must not be
+	// committed to pod.json. A host value overrides a BuildArgs entry of the
+	// same name. Names unset on the host are skipped, or fail Start when
+	// RequireBuildArgs is set. Their values are redacted from build output
+	// and errors.
+	InheritBuildArgs []string `json:"inheritBuildArgs"`
+	RequireBuildArgs bool     `json:"requireBuildArgs"`
+
+	// BuildSecrets are host files passed to docker build as BuildKit secrets,
+	// for credentials such as a token for fetching private modules, which
+	// build args would leave in the image's layers. A Dockerfile reads one
+	// with RUN --mount=type=secret,id=<id>.
+	BuildSecrets []BuildSecret `json:"buildSecrets"`
+
+	// StopTimeout is how long Session.Stop waits after the stop signal before
+	// Docker sends SIGKILL, as a Go duration string (e.g. "45s"). Empty uses the
+	// default of 10 seconds.
+	StopTimeout string `json:"stopTimeout"`
+
+	// MaxRuntime caps how long the container started by Start may run, as a Go
+	// duration string (e.g. "2h"). Once it is exceeded, the session emits an
+	// EventError and stops the container. Empty uses the Dispatcher's default
+	// from WithMaxRuntime, if any.
+	MaxRuntime string `json:"maxRuntime"`
+
+	// DockerfilePath names the pod's Dockerfile relative to the pod directory,
+	// e.g. "Containerfile". Passed to docker build as -f. Defaults to Dockerfile.
+	DockerfilePath string `json:"dockerfilePath"`
+	// BuildTarget is the multi-stage build stage to build, passed as --target.
+	BuildTarget string `json:"buildTarget"`
+
+	// Build holds docker build flags applied to every build of the pod.
+	Build BuildConfig `json:"build"`
+
+	// KeepContainer leaves the container in place after it exits, for
+	// debugging with docker inspect and docker logs. By default the session
+	// removes it once its exit has been recorded.
+	KeepContainer bool `json:"keepContainer"`
+
+	// SkipPermissions runs Claude Code without permission prompts, for
+	// unattended pods, by adding the flags in skipPermissionsArgs to the claude
+	// command of both Start and Resume. The agent can then run any tool without
+	// asking, so the container is its only boundary.
+	SkipPermissions bool `json:"skipPermissions"`
+
+	// FetchIssue has Start fetch the issue's title, body, and labels on the
+	// host, with the Dispatcher's IssueFetcher, and put them in the prompt
+	// after the issue URL, so the agent need not fetch them itself.
+	FetchIssue bool `json:"fetchIssue"`
+
+	// PromptPrefix replaces "Work on this GitHub issue: " at the start of
+	// Start's directive, e.g. "You are the red team lead. Your assignment: ".
+	// The issue URL is appended, unless the prefix places it with {{url}}.
+	PromptPrefix string `json:"promptPrefix"`
+
+	// NoDefaults keeps the defaults file (see DefaultsPath) from being merged
+	// under the pod's config. Meaningful only in a pod's own pod.json.
+	NoDefaults bool `json:"noDefaults"`
+
+	// explicit records which of the mergeableBools the JSON set, false
+	// included, so mergePodConfig can tell a pod's false from an absent key.
+	explicit map[string]bool
+}
+
+// mergeableBools are the pod.json keys of the booleans mergePodConfig layers,
+// lowercased since encoding/json matches keys regardless of case.
+var mergeableBools = []string{
+	"requirebuildargs", "keepcontainer", "privileged", "skippermissions",
+	"stripansi", "fetchissue", "build.nocache", "build.pull",
+}
+
+// UnmarshalJSON decodes a pod.json object, recording which of its booleans
+// are set so that an explicit false overrides a default true when merged.
+func (c *PodConfig) UnmarshalJSON(data []byte) error {
+	type plain PodConfig
+	var config plain
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(keys))
+	for k, v := range keys {
+		k = strings.ToLower(k)
+		present[k] = true
+		if k != "build" {
+			continue
+		}
+		var build map[string]json.RawMessage
+		if err := json.Unmarshal(v, &build); err != nil {
+			return err
+		}
+		for bk := range build {
+			present["build."+strings.ToLower(bk)] = true
+		}
+	}
+	for _, k := range mergeableBools {
+		if present[k] {
+			if config.explicit == nil {
+				config.explicit = make(map[string]bool)
+			}
+			config.explicit[k] = true
+		}
+	}
+	*c = PodConfig(config)
+	return nil
+}
+
+// BuildSecret is a BuildKit build secret: the host file Src, exposed to the
+// build under ID. Src must be an absolute path, or begin with ~/ for the
+// user's home directory.
+type BuildSecret struct {
+	ID  string `json:"id"`
+	Src string `json:"src"`
+}
+
+// BuildConfig holds the docker build flags a pod sets in pod.json under "build".
+type BuildConfig struct {
+	NoCache bool `json:"noCache"` // build without the layer cache (--no-cache)
+	Pull    bool `json:"pull"`    // always pull newer base images (--pull)
+}
+
+// externalImage returns the image the pod runs without building it: Image
+// when the pod sets both Image and PullPolicy, and empty otherwise.
+func (c PodConfig) externalImage() string {
+	if c.Image == "" || c.PullPolicy == "" {
+		return ""
+	}
+	return c.Image
+}
+
+// pullPolicy returns the docker run --pull policy for the pod: PullPolicy for
+// an external image, and empty otherwise, since a built tag exists only
+// locally and pulling it would replace the build.
+func (c PodConfig) pullPolicy() string {
+	if c.externalImage() == "" {
+		return ""
+	}
+	return c.PullPolicy
+}
+
+// skipPermissionsArgs are the claude flags that disable permission prompts,
+// kept in one place so that pods need not change if Claude Code renames them.
+var skipPermissionsArgs = []string{"--permission-mode", "bypassPermissions"}
+
+// claudeArgs returns the flags c adds to every claude command it runs.
+func (c PodConfig) claudeArgs() []string {
+	if c.SkipPermissions {
+		return skipPermissionsArgs
+	}
+	return nil
+}
+
+// defaultContainerHome is the container home directory assumed when
+// PodConfig.ContainerHome is unset, matching images that run as root.
+const defaultContainerHome = "/root"
+
+// containerHome returns the configured container home directory, or
+// defaultContainerHome if none is set.
+func (c PodConfig) containerHome() string {
+	if c.ContainerHome != "" {
+		return c.ContainerHome
+	}
+	return defaultContainerHome
+}
+
+// expandTarget returns the mount target with a leading ~ expanded to
+// containerHome, the home of the container user.
+func expandTarget(target, containerHome string) string {
+	if target == "~" {
+		return containerHome
+	}
+	if strings.HasPrefix(target, "~/") {
+		return path.Join(containerHome, target[2:])
+	}
+	return target
+}
+
+// PodLimits caps the mounts and environment variables (env plus inheritEnv) a
+// pod may declare, so that generated config gone wrong fails validation
+// instead of producing an unusable docker command line. Exceeding either wraps
+// ErrInvalidPod as well as ErrInvalidConfig, so DiscoverAll skips the pod
+// rather than failing. A zero field uses the DefaultPodLimits value. A Policy
+// may set lower limits still.
+type PodLimits struct {
+	MaxMounts int // most mounts a pod may declare
+	MaxEnv    int // most env plus inheritEnv entries a pod may declare
+}
+
+// DefaultPodLimits allows 100 mounts and 500 environment variables. DiscoverPod
+// and DiscoverAll hold every pod to it; a Dispatcher can set other limits with
+// WithPodLimits.
+var DefaultPodLimits = PodLimits{MaxMounts: 100, MaxEnv: 500}
+
+// check returns an error wrapping ErrInvalidPod if c exceeds the limits.
+func (l PodLimits) check(c PodConfig) error {
+	maxMounts, maxEnv := l.MaxMounts, l.MaxEnv
+	if maxMounts <= 0 {
+		maxMounts = DefaultPodLimits.MaxMounts
+	}
+	if maxEnv <= 0 {
+		maxEnv = DefaultPodLimits.MaxEnv
+	}
+	if len(c.Mounts) > maxMounts {
+		return fmt.Errorf("%w: %d mounts exceed the limit of %d", ErrInvalidPod, len(c.Mounts), maxMounts)
+	}
+	if n := c.envCount(); n > maxEnv {
+		return fmt.Errorf("%w: %d env and inheritEnv entries exceed the limit of %d", ErrInvalidPod, n, maxEnv)
+	}
+	return nil
+}
+
+// envCount returns the number of environment variables c passes to the
+// container: its env entries plus its inheritEnv names.
+func (c PodConfig) envCount() int {
+	return len(c.Env) + len(c.InheritEnv)
+}
+
+// defaultDockerfile is the Dockerfile name used when PodConfig.DockerfilePath is unset.
+const defaultDockerfile = "Dockerfile"
+
+// dockerfile returns the configured Dockerfile path, relative to the pod
+// directory, or defaultDockerfile if none is set.
+func (c PodConfig) dockerfile() string {
+	if c.DockerfilePath != "" {
+		return c.DockerfilePath
+	}
+	return defaultDockerfile
+}
+
+// stopTimeout returns the parsed StopTimeout, or zero if it is unset or invalid.
+// validateConfig rejects invalid values before a session is created.
+func (c PodConfig) stopTimeout() time.Duration {
+	d, err := time.ParseDuration(c.StopTimeout)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// maxRuntime returns the parsed MaxRuntime, or zero if it is unset or invalid.
+// validateConfig rejects invalid values before a session is created.
+func (c PodConfig) maxRuntime() time.Duration {
+	d, err := time.ParseDuration(c.MaxRuntime)
+	if err != nil {
+		return 0
+	}
+	return d
 }
 
 // DiscoverPod loads a single pod by name from the given pods directory.
 // It returns ErrPodNotFound if the pod directory does not exist, and
-// ErrInvalidPod if the directory exists but contains no Dockerfile.
+// ErrInvalidPod if the directory exists but contains no Dockerfile (or the
+// file named by PodConfig.DockerfilePath).
 // If pod.json is absent the pod is returned with a zero-value PodConfig.
-// If pod.json is present but malformed, an error is returned.
-// Mount source paths beginning with ~ or ~/ are expanded to the user's home
-// directory. ~user expansion is not supported.
-// If template.md is absent, Pod.Template is an empty string.
-// If template.md is present but cannot be read, an error is returned.
+// Unless pod.json sets noDefaults, the defaults file at DefaultsPath(podsDir),
+// if present, is merged under it as by WithDefaultConfig.
+// If either file is present but malformed, an error is returned; if the merged
+// config holds invalid values (e.g. a malformed port), ErrInvalidConfig is returned.
+// Mount source, seccomp profile, and build secret paths beginning with ~ or ~/
+// (~/ only for the profile and secrets) are expanded to the user's home
+// directory, and mount targets beginning with ~ or ~/ to the container home
+// directory (PodConfig.ContainerHome, default /root). ~user expansion is not supported.
+// If template.md or review.md is absent, Pod.Template or Pod.ReviewTemplate
+// is an empty string. If either is present but cannot be read, an error is returned.
+// A pod over DefaultPodLimits fails with ErrInvalidPod and ErrInvalidConfig.
 func DiscoverPod(podsDir, name string) (Pod, error) {
+	return discoverPod(podsDir, name, DefaultPodLimits)
+}
+
+// discoverPod is DiscoverPod holding the pod to limits.
+func discoverPod(podsDir, name string, limits PodLimits) (Pod, error) {
 	dir := filepath.Join(podsDir, name)
 
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -50,50 +373,73 @@ func DiscoverPod(podsDir, name string) (Pod, error) {
 		return Pod{}, fmt.Errorf("stat pod directory: %w", err)
 	}
 
-	dockerfile := filepath.Join(dir, "Dockerfile")
-	if _, err := os.Stat(dockerfile); os.IsNotExist(err) {
-		return Pod{}, fmt.Errorf("%w: %s", ErrInvalidPod, name)
-	} else if err != nil {
-		return Pod{}, fmt.Errorf("stat Dockerfile: %w", err)
+	config, _, err := readPodConfig(filepath.Join(dir, "pod.json"))
+	if err != nil {
+		return Pod{}, err
 	}
-
-	var config PodConfig
-	configPath := filepath.Join(dir, "pod.json")
-	//nolint:gosec // configPath is constructed from a trusted pods directory, not user input
-	data, err := os.ReadFile(configPath)
-	if err != nil && !os.IsNotExist(err) {
-		return Pod{}, fmt.Errorf("read pod.json: %w", err)
-	}
-	if len(data) > 0 {
-		if jsonErr := json.Unmarshal(data, &config); jsonErr != nil {
-			return Pod{}, fmt.Errorf("parse pod.json: %w", jsonErr)
-		}
-		// Expand ~ in mount source paths. Neither Go's os/exec nor Docker's -v
-		// flag performs shell expansion, so a literal ~ would silently fail to mount.
-		if len(config.Mounts) > 0 {
-			home, homeErr := os.UserHomeDir()
-			if homeErr != nil {
-				return Pod{}, fmt.Errorf("resolve home directory: %w", homeErr)
+	if !config.NoDefaults {
+		defaults, ok, err := readPodConfig(DefaultsPath(podsDir))
+		if err != nil {
+			return Pod{}, err
+		}
+		// Without a defaults file the pod's config is kept exactly as written.
+		if ok {
+			config = mergePodConfig(defaults, config)
+		}
+	}
+	if cfgErr := validateConfig(config); cfgErr != nil {
+		return Pod{}, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, name, cfgErr)
+	}
+	if limitErr := limits.check(config); limitErr != nil {
+		return Pod{}, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, name, limitErr)
+	}
+	// Expand ~ in mount source and target paths and in the seccomp profile
+	// and build secret paths. Neither Go's os/exec nor Docker's flags perform shell expansion,
+	// so a literal ~ would silently fail to resolve. Mount targets live in the
+	// container, so they expand to the container home and are joined with
+	// forward slashes.
+	if len(config.Mounts) > 0 || len(config.BuildSecrets) > 0 || strings.HasPrefix(config.SeccompProfile, "~/") {
+		home, homeErr := os.UserHomeDir()
+		if homeErr != nil {
+			return Pod{}, fmt.Errorf("resolve home directory: %w", homeErr)
+		}
+		if strings.HasPrefix(config.SeccompProfile, "~/") {
+			config.SeccompProfile = filepath.Join(home, config.SeccompProfile[2:])
+		}
+		for i := range config.BuildSecrets {
+			if strings.HasPrefix(config.BuildSecrets[i].Src, "~/") {
+				config.BuildSecrets[i].Src = filepath.Join(home, config.BuildSecrets[i].Src[2:])
 			}
-			for i := range config.Mounts {
-				if config.Mounts[i].Source == "~" {
-					config.Mounts[i].Source = home
-				} else if strings.HasPrefix(config.Mounts[i].Source, "~/") {
-					config.Mounts[i].Source = filepath.Join(home, config.Mounts[i].Source[2:])
-				}
+		}
+		containerHome := config.containerHome()
+		for i := range config.Mounts {
+			switch {
+			case config.Mounts[i].isVolume():
+				// A volume name is not a path; leave it as written.
+			case config.Mounts[i].Source == "~":
+				config.Mounts[i].Source = home
+			case strings.HasPrefix(config.Mounts[i].Source, "~/"):
+				config.Mounts[i].Source = filepath.Join(home, config.Mounts[i].Source[2:])
 			}
+			config.Mounts[i].Target = expandTarget(config.Mounts[i].Target, containerHome)
 		}
 	}
 
-	var template string
-	templatePath := filepath.Join(dir, "template.md")
-	//nolint:gosec // templatePath is constructed from a trusted pods directory, not user input
-	templateData, err := os.ReadFile(templatePath)
-	if err != nil && !os.IsNotExist(err) {
-		return Pod{}, fmt.Errorf("read template.md: %w", err)
+	dockerfileName := config.dockerfile()
+	dockerfile := filepath.Join(dir, dockerfileName)
+	if _, err := os.Stat(dockerfile); os.IsNotExist(err) {
+		return Pod{}, fmt.Errorf("%w: %s not found: %s", ErrInvalidPod, dockerfileName, name)
+	} else if err != nil {
+		return Pod{}, fmt.Errorf("stat %s: %w", dockerfileName, err)
+	}
+
+	template, err := readTemplate(dir, "template.md")
+	if err != nil {
+		return Pod{}, err
 	}
-	if len(templateData) > 0 {
-		template = string(templateData)
+	reviewTemplate, err := readTemplate(dir, "review.md")
+	if err != nil {
+		return Pod{}, err
 	}
 
 	absDir, err := filepath.Abs(dir)
@@ -102,18 +448,63 @@ func DiscoverPod(podsDir, name string) (Pod, error) {
 	}
 
 	return Pod{
-		Name:       name,
-		Dir:        absDir,
-		Config:     config,
-		Dockerfile: filepath.Join(absDir, "Dockerfile"),
-		Template:   template,
+		Name:           name,
+		Dir:            absDir,
+		Config:         config,
+		Dockerfile:     filepath.Join(absDir, dockerfileName),
+		Template:       template,
+		ReviewTemplate: reviewTemplate,
 	}, nil
 }
 
+// DefaultsPath returns the path of the defaults file DiscoverPod merges under
+// every pod's pod.json: defaults.json beside podsDir, so ~/.cldpd/defaults.json
+// for the default pods directory. It has the same shape as pod.json.
+func DefaultsPath(podsDir string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(podsDir)), "defaults.json")
+}
+
+// readPodConfig parses the config file at path, which holds a PodConfig as
+// JSON, and reports whether it holds any. A file that does not exist or is
+// empty yields a zero-value PodConfig and false.
+func readPodConfig(path string) (PodConfig, bool, error) {
+	var config PodConfig
+	name := filepath.Base(path)
+	//nolint:gosec // path is constructed from a trusted pods directory, not user input
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return PodConfig{}, false, fmt.Errorf("read %s: %w", name, err)
+	}
+	if len(data) == 0 {
+		return PodConfig{}, false, nil
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return PodConfig{}, false, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return config, true, nil
+}
+
+// readTemplate returns the contents of the prompt template name in the pod
+// directory dir, or an empty string if it does not exist.
+func readTemplate(dir, name string) (string, error) {
+	//nolint:gosec // the path is constructed from a trusted pods directory, not user input
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
 // DiscoverAll loads all valid pods from the given pods directory.
-// Entries that are not directories, or directories without a Dockerfile, are skipped.
+// Entries that are not directories, directories without a Dockerfile, and
+// pods over DefaultPodLimits are skipped.
 // The returned slice is sorted by pod name.
 func DiscoverAll(podsDir string) ([]Pod, error) {
+	return discoverAll(podsDir, DefaultPodLimits)
+}
+
+// discoverAll is DiscoverAll holding each pod to limits.
+func discoverAll(podsDir string, limits PodLimits) ([]Pod, error) {
 	entries, err := os.ReadDir(podsDir)
 	if err != nil {
 		return nil, fmt.Errorf("read pods directory: %w", err)
@@ -124,9 +515,9 @@ func DiscoverAll(podsDir string) ([]Pod, error) {
 		if !entry.IsDir() {
 			continue
 		}
-		pod, err := DiscoverPod(podsDir, entry.Name())
+		pod, err := discoverPod(podsDir, entry.Name(), limits)
 		if err != nil {
-			// Skip pods that exist but lack a Dockerfile.
+			// Skip pods that exist but lack a Dockerfile or exceed the limits.
 			if isInvalidPod(err) {
 				continue
 			}
@@ -146,3 +537,322 @@ func DiscoverAll(podsDir string) ([]Pod, error) {
 func isInvalidPod(err error) bool {
 	return errors.Is(err, ErrInvalidPod)
 }
+
+// mergePodConfig returns base with override layered on top, so the override
+// (usually a pod's own pod.json) wins wherever it sets a value:
+//   - strings take the override's value when it is non-empty;
+//   - Env and BuildArgs are unioned, with the override's keys replacing base keys;
+//   - InheritEnv, Ports, Tmpfs, ExtraHosts, and CapAdd are unioned in order, base entries first, without duplicates;
+//   - Mounts are unioned, with an override mount replacing a base mount of the
+//     same Target, compared after ~ expansion to the merged ContainerHome;
+//   - BuildSecrets are unioned, with an override secret replacing a base secret of the same ID;
+//   - booleans take the override's value when it is true or set explicitly in
+//     its JSON, so a pod's false turns off a default true; NoDefaults is always
+//     the override's.
+//
+// Neither argument is modified.
+func mergePodConfig(base, override PodConfig) PodConfig {
+	merged := PodConfig{
+		Env:              mergeMaps(base.Env, override.Env),
+		BuildArgs:        mergeMaps(base.BuildArgs, override.BuildArgs),
+		Image:            firstNonEmpty(override.Image, base.Image),
+		Workdir:          firstNonEmpty(override.Workdir, base.Workdir),
+		Hostname:         firstNonEmpty(override.Hostname, base.Hostname),
+		InheritEnv:       mergeLists(base.InheritEnv, override.InheritEnv),
+		InheritBuildArgs: mergeLists(base.InheritBuildArgs, override.InheritBuildArgs),
+		RequireBuildArgs: override.mergeBool("requirebuildargs", base.RequireBuildArgs, override.RequireBuildArgs),
+		BuildSecrets:     mergeBuildSecrets(base.BuildSecrets, override.BuildSecrets),
+		KeepContainer:    override.mergeBool("keepcontainer", base.KeepContainer, override.KeepContainer),
+		Privileged:       override.mergeBool("privileged", base.Privileged, override.Privileged),
+		SkipPermissions:  override.mergeBool("skippermissions", base.SkipPermissions, override.SkipPermissions),
+		StripANSI:        override.mergeBool("stripansi", base.StripANSI, override.StripANSI),
+		FetchIssue:       override.mergeBool("fetchissue", base.FetchIssue, override.FetchIssue),
+		Ports:            mergeLists(base.Ports, override.Ports),
+		User:             firstNonEmpty(override.User, base.User),
+		GPUs:             firstNonEmpty(override.GPUs, base.GPUs),
+		PullPolicy:       firstNonEmpty(override.PullPolicy, base.PullPolicy),
+		Tmpfs:            mergeLists(base.Tmpfs, override.Tmpfs),
+		ExtraHosts:       mergeLists(base.ExtraHosts, override.ExtraHosts),
+		CapAdd:           mergeLists(base.CapAdd, override.CapAdd),
+		SeccompProfile:   firstNonEmpty(override.SeccompProfile, base.SeccompProfile),
+		ApparmorProfile:  firstNonEmpty(override.ApparmorProfile, base.ApparmorProfile),
+		OutputFormat:     firstNonEmpty(override.OutputFormat, base.OutputFormat),
+		ContainerHome:    firstNonEmpty(override.ContainerHome, base.ContainerHome),
+		StopTimeout:      firstNonEmpty(override.StopTimeout, base.StopTimeout),
+		MaxRuntime:       firstNonEmpty(override.MaxRuntime, base.MaxRuntime),
+		BuildTarget:      firstNonEmpty(override.BuildTarget, base.BuildTarget),
+		PromptPrefix:     firstNonEmpty(override.PromptPrefix, base.PromptPrefix),
+		// The Dockerfile belongs to the pod directory, which DiscoverPod has
+		// already resolved it against, so a base value is meaningless.
+		DockerfilePath: override.DockerfilePath,
+		NoDefaults:     override.NoDefaults,
+		Build: BuildConfig{
+			NoCache: override.mergeBool("build.nocache", base.Build.NoCache, override.Build.NoCache),
+			Pull:    override.mergeBool("build.pull", base.Build.Pull, override.Build.Pull),
+		},
+		// Kept so that a further merge beneath this one, such as
+		// WithDefaultConfig beneath defaults.json, still honours an explicit
+		// false.
+		explicit: mergeExplicit(base.explicit, override.explicit),
+	}
+
+	// Targets are compared as DiscoverPod will expand them, so a base ~/.ssh
+	// and an override /root/.ssh name the same mount.
+	home := merged.containerHome()
+	overridden := make(map[string]bool, len(override.Mounts))
+	for _, m := range override.Mounts {
+		overridden[path.Clean(expandTarget(m.Target, home))] = true
+	}
+	for _, m := range base.Mounts {
+		if !overridden[path.Clean(expandTarget(m.Target, home))] {
+			merged.Mounts = append(merged.Mounts, m)
+		}
+	}
+	merged.Mounts = append(merged.Mounts, override.Mounts...)
+
+	return merged
+}
+
+// mergeBool returns the merged value of the boolean at key: value, c's own,
+// when it is true or c's JSON set it, and base otherwise.
+func (c PodConfig) mergeBool(key string, base, value bool) bool {
+	if value || c.explicit[key] {
+		return value
+	}
+	return base
+}
+
+// mergeExplicit returns the union of the explicit sets a and b, or nil if both
+// are empty.
+func mergeExplicit(a, b map[string]bool) map[string]bool {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	out := make(map[string]bool, len(a)+len(b))
+	maps.Copy(out, a)
+	maps.Copy(out, b)
+	return out
+}
+
+// mergeBuildSecrets returns base's secrets that override does not replace by
+// ID, followed by override's. Returns nil if both are empty.
+func mergeBuildSecrets(base, override []BuildSecret) []BuildSecret {
+	var merged []BuildSecret
+	for _, b := range base {
+		if !slices.ContainsFunc(override, func(o BuildSecret) bool { return o.ID == b.ID }) {
+			merged = append(merged, b)
+		}
+	}
+	return append(merged, override...)
+}
+
+// mergeMaps returns a new map holding base's entries overlaid by override's.
+// Returns nil if both are empty.
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeLists returns base followed by the entries of override not already present.
+// Returns nil if both are empty.
+func mergeLists(base, override []string) []string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(base)+len(override))
+	seen := make(map[string]bool, len(base)+len(override))
+	for _, list := range [][]string{base, override} {
+		for _, v := range list {
+			if !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// firstNonEmpty returns the first non-empty string, or "" if all are empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// validateConfig checks PodConfig values that Docker would otherwise reject at
+// run time. It returns an error describing the first bad value.
+func validateConfig(config PodConfig) error {
+	switch config.OutputFormat {
+	case "", OutputFormatText, OutputFormatStreamJSON:
+	default:
+		return fmt.Errorf("outputFormat %q: must be %s or %s", config.OutputFormat, OutputFormatText, OutputFormatStreamJSON)
+	}
+	switch config.PullPolicy {
+	case "", PullAlways, PullMissing, PullNever:
+	default:
+		return fmt.Errorf("pullPolicy %q: must be %s, %s, or %s", config.PullPolicy, PullAlways, PullMissing, PullNever)
+	}
+	if config.DockerfilePath != "" && !filepath.IsLocal(config.DockerfilePath) {
+		return fmt.Errorf("dockerfilePath %q: must be a path inside the pod directory", config.DockerfilePath)
+	}
+	if config.ContainerHome != "" && !path.IsAbs(config.ContainerHome) {
+		return fmt.Errorf("containerHome %q: must be an absolute path", config.ContainerHome)
+	}
+	for _, m := range config.Mounts {
+		switch m.Type {
+		case "", MountTypeBind:
+		case MountTypeVolume:
+			if !volumeNamePattern.MatchString(m.Source) {
+				return fmt.Errorf("mount %s: volume name %q must be letters, digits, and _.- only", m.Target, m.Source)
+			}
+		default:
+			return fmt.Errorf("mount %s: type %q must be %s or %s", m.Target, m.Type, MountTypeBind, MountTypeVolume)
+		}
+	}
+	if config.StopTimeout != "" {
+		d, err := time.ParseDuration(config.StopTimeout)
+		if err != nil {
+			return fmt.Errorf("stopTimeout %q: must be a duration such as 45s", config.StopTimeout)
+		}
+		if d <= 0 {
+			return fmt.Errorf("stopTimeout %q: must be positive", config.StopTimeout)
+		}
+	}
+	if config.MaxRuntime != "" {
+		d, err := time.ParseDuration(config.MaxRuntime)
+		if err != nil {
+			return fmt.Errorf("maxRuntime %q: must be a duration such as 2h", config.MaxRuntime)
+		}
+		if d <= 0 {
+			return fmt.Errorf("maxRuntime %q: must be positive", config.MaxRuntime)
+		}
+	}
+	for _, p := range config.Ports {
+		if err := validatePort(p); err != nil {
+			return fmt.Errorf("port %q: %w", p, err)
+		}
+	}
+	for _, spec := range config.Tmpfs {
+		if target, _, _ := strings.Cut(spec, ":"); !path.IsAbs(target) {
+			return fmt.Errorf("tmpfs %q: must start with an absolute container path", spec)
+		}
+	}
+	if config.Hostname != "" && !hostnamePattern.MatchString(config.Hostname) {
+		return fmt.Errorf("hostname %q: must be letters, digits, and .- only, starting and ending with a letter or digit", config.Hostname)
+	}
+	for _, h := range config.ExtraHosts {
+		if err := validateExtraHost(h); err != nil {
+			return fmt.Errorf("extraHosts %q: %w", h, err)
+		}
+	}
+	seen := make(map[string]bool, len(config.BuildSecrets))
+	for _, s := range config.BuildSecrets {
+		if !secretIDPattern.MatchString(s.ID) {
+			return fmt.Errorf("buildSecrets id %q: must be letters, digits, and _.- only", s.ID)
+		}
+		if seen[s.ID] {
+			return fmt.Errorf("buildSecrets id %q: duplicate", s.ID)
+		}
+		seen[s.ID] = true
+		if !filepath.IsAbs(s.Src) && !strings.HasPrefix(s.Src, "~/") {
+			return fmt.Errorf("buildSecrets %s: src %q must be an absolute path or begin with ~/", s.ID, s.Src)
+		}
+	}
+	for _, c := range config.CapAdd {
+		if !capabilityPattern.MatchString(c) {
+			return fmt.Errorf("capAdd %q: must be a capability name such as NET_ADMIN", c)
+		}
+	}
+	return nil
+}
+
+// volumeNamePattern matches the names Docker accepts for a named volume.
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// secretIDPattern matches a BuildKit secret id.
+var secretIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// hostnamePattern matches a container hostname: dot-separated labels of
+// letters, digits, and hyphens, at most 63 characters each.
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// capabilityPattern matches a Linux capability name, with or without the CAP_
+// prefix, or ALL.
+var capabilityPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z_]*$`)
+
+// hostGateway is the --add-host address Docker replaces with the host's
+// gateway IP, so that "host.docker.internal:host-gateway" reaches the host.
+const hostGateway = "host-gateway"
+
+// validateExtraHost checks an --add-host entry of the form host:ip, where ip is
+// an IPv4 or IPv6 address or host-gateway. The host is split at the first
+// colon, since IPv6 addresses contain colons.
+func validateExtraHost(spec string) error {
+	host, ip, ok := strings.Cut(spec, ":")
+	if !ok || host == "" {
+		return errors.New("must be host:ip")
+	}
+	if ip != hostGateway && net.ParseIP(ip) == nil {
+		return fmt.Errorf("%q is not an IP address or %s", ip, hostGateway)
+	}
+	return nil
+}
+
+// validatePort checks a port publishing spec of the form
+// [ip:][hostPort:]containerPort[/proto]. The container port is required;
+// an empty host port (":3000") lets Docker choose an ephemeral port.
+func validatePort(spec string) error {
+	ports := spec
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		ports = spec[:i]
+		switch proto := spec[i+1:]; proto {
+		case "tcp", "udp", "sctp":
+		default:
+			return fmt.Errorf("unknown protocol %q", proto)
+		}
+	}
+
+	parts := strings.Split(ports, ":")
+	if len(parts) > 3 {
+		return errors.New("too many components")
+	}
+	if err := validatePortNumber(parts[len(parts)-1]); err != nil {
+		return fmt.Errorf("container port: %w", err)
+	}
+	if len(parts) >= 2 && parts[len(parts)-2] != "" {
+		if err := validatePortNumber(parts[len(parts)-2]); err != nil {
+			return fmt.Errorf("host port: %w", err)
+		}
+	}
+	if len(parts) == 3 && net.ParseIP(parts[0]) == nil {
+		return fmt.Errorf("invalid host IP %q", parts[0])
+	}
+	return nil
+}
+
+// validatePortNumber checks that s is a port number between 1 and 65535.
+func validatePortNumber(s string) error {
+	if s == "" {
+		return errors.New("missing")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not numeric", s)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("%d is out of range", n)
+	}
+	return nil
+}
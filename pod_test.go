@@ -3,10 +3,16 @@
 package cldpd
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 // makePodDir creates a pod directory with a Dockerfile inside podsDir.
@@ -451,6 +457,34 @@ func TestDiscoverPod_Template_Unreadable(t *testing.T) {
 	}
 }
 
+func TestDiscoverPod_ReviewTemplate(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writeTemplate(t, dir, "Issue orders.")
+	if err := os.WriteFile(filepath.Join(dir, "review.md"), []byte("Review orders."), 0644); err != nil {
+		t.Fatalf("write review.md: %v", err)
+	}
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Template != "Issue orders." || pod.ReviewTemplate != "Review orders." {
+		t.Errorf("templates: got %q and %q, want each file's contents", pod.Template, pod.ReviewTemplate)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "review.md")); err != nil {
+		t.Fatalf("remove review.md: %v", err)
+	}
+	pod, err = DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.ReviewTemplate != "" {
+		t.Errorf("ReviewTemplate: got %q, want empty string when review.md is absent", pod.ReviewTemplate)
+	}
+}
+
 func TestDiscoverPod_Mount_TildeExpanded(t *testing.T) {
 	podsDir := t.TempDir()
 	dir := makePodDir(t, podsDir, "mypod")
@@ -471,6 +505,52 @@ func TestDiscoverPod_Mount_TildeExpanded(t *testing.T) {
 	}
 }
 
+func TestDiscoverPod_Mount_Volume(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"mounts": [
+		{"source": "claude-cache", "target": "~/.cache/claude", "type": "volume"},
+		{"source": "~/src", "target": "/src", "type": "bind"}
+	]}`)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("get home dir: %v", err)
+	}
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vol := pod.Config.Mounts[0]
+	if vol.Source != "claude-cache" || vol.Type != MountTypeVolume {
+		t.Errorf("volume mount: got %+v, want source claude-cache, type volume", vol)
+	}
+	if vol.Target != "/root/.cache/claude" {
+		t.Errorf("volume target: got %q, want ~ expanded to /root/.cache/claude", vol.Target)
+	}
+	if want := filepath.Join(home, "src"); pod.Config.Mounts[1].Source != want {
+		t.Errorf("bind source: got %q, want %q", pod.Config.Mounts[1].Source, want)
+	}
+}
+
+func TestDiscoverPod_Mount_InvalidType(t *testing.T) {
+	cases := []string{
+		`{"source": "cache", "target": "/c", "type": "tmpfs"}`,
+		`{"source": "~/cache", "target": "/c", "type": "volume"}`,
+		`{"source": "", "target": "/c", "type": "volume"}`,
+	}
+	for _, m := range cases {
+		podsDir := t.TempDir()
+		dir := makePodDir(t, podsDir, "mypod")
+		writePodJSON(t, dir, `{"mounts": [`+m+`]}`)
+
+		if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: got %v, want ErrInvalidConfig", m, err)
+		}
+	}
+}
+
 func TestDiscoverPod_Mount_TildeAloneExpanded(t *testing.T) {
 	podsDir := t.TempDir()
 	dir := makePodDir(t, podsDir, "mypod")
@@ -560,3 +640,1056 @@ func TestDiscoverAll_Template_IncludedForPodsWithTemplate(t *testing.T) {
 		t.Errorf("pods[1].Template: got %q, want %q", pods[1].Template, "standing orders")
 	}
 }
+
+func TestDiscoverPod_Ports(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"ports": ["8080:80", ":3000", "9000", "127.0.0.1:5353:53/udp"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"8080:80", ":3000", "9000", "127.0.0.1:5353:53/udp"}
+	if len(pod.Config.Ports) != len(want) {
+		t.Fatalf("Ports: got %v, want %v", pod.Config.Ports, want)
+	}
+	for i, p := range want {
+		if pod.Config.Ports[i] != p {
+			t.Errorf("Ports[%d]: got %q, want %q", i, pod.Config.Ports[i], p)
+		}
+	}
+}
+
+func TestDiscoverPod_Ports_Invalid(t *testing.T) {
+	cases := []string{
+		"",
+		"8080:",
+		"abc:80",
+		"8080:http",
+		"0:80",
+		"8080:70000",
+		"8080:80/icmp",
+		"notanip:8080:80",
+		"1:2:3:4",
+	}
+	for _, p := range cases {
+		t.Run(p, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"ports": ["`+p+`"]}`)
+
+			_, err := DiscoverPod(podsDir, "mypod")
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_Tmpfs(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"tmpfs": ["/tmp", "/scratch:size=512m"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(pod.Config.Tmpfs, ",") != "/tmp,/scratch:size=512m" {
+		t.Errorf("Tmpfs: got %v", pod.Config.Tmpfs)
+	}
+}
+
+func TestDiscoverPod_Tmpfs_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "tmp", "~/scratch", ":size=1m"} {
+		t.Run(spec, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"tmpfs": ["`+spec+`"]}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_ExtraHosts(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"extraHosts": ["api.local:192.168.1.5", "host.docker.internal:host-gateway", "v6.local:::1"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"api.local:192.168.1.5", "host.docker.internal:host-gateway", "v6.local:::1"}
+	if !slices.Equal(pod.Config.ExtraHosts, want) {
+		t.Errorf("ExtraHosts: got %v, want %v", pod.Config.ExtraHosts, want)
+	}
+}
+
+func TestDiscoverPod_ExtraHosts_Invalid(t *testing.T) {
+	for _, spec := range []string{"api.local", ":192.168.1.5", "api.local:", "api.local:not-an-ip"} {
+		t.Run(spec, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"extraHosts": ["`+spec+`"]}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_BuildSecrets(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"buildSecrets": [{"id": "npmrc", "src": "~/.npmrc"}, {"id": "gh_token", "src": "/run/secrets/gh"}]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []BuildSecret{
+		{ID: "npmrc", Src: filepath.Join(home, ".npmrc")},
+		{ID: "gh_token", Src: "/run/secrets/gh"},
+	}
+	if !slices.Equal(pod.Config.BuildSecrets, want) {
+		t.Errorf("BuildSecrets: got %v, want %v", pod.Config.BuildSecrets, want)
+	}
+}
+
+func TestDiscoverPod_BuildSecrets_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"empty id":     `[{"id": "", "src": "/run/secrets/gh"}]`,
+		"bad id":       `[{"id": "gh token", "src": "/run/secrets/gh"}]`,
+		"duplicate id": `[{"id": "gh", "src": "/a"}, {"id": "gh", "src": "/b"}]`,
+		"relative src": `[{"id": "gh", "src": "secrets/gh"}]`,
+		"empty src":    `[{"id": "gh", "src": ""}]`,
+	}
+	for name, secrets := range cases {
+		t.Run(name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"buildSecrets": `+secrets+`}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_Hostname(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"hostname": "agent-1.pods.local"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Config.Hostname != "agent-1.pods.local" {
+		t.Errorf("Hostname: got %q, want agent-1.pods.local", pod.Config.Hostname)
+	}
+}
+
+func TestDiscoverPod_Hostname_Invalid(t *testing.T) {
+	for _, name := range []string{"-agent", "agent-", "agent_1", "agent..local", "agent 1", strings.Repeat("a", 64)} {
+		t.Run(name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"hostname": "`+name+`"}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_CapAddAndPrivileged(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"capAdd": ["SYS_ADMIN"], "privileged": true}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(pod.Config.CapAdd, []string{"SYS_ADMIN"}) {
+		t.Errorf("CapAdd: got %v, want [SYS_ADMIN]", pod.Config.CapAdd)
+	}
+	if !pod.Config.Privileged {
+		t.Error("Privileged: got false, want true")
+	}
+}
+
+func TestDiscoverPod_CapAdd_Invalid(t *testing.T) {
+	for _, c := range []string{"", "NET ADMIN", "--privileged", "SYS_ADMIN=1"} {
+		t.Run(c, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"capAdd": ["`+c+`"]}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_PullPolicy(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"image": "ghcr.io/org/agent:latest", "pullPolicy": "always"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Config.PullPolicy != PullAlways {
+		t.Errorf("PullPolicy: got %q, want %q", pod.Config.PullPolicy, PullAlways)
+	}
+	if got := pod.Config.pullPolicy(); got != PullAlways {
+		t.Errorf("pullPolicy(): got %q, want %q", got, PullAlways)
+	}
+}
+
+func TestDiscoverPod_PullPolicy_Invalid(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"pullPolicy": "sometimes"}`)
+
+	if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestPodConfig_PullPolicy_NoImage(t *testing.T) {
+	c := PodConfig{PullPolicy: PullAlways}
+	if got := c.pullPolicy(); got != "" {
+		t.Errorf("pullPolicy() without Image: got %q, want empty", got)
+	}
+}
+
+func TestPodConfig_ExternalImage(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PodConfig
+		want string
+	}{
+		{"image and policy", PodConfig{Image: "ghcr.io/org/agent:latest", PullPolicy: PullNever}, "ghcr.io/org/agent:latest"},
+		{"image only", PodConfig{Image: "myorg/agent:v1"}, ""},
+		{"policy only", PodConfig{PullPolicy: PullAlways}, ""},
+		{"neither", PodConfig{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.externalImage(); got != tt.want {
+				t.Errorf("externalImage(): got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverAll_InvalidConfigNotSkipped(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"ports": ["nope"]}`)
+
+	_, err := DiscoverAll(podsDir)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDiscoverPod_MountTarget_TildeDefaultsToRoot(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"mounts": [
+		{"source": "/keys", "target": "~/.ssh"},
+		{"source": "/cache", "target": "~"}
+	]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pod.Config.Mounts[0].Target; got != "/root/.ssh" {
+		t.Errorf("Mounts[0].Target: got %q, want %q", got, "/root/.ssh")
+	}
+	if got := pod.Config.Mounts[1].Target; got != "/root" {
+		t.Errorf("Mounts[1].Target: got %q, want %q", got, "/root")
+	}
+}
+
+func TestDiscoverPod_MountTarget_TildeUsesContainerHome(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{
+		"containerHome": "/home/agent",
+		"mounts": [
+			{"source": "/keys", "target": "~/.ssh", "readOnly": true},
+			{"source": "/npm", "target": "~/.npm"},
+			{"source": "/data", "target": "/data"}
+		]
+	}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"/home/agent/.ssh", "/home/agent/.npm", "/data"}
+	for i, w := range want {
+		if got := pod.Config.Mounts[i].Target; got != w {
+			t.Errorf("Mounts[%d].Target: got %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestDiscoverPod_ContainerHome_MustBeAbsolute(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"containerHome": "home/agent"}`)
+
+	_, err := DiscoverPod(podsDir, "mypod")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDiscoverPod_SecurityProfiles(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"seccompProfile": "unconfined", "apparmorProfile": "cldpd-agent"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Config.SeccompProfile != "unconfined" {
+		t.Errorf("SeccompProfile: got %q, want %q", pod.Config.SeccompProfile, "unconfined")
+	}
+	if pod.Config.ApparmorProfile != "cldpd-agent" {
+		t.Errorf("ApparmorProfile: got %q, want %q", pod.Config.ApparmorProfile, "cldpd-agent")
+	}
+}
+
+func TestDiscoverPod_SeccompProfile_TildeExpanded(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"seccompProfile": "~/profiles/seccomp.json"}`)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("get home dir: %v", err)
+	}
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := filepath.Join(home, "profiles", "seccomp.json")
+	if pod.Config.SeccompProfile != want {
+		t.Errorf("SeccompProfile: got %q, want %q", pod.Config.SeccompProfile, want)
+	}
+}
+
+func TestMergePodConfig_OverrideWins(t *testing.T) {
+	base := PodConfig{
+		Env:        map[string]string{"A": "base", "B": "base"},
+		Image:      "base-image",
+		Workdir:    "/base",
+		User:       "1000",
+		InheritEnv: []string{"ANTHROPIC_API_KEY"},
+		Ports:      []string{"8080:80"},
+		Mounts: []Mount{
+			{Source: "/base/ssh", Target: "/root/.ssh"},
+			{Source: "/base/cache", Target: "/cache"},
+		},
+	}
+	override := PodConfig{
+		Env:        map[string]string{"B": "pod", "C": "pod"},
+		Workdir:    "/pod",
+		InheritEnv: []string{"GITHUB_TOKEN", "ANTHROPIC_API_KEY"},
+		Mounts:     []Mount{{Source: "/pod/ssh", Target: "/root/.ssh", ReadOnly: true}},
+	}
+
+	got := mergePodConfig(base, override)
+
+	if got.Env["A"] != "base" || got.Env["B"] != "pod" || got.Env["C"] != "pod" {
+		t.Errorf("Env: got %v", got.Env)
+	}
+	if got.Image != "base-image" {
+		t.Errorf("Image: got %q, want base-image", got.Image)
+	}
+	if got.Workdir != "/pod" {
+		t.Errorf("Workdir: got %q, want /pod", got.Workdir)
+	}
+	if got.User != "1000" {
+		t.Errorf("User: got %q, want 1000", got.User)
+	}
+	if strings.Join(got.InheritEnv, ",") != "ANTHROPIC_API_KEY,GITHUB_TOKEN" {
+		t.Errorf("InheritEnv: got %v", got.InheritEnv)
+	}
+	if len(got.Ports) != 1 || got.Ports[0] != "8080:80" {
+		t.Errorf("Ports: got %v", got.Ports)
+	}
+	if len(got.Mounts) != 2 || got.Mounts[0].Target != "/cache" || got.Mounts[1].Source != "/pod/ssh" {
+		t.Errorf("Mounts: got %v, want base /cache then pod /root/.ssh", got.Mounts)
+	}
+}
+
+func TestMergePodConfig_InheritBuildArgs(t *testing.T) {
+	base := PodConfig{InheritBuildArgs: []string{"NPM_TOKEN"}, RequireBuildArgs: true}
+	override := PodConfig{InheritBuildArgs: []string{"PIP_INDEX_URL", "NPM_TOKEN"}}
+
+	got := mergePodConfig(base, override)
+	if strings.Join(got.InheritBuildArgs, ",") != "NPM_TOKEN,PIP_INDEX_URL" {
+		t.Errorf("InheritBuildArgs: got %v", got.InheritBuildArgs)
+	}
+	if !got.RequireBuildArgs {
+		t.Error("RequireBuildArgs: got false, want true from base")
+	}
+}
+
+func TestMergePodConfig_Build(t *testing.T) {
+	got := mergePodConfig(PodConfig{Build: BuildConfig{Pull: true}}, PodConfig{Build: BuildConfig{NoCache: true}})
+	if got.Build != (BuildConfig{NoCache: true, Pull: true}) {
+		t.Errorf("Build: got %+v, want both set", got.Build)
+	}
+}
+
+func TestMergePodConfig_KeepContainer(t *testing.T) {
+	if got := mergePodConfig(PodConfig{KeepContainer: true}, PodConfig{}); !got.KeepContainer {
+		t.Error("KeepContainer: got false, want true from base")
+	}
+	if got := mergePodConfig(PodConfig{}, PodConfig{}); got.KeepContainer {
+		t.Error("KeepContainer: got true, want false")
+	}
+}
+
+func TestMergePodConfig_StripANSI(t *testing.T) {
+	if got := mergePodConfig(PodConfig{StripANSI: true}, PodConfig{}); !got.StripANSI {
+		t.Error("StripANSI: got false, want true from base")
+	}
+	if got := mergePodConfig(PodConfig{}, PodConfig{StripANSI: true}); !got.StripANSI {
+		t.Error("StripANSI: got false, want true from override")
+	}
+}
+
+func TestMergePodConfig_CapAddAndPrivileged(t *testing.T) {
+	got := mergePodConfig(PodConfig{CapAdd: []string{"NET_ADMIN"}, Privileged: true}, PodConfig{CapAdd: []string{"SYS_PTRACE", "NET_ADMIN"}})
+	if !slices.Equal(got.CapAdd, []string{"NET_ADMIN", "SYS_PTRACE"}) {
+		t.Errorf("CapAdd: got %v, want [NET_ADMIN SYS_PTRACE]", got.CapAdd)
+	}
+	if !got.Privileged {
+		t.Error("Privileged: got false, want true from base")
+	}
+}
+
+func TestMergePodConfig_BuildSecrets(t *testing.T) {
+	base := []BuildSecret{{ID: "npmrc", Src: "/base/.npmrc"}, {ID: "gh", Src: "/base/gh"}}
+	override := []BuildSecret{{ID: "gh", Src: "/pod/gh"}}
+	got := mergePodConfig(PodConfig{BuildSecrets: base}, PodConfig{BuildSecrets: override})
+	want := []BuildSecret{{ID: "npmrc", Src: "/base/.npmrc"}, {ID: "gh", Src: "/pod/gh"}}
+	if !slices.Equal(got.BuildSecrets, want) {
+		t.Errorf("BuildSecrets: got %v, want %v", got.BuildSecrets, want)
+	}
+}
+
+func TestMergePodConfig_Hostname(t *testing.T) {
+	got := mergePodConfig(PodConfig{Hostname: "base"}, PodConfig{})
+	if got.Hostname != "base" {
+		t.Errorf("Hostname: got %q, want base from base", got.Hostname)
+	}
+	got = mergePodConfig(PodConfig{Hostname: "base"}, PodConfig{Hostname: "pod"})
+	if got.Hostname != "pod" {
+		t.Errorf("Hostname: got %q, want pod from override", got.Hostname)
+	}
+}
+
+func TestMergePodConfig_PromptPrefix(t *testing.T) {
+	got := mergePodConfig(PodConfig{PromptPrefix: "base: "}, PodConfig{})
+	if got.PromptPrefix != "base: " {
+		t.Errorf("PromptPrefix: got %q, want base: from base", got.PromptPrefix)
+	}
+	got = mergePodConfig(PodConfig{PromptPrefix: "base: "}, PodConfig{PromptPrefix: "pod: "})
+	if got.PromptPrefix != "pod: " {
+		t.Errorf("PromptPrefix: got %q, want pod: from override", got.PromptPrefix)
+	}
+}
+
+func TestMergePodConfig_SkipPermissions(t *testing.T) {
+	if got := mergePodConfig(PodConfig{SkipPermissions: true}, PodConfig{}); !got.SkipPermissions {
+		t.Error("SkipPermissions: got false, want true from base")
+	}
+	if got := mergePodConfig(PodConfig{}, PodConfig{SkipPermissions: true}); !got.SkipPermissions {
+		t.Error("SkipPermissions: got false, want true from override")
+	}
+}
+
+func TestMergePodConfig_PullPolicy(t *testing.T) {
+	got := mergePodConfig(PodConfig{PullPolicy: PullMissing}, PodConfig{})
+	if got.PullPolicy != PullMissing {
+		t.Errorf("PullPolicy: got %q, want %q from base", got.PullPolicy, PullMissing)
+	}
+	got = mergePodConfig(PodConfig{PullPolicy: PullMissing}, PodConfig{PullPolicy: PullNever})
+	if got.PullPolicy != PullNever {
+		t.Errorf("PullPolicy: got %q, want %q from override", got.PullPolicy, PullNever)
+	}
+}
+
+func TestMergePodConfig_FieldKinds(t *testing.T) {
+	tests := []struct {
+		name           string
+		base, override PodConfig
+		want           PodConfig
+	}{
+		{
+			name: "string from base",
+			base: PodConfig{Workdir: "/base"},
+			want: PodConfig{Workdir: "/base"},
+		},
+		{
+			name:     "string from override",
+			base:     PodConfig{Workdir: "/base"},
+			override: PodConfig{Workdir: "/pod"},
+			want:     PodConfig{Workdir: "/pod"},
+		},
+		{
+			name:     "bool set by either",
+			base:     PodConfig{KeepContainer: true},
+			override: PodConfig{StripANSI: true},
+			want:     PodConfig{KeepContainer: true, StripANSI: true},
+		},
+		{
+			name:     "nested bools set by either",
+			base:     PodConfig{Build: BuildConfig{NoCache: true}},
+			override: PodConfig{Build: BuildConfig{Pull: true}},
+			want:     PodConfig{Build: BuildConfig{NoCache: true, Pull: true}},
+		},
+		{
+			name: "explicit false overrides true",
+			base: PodConfig{
+				RequireBuildArgs: true, KeepContainer: true, Privileged: true, SkipPermissions: true,
+				StripANSI: true, FetchIssue: true, Build: BuildConfig{NoCache: true, Pull: true},
+			},
+			override: PodConfig{explicit: allExplicit()},
+			want:     PodConfig{explicit: allExplicit()},
+		},
+		{
+			name:     "explicit false on one bool keeps the others",
+			base:     PodConfig{Privileged: true, SkipPermissions: true, Build: BuildConfig{NoCache: true}},
+			override: PodConfig{explicit: map[string]bool{"privileged": true, "build.pull": true}},
+			want:     PodConfig{SkipPermissions: true, Build: BuildConfig{NoCache: true}, explicit: map[string]bool{"privileged": true, "build.pull": true}},
+		},
+		{
+			name:     "map merged key-wise, override wins",
+			base:     PodConfig{Env: map[string]string{"A": "base", "B": "base"}},
+			override: PodConfig{Env: map[string]string{"B": "pod"}},
+			want:     PodConfig{Env: map[string]string{"A": "base", "B": "pod"}},
+		},
+		{
+			name:     "list concatenated without duplicates",
+			base:     PodConfig{InheritEnv: []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN"}},
+			override: PodConfig{InheritEnv: []string{"GITHUB_TOKEN", "NPM_TOKEN"}},
+			want:     PodConfig{InheritEnv: []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN", "NPM_TOKEN"}},
+		},
+		{
+			name:     "mounts concatenated, override replaces by target",
+			base:     PodConfig{Mounts: []Mount{{Source: "/h/.ssh", Target: "/root/.ssh", ReadOnly: true}, {Source: "/h/cache", Target: "/cache"}}},
+			override: PodConfig{Mounts: []Mount{{Source: "/p/cache", Target: "/cache"}, {Source: "/p/src", Target: "/src"}}},
+			want:     PodConfig{Mounts: []Mount{{Source: "/h/.ssh", Target: "/root/.ssh", ReadOnly: true}, {Source: "/p/cache", Target: "/cache"}, {Source: "/p/src", Target: "/src"}}},
+		},
+		{
+			name:     "mount targets compared after ~ expansion",
+			base:     PodConfig{Mounts: []Mount{{Source: "/h/.ssh", Target: "~/.ssh", ReadOnly: true}}},
+			override: PodConfig{ContainerHome: "/home/claude", Mounts: []Mount{{Source: "/p/.ssh", Target: "/home/claude/.ssh"}}},
+			want:     PodConfig{ContainerHome: "/home/claude", Mounts: []Mount{{Source: "/p/.ssh", Target: "/home/claude/.ssh"}}},
+		},
+		{
+			name:     "mount targets expanded to the base container home",
+			base:     PodConfig{ContainerHome: "/home/agent", Mounts: []Mount{{Source: "/h/cfg", Target: "/home/agent/.config"}}},
+			override: PodConfig{Mounts: []Mount{{Source: "/p/cfg", Target: "~/.config/"}}},
+			want:     PodConfig{ContainerHome: "/home/agent", Mounts: []Mount{{Source: "/p/cfg", Target: "~/.config/"}}},
+		},
+		{
+			name:     "mount targets under different homes kept",
+			base:     PodConfig{Mounts: []Mount{{Source: "/h/.ssh", Target: "/root/.ssh"}}},
+			override: PodConfig{ContainerHome: "/home/claude", Mounts: []Mount{{Source: "/p/.ssh", Target: "~/.ssh"}}},
+			want:     PodConfig{ContainerHome: "/home/claude", Mounts: []Mount{{Source: "/h/.ssh", Target: "/root/.ssh"}, {Source: "/p/.ssh", Target: "~/.ssh"}}},
+		},
+		{
+			name:     "build secrets concatenated, override replaces by ID",
+			base:     PodConfig{BuildSecrets: []BuildSecret{{ID: "gh", Src: "/h/gh"}}},
+			override: PodConfig{BuildSecrets: []BuildSecret{{ID: "gh", Src: "/p/gh"}, {ID: "npmrc", Src: "/p/.npmrc"}}},
+			want:     PodConfig{BuildSecrets: []BuildSecret{{ID: "gh", Src: "/p/gh"}, {ID: "npmrc", Src: "/p/.npmrc"}}},
+		},
+		{
+			name: "dockerfilePath and noDefaults only from override",
+			base: PodConfig{DockerfilePath: "Containerfile", NoDefaults: true},
+			want: PodConfig{},
+		},
+		{
+			name:     "noDefaults from override",
+			override: PodConfig{NoDefaults: true},
+			want:     PodConfig{NoDefaults: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePodConfig(tt.base, tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// allExplicit returns an explicit set naming every merged boolean.
+func allExplicit() map[string]bool {
+	m := make(map[string]bool, len(mergeableBools))
+	for _, k := range mergeableBools {
+		m[k] = true
+	}
+	return m
+}
+
+func TestPodConfig_UnmarshalJSON_Explicit(t *testing.T) {
+	var c PodConfig
+	if err := json.Unmarshal([]byte(`{"Privileged": false, "keepContainer": true, "workdir": "/w", "build": {"noCache": false}}`), &c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]bool{"privileged": true, "keepcontainer": true, "build.nocache": true}
+	if !reflect.DeepEqual(c.explicit, want) {
+		t.Errorf("explicit: got %v, want %v", c.explicit, want)
+	}
+	if !c.KeepContainer || c.Workdir != "/w" {
+		t.Errorf("fields: got %+v", c)
+	}
+
+	var none PodConfig
+	if err := json.Unmarshal([]byte(`{"workdir": "/w"}`), &none); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if none.explicit != nil {
+		t.Errorf("explicit without booleans: got %v, want nil", none.explicit)
+	}
+}
+
+func TestMergePodConfig_DoesNotModifyInputs(t *testing.T) {
+	base := PodConfig{Env: map[string]string{"A": "base"}}
+	override := PodConfig{Env: map[string]string{"B": "pod"}}
+	mergePodConfig(base, override)
+	if len(base.Env) != 1 || len(override.Env) != 1 {
+		t.Errorf("inputs modified: base %v, override %v", base.Env, override.Env)
+	}
+}
+
+func TestMergePodConfig_EmptyStaysNil(t *testing.T) {
+	got := mergePodConfig(PodConfig{}, PodConfig{})
+	if got.Env != nil || got.InheritEnv != nil || got.Mounts != nil {
+		t.Errorf("got %+v, want nil maps and slices", got)
+	}
+}
+
+// writeDefaultsJSON writes the defaults file for podsDir.
+func writeDefaultsJSON(t *testing.T, podsDir, content string) {
+	t.Helper()
+	if err := os.WriteFile(DefaultsPath(podsDir), []byte(content), 0644); err != nil {
+		t.Fatalf("write defaults.json: %v", err)
+	}
+}
+
+func TestDefaultsPath(t *testing.T) {
+	for _, podsDir := range []string{"/home/u/.cldpd/pods", "/home/u/.cldpd/pods/"} {
+		if got := DefaultsPath(podsDir); got != "/home/u/.cldpd/defaults.json" {
+			t.Errorf("DefaultsPath(%q): got %q, want /home/u/.cldpd/defaults.json", podsDir, got)
+		}
+	}
+}
+
+func TestDiscoverPod_Defaults(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{
+		"env": {"LOG_LEVEL": "info", "REGION": "eu"},
+		"inheritEnv": ["ANTHROPIC_API_KEY", "GITHUB_TOKEN"],
+		"mounts": [{"source": "/keys/ssh", "target": "~/.ssh", "readOnly": true}],
+		"workdir": "/workspace"
+	}`)
+	writePodJSON(t, dir, `{
+		"env": {"LOG_LEVEL": "debug"},
+		"inheritEnv": ["GITHUB_TOKEN", "NPM_TOKEN"],
+		"containerHome": "/home/agent"
+	}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := pod.Config
+	if want := map[string]string{"LOG_LEVEL": "debug", "REGION": "eu"}; !reflect.DeepEqual(cfg.Env, want) {
+		t.Errorf("Env: got %v, want %v", cfg.Env, want)
+	}
+	if want := []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN", "NPM_TOKEN"}; !slices.Equal(cfg.InheritEnv, want) {
+		t.Errorf("InheritEnv: got %v, want %v", cfg.InheritEnv, want)
+	}
+	if cfg.Workdir != "/workspace" {
+		t.Errorf("Workdir: got %q, want /workspace from the defaults", cfg.Workdir)
+	}
+	// The defaults' ~ target expands to the pod's container home.
+	if want := []Mount{{Source: "/keys/ssh", Target: "/home/agent/.ssh", ReadOnly: true}}; !slices.Equal(cfg.Mounts, want) {
+		t.Errorf("Mounts: got %v, want %v", cfg.Mounts, want)
+	}
+}
+
+func TestDiscoverPod_Defaults_WithoutPodJSON(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{"inheritEnv": ["ANTHROPIC_API_KEY"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(pod.Config.InheritEnv, []string{"ANTHROPIC_API_KEY"}) {
+		t.Errorf("InheritEnv: got %v, want the defaults", pod.Config.InheritEnv)
+	}
+}
+
+func TestDiscoverPod_Defaults_Absent(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"inheritEnv": ["GITHUB_TOKEN"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (PodConfig{InheritEnv: []string{"GITHUB_TOKEN"}}); !reflect.DeepEqual(pod.Config, want) {
+		t.Errorf("Config: got %+v, want the pod's own config", pod.Config)
+	}
+}
+
+func TestDiscoverPod_Defaults_ExplicitFalse(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{"privileged": true, "skipPermissions": true, "build": {"noCache": true, "pull": true}}`)
+	writePodJSON(t, dir, `{"privileged": false, "build": {"noCache": false}}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Config.Privileged {
+		t.Error("Privileged: got true, want the pod's false")
+	}
+	if pod.Config.Build.NoCache {
+		t.Error("Build.NoCache: got true, want the pod's false")
+	}
+	if !pod.Config.SkipPermissions || !pod.Config.Build.Pull {
+		t.Errorf("unset booleans: got %+v, want the defaults' true", pod.Config)
+	}
+}
+
+func TestDiscoverPod_Defaults_MountTargetExpanded(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{"mounts": [{"source": "/h/.ssh", "target": "~/.ssh", "readOnly": true}]}`)
+	writePodJSON(t, dir, `{"containerHome": "/home/claude", "mounts": [{"source": "/p/.ssh", "target": "/home/claude/.ssh"}]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []Mount{{Source: "/p/.ssh", Target: "/home/claude/.ssh"}}; !slices.Equal(pod.Config.Mounts, want) {
+		t.Errorf("Mounts: got %+v, want %+v", pod.Config.Mounts, want)
+	}
+}
+
+func TestDiscoverPod_Defaults_NoDefaultsMounts(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{"mounts": [{"source": "/h/cache", "target": "/cache"}]}`)
+	writePodJSON(t, dir, `{"noDefaults": true, "mounts": [{"source": "/p/.ssh", "target": "~/.ssh"}]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []Mount{{Source: "/p/.ssh", Target: "/root/.ssh"}}; !slices.Equal(pod.Config.Mounts, want) {
+		t.Errorf("Mounts: got %+v, want only the pod's mount, expanded", pod.Config.Mounts)
+	}
+}
+
+func TestDiscoverPod_Defaults_NoDefaults(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	dir := makePodDir(t, podsDir, "mypod")
+	writeDefaultsJSON(t, podsDir, `{"inheritEnv": ["ANTHROPIC_API_KEY"], "keepContainer": true}`)
+	writePodJSON(t, dir, `{"noDefaults": true, "inheritEnv": ["GITHUB_TOKEN"]}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (PodConfig{NoDefaults: true, InheritEnv: []string{"GITHUB_TOKEN"}}); !reflect.DeepEqual(pod.Config, want) {
+		t.Errorf("Config: got %+v, want the pod's own config", pod.Config)
+	}
+}
+
+func TestDiscoverPod_Defaults_Invalid(t *testing.T) {
+	podsDir := filepath.Join(t.TempDir(), "pods")
+	makePodDir(t, podsDir, "mypod")
+
+	writeDefaultsJSON(t, podsDir, `{not json`)
+	if _, err := DiscoverPod(podsDir, "mypod"); err == nil || !strings.Contains(err.Error(), "defaults.json") {
+		t.Errorf("malformed defaults: got %v, want a parse error naming defaults.json", err)
+	}
+
+	writeDefaultsJSON(t, podsDir, `{"ports": ["not-a-port"]}`)
+	if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("invalid defaults: got %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestDiscoverPod_StopTimeout(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"stopTimeout": "45s"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pod.Config.stopTimeout(); got != 45*time.Second {
+		t.Errorf("stopTimeout: got %v, want 45s", got)
+	}
+}
+
+func TestDiscoverPod_MaxRuntime(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"maxRuntime": "2h"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := pod.Config.maxRuntime(); got != 2*time.Hour {
+		t.Errorf("maxRuntime: got %v, want 2h", got)
+	}
+}
+
+func TestDiscoverPod_User(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"user": "1000:1000"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Config.User != "1000:1000" {
+		t.Errorf("User: got %q, want %q", pod.Config.User, "1000:1000")
+	}
+}
+
+func TestDiscoverPod_Build(t *testing.T) {
+	tests := []struct {
+		json string
+		want BuildConfig
+	}{
+		{`{}`, BuildConfig{}},
+		{`{"build": {"noCache": false, "pull": true}}`, BuildConfig{Pull: true}},
+		{`{"build": {"noCache": true}}`, BuildConfig{NoCache: true}},
+	}
+	for _, tt := range tests {
+		podsDir := t.TempDir()
+		dir := makePodDir(t, podsDir, "mypod")
+		writePodJSON(t, dir, tt.json)
+
+		pod, err := DiscoverPod(podsDir, "mypod")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.json, err)
+		}
+		if pod.Config.Build != tt.want {
+			t.Errorf("%s: Build: got %+v, want %+v", tt.json, pod.Config.Build, tt.want)
+		}
+	}
+}
+
+func TestDiscoverPod_DockerfilePath(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := filepath.Join(podsDir, "mypod")
+	if err := os.MkdirAll(filepath.Join(dir, "build"), 0755); err != nil {
+		t.Fatalf("create pod dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "build", "Containerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("write Containerfile: %v", err)
+	}
+	writePodJSON(t, dir, `{"dockerfilePath": "build/Containerfile", "buildTarget": "dev"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, err := filepath.Abs(filepath.Join(dir, "build", "Containerfile"))
+	if err != nil {
+		t.Fatalf("abs: %v", err)
+	}
+	if pod.Dockerfile != want {
+		t.Errorf("Dockerfile: got %q, want %q", pod.Dockerfile, want)
+	}
+	if pod.Config.BuildTarget != "dev" {
+		t.Errorf("BuildTarget: got %q, want %q", pod.Config.BuildTarget, "dev")
+	}
+}
+
+func TestDiscoverPod_DockerfilePath_Default(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"buildTarget": "review"}`)
+
+	pod, err := DiscoverPod(podsDir, "mypod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Base(pod.Dockerfile) != "Dockerfile" {
+		t.Errorf("Dockerfile: got %q, want .../Dockerfile", pod.Dockerfile)
+	}
+}
+
+func TestDiscoverPod_DockerfilePath_Missing(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"dockerfilePath": "Containerfile"}`)
+
+	_, err := DiscoverPod(podsDir, "mypod")
+	if !errors.Is(err, ErrInvalidPod) {
+		t.Fatalf("got %v, want ErrInvalidPod", err)
+	}
+	if !strings.Contains(err.Error(), "Containerfile") {
+		t.Errorf("error %q does not name Containerfile", err)
+	}
+}
+
+func TestDiscoverPod_DockerfilePath_OutsidePod(t *testing.T) {
+	for _, p := range []string{"../Dockerfile", "/etc/Dockerfile"} {
+		t.Run(p, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, `{"dockerfilePath": "`+p+`"}`)
+
+			if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverPod_StopTimeout_Invalid(t *testing.T) {
+	for _, value := range []string{"45", "soon", "0s", "-5s"} {
+		podsDir := t.TempDir()
+		dir := makePodDir(t, podsDir, "mypod")
+		writePodJSON(t, dir, `{"stopTimeout": "`+value+`"}`)
+
+		if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("stopTimeout %q: got %v, want ErrInvalidConfig", value, err)
+		}
+	}
+}
+
+func TestDiscoverPod_MaxRuntime_Invalid(t *testing.T) {
+	for _, value := range []string{"2", "forever", "0s", "-1h"} {
+		podsDir := t.TempDir()
+		dir := makePodDir(t, podsDir, "mypod")
+		writePodJSON(t, dir, `{"maxRuntime": "`+value+`"}`)
+
+		if _, err := DiscoverPod(podsDir, "mypod"); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("maxRuntime %q: got %v, want ErrInvalidConfig", value, err)
+		}
+	}
+}
+
+// limitPodJSON returns a pod.json with the given numbers of mounts, env
+// entries, and inheritEnv names.
+func limitPodJSON(t *testing.T, mounts, env, inherit int) string {
+	t.Helper()
+	cfg := PodConfig{Env: make(map[string]string, env)}
+	for i := range mounts {
+		cfg.Mounts = append(cfg.Mounts, Mount{Source: fmt.Sprintf("/src/%d", i), Target: fmt.Sprintf("/dst/%d", i)})
+	}
+	for i := range env {
+		cfg.Env[fmt.Sprintf("VAR_%d", i)] = "x"
+	}
+	for i := range inherit {
+		cfg.InheritEnv = append(cfg.InheritEnv, fmt.Sprintf("HOST_%d", i))
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal pod.json: %v", err)
+	}
+	return string(data)
+}
+
+func TestDiscoverPod_Limits(t *testing.T) {
+	cases := []struct {
+		name                 string
+		mounts, env, inherit int
+		wantErr              bool
+	}{
+		{"mounts at limit", DefaultPodLimits.MaxMounts, 0, 0, false},
+		{"mounts over limit", DefaultPodLimits.MaxMounts + 1, 0, 0, true},
+		{"env at limit", 0, DefaultPodLimits.MaxEnv - 10, 10, false},
+		{"env over limit", 0, DefaultPodLimits.MaxEnv - 10, 11, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			podsDir := t.TempDir()
+			dir := makePodDir(t, podsDir, "mypod")
+			writePodJSON(t, dir, limitPodJSON(t, tc.mounts, tc.env, tc.inherit))
+
+			_, err := DiscoverPod(podsDir, "mypod")
+			if tc.wantErr && (!errors.Is(err, ErrInvalidPod) || !errors.Is(err, ErrInvalidConfig)) {
+				t.Errorf("got %v, want ErrInvalidPod and ErrInvalidConfig", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDiscoverAll_SkipsPodOverLimit(t *testing.T) {
+	podsDir := t.TempDir()
+	writePodJSON(t, makePodDir(t, podsDir, "huge"), limitPodJSON(t, DefaultPodLimits.MaxMounts+1, 0, 0))
+	makePodDir(t, podsDir, "valid")
+
+	pods, err := DiscoverAll(podsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "valid" {
+		t.Errorf("got %v, want only the valid pod", pods)
+	}
+}
+
+func TestDiscoverPod_OutputFormat_Invalid(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "mypod")
+	writePodJSON(t, dir, `{"outputFormat": "xml"}`)
+
+	_, err := DiscoverPod(podsDir, "mypod")
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("got %v, want ErrInvalidConfig", err)
+	}
+}
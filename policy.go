@@ -0,0 +1,219 @@
+package cldpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Policy restricts the host state a pod may request: which host environment
+// variables it may inherit, which host paths it may bind mount, and which
+// privileges beyond Docker's defaults its container may run with. It is an
+// administrator-level control, loaded from a file pods cannot edit.
+//
+// A name or path is rejected if it matches a deny entry, or if an allow list is
+// non-empty and it matches no allow entry. Mount entries are path prefixes
+// matched on directory boundaries, and cover build secret sources as well as
+// bind mounts; named volume mounts are not checked against them. Capabilities
+// are compared without case or the CAP_ prefix; a pod adding ALL matches every
+// deny entry and is allowed only by an allow entry of ALL. MaxMounts and
+// MaxEnv lower the PodLimits every pod is held to.
+type Policy struct {
+	AllowEnv          []string `json:"allowEnv"`          // inheritEnv and inheritBuildArgs names pods may request; empty allows all
+	DenyEnv           []string `json:"denyEnv"`           // inheritEnv and inheritBuildArgs names pods may never request
+	AllowMountSources []string `json:"allowMountSources"` // host path prefixes pods may mount or use as build secrets; empty allows all
+	DenyMountSources  []string `json:"denyMountSources"`  // host path prefixes pods may never mount or use as build secrets
+	MaxMounts         int      `json:"maxMounts"`         // most mounts a pod may declare; zero leaves only the PodLimits
+	MaxEnv            int      `json:"maxEnv"`            // most env plus inheritEnv entries; zero leaves only the PodLimits
+
+	DenyPrivileged bool     `json:"denyPrivileged"` // pods may not set privileged
+	AllowCapAdd    []string `json:"allowCapAdd"`    // capabilities pods may add; empty allows all
+	DenyCapAdd     []string `json:"denyCapAdd"`     // capabilities pods may never add
+	DenyUnconfined bool     `json:"denyUnconfined"` // pods may not set seccompProfile or apparmorProfile to "unconfined"
+	DenyGPUs       bool     `json:"denyGPUs"`       // pods may not request GPUs
+	DenyExtraHosts bool     `json:"denyExtraHosts"` // pods may not add /etc/hosts entries
+	DenyPorts      bool     `json:"denyPorts"`      // pods may not publish ports on the host
+}
+
+// DefaultPolicyPath returns the conventional policy file path: ~/.cldpd/policy.json.
+func DefaultPolicyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".cldpd", "policy.json"), nil
+}
+
+// LoadPolicy reads a Policy from the JSON file at path. It returns a nil
+// Policy and nil error if the file does not exist, so enforcement is disabled
+// entirely when no policy is installed.
+func LoadPolicy(path string) (*Policy, error) {
+	//nolint:gosec // path is an administrator-controlled policy file location
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	return &p, nil
+}
+
+// Check reports every item in cfg that violates the policy. It returns an
+// error wrapping ErrPolicyViolation listing all violations, or nil if cfg
+// complies. A nil Policy permits everything.
+func (p *Policy) Check(cfg PodConfig) error {
+	return violationError(p.violations(cfg))
+}
+
+// violationError returns an error wrapping ErrPolicyViolation that lists
+// violations, or nil if there are none.
+func violationError(violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPolicyViolation, strings.Join(violations, "; "))
+}
+
+// violations returns a description of each item in cfg that violates the
+// policy, in the order Check reports them.
+func (p *Policy) violations(cfg PodConfig) []string {
+	if p == nil {
+		return nil
+	}
+
+	var violations []string
+	for _, name := range cfg.InheritEnv {
+		violations = p.appendEnvViolation(violations, "inheritEnv", name)
+	}
+	// Build args read from the host are host environment all the same, so
+	// they answer to the same lists as inheritEnv.
+	for _, name := range cfg.InheritBuildArgs {
+		violations = p.appendEnvViolation(violations, "inheritBuildArgs", name)
+	}
+	for _, m := range cfg.Mounts {
+		if m.isVolume() {
+			// Mount source rules govern host paths; a volume name is not one.
+			continue
+		}
+		if matchesPathPrefix(m.Source, p.DenyMountSources) {
+			violations = append(violations, fmt.Sprintf("mount source %s is denied", m.Source))
+		} else if len(p.AllowMountSources) > 0 && !matchesPathPrefix(m.Source, p.AllowMountSources) {
+			violations = append(violations, fmt.Sprintf("mount source %s is not allowed", m.Source))
+		}
+	}
+	// A build secret reads a host file into the build just as a bind mount
+	// exposes one to the container, so it answers to the same prefixes.
+	for _, b := range cfg.BuildSecrets {
+		if matchesPathPrefix(b.Src, p.DenyMountSources) {
+			violations = append(violations, fmt.Sprintf("buildSecrets %s src %s is denied", b.ID, b.Src))
+		} else if len(p.AllowMountSources) > 0 && !matchesPathPrefix(b.Src, p.AllowMountSources) {
+			violations = append(violations, fmt.Sprintf("buildSecrets %s src %s is not allowed", b.ID, b.Src))
+		}
+	}
+
+	if p.MaxMounts > 0 && len(cfg.Mounts) > p.MaxMounts {
+		violations = append(violations, fmt.Sprintf("%d mounts exceed the limit of %d", len(cfg.Mounts), p.MaxMounts))
+	}
+	if n := cfg.envCount(); p.MaxEnv > 0 && n > p.MaxEnv {
+		violations = append(violations, fmt.Sprintf("%d env and inheritEnv entries exceed the limit of %d", n, p.MaxEnv))
+	}
+
+	if p.DenyPrivileged && cfg.Privileged {
+		violations = append(violations, "privileged is denied")
+	}
+	for _, c := range cfg.CapAdd {
+		if matchesCapability(c, p.DenyCapAdd) {
+			violations = append(violations, fmt.Sprintf("capAdd %s is denied", c))
+		} else if len(p.AllowCapAdd) > 0 && !allowsCapability(c, p.AllowCapAdd) {
+			violations = append(violations, fmt.Sprintf("capAdd %s is not allowed", c))
+		}
+	}
+	if p.DenyUnconfined {
+		if cfg.SeccompProfile == unconfinedProfile {
+			violations = append(violations, "seccompProfile unconfined is denied")
+		}
+		if cfg.ApparmorProfile == unconfinedProfile {
+			violations = append(violations, "apparmorProfile unconfined is denied")
+		}
+	}
+	if p.DenyGPUs && cfg.GPUs != "" {
+		violations = append(violations, fmt.Sprintf("gpus %s is denied", cfg.GPUs))
+	}
+	if p.DenyExtraHosts {
+		for _, h := range cfg.ExtraHosts {
+			violations = append(violations, fmt.Sprintf("extraHosts %s is denied", h))
+		}
+	}
+	if p.DenyPorts {
+		for _, port := range cfg.Ports {
+			violations = append(violations, fmt.Sprintf("port %s is denied", port))
+		}
+	}
+	return violations
+}
+
+// appendEnvViolation appends a violation to violations if the policy's env
+// lists forbid field to read host environment variable name.
+func (p *Policy) appendEnvViolation(violations []string, field, name string) []string {
+	if slices.Contains(p.DenyEnv, name) {
+		return append(violations, fmt.Sprintf("%s %s is denied", field, name))
+	}
+	if len(p.AllowEnv) > 0 && !slices.Contains(p.AllowEnv, name) {
+		return append(violations, fmt.Sprintf("%s %s is not allowed", field, name))
+	}
+	return violations
+}
+
+// unconfinedProfile is the seccomp and AppArmor profile name that lifts the
+// confinement entirely.
+const unconfinedProfile = "unconfined"
+
+// capabilityName returns c in the form Docker reports it: upper case, without
+// the CAP_ prefix.
+func capabilityName(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+}
+
+// matchesCapability reports whether c names, or as ALL includes, any of caps.
+func matchesCapability(c string, caps []string) bool {
+	c = capabilityName(c)
+	for _, e := range caps {
+		if e = capabilityName(e); c == e || c == "ALL" || e == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCapability reports whether caps permit adding c. ALL is permitted only
+// if caps list ALL itself.
+func allowsCapability(c string, caps []string) bool {
+	c = capabilityName(c)
+	for _, e := range caps {
+		if e = capabilityName(e); c == e || e == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPathPrefix reports whether path equals or lies beneath any of prefixes.
+// Both sides are cleaned first, so "/home/me/../etc" does not escape a prefix check.
+func matchesPathPrefix(path string, prefixes []string) bool {
+	path = filepath.Clean(path)
+	for _, prefix := range prefixes {
+		prefix = filepath.Clean(prefix)
+		if path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator)) || prefix == string(filepath.Separator) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Check_Allow(t *testing.T) {
+	p := &Policy{
+		AllowEnv:          []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN"},
+		AllowMountSources: []string{"/home/agent"},
+	}
+	cfg := PodConfig{
+		InheritEnv: []string{"GITHUB_TOKEN"},
+		Mounts:     []Mount{{Source: "/home/agent/.ssh", Target: "/root/.ssh"}},
+	}
+	if err := p.Check(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPolicy_Check_Deny(t *testing.T) {
+	p := &Policy{
+		DenyEnv:          []string{"AWS_SECRET_ACCESS_KEY"},
+		DenyMountSources: []string{"/var/run/docker.sock"},
+	}
+	cases := []PodConfig{
+		{InheritEnv: []string{"AWS_SECRET_ACCESS_KEY"}},
+		{Mounts: []Mount{{Source: "/var/run/docker.sock", Target: "/var/run/docker.sock"}}},
+	}
+	for _, cfg := range cases {
+		if err := p.Check(cfg); !errors.Is(err, ErrPolicyViolation) {
+			t.Errorf("Check(%+v): got %v, want ErrPolicyViolation", cfg, err)
+		}
+	}
+}
+
+func TestPolicy_Check_Limits(t *testing.T) {
+	p := &Policy{MaxMounts: 2, MaxEnv: 3}
+	mounts := []Mount{{Source: "/a", Target: "/a"}, {Source: "/b", Target: "/b"}}
+	atLimit := PodConfig{
+		Env:        map[string]string{"A": "1", "B": "2"},
+		InheritEnv: []string{"C"},
+		Mounts:     mounts,
+	}
+	if err := p.Check(atLimit); err != nil {
+		t.Errorf("at limit: unexpected error: %v", err)
+	}
+
+	over := PodConfig{
+		Env:        map[string]string{"A": "1", "B": "2"},
+		InheritEnv: []string{"C", "D"},
+		Mounts:     append(mounts, Mount{Source: "/c", Target: "/c"}),
+	}
+	err := p.Check(over)
+	if !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("over limit: got %v, want ErrPolicyViolation", err)
+	}
+	for _, want := range []string{"3 mounts exceed the limit of 2", "4 env and inheritEnv entries exceed the limit of 3"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestPolicy_Check_DenyOverridesAllow(t *testing.T) {
+	p := &Policy{
+		AllowMountSources: []string{"/home"},
+		DenyMountSources:  []string{"/home/shared/secrets"},
+	}
+	cfg := PodConfig{Mounts: []Mount{{Source: "/home/shared/secrets/key", Target: "/key"}}}
+	if err := p.Check(cfg); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("got %v, want ErrPolicyViolation", err)
+	}
+}
+
+func TestPolicy_Check_MixedViolationsReportedTogether(t *testing.T) {
+	p := &Policy{
+		AllowEnv:          []string{"ANTHROPIC_API_KEY"},
+		AllowMountSources: []string{"/srv/pods"},
+	}
+	cfg := PodConfig{
+		InheritEnv: []string{"ANTHROPIC_API_KEY", "HOME_TOKEN", "NPM_TOKEN"},
+		Mounts: []Mount{
+			{Source: "/srv/pods/cache", Target: "/cache"},
+			{Source: "/etc", Target: "/host-etc"},
+		},
+	}
+	err := p.Check(cfg)
+	if !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("got %v, want ErrPolicyViolation", err)
+	}
+	for _, want := range []string{"HOME_TOKEN", "NPM_TOKEN", "/etc"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing violation %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "ANTHROPIC_API_KEY") || strings.Contains(err.Error(), "/srv/pods/cache") {
+		t.Errorf("error %q lists permitted items", err)
+	}
+}
+
+func TestPolicy_Check_BuildSecretSources(t *testing.T) {
+	secret := PodConfig{BuildSecrets: []BuildSecret{{ID: "aws", Src: "/home/agent/.aws/credentials"}}}
+
+	deny := &Policy{DenyMountSources: []string{"/home/agent/.aws"}}
+	err := deny.Check(secret)
+	if !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("denied source: got %v, want ErrPolicyViolation", err)
+	}
+	if want := "buildSecrets aws src /home/agent/.aws/credentials is denied"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q missing %q", err, want)
+	}
+
+	allow := &Policy{AllowMountSources: []string{"/srv/secrets"}}
+	if err := allow.Check(secret); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("unlisted source: got %v, want ErrPolicyViolation", err)
+	}
+	allow.AllowMountSources = append(allow.AllowMountSources, "/home/agent")
+	if err := allow.Check(secret); err != nil {
+		t.Errorf("allowed source: unexpected error: %v", err)
+	}
+}
+
+func TestPolicy_Check_PrefixOnDirectoryBoundary(t *testing.T) {
+	p := &Policy{AllowMountSources: []string{"/home/agent"}}
+	for _, src := range []string{"/home/agent-evil", "/home/agent/../root"} {
+		cfg := PodConfig{Mounts: []Mount{{Source: src, Target: "/x"}}}
+		if err := p.Check(cfg); !errors.Is(err, ErrPolicyViolation) {
+			t.Errorf("source %q: got %v, want ErrPolicyViolation", src, err)
+		}
+	}
+}
+
+func TestPolicy_Check_VolumesSkipSourceRules(t *testing.T) {
+	p := &Policy{AllowMountSources: []string{"/home/agent"}, DenyMountSources: []string{"claude-cache"}}
+	cfg := PodConfig{Mounts: []Mount{{Source: "claude-cache", Target: "/root/.cache/claude", Type: MountTypeVolume}}}
+	if err := p.Check(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A bind mount of the same source is still checked.
+	cfg.Mounts[0].Type = MountTypeBind
+	if err := p.Check(cfg); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("bind mount: got %v, want ErrPolicyViolation", err)
+	}
+}
+
+func TestPolicy_Check_NilPermitsAll(t *testing.T) {
+	var p *Policy
+	cfg := PodConfig{
+		InheritEnv: []string{"ANYTHING"},
+		Mounts:     []Mount{{Source: "/", Target: "/host"}},
+	}
+	if err := p.Check(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadPolicy_MissingFileDisables(t *testing.T) {
+	p, err := LoadPolicy(filepath.Join(t.TempDir(), "policy.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p != nil {
+		t.Errorf("got %+v, want nil policy", p)
+	}
+}
+
+func TestLoadPolicy_Parses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"denyEnv": ["AWS_SECRET_ACCESS_KEY"], "allowMountSources": ["/srv"]}`), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.DenyEnv) != 1 || len(p.AllowMountSources) != 1 {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestLoadPolicy_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{not json`), 0644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("expected error for malformed policy, got nil")
+	}
+}
+
+func TestDispatcher_Start_PolicyAppliesToMergedConfig(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	built := false
+	r := &mockRunner{
+		buildFn: func(_ context.Context, _ string, _ string, _ BuildOptions) error {
+			built = true
+			return nil
+		},
+	}
+	// The violating name comes from the default config, not pod.json.
+	d := NewDispatcher(podsDir, r,
+		WithDefaultConfig(PodConfig{InheritEnv: []string{"AWS_SECRET_ACCESS_KEY"}}),
+		WithPolicy(&Policy{DenyEnv: []string{"AWS_SECRET_ACCESS_KEY"}}),
+	)
+
+	_, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1")
+	if !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("got %v, want ErrPolicyViolation", err)
+	}
+	if built {
+		t.Error("Build called despite policy violation")
+	}
+}
+
+func TestPolicy_Check_Privileges(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		cfg    PodConfig
+		want   string // substring of the violation; empty for none
+	}{
+		{"privileged denied", Policy{DenyPrivileged: true}, PodConfig{Privileged: true}, "privileged is denied"},
+		{"privileged unset", Policy{DenyPrivileged: true}, PodConfig{}, ""},
+		{"capability denied", Policy{DenyCapAdd: []string{"SYS_ADMIN"}}, PodConfig{CapAdd: []string{"cap_sys_admin"}}, "capAdd cap_sys_admin is denied"},
+		{"ALL matches a deny entry", Policy{DenyCapAdd: []string{"SYS_ADMIN"}}, PodConfig{CapAdd: []string{"ALL"}}, "capAdd ALL is denied"},
+		{"deny ALL", Policy{DenyCapAdd: []string{"ALL"}}, PodConfig{CapAdd: []string{"NET_ADMIN"}}, "capAdd NET_ADMIN is denied"},
+		{"capability not allowed", Policy{AllowCapAdd: []string{"NET_ADMIN"}}, PodConfig{CapAdd: []string{"SYS_PTRACE"}}, "capAdd SYS_PTRACE is not allowed"},
+		{"ALL not allowed", Policy{AllowCapAdd: []string{"NET_ADMIN"}}, PodConfig{CapAdd: []string{"ALL"}}, "capAdd ALL is not allowed"},
+		{"capability allowed", Policy{AllowCapAdd: []string{"CAP_NET_ADMIN"}}, PodConfig{CapAdd: []string{"NET_ADMIN"}}, ""},
+		{"seccomp unconfined", Policy{DenyUnconfined: true}, PodConfig{SeccompProfile: "unconfined"}, "seccompProfile unconfined is denied"},
+		{"apparmor unconfined", Policy{DenyUnconfined: true}, PodConfig{ApparmorProfile: "unconfined"}, "apparmorProfile unconfined is denied"},
+		{"custom seccomp profile", Policy{DenyUnconfined: true}, PodConfig{SeccompProfile: "/etc/cldpd/seccomp.json"}, ""},
+		{"gpus denied", Policy{DenyGPUs: true}, PodConfig{GPUs: "all"}, "gpus all is denied"},
+		{"extra hosts denied", Policy{DenyExtraHosts: true}, PodConfig{ExtraHosts: []string{"api.local:10.0.0.5"}}, "extraHosts api.local:10.0.0.5 is denied"},
+		{"ports denied", Policy{DenyPorts: true}, PodConfig{Ports: []string{"8080:80"}}, "port 8080:80 is denied"},
+		{"zero policy permits all", Policy{}, PodConfig{Privileged: true, CapAdd: []string{"ALL"}, SeccompProfile: "unconfined", GPUs: "all", Ports: []string{"80"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.cfg)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrPolicyViolation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want ErrPolicyViolation naming %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Start_PolicyLogsEachDenial(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	writePodJSON(t, filepath.Join(podsDir, "myrepo"), `{"privileged": true, "gpus": "all"}`)
+
+	h := newRecordingHandler()
+	d := NewDispatcher(podsDir, &mockRunner{},
+		WithLogger(slog.New(h)),
+		WithPolicy(&Policy{DenyPrivileged: true, DenyGPUs: true}),
+	)
+	if _, err := d.Start(context.Background(), "myrepo", "https://github.com/org/repo/issues/1"); !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("got %v, want ErrPolicyViolation", err)
+	}
+
+	var denials []string
+	h.mu.Lock()
+	for _, r := range *h.records {
+		if r.Message != "policy denied pod" {
+			continue
+		}
+		if r.Level != slog.LevelWarn {
+			t.Errorf("level: got %v, want Warn", r.Level)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "violation" {
+				denials = append(denials, a.Value.String())
+			}
+			return true
+		})
+	}
+	h.mu.Unlock()
+	if want := []string{"privileged is denied", "gpus all is denied"}; !slices.Equal(denials, want) {
+		t.Errorf("logged violations: got %q, want %q", denials, want)
+	}
+}
+
+func TestPolicy_Check_InheritBuildArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string // substring of the violation; empty for none
+	}{
+		{"denied", Policy{DenyEnv: []string{"NPM_TOKEN"}}, "inheritBuildArgs NPM_TOKEN is denied"},
+		{"not allowed", Policy{AllowEnv: []string{"ANTHROPIC_API_KEY"}}, "inheritBuildArgs NPM_TOKEN is not allowed"},
+		{"allowed", Policy{AllowEnv: []string{"NPM_TOKEN"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(PodConfig{InheritBuildArgs: []string{"NPM_TOKEN"}})
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrPolicyViolation) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want ErrPolicyViolation containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_BuildAndPrefetch_EnforcePolicy(t *testing.T) {
+	podsDir := t.TempDir()
+	makeTestPod(t, podsDir, "myrepo")
+	if err := os.WriteFile(filepath.Join(podsDir, "myrepo", "pod.json"), []byte(`{"inheritBuildArgs":["NPM_TOKEN"]}`), 0644); err != nil {
+		t.Fatalf("write pod.json: %v", err)
+	}
+	r := &mockRunner{
+		buildFn: func(context.Context, string, string, BuildOptions) error {
+			t.Error("Build called despite policy violation")
+			return nil
+		},
+	}
+	d := NewDispatcher(podsDir, r, WithPolicy(&Policy{DenyEnv: []string{"NPM_TOKEN"}}))
+
+	if err := d.Build(context.Background(), "myrepo", BuildOptions{}); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Build: got %v, want ErrPolicyViolation", err)
+	}
+	if err := d.Prefetch(context.Background(), "myrepo"); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Prefetch: got %v, want ErrPolicyViolation", err)
+	}
+}
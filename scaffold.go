@@ -0,0 +1,148 @@
+package cldpd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ScaffoldOptions configures ScaffoldPod.
+type ScaffoldOptions struct {
+	From  string // name of an existing pod to copy instead of the starter files
+	Force bool   // overwrite files in an existing pod directory
+}
+
+// scaffoldDockerfile is the starter Dockerfile written by ScaffoldPod.
+const scaffoldDockerfile = `# cldpd pod image. The container is started with:
+#
+#   claude -p "Work on this GitHub issue: <url>"
+#
+# template.md starts empty. Standing orders written there are prepended to
+# the prompt, followed by a blank line.
+#
+# Install whatever toolchain your agent team needs alongside Claude Code.
+#
+# NOTE: For production use, pin node:22-slim to a specific digest
+# and specify a version for @anthropic-ai/claude-code.
+FROM node:22-slim
+
+# Install git and SSH client
+RUN apt-get update && apt-get install -y --no-install-recommends \
+    git \
+    openssh-client \
+    && rm -rf /var/lib/apt/lists/*
+
+# Install Claude Code
+RUN npm install -g @anthropic-ai/claude-code
+
+WORKDIR /workspace
+`
+
+// scaffoldPodJSON is the starter pod.json written by ScaffoldPod.
+const scaffoldPodJSON = `{
+  "env": {},
+  "inheritEnv": [],
+  "mounts": []
+}
+`
+
+// scaffoldTemplate is the starter template.md written by ScaffoldPod: empty,
+// so the prompt carries only the issue until standing orders are written.
+const scaffoldTemplate = ""
+
+// ScaffoldPod creates a new pod directory named name under podsDir and returns
+// the resulting Pod as DiscoverPod would load it.
+//
+// By default the pod is populated with a starter Dockerfile, a pod.json with
+// empty env, inheritEnv, and mounts stubs, and an empty template.md. When
+// opts.From names an existing pod, that pod's files are copied instead.
+//
+// ScaffoldPod returns ErrPodExists if the pod directory already exists and
+// opts.Force is false. With opts.Force, existing files of the same name are
+// overwritten; other files in the directory are left in place.
+func ScaffoldPod(podsDir, name string, opts ScaffoldOptions) (Pod, error) {
+	if err := validatePodName(name); err != nil {
+		return Pod{}, err
+	}
+
+	dir := filepath.Join(podsDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		if !opts.Force {
+			return Pod{}, fmt.Errorf("%w: %s", ErrPodExists, name)
+		}
+	} else if !os.IsNotExist(err) {
+		return Pod{}, fmt.Errorf("stat pod directory: %w", err)
+	}
+
+	if opts.From != "" {
+		src, err := DiscoverPod(podsDir, opts.From)
+		if err != nil {
+			return Pod{}, err
+		}
+		if err := copyDir(src.Dir, dir); err != nil {
+			return Pod{}, fmt.Errorf("copy pod %s: %w", opts.From, err)
+		}
+		return DiscoverPod(podsDir, name)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return Pod{}, fmt.Errorf("create pod directory: %w", err)
+	}
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"Dockerfile", scaffoldDockerfile},
+		{"pod.json", scaffoldPodJSON},
+		{"template.md", scaffoldTemplate},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.content), 0o600); err != nil {
+			return Pod{}, fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+
+	return DiscoverPod(podsDir, name)
+}
+
+// validatePodName rejects names that would escape or alias the pods directory.
+func validatePodName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid pod name %q", name)
+	}
+	return nil
+}
+
+// copyDir recursively copies the regular files and directories under src into dst.
+// Symlinks and other special files are skipped.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o750)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		//nolint:gosec // path is within a trusted pods directory
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,120 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScaffoldPod_Default(t *testing.T) {
+	podsDir := t.TempDir()
+
+	pod, err := ScaffoldPod(podsDir, "newpod", ScaffoldOptions{})
+	if err != nil {
+		t.Fatalf("ScaffoldPod: %v", err)
+	}
+	if pod.Name != "newpod" {
+		t.Errorf("Name: got %q, want %q", pod.Name, "newpod")
+	}
+	if pod.Template != "" {
+		t.Errorf("Template: got %q, want empty", pod.Template)
+	}
+	for _, name := range []string{"Dockerfile", "pod.json", "template.md"} {
+		if _, err := os.Stat(filepath.Join(podsDir, "newpod", name)); err != nil {
+			t.Errorf("%s not created: %v", name, err)
+		}
+	}
+
+	// The scaffold must be discoverable and its pod.json must parse.
+	discovered, err := DiscoverPod(podsDir, "newpod")
+	if err != nil {
+		t.Fatalf("DiscoverPod on scaffold: %v", err)
+	}
+	if discovered.Config.Env == nil {
+		t.Error("Config.Env: got nil, want empty stub")
+	}
+	if discovered.Config.InheritEnv == nil {
+		t.Error("Config.InheritEnv: got nil, want empty stub")
+	}
+	if discovered.Config.Mounts == nil {
+		t.Error("Config.Mounts: got nil, want empty stub")
+	}
+}
+
+func TestScaffoldPod_ExistingRefused(t *testing.T) {
+	podsDir := t.TempDir()
+	makePodDir(t, podsDir, "existing")
+
+	_, err := ScaffoldPod(podsDir, "existing", ScaffoldOptions{})
+	if !errors.Is(err, ErrPodExists) {
+		t.Errorf("got %v, want ErrPodExists", err)
+	}
+}
+
+func TestScaffoldPod_ExistingForce(t *testing.T) {
+	podsDir := t.TempDir()
+	dir := makePodDir(t, podsDir, "existing")
+	writeTemplate(t, dir, "old orders")
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("write notes: %v", err)
+	}
+
+	pod, err := ScaffoldPod(podsDir, "existing", ScaffoldOptions{Force: true})
+	if err != nil {
+		t.Fatalf("ScaffoldPod with Force: %v", err)
+	}
+	if pod.Template != "" {
+		t.Errorf("Template: got %q, want the old template overwritten with an empty one", pod.Template)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("unrelated file removed by force: %v", err)
+	}
+}
+
+func TestScaffoldPod_From(t *testing.T) {
+	podsDir := t.TempDir()
+	srcDir := makePodDir(t, podsDir, "source")
+	writePodJSON(t, srcDir, `{"image":"custom:v1","inheritEnv":["ANTHROPIC_API_KEY"]}`)
+	writeTemplate(t, srcDir, "source orders")
+	if err := os.MkdirAll(filepath.Join(srcDir, "scripts"), 0755); err != nil {
+		t.Fatalf("mkdir scripts: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "scripts", "setup.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	pod, err := ScaffoldPod(podsDir, "copy", ScaffoldOptions{From: "source"})
+	if err != nil {
+		t.Fatalf("ScaffoldPod from source: %v", err)
+	}
+	if pod.Config.Image != "custom:v1" {
+		t.Errorf("Config.Image: got %q, want %q", pod.Config.Image, "custom:v1")
+	}
+	if pod.Template != "source orders" {
+		t.Errorf("Template: got %q, want %q", pod.Template, "source orders")
+	}
+	if _, err := os.Stat(filepath.Join(podsDir, "copy", "scripts", "setup.sh")); err != nil {
+		t.Errorf("nested file not copied: %v", err)
+	}
+}
+
+func TestScaffoldPod_FromMissing(t *testing.T) {
+	podsDir := t.TempDir()
+
+	_, err := ScaffoldPod(podsDir, "copy", ScaffoldOptions{From: "ghost"})
+	if !errors.Is(err, ErrPodNotFound) {
+		t.Errorf("got %v, want ErrPodNotFound", err)
+	}
+}
+
+func TestScaffoldPod_InvalidName(t *testing.T) {
+	podsDir := t.TempDir()
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		if _, err := ScaffoldPod(podsDir, name, ScaffoldOptions{}); err == nil {
+			t.Errorf("ScaffoldPod(%q): got nil error, want error", name)
+		}
+	}
+}
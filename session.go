@@ -2,11 +2,18 @@ package cldpd
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -17,8 +24,103 @@ const (
 	// Lifecycle events block until delivered. Output events may be dropped
 	// under sustained backpressure.
 	eventChannelBuffer = 256
+
+	// lifecycleReserve is the number of Events buffer slots that every other
+	// event leaves free until ContainerStarted is sent, so that the lifecycle
+	// events emitted while preparing, which block until delivered, always fit
+	// even when Events is not being read.
+	lifecycleReserve = 4
+
+	// maxAnnotations is the maximum number of annotations a session may carry.
+	maxAnnotations = 64
+
+	// maxAnnotationKeyLen and maxAnnotationValueLen bound the byte length of
+	// each annotation key and value.
+	maxAnnotationKeyLen   = 128
+	maxAnnotationValueLen = 4096
+
+	// maxOutputBytes bounds the output a session captures for Output when
+	// full output capture is enabled.
+	maxOutputBytes = 16 << 20
+
+	// defaultMaxLineLength is the default bound on the bytes of a line carried
+	// in an output event's Data; see WithMaxLineLength.
+	defaultMaxLineLength = 16 << 10
+
+	// maxScanLine is the default bound on the length of a single output line
+	// the event goroutine reads; see WithMaxLineSize.
+	maxScanLine = maxOutputBytes
+
+	// stopRetryInterval is how often Stop and Kill check, while waiting for
+	// the session to end, whether the container they targeted has since started.
+	stopRetryInterval = 100 * time.Millisecond
 )
 
+// SessionTiming reports wall-clock timing for the phases of a session.
+type SessionTiming struct {
+	StartedAt     time.Time     // when the session began; for Start, this is when the build began
+	BuildDuration time.Duration // time spent building the image; zero for Resume and Attach
+	RunDuration   time.Duration // time spent in the container or exec; zero until it exits
+}
+
+// SessionResult summarizes a finished session.
+type SessionResult struct {
+	StartedAt      time.Time // when the session began
+	FinishedAt     time.Time // when the container or exec exited and the session ended
+	Err            error     // error the session ended with, as returned by Wait; nil on a normal exit
+	ExitCode       int       // exit code, as returned by Wait
+	OutputLines    int64     // output lines read from the container, as EventOutput or EventMessage
+	DroppedLines   int64     // output lines not delivered on Events because its buffer was full
+	TruncatedLines int64     // output lines whose event Data was cut to the maximum line length
+	Stopped        bool      // whether Stop or Kill was called
+}
+
+// sessionConfig carries per-session settings from the Dispatcher into newSession.
+type sessionConfig struct {
+	// prepare, if set, runs in the container goroutine before runFn, emitting
+	// its events through emit, which is Session.emitPrepare: lifecycle events
+	// block until delivered or the session is stopped, while build output and
+	// warnings may be dropped.
+	// Its duration is the session's BuildDuration. If it returns an error,
+	// runFn is not called and the session ends with that error.
+	prepare func(emit func(Event)) error
+	// onExit, if set, is called once in the container goroutine with the
+	// session's result, before Wait returns.
+	onExit func(code int, err error, runDuration time.Duration)
+	// onRun, if set, is called in the container goroutine each time runFn is
+	// about to run, including restarts.
+	onRun func()
+	// onOutputEnd, if set, is called once in the event goroutine when the
+	// output ends, with the number of lines dropped from Events, before Wait
+	// returns.
+	onOutputEnd func(dropped int64)
+	// annotations are the session's initial annotations, already checked
+	// with checkAnnotations.
+	annotations map[string]string
+	// onAnnotate, if set, is called with a copy of the annotations each time
+	// SetAnnotation changes them. Calls are serialized, in the order the
+	// changes were made.
+	onAnnotate func(map[string]string)
+	// claudeArgs are the pod-level flags added to the claude command run by
+	// Session.Resume.
+	claudeArgs []string
+	// logger receives the session's diagnostics, already carrying its pod,
+	// session, and container attributes. Nil discards them.
+	logger         *slog.Logger
+	healthInterval time.Duration // poll interval for container health; zero disables monitoring
+	idleTimeout    time.Duration // stop the container after this long without output; zero disables
+	maxRuntime     time.Duration // stop the container once it has run this long; zero disables
+	restartMax     int           // times to re-run runFn after a non-zero exit; zero disables restarts
+	restartBackoff time.Duration // wait before each restart
+	stopTimeout    time.Duration // Stop's default timeout; zero uses sessionStopTimeout
+	parseStream    bool          // parse stream-json output lines into EventMessage
+	stripANSI      bool          // remove terminal escape sequences from output lines
+	maxLineLength  int           // bound on an output event's Data, in bytes; zero disables truncation
+	maxLineSize    int           // bound on a line the event goroutine reads, in bytes; zero uses maxScanLine
+	captureOutput  bool          // keep every output line for Output
+	removeOnExit   bool          // remove the container once it has exited
+}
+
 // Session represents an active pod lifecycle. It is returned by Dispatcher.Start
 // and Dispatcher.Resume. The caller owns the Session and is responsible for
 // calling Stop or Wait.
@@ -26,39 +128,115 @@ const (
 // Events and Wait are independent consumption paths — neither requires the other.
 // Stop is idempotent.
 type Session struct {
-	runner    Runner
-	exitErr   error
-	events    chan Event
-	done      chan struct{}
-	id        string
-	container string
-	// mu guards exitCode and exitErr.
-	mu       sync.Mutex
-	once     sync.Once // guards done channel close
-	exitCode int
+	runner  Runner
+	logger  *slog.Logger
+	exitErr error
+	events  chan Event
+	done    chan struct{}
+	// subscribers are the channels returned by Subscribe; guarded by emitMu.
+	subscribers []chan Event
+	id          string
+	container   string
+	timing      SessionTiming
+	stopTimeout time.Duration // default StopWith timeout; zero uses sessionStopTimeout
+	// pipe carries output to the event goroutine; Resume writes to it
+	// alongside runFn. claudeArgs are the flags Resume adds to claude.
+	pipe       *io.PipeWriter
+	claudeArgs []string
+	// resumeMu serializes Resume calls.
+	resumeMu sync.Mutex
+	// annotations holds caller-supplied metadata; guarded by annotationsMu.
+	// onAnnotate is sessionConfig.onAnnotate.
+	annotations   map[string]string
+	annotationsMu sync.RWMutex
+	onAnnotate    func(map[string]string)
+	// mu guards exitCode, exitErr, removeContainer, killCalled, and timing.RunDuration.
+	mu sync.Mutex
+	// emitMu serializes sends on events and subscribers with their close, so that
+	// goroutines other than the event goroutine (e.g. the health monitor) never
+	// send on a closed channel.
+	emitMu sync.Mutex
+	once   sync.Once // guards done channel close
+	// stopping is closed by Stop and Kill so the container goroutine does not
+	// restart a container the caller asked to end.
+	stopping chan struct{}
+	stopOnce sync.Once // guards stopping channel close
+	// finishedAt, outputLines, droppedLines, and truncatedLines are written
+	// only by the event goroutine before done is closed, and read only after.
+	finishedAt     time.Time
+	outputLines    int64
+	droppedLines   int64
+	truncatedLines int64
+	exitCode       int
+	// lastOutput is when the container started or last wrote a line, in Unix
+	// nanoseconds, for the idle monitor.
+	lastOutput atomic.Int64
+	// output holds the captured output lines when capture is enabled, and is
+	// nil otherwise. outputFull is set once a line did not fit under
+	// maxOutputBytes; capture stops there. Both are guarded by outputMu.
+	output       *strings.Builder
+	outputMu     sync.Mutex
+	eventsClosed bool // guarded by emitMu
+	outputFull   bool
+	// awaitingStart is set while the session prepares a container and has not
+	// yet sent ContainerStarted; emitOutput then leaves lifecycleReserve slots
+	// of Events free. Guarded by emitMu.
+	awaitingStart bool
+	// removeContainer is set by the container goroutine when the event
+	// goroutine should remove the container after it exits.
+	removeContainer bool
+	// killCalled is set by Kill, so that a SIGKILL exit is not mistaken for
+	// Stop escalating past its timeout.
+	killCalled bool
 }
 
 // newSession creates a Session and starts its goroutines.
 //
 // The goroutine sequence:
-//  1. container goroutine: calls runFn, writes exitCode/exitErr under mutex, closes pipeWriter.
-//  2. event goroutine: reads lines from pipeReader, emits EventOutput, closes done, then emits terminal event.
+//  1. container goroutine: calls cfg.prepare if set, then runFn unless Stop or
+//     Kill was called during prepare, writes exitCode/exitErr under mutex,
+//     closes pipeWriter.
+//  2. event goroutine: reads lines from pipeReader, emits EventOutput (or EventMessage
+//     when cfg.parseStream is set), removes the container when cfg.removeOnExit
+//     is set and the container ran, closes done, then emits terminal event.
 //
 // done is closed before the terminal event is emitted, so Wait() never blocks on
 // event consumption. preamble events are emitted synchronously before goroutines start.
+// Events emitted by cfg.prepare precede all output, because runFn has not yet
+// written to the pipe while prepare runs.
+//
+// runFn is called with a context owned by the session, not the caller's, so
+// that the container outlives whatever context it was started with; only Stop
+// and Kill end it. The context is cancelled once the session has ended.
 func newSession(
 	id string,
 	container string,
 	runner Runner,
-	runFn func(pw io.WriteCloser) (int, error),
+	runFn func(ctx context.Context, pw io.WriteCloser) (int, error),
 	preamble []Event,
+	cfg sessionConfig,
 ) *Session {
 	s := &Session{
-		id:        id,
-		container: container,
-		runner:    runner,
-		events:    make(chan Event, eventChannelBuffer),
-		done:      make(chan struct{}),
+		id:          id,
+		container:   container,
+		runner:      runner,
+		timing:      SessionTiming{StartedAt: time.Now()},
+		stopTimeout: cfg.stopTimeout,
+		events:      make(chan Event, eventChannelBuffer),
+		done:        make(chan struct{}),
+		stopping:    make(chan struct{}),
+		logger:      cfg.logger,
+		claudeArgs:  cfg.claudeArgs,
+		annotations: maps.Clone(cfg.annotations),
+		onAnnotate:  cfg.onAnnotate,
+
+		awaitingStart: cfg.prepare != nil,
+	}
+	if s.logger == nil {
+		s.logger = slog.New(slog.DiscardHandler)
+	}
+	if cfg.captureOutput {
+		s.output = &strings.Builder{}
 	}
 
 	// Emit preamble lifecycle events synchronously before spawning goroutines.
@@ -67,17 +245,79 @@ func newSession(
 	}
 
 	pr, pw := io.Pipe()
+	s.pipe = pw
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	// committed is closed once the container goroutine has written the result.
+	committed := make(chan struct{})
 
-	// Container goroutine: runs the container, stores result, closes the pipe.
+	// Container goroutine: prepares and runs the container, stores result, closes the pipe.
 	go func() {
-		code, err := runFn(pw)
+		defer cancelRun()
+		var err error
+		if cfg.prepare != nil {
+			prepareStart := time.Now()
+			err = cfg.prepare(s.emitPrepare)
+			s.mu.Lock()
+			s.timing.BuildDuration = time.Since(prepareStart)
+			s.mu.Unlock()
+			if err == nil && s.stopRequested() {
+				// Stop or Kill was called before the container was created, and
+				// found nothing to signal; starting it now would leave one
+				// running that nobody is waiting to stop.
+				err = ErrStoppedBeforeStart
+				s.logger.Debug("stopped before the container started")
+			}
+		}
+
+		code := -1
+		var runDuration time.Duration
+		ran := err == nil
+		if ran {
+			runStart := time.Now()
+			s.logger.Debug("container started")
+			if cfg.idleTimeout > 0 {
+				s.lastOutput.Store(runStart.UnixNano())
+				go s.monitorIdle(cfg.idleTimeout)
+			}
+			if cfg.maxRuntime > 0 {
+				go s.enforceMaxRuntime(cfg.maxRuntime)
+			}
+			if cfg.onRun != nil {
+				cfg.onRun()
+			}
+			code, err = runFn(runCtx, pw)
+			for attempt := 1; err == nil && code != 0 && attempt <= cfg.restartMax; attempt++ {
+				if !s.waitRestart(cfg.restartBackoff) {
+					break
+				}
+				s.logger.Debug("container restarting", "code", code, "attempt", attempt)
+				s.emitOutput(Event{Type: EventRestart, Data: container, Code: code, Time: time.Now()})
+				if cfg.onRun != nil {
+					cfg.onRun()
+				}
+				code, err = runFn(runCtx, pw)
+			}
+			runDuration = time.Since(runStart)
+			if err != nil {
+				s.logger.Debug("container exited", "code", code, "error", err, "duration", runDuration)
+			} else {
+				s.logger.Debug("container exited", "code", code, "duration", runDuration)
+			}
+		}
 		// Write results under mutex before closing the pipe. Closing pw signals
 		// EOF to the event goroutine; by writing first, we guarantee the event
 		// goroutine observes committed values when it reads after EOF.
 		s.mu.Lock()
 		s.exitCode = code
 		s.exitErr = err
+		s.timing.RunDuration = runDuration
+		// A 125 may mean the name belongs to another session's container.
+		s.removeContainer = cfg.removeOnExit && ran && !errors.Is(err, ErrDockerRunFailed)
 		s.mu.Unlock()
+		close(committed)
+		if cfg.onExit != nil {
+			cfg.onExit(code, err, runDuration)
+		}
 		// PipeWriter.Close always returns nil, but the error is checked to satisfy errcheck.
 		_ = pw.Close()
 	}()
@@ -85,26 +325,97 @@ func newSession(
 	// Event goroutine: reads lines from pipeReader, emits events, then closes channel.
 	go func() {
 		scanner := bufio.NewScanner(pr)
+		maxLine := cfg.maxLineSize
+		if maxLine <= 0 {
+			maxLine = maxScanLine
+		}
+		scanner.Buffer(make([]byte, 0, min(64*1024, maxLine)), maxLine)
 		for scanner.Scan() {
-			s.emitOutput(Event{
+			line := scanner.Text()
+			if cfg.stripANSI {
+				line = stripANSI(line)
+			}
+			// The whole line is parsed and captured; only Data is truncated.
+			data, truncated := truncateLine(line, cfg.maxLineLength)
+			if truncated {
+				s.truncatedLines++
+			}
+			if cfg.parseStream {
+				if msg, ok := parseStreamLine(line); ok {
+					s.emitLine(Event{
+						Type:    EventMessage,
+						Data:    data,
+						Message: &msg,
+						Time:    time.Now(),
+					}, line)
+					continue
+				}
+			}
+			s.emitLine(Event{
 				Type: EventOutput,
-				Data: scanner.Text(),
+				Data: data,
 				Time: time.Now(),
-			})
+			}, line)
+		}
+		// A line over the scanner's limit, or a failed read, loses output:
+		// it becomes the session's error rather than passing for a clean end.
+		var outputErr error
+		if err := scanner.Err(); err != nil {
+			outputErr = fmt.Errorf("read output: %w", err)
+			if errors.Is(err, bufio.ErrTooLong) {
+				outputErr = fmt.Errorf("read output: %w (limit %d bytes)", err, maxLine)
+			}
+			s.logger.Warn("output read failed", "error", outputErr)
+			// Warn now, since the container may run on for a long while, and
+			// drain the rest so it is not blocked on its output.
+			s.emitOutput(Event{Type: EventWarning, Data: outputErr.Error() + "; the rest of the output is discarded", Time: time.Now()})
+			_, _ = io.Copy(io.Discard, pr)
 		}
 		// pipeReader is exhausted (EOF). Pipe closure is normal termination.
 		// PipeReader.Close always returns nil, but the error is checked to satisfy errcheck.
 		_ = pr.Close()
+		if s.droppedLines > 0 {
+			s.logger.Warn("output lines dropped", "count", s.droppedLines)
+		}
+		if s.truncatedLines > 0 {
+			s.logger.Warn("output lines truncated", "count", s.truncatedLines, "limit", cfg.maxLineLength)
+		}
+		if cfg.onOutputEnd != nil {
+			cfg.onOutputEnd(s.droppedLines)
+		}
 
-		// Read the result stored by the container goroutine. EOF guarantees the
-		// container goroutine has already committed exitCode/exitErr under its mutex.
+		// Read the result stored by the container goroutine. EOF follows the
+		// commit, but a failed read need not, so wait for it explicitly.
+		<-committed
 		s.mu.Lock()
+		if s.exitErr == nil && outputErr != nil {
+			s.exitErr = outputErr
+		}
 		code := s.exitCode
 		err := s.exitErr
+		remove := s.removeContainer
+		killCalled := s.killCalled
 		s.mu.Unlock()
 
+		// Inspect before removal, while the container's state is still there.
+		exited := EventContainerExited
+		if err == nil && !killCalled && s.stopEscalated(code) {
+			exited = EventContainerKilled
+		}
+
+		// The exit has been recorded; remove the container before Wait returns,
+		// so that the next Start can reuse its name. A failure is reported but
+		// does not change the session's result.
+		if remove {
+			if rmErr := s.runner.Remove(context.Background(), s.container, true); rmErr != nil {
+				s.logger.Warn("container remove failed", "error", rmErr)
+				s.emitOutput(Event{Type: EventError, Data: rmErr.Error(), Err: rmErr, Time: time.Now()})
+			}
+		}
+
 		// Signal Wait BEFORE emitting the terminal event. This ensures Wait()
 		// never deadlocks even if the event channel is full.
+		s.finishedAt = time.Now()
 		s.once.Do(func() { close(s.done) })
 
 		// Emit terminal event with a non-blocking send. If the channel is full,
@@ -115,26 +426,117 @@ func newSession(
 			terminal = Event{
 				Type: EventError,
 				Data: err.Error(),
+				Err:  err,
 				Time: time.Now(),
 			}
 		} else {
 			terminal = Event{
-				Type: EventContainerExited,
+				Type: exited,
 				Code: code,
 				Time: time.Now(),
 			}
+			if code != 0 {
+				terminal.Err = &ExitError{Code: code}
+			}
 		}
-		select {
-		case s.events <- terminal:
-		default:
-		}
-
+		s.emitMu.Lock()
+		s.broadcast(terminal)
 		close(s.events)
+		for _, ch := range s.subscribers {
+			close(ch)
+		}
+		s.eventsClosed = true
+		s.emitMu.Unlock()
 	}()
 
+	if cfg.healthInterval > 0 {
+		go s.monitorHealth(cfg.healthInterval)
+	}
+
 	return s
 }
 
+// monitorHealth polls the container's healthcheck status every interval and
+// emits EventHealthChanged whenever it changes. It returns when the session is done.
+// Empty statuses (no healthcheck) and inspect errors are ignored.
+func (s *Session) monitorHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		status, err := s.runner.Health(ctx, s.container)
+		cancel()
+		if err != nil || status == "" || status == last {
+			continue
+		}
+		last = status
+		s.emitOutput(Event{
+			Type: EventHealthChanged,
+			Data: status,
+			Time: time.Now(),
+		})
+	}
+}
+
+// monitorIdle stops the session once the container has written no output for
+// timeout, emitting an EventError wrapping ErrIdleTimeout first. It returns
+// when the session ends, so it never fires after the terminal event.
+func (s *Session) monitorIdle(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-timer.C:
+		}
+		idle := time.Since(time.Unix(0, s.lastOutput.Load()))
+		if idle < timeout {
+			timer.Reset(timeout - idle)
+			continue
+		}
+		s.logger.Warn("idle timeout", "timeout", timeout)
+		s.stopWithError(fmt.Errorf("%w: no output for %v", ErrIdleTimeout, timeout))
+		return
+	}
+}
+
+// enforceMaxRuntime stops the session once its container has run for limit,
+// emitting an EventError wrapping ErrMaxRuntimeExceeded first. It returns when
+// the session ends, so it never fires after the terminal event.
+func (s *Session) enforceMaxRuntime(limit time.Duration) {
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+		return
+	case <-timer.C:
+	}
+	s.logger.Warn("max runtime exceeded", "limit", limit)
+	s.stopWithError(fmt.Errorf("%w: ran for %v", ErrMaxRuntimeExceeded, limit))
+}
+
+// stopWithError emits err as an EventError and stops the session, as a
+// monitor that has given up on the container does. It does nothing if Stop or
+// Kill has already been called.
+func (s *Session) stopWithError(err error) {
+	if s.stopRequested() {
+		return
+	}
+	s.emitOutput(Event{Type: EventError, Data: err.Error(), Err: err, Time: time.Now()})
+	if err := s.Stop(context.Background()); err != nil {
+		s.logger.Warn("stop failed", "error", err)
+	}
+}
+
 // emitLifecycle sends a lifecycle event to the channel, blocking until delivered.
 // Used only for preamble events emitted synchronously before goroutines start,
 // when the channel buffer is empty and blocking is safe.
@@ -142,13 +544,197 @@ func (s *Session) emitLifecycle(e Event) {
 	s.events <- e
 }
 
-// emitOutput sends an output event to the channel. If the channel is full,
-// the event is dropped to avoid blocking the event goroutine indefinitely.
+// emitPrepare sends an event emitted while the session prepares its container,
+// or by a detached run reporting its start. BuildStarted, BuildComplete, and
+// ContainerStarted block until delivered on Events, as the preamble's do, and
+// are sent to subscribers without blocking. Any other event, such as a build
+// output line, is sent as by emitOutput, which keeps lifecycleReserve slots
+// free for them until ContainerStarted. Once Stop or Kill is called, a
+// lifecycle event no longer waits: the caller ending the session may have
+// stopped reading Events. Called only by the container goroutine, before it
+// closes the pipe, so the channels are still open.
+func (s *Session) emitPrepare(e Event) {
+	switch e.Type {
+	case EventBuildStarted, EventBuildComplete, EventContainerStarted:
+		select {
+		case s.events <- e:
+		case <-s.stopping:
+		}
+		s.emitMu.Lock()
+		if e.Type == EventContainerStarted {
+			s.awaitingStart = false
+		}
+		s.sendSubscribers(e)
+		s.emitMu.Unlock()
+		return
+	}
+	s.emitOutput(e)
+}
+
+// emitOutput sends an output event to the channel and every subscriber. If a
+// channel is full, the event is dropped for that channel only, to avoid blocking
+// the event goroutine indefinitely. Until ContainerStarted is sent, the last
+// lifecycleReserve slots of Events are left to lifecycle events, so that a
+// health change during a long build cannot block prepare. Events emitted after
+// the channels are closed are discarded.
 func (s *Session) emitOutput(e Event) {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	if s.eventsClosed {
+		return
+	}
+	if s.awaitingStart && len(s.events) >= cap(s.events)-lifecycleReserve {
+		s.sendSubscribers(e)
+		return
+	}
+	s.broadcast(e)
+}
+
+// emitLine is emitOutput for a line of container output, counting it in the
+// session result and capturing line, the output before any truncation of
+// e.Data. Called only by the event goroutine.
+func (s *Session) emitLine(e Event, line string) {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	s.outputLines++
+	s.lastOutput.Store(time.Now().UnixNano())
+	if !s.broadcast(e) {
+		s.droppedLines++
+	}
+	s.captureLine(line)
+}
+
+// truncateLine cuts line to at most limit bytes, backing off to a UTF-8
+// boundary, and appends a marker giving the line's full length. It reports
+// whether line was cut. A non-positive limit leaves every line whole.
+func truncateLine(line string, limit int) (string, bool) {
+	if limit <= 0 || len(line) <= limit {
+		return line, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… [truncated, %d bytes total]", line[:cut], len(line)), true
+}
+
+// captureLine appends line to the captured output, if capture is enabled and
+// the line fits under maxOutputBytes.
+func (s *Session) captureLine(line string) {
+	if s.output == nil {
+		return
+	}
+	s.outputMu.Lock()
+	defer s.outputMu.Unlock()
+	if s.outputFull {
+		return
+	}
+	n := len(line)
+	if s.output.Len() > 0 {
+		n++
+	}
+	if s.output.Len()+n > maxOutputBytes {
+		s.outputFull = true
+		return
+	}
+	if s.output.Len() > 0 {
+		s.output.WriteByte('\n')
+	}
+	s.output.WriteString(line)
+}
+
+// broadcast performs a non-blocking send of e on events and each subscriber,
+// reporting whether it was delivered on events. Must be called with emitMu held
+// and before the channels are closed.
+func (s *Session) broadcast(e Event) bool {
+	delivered := true
 	select {
 	case s.events <- e:
 	default:
-		// Channel full; drop this output event.
+		// Channel full; drop this event.
+		delivered = false
+	}
+	s.sendSubscribers(e)
+	return delivered
+}
+
+// sendSubscribers performs a non-blocking send of e on each subscriber. Must
+// be called with emitMu held and before the channels are closed.
+func (s *Session) sendSubscribers(e Event) {
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// waitRestart waits backoff before a restart. It reports false, meaning do not
+// restart, if Stop or Kill has been called.
+func (s *Session) waitRestart(backoff time.Duration) bool {
+	if s.stopRequested() {
+		return false
+	}
+	t := time.NewTimer(backoff)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-s.stopping:
+		return false
+	}
+}
+
+// markStopping records that the caller asked the container to end.
+func (s *Session) markStopping() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// stopEscalated reports whether a session that ended with code was ended by
+// Stop's SIGKILL escalation: Stop was called, and the container itself exited
+// by SIGKILL without being OOM killed.
+func (s *Session) stopEscalated(code int) bool {
+	if code != exitKilled || !s.stopRequested() {
+		return false
+	}
+	state, err := s.runner.Inspect(context.Background(), s.container)
+	return err == nil && !state.Running && !state.OOMKilled && state.ExitCode == exitKilled
+}
+
+// stopRequested reports whether Stop or Kill has been called.
+func (s *Session) stopRequested() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// awaitEnd blocks until the session ends or ctx expires, after Stop or Kill
+// has signalled the container. A signal sent in the window between Start
+// returning and docker run creating the container finds no container and is
+// lost, so awaitEnd polls the container and calls signal again if it is
+// running once the first signal has returned.
+func (s *Session) awaitEnd(ctx context.Context, signal func(context.Context) error) error {
+	ticker := time.NewTicker(stopRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			state, err := s.runner.Inspect(ctx, s.container)
+			if err != nil || !state.Running {
+				continue
+			}
+			s.logger.Debug("container still running; signalling again")
+			if err := signal(ctx); err != nil {
+				return err
+			}
+		}
 	}
 }
 
@@ -157,6 +743,197 @@ func (s *Session) ID() string {
 	return s.id
 }
 
+// Timing returns the session's phase timings. RunDuration is zero until the
+// container or exec has exited.
+func (s *Session) Timing() SessionTiming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timing
+}
+
+// Resume sends a follow-up prompt to the session's container, running
+// claude --resume -p prompt in it with the pod's claude flags, as
+// Dispatcher.Resume does. Unlike Dispatcher.Resume, the exec's output is
+// streamed through this session, on Events, Subscribe channels, and Output,
+// rather than a new Session. Resume blocks until the exec exits and returns
+// its exit code; a non-zero exit is returned with a nil error. ctx governs only
+// the exec.
+//
+// The container must still be running, so Resume suits pods whose container
+// outlives its first prompt, e.g. one whose entrypoint keeps it up once claude
+// exits; a container whose claude -p is its only process ends the session
+// when the prompt is done.
+// Once the session has ended, or Stop or Kill has been called, Resume returns
+// ErrSessionNotFound; use Dispatcher.Resume or a new Start instead. Stop and
+// Kill end any Resume in progress along with the container.
+//
+// Resume calls on one session run one at a time. Output written while the
+// container itself is writing is interleaved with it a line at a time.
+func (s *Session) Resume(ctx context.Context, prompt string) (int, error) {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	select {
+	case <-s.done:
+		return -1, fmt.Errorf("%w: session %s has ended", ErrSessionNotFound, s.id)
+	default:
+	}
+	if s.stopRequested() {
+		return -1, fmt.Errorf("%w: session %s is stopping", ErrSessionNotFound, s.id)
+	}
+
+	cmd := append([]string{"claude", "--resume", "-p", prompt}, s.claudeArgs...)
+	s.logger.Debug("resume started")
+	w := &lineWriter{w: s.pipe}
+	code, err := s.runner.Exec(ctx, s.container, cmd, w)
+	if ferr := w.flush(); err == nil && ferr != nil {
+		err = ferr
+	}
+	if err != nil {
+		s.logger.Debug("resume finished", "code", code, "error", err)
+	} else {
+		s.logger.Debug("resume finished", "code", code)
+	}
+	return code, err
+}
+
+// lineWriter passes what is written to it on to w a whole line per Write, so
+// its lines are not spliced into those of other writers sharing w.
+type lineWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// Write buffers p and writes each complete line it holds to w.
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if _, err := lw.w.Write(lw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		lw.buf = lw.buf[i+1:]
+	}
+}
+
+// flush writes a final line left without a newline, terminating it.
+func (lw *lineWriter) flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	_, err := lw.w.Write(append(lw.buf, '\n'))
+	lw.buf = nil
+	return err
+}
+
+// Output returns the output lines collected so far, joined by newlines, when
+// the Dispatcher was created with WithFullOutputCapture; otherwise it returns
+// "". Lines are captured whether or not they were delivered on Events, and in
+// full even where an event's Data was truncated. Capture stops at the first
+// line that would take the total past 16 MiB.
+func (s *Session) Output() string {
+	if s.output == nil {
+		return ""
+	}
+	s.outputMu.Lock()
+	defer s.outputMu.Unlock()
+	return s.output.String()
+}
+
+// Result returns a summary of the finished session. It reports false, with a
+// zero SessionResult, until the session has ended.
+func (s *Session) Result() (SessionResult, bool) {
+	select {
+	case <-s.done:
+	default:
+		return SessionResult{}, false
+	}
+	stopped := s.stopRequested()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionResult{
+		StartedAt:      s.timing.StartedAt,
+		FinishedAt:     s.finishedAt,
+		Err:            s.exitErr,
+		ExitCode:       s.exitCode,
+		OutputLines:    s.outputLines,
+		DroppedLines:   s.droppedLines,
+		TruncatedLines: s.truncatedLines,
+		Stopped:        stopped,
+	}, true
+}
+
+// SetAnnotation attaches a key/value pair to the session for caller bookkeeping
+// (e.g. a check-run ID or a UI panel binding). Setting an existing key replaces
+// its value. SetAnnotation is safe for concurrent use. For a session started
+// by a Dispatcher with WithSessionStore, the session's record is saved again
+// with the new annotations while the container runs.
+//
+// Returns ErrAnnotationLimit if the key is empty, the key or value exceeds its
+// size bound, or the session already carries the maximum number of annotations.
+func (s *Session) SetAnnotation(key, value string) error {
+	if err := checkAnnotation(key, value); err != nil {
+		return err
+	}
+
+	s.annotationsMu.Lock()
+	defer s.annotationsMu.Unlock()
+	if s.annotations == nil {
+		s.annotations = make(map[string]string)
+	}
+	if _, exists := s.annotations[key]; !exists && len(s.annotations) >= maxAnnotations {
+		return fmt.Errorf("%w: session already has %d annotations", ErrAnnotationLimit, maxAnnotations)
+	}
+	s.annotations[key] = value
+	if s.onAnnotate != nil {
+		s.onAnnotate(maps.Clone(s.annotations))
+	}
+	return nil
+}
+
+// checkAnnotation returns an error wrapping ErrAnnotationLimit if key is empty
+// or key or value exceeds its size bound.
+func checkAnnotation(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrAnnotationLimit)
+	}
+	if len(key) > maxAnnotationKeyLen {
+		return fmt.Errorf("%w: key %q exceeds %d bytes", ErrAnnotationLimit, key[:16]+"...", maxAnnotationKeyLen)
+	}
+	if len(value) > maxAnnotationValueLen {
+		return fmt.Errorf("%w: value for %q exceeds %d bytes", ErrAnnotationLimit, key, maxAnnotationValueLen)
+	}
+	return nil
+}
+
+// checkAnnotations applies the bounds SetAnnotation enforces to a whole set
+// of annotations, such as StartOptions.Annotations.
+func checkAnnotations(annotations map[string]string) error {
+	if len(annotations) > maxAnnotations {
+		return fmt.Errorf("%w: %d annotations exceed the limit of %d", ErrAnnotationLimit, len(annotations), maxAnnotations)
+	}
+	for k, v := range annotations {
+		if err := checkAnnotation(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Annotations returns a copy of the session's annotations. The returned map
+// is owned by the caller; modifying it does not affect the session.
+func (s *Session) Annotations() map[string]string {
+	s.annotationsMu.RLock()
+	defer s.annotationsMu.RUnlock()
+	out := make(map[string]string, len(s.annotations))
+	for k, v := range s.annotations {
+		out[k] = v
+	}
+	return out
+}
+
 // Events returns a receive-only channel of typed events. The channel is closed
 // after the terminal event (ContainerExited or Error). Callers may range over
 // this channel to consume the full event stream.
@@ -170,12 +947,55 @@ func (s *Session) Events() <-chan Event {
 	return s.events
 }
 
+// Subscribe returns a new channel that receives the session's events
+// independently of Events and of other subscribers, each with its own buffer.
+// A subscriber receives only events emitted after it subscribed; lifecycle
+// events from before the container started are not replayed. The channel is
+// closed after the terminal event, or immediately if the session has already
+// finished. Subscribe is safe for concurrent use.
+//
+// As with Events, a subscriber that falls behind has events dropped rather
+// than blocking the session.
+func (s *Session) Subscribe() <-chan Event {
+	ch := make(chan Event, eventChannelBuffer)
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	if s.eventsClosed {
+		close(ch)
+		return ch
+	}
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// StopOptions configures a graceful stop.
+type StopOptions struct {
+	// Signal is the signal sent to the container before the timeout elapses
+	// (e.g. "SIGINT"). Empty uses the container's stop signal, SIGTERM by default.
+	Signal string
+	// Timeout is how long to wait after Signal before sending SIGKILL.
+	// Zero uses the pod's stopTimeout, or 10 seconds if the pod sets none. Docker clamps values below one second to one second.
+	Timeout time.Duration
+}
+
 // Stop initiates graceful shutdown of the container. It calls runner.Stop with
-// a 10-second SIGTERM timeout, then blocks until the container goroutine exits
-// or ctx expires.
+// SIGTERM and the pod's stopTimeout (10 seconds by default), then blocks until
+// the container goroutine exits or ctx expires.
+//
+// When Stop returns nil, the exit has been recorded, so Wait returns the final
+// code and error without blocking; StopAndWait does both in one call.
 //
 // Stop is idempotent: calling it on an already-stopped session returns nil immediately.
 func (s *Session) Stop(ctx context.Context) error {
+	return s.StopWith(ctx, StopOptions{})
+}
+
+// StopWith initiates graceful shutdown of the container using the given signal
+// and timeout, then blocks until the container goroutine exits or ctx expires.
+// Zero-value fields in opts fall back to Stop's defaults.
+//
+// StopWith is idempotent: calling it on an already-stopped session returns nil immediately.
+func (s *Session) StopWith(ctx context.Context, opts StopOptions) error {
 	// If already done, return immediately.
 	select {
 	case <-s.done:
@@ -183,18 +1003,78 @@ func (s *Session) Stop(ctx context.Context) error {
 	default:
 	}
 
-	if err := s.runner.Stop(ctx, s.container, sessionStopTimeout); err != nil {
-		return fmt.Errorf("stop session %s: %w", s.id, err)
+	s.markStopping()
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = s.stopTimeout
+	}
+	if timeout == 0 {
+		timeout = sessionStopTimeout
+	}
+	s.logger.Debug("stop requested", "signal", opts.Signal, "timeout", timeout)
+
+	stop := func(ctx context.Context) error {
+		if err := s.runner.Stop(ctx, s.container, timeout, opts.Signal); err != nil {
+			return fmt.Errorf("stop session %s: %w", s.id, err)
+		}
+		return nil
+	}
+	if err := stop(ctx); err != nil {
+		return err
 	}
 
 	// Wait for the event goroutine to finish (done channel closes, then terminal
 	// event emitted, then events channel closed).
+	return s.awaitEnd(ctx, stop)
+}
+
+// StopAndWait stops the session as Stop does and returns its result as Wait
+// does. The exit code is the container's own: typically 143 if it exited on
+// SIGTERM, or 137 if Docker killed it when the stop timeout ran out. If Stop
+// fails, StopAndWait returns -1 and Stop's error without waiting.
+func (s *Session) StopAndWait(ctx context.Context) (int, error) {
+	if err := s.Stop(ctx); err != nil {
+		return -1, err
+	}
+	return s.Wait()
+}
+
+// StopWithTimeout is Stop with a per-call timeout, overriding the pod's
+// stopTimeout. A zero d behaves like Stop.
+func (s *Session) StopWithTimeout(ctx context.Context, d time.Duration) error {
+	return s.StopWith(ctx, StopOptions{Timeout: d})
+}
+
+// Kill terminates the container immediately with SIGKILL, without the graceful
+// SIGTERM period used by Stop, then blocks until the container goroutine exits
+// or ctx expires.
+//
+// Kill is idempotent: calling it on an already-stopped session returns nil immediately.
+func (s *Session) Kill(ctx context.Context) error {
+	// If already done, return immediately.
 	select {
 	case <-s.done:
 		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+	default:
+	}
+
+	s.mu.Lock()
+	s.killCalled = true
+	s.mu.Unlock()
+	s.markStopping()
+	s.logger.Debug("kill requested")
+
+	kill := func(ctx context.Context) error {
+		if err := s.runner.Kill(ctx, s.container); err != nil {
+			return fmt.Errorf("kill session %s: %w", s.id, err)
+		}
+		return nil
+	}
+	if err := kill(ctx); err != nil {
+		return err
 	}
+	return s.awaitEnd(ctx, kill)
 }
 
 // Wait blocks until the container exits and returns its exit code and any
@@ -3,10 +3,17 @@
 package cldpd
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -53,15 +60,15 @@ func waitForDone(t *testing.T, s *Session, timeout time.Duration) (int, error) {
 }
 
 // immediateRunFn returns a runFn that exits immediately with the given code/err.
-func immediateRunFn(code int, err error) func(pw io.WriteCloser) (int, error) {
-	return func(pw io.WriteCloser) (int, error) {
+func immediateRunFn(code int, err error) func(ctx context.Context, pw io.WriteCloser) (int, error) {
+	return func(_ context.Context, pw io.WriteCloser) (int, error) {
 		return code, err
 	}
 }
 
 // writingRunFn returns a runFn that writes lines to pw, then exits with code/err.
-func writingRunFn(lines []string, code int, err error) func(pw io.WriteCloser) (int, error) {
-	return func(pw io.WriteCloser) (int, error) {
+func writingRunFn(lines []string, code int, err error) func(ctx context.Context, pw io.WriteCloser) (int, error) {
+	return func(_ context.Context, pw io.WriteCloser) (int, error) {
 		for _, line := range lines {
 			fmt.Fprintln(pw, line)
 		}
@@ -70,15 +77,15 @@ func writingRunFn(lines []string, code int, err error) func(pw io.WriteCloser) (
 }
 
 // blockingRunFn returns a runFn that blocks until unblock is closed, then returns code/err.
-func blockingRunFn(unblock <-chan struct{}, code int, err error) func(pw io.WriteCloser) (int, error) {
-	return func(pw io.WriteCloser) (int, error) {
+func blockingRunFn(unblock <-chan struct{}, code int, err error) func(ctx context.Context, pw io.WriteCloser) (int, error) {
+	return func(_ context.Context, pw io.WriteCloser) (int, error) {
 		<-unblock
 		return code, err
 	}
 }
 
 func TestSession_ID(t *testing.T) {
-	s := newSession("test-session-id", "cldpd-test", &mockRunner{}, immediateRunFn(0, nil), nil)
+	s := newSession("test-session-id", "cldpd-test", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
 	if s.ID() != "test-session-id" {
 		t.Errorf("ID: got %q, want %q", s.ID(), "test-session-id")
 	}
@@ -87,7 +94,7 @@ func TestSession_ID(t *testing.T) {
 }
 
 func TestSession_Events_ReturnsChannel(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
 	ch := s.Events()
 	if ch == nil {
 		t.Fatal("Events() returned nil channel")
@@ -96,7 +103,7 @@ func TestSession_Events_ReturnsChannel(t *testing.T) {
 }
 
 func TestSession_NoPreamble_ContainerExited(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	if len(events) != 1 {
@@ -116,7 +123,7 @@ func TestSession_Preamble_EmittedFirst(t *testing.T) {
 		{Type: EventBuildComplete, Data: "cldpd-test", Time: time.Now()},
 		{Type: EventContainerStarted, Data: "ctn", Time: time.Now()},
 	}
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), preamble)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), preamble, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	// Expect: preamble(3) + ContainerExited(1) = 4
@@ -139,7 +146,7 @@ func TestSession_Preamble_EmittedFirst(t *testing.T) {
 
 func TestSession_Output_Events_InOrder(t *testing.T) {
 	lines := []string{"line one", "line two", "line three"}
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	// At minimum: 3 output events + 1 ContainerExited
@@ -161,7 +168,7 @@ func TestSession_Output_Events_InOrder(t *testing.T) {
 
 func TestSession_Output_BeforeTerminal(t *testing.T) {
 	lines := []string{"hello"}
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	// Last event must be ContainerExited, not output.
@@ -172,7 +179,7 @@ func TestSession_Output_BeforeTerminal(t *testing.T) {
 }
 
 func TestSession_NonZeroExit_ContainerExited_Code(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(42, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(42, nil), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	var exitEvent *Event
@@ -191,7 +198,7 @@ func TestSession_NonZeroExit_ContainerExited_Code(t *testing.T) {
 
 func TestSession_RunError_EmitsEventError(t *testing.T) {
 	runErr := errors.New("docker run: unexpected error")
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	var errEvent *Event
@@ -206,11 +213,47 @@ func TestSession_RunError_EmitsEventError(t *testing.T) {
 	if errEvent.Data == "" {
 		t.Error("EventError.Data: expected non-empty error message")
 	}
+	if !errors.Is(errEvent.Err, runErr) {
+		t.Errorf("EventError.Err: got %v, want %v", errEvent.Err, runErr)
+	}
+}
+
+func TestSession_NonZeroExit_EventCarriesExitError(t *testing.T) {
+	for _, code := range []int{1, 2, 137} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(code, nil), nil, sessionConfig{})
+			events := collectEvents(t, s.Events(), 2*time.Second)
+
+			last := events[len(events)-1]
+			if last.Type != EventContainerExited {
+				t.Fatalf("terminal event: got %v, want %v", last.Type, EventContainerExited)
+			}
+			if !errors.Is(last.Err, ErrContainerFailed) {
+				t.Errorf("Err: got %v, want ErrContainerFailed", last.Err)
+			}
+			var exitErr *ExitError
+			if !errors.As(last.Err, &exitErr) || exitErr.Code != code {
+				t.Errorf("Err: got %v, want an ExitError with code %d", last.Err, code)
+			}
+			// Wait keeps reporting a non-zero exit as a code, not an error.
+			if got, err := s.Wait(); got != code || err != nil {
+				t.Errorf("Wait: got (%d, %v), want (%d, nil)", got, err, code)
+			}
+		})
+	}
+}
+
+func TestSession_ZeroExit_EventHasNoErr(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	if last := events[len(events)-1]; last.Err != nil {
+		t.Errorf("Err: got %v, want nil", last.Err)
+	}
 }
 
 func TestSession_RunError_NoContainerExited(t *testing.T) {
 	runErr := errors.New("fatal error")
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	for _, e := range events {
@@ -221,7 +264,7 @@ func TestSession_RunError_NoContainerExited(t *testing.T) {
 }
 
 func TestSession_Channel_ClosedAfterTerminal(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
 	ch := s.Events()
 
 	// Drain all events; channel must be closed.
@@ -239,7 +282,7 @@ func TestSession_Channel_ClosedAfterTerminal(t *testing.T) {
 }
 
 func TestSession_Wait_ReturnsExitCode(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(7, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(7, nil), nil, sessionConfig{})
 	// Don't consume events; Wait must work independently.
 	code, err := waitForDone(t, s, 2*time.Second)
 	if err != nil {
@@ -252,7 +295,7 @@ func TestSession_Wait_ReturnsExitCode(t *testing.T) {
 
 func TestSession_Wait_ReturnsError(t *testing.T) {
 	runErr := errors.New("process failed")
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil, sessionConfig{})
 	_, err := waitForDone(t, s, 2*time.Second)
 	if !errors.Is(err, runErr) {
 		t.Errorf("Wait err: got %v, want %v", err, runErr)
@@ -261,7 +304,7 @@ func TestSession_Wait_ReturnsError(t *testing.T) {
 
 func TestSession_Wait_IndependentOfEvents(t *testing.T) {
 	// Call Wait without ever consuming Events; it must still return.
-	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
 	code, err := waitForDone(t, s, 2*time.Second)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -275,13 +318,13 @@ func TestSession_Stop_UnblocksWait(t *testing.T) {
 	unblock := make(chan struct{})
 	var stopCalled bool
 	r := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			stopCalled = true
 			close(unblock)
 			return nil
 		},
 	}
-	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil)
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
 
 	ctx := context.Background()
 	if err := s.Stop(ctx); err != nil {
@@ -306,7 +349,7 @@ func TestSession_Stop_UnblocksWait(t *testing.T) {
 func TestSession_Stop_Idempotent(t *testing.T) {
 	stopCount := 0
 	r := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			stopCount++
 			return nil
 		},
@@ -315,7 +358,7 @@ func TestSession_Stop_Idempotent(t *testing.T) {
 	// Use a different stop mock that also closes unblock.
 	unblockOnce := make(chan struct{})
 	r2 := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			stopCount++
 			select {
 			case <-unblockOnce:
@@ -328,7 +371,7 @@ func TestSession_Stop_Idempotent(t *testing.T) {
 	_ = r
 	_ = unblock
 
-	s := newSession("sid", "ctn", r2, blockingRunFn(unblockOnce, 0, nil), nil)
+	s := newSession("sid", "ctn", r2, blockingRunFn(unblockOnce, 0, nil), nil, sessionConfig{})
 
 	ctx := context.Background()
 	// First Stop.
@@ -351,13 +394,13 @@ func TestSession_Stop_PassesContainerName(t *testing.T) {
 	var stoppedContainer string
 	unblock := make(chan struct{})
 	r := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			stoppedContainer = container
 			close(unblock)
 			return nil
 		},
 	}
-	s := newSession("sid", "my-container", r, blockingRunFn(unblock, 0, nil), nil)
+	s := newSession("sid", "my-container", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
 	if err := s.Stop(context.Background()); err != nil {
 		t.Fatalf("Stop: %v", err)
 	}
@@ -375,12 +418,12 @@ func TestSession_Stop_ContextExpires(t *testing.T) {
 	neverUnblock := make(chan struct{}) // never closed
 
 	r := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			// Stop succeeds but the container goroutine won't exit.
 			return nil
 		},
 	}
-	s := newSession("sid", "ctn", r, blockingRunFn(neverUnblock, 0, nil), nil)
+	s := newSession("sid", "ctn", r, blockingRunFn(neverUnblock, 0, nil), nil, sessionConfig{})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
@@ -401,11 +444,11 @@ func TestSession_Stop_ContextExpires(t *testing.T) {
 func TestSession_Stop_RunnerError(t *testing.T) {
 	stopErr := fmt.Errorf("%w: exit code 1", ErrStopFailed)
 	r := &mockRunner{
-		stopFn: func(ctx context.Context, container string, timeout time.Duration) error {
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
 			return stopErr
 		},
 	}
-	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil)
+	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil, sessionConfig{})
 
 	// Wait for the session to finish naturally first so the events drain.
 	collectEvents(t, s.Events(), 2*time.Second)
@@ -417,7 +460,7 @@ func TestSession_Stop_RunnerError(t *testing.T) {
 }
 
 func TestSession_EventTime_NonZero(t *testing.T) {
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"hello"}, 0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"hello"}, 0, nil), nil, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 	for _, e := range events {
 		if e.Time.IsZero() {
@@ -438,7 +481,7 @@ func TestSession_EmitOutput_DropsWhenFull(t *testing.T) {
 		lines = append(lines, fmt.Sprintf("line %d", i))
 	}
 
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
 
 	// Drain concurrently so lifecycle events are never blocked.
 	events := collectEvents(t, s.Events(), 5*time.Second)
@@ -483,7 +526,7 @@ func TestSession_LifecycleEvents_NeverDropped(t *testing.T) {
 		{Type: EventBuildComplete, Data: "img", Time: time.Now()},
 		{Type: EventContainerStarted, Data: "ctn", Time: time.Now()},
 	}
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"line"}, 0, nil), preamble)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"line"}, 0, nil), preamble, sessionConfig{})
 	events := collectEvents(t, s.Events(), 2*time.Second)
 
 	typeCount := make(map[EventType]int)
@@ -512,7 +555,7 @@ func TestSession_Wait_ExitCode_NotStale_AfterHighVolume(t *testing.T) {
 		lines[i] = fmt.Sprintf("line %d", i)
 	}
 
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 42, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 42, nil), nil, sessionConfig{})
 	code, err := waitForDone(t, s, 5*time.Second)
 	if err != nil {
 		t.Errorf("Wait error: got %v, want nil", err)
@@ -531,7 +574,7 @@ func TestSession_Wait_DoesNotDeadlock_WhenEventsNotConsumed(t *testing.T) {
 		lines[i] = fmt.Sprintf("line %d", i)
 	}
 
-	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
 	// Deliberately do NOT call s.Events() — channel is never consumed.
 	code, err := waitForDone(t, s, 5*time.Second)
 	if err != nil {
@@ -541,3 +584,1698 @@ func TestSession_Wait_DoesNotDeadlock_WhenEventsNotConsumed(t *testing.T) {
 		t.Errorf("exit code: got %d, want 0", code)
 	}
 }
+
+func TestSession_Timing_RunDuration(t *testing.T) {
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		time.Sleep(20 * time.Millisecond)
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	timing := s.Timing()
+	if timing.StartedAt.IsZero() {
+		t.Error("StartedAt: got zero, want non-zero")
+	}
+	if timing.RunDuration < 20*time.Millisecond {
+		t.Errorf("RunDuration: got %v, want >= 20ms", timing.RunDuration)
+	}
+	if timing.BuildDuration != 0 {
+		t.Errorf("BuildDuration: got %v, want 0", timing.BuildDuration)
+	}
+}
+
+func TestSession_Prepare_TimedAsBuild(t *testing.T) {
+	cfg := sessionConfig{prepare: func(_ func(Event)) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}}
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, cfg)
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	if d := s.Timing().BuildDuration; d < 20*time.Millisecond {
+		t.Errorf("BuildDuration: got %v, want >= 20ms", d)
+	}
+}
+
+func TestSession_Prepare_EventsPrecedeOutput(t *testing.T) {
+	cfg := sessionConfig{prepare: func(emit func(Event)) error {
+		emit(Event{Type: EventBuildStarted, Time: time.Now()})
+		emit(Event{Type: EventBuildComplete, Time: time.Now()})
+		return nil
+	}}
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		fmt.Fprintln(pw, "out")
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, cfg)
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	want := []EventType{EventBuildStarted, EventBuildComplete, EventOutput, EventContainerExited}
+	if len(events) != len(want) {
+		t.Fatalf("events: got %v, want types %v", events, want)
+	}
+	for i, typ := range want {
+		if events[i].Type != typ {
+			t.Errorf("event[%d]: got type %d, want %d", i, events[i].Type, typ)
+		}
+	}
+}
+
+func TestSession_Prepare_ErrorSkipsRun(t *testing.T) {
+	prepErr := errors.New("build broke")
+	ran := false
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		ran = true
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{
+		prepare: func(_ func(Event)) error { return prepErr },
+	})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	code, err := waitForDone(t, s, 2*time.Second)
+
+	if ran {
+		t.Error("runFn called after prepare failed")
+	}
+	if !errors.Is(err, prepErr) || code != -1 {
+		t.Errorf("Wait: got (%d, %v), want (-1, %v)", code, err, prepErr)
+	}
+	if len(events) != 1 || events[0].Type != EventError {
+		t.Errorf("events: got %v, want a single Error", events)
+	}
+	if s.Timing().RunDuration != 0 {
+		t.Errorf("RunDuration: got %v, want 0", s.Timing().RunDuration)
+	}
+}
+
+func TestSession_Prepare_HealthLeavesLifecycleReserve(t *testing.T) {
+	// More health changes than Events holds arrive during the build.
+	filled := make(chan struct{})
+	var polls atomic.Int32
+	r := &mockRunner{
+		healthFn: func(context.Context, string) (string, error) {
+			n := polls.Add(1)
+			if n == eventChannelBuffer+10 {
+				close(filled)
+			}
+			return fmt.Sprint(n), nil
+		},
+	}
+	cfg := sessionConfig{
+		healthInterval: time.Millisecond,
+		prepare: func(emit func(Event)) error {
+			emit(Event{Type: EventBuildStarted, Time: time.Now()})
+			select {
+			case <-filled:
+			case <-time.After(5 * time.Second):
+				return errors.New("health monitor never filled the buffer")
+			}
+			emit(Event{Type: EventBuildComplete, Time: time.Now()})
+			emit(Event{Type: EventContainerStarted, Time: time.Now()})
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil, cfg)
+
+	// Nobody reads Events until the session has ended.
+	if _, err := waitForDone(t, s, 10*time.Second); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	var types []EventType
+	for _, e := range collectEvents(t, s.Events(), 2*time.Second) {
+		if e.Type != EventHealthChanged {
+			types = append(types, e.Type)
+		}
+	}
+	want := []EventType{EventBuildStarted, EventBuildComplete, EventContainerStarted}
+	if len(types) < len(want) || !slices.Equal(types[:len(want)], want) {
+		t.Errorf("lifecycle events: got %v, want %v first", types, want)
+	}
+}
+
+func TestSession_Prepare_StopUnblocksLifecycle(t *testing.T) {
+	var runs atomic.Int32
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		runs.Add(1)
+		return 0, nil
+	}
+	// One more lifecycle event than Events holds, with nobody reading.
+	prepare := func(emit func(Event)) error {
+		for range eventChannelBuffer + 1 {
+			emit(Event{Type: EventBuildStarted, Time: time.Now()})
+		}
+		return nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{prepare: prepare})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if _, err := waitForDone(t, s, 2*time.Second); !errors.Is(err, ErrStoppedBeforeStart) {
+		t.Errorf("Wait: got %v, want ErrStoppedBeforeStart", err)
+	}
+	if runs.Load() != 0 {
+		t.Errorf("runFn called %d times after Stop during prepare, want 0", runs.Load())
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Timing_RunDurationZeroWhileRunning(t *testing.T) {
+	unblock := make(chan struct{})
+	s := newSession("sid", "ctn", &mockRunner{}, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
+
+	if d := s.Timing().RunDuration; d != 0 {
+		t.Errorf("RunDuration while running: got %v, want 0", d)
+	}
+
+	close(unblock)
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+}
+
+func TestSession_Result_CleanExit(t *testing.T) {
+	lines := []string{"one", "two", "three"}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	res, ok := s.Result()
+	if !ok {
+		t.Fatal("Result: got ok=false after session ended")
+	}
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Errorf("exit: got (%d, %v), want (0, nil)", res.ExitCode, res.Err)
+	}
+	if res.OutputLines != 3 {
+		t.Errorf("OutputLines: got %d, want 3", res.OutputLines)
+	}
+	if res.DroppedLines != 0 {
+		t.Errorf("DroppedLines: got %d, want 0", res.DroppedLines)
+	}
+	if res.Stopped {
+		t.Error("Stopped: got true, want false")
+	}
+	if res.StartedAt.IsZero() || res.FinishedAt.Before(res.StartedAt) {
+		t.Errorf("times: started %v, finished %v", res.StartedAt, res.FinishedAt)
+	}
+}
+
+func TestSession_Result_ErrorExit(t *testing.T) {
+	runErr := errors.New("run failed")
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(-1, runErr), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	res, ok := s.Result()
+	if !ok {
+		t.Fatal("Result: got ok=false after session ended")
+	}
+	if res.ExitCode != -1 || !errors.Is(res.Err, runErr) {
+		t.Errorf("exit: got (%d, %v), want (-1, %v)", res.ExitCode, res.Err, runErr)
+	}
+	if res.Stopped {
+		t.Error("Stopped: got true, want false")
+	}
+}
+
+func TestSession_Result_Stopped(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{})
+
+	if _, ok := s.Result(); ok {
+		t.Error("Result while running: got ok=true, want false")
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	res, ok := s.Result()
+	if !ok {
+		t.Fatal("Result: got ok=false after session ended")
+	}
+	if !res.Stopped {
+		t.Error("Stopped: got false, want true")
+	}
+	if res.ExitCode != 143 {
+		t.Errorf("ExitCode: got %d, want 143", res.ExitCode)
+	}
+}
+
+func TestSession_Result_CountsDroppedLines(t *testing.T) {
+	lineCount := eventChannelBuffer + 10
+	lines := make([]string, lineCount)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
+
+	// Nothing consumes Events until the session is done, so the buffer fills.
+	waitForDone(t, s, 5*time.Second)
+	res, ok := s.Result()
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	if !ok {
+		t.Fatal("Result: got ok=false after session ended")
+	}
+	if res.OutputLines != int64(lineCount) {
+		t.Errorf("OutputLines: got %d, want %d", res.OutputLines, lineCount)
+	}
+	if res.DroppedLines != 10 {
+		t.Errorf("DroppedLines: got %d, want 10", res.DroppedLines)
+	}
+}
+
+func TestSession_MaxLineLength_TruncatesData(t *testing.T) {
+	const limit = 64
+	under := strings.Repeat("a", limit-1)
+	at := strings.Repeat("b", limit)
+	over := strings.Repeat("c", 1<<20)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{under, at, over}, 0, nil), nil,
+		sessionConfig{maxLineLength: limit, captureOutput: true})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %v", len(events), events)
+	}
+	if events[0].Data != under {
+		t.Errorf("line under the limit: got %d bytes, want it whole", len(events[0].Data))
+	}
+	if events[1].Data != at {
+		t.Errorf("line at the limit: got %d bytes, want it whole", len(events[1].Data))
+	}
+	if want := strings.Repeat("c", limit) + "… [truncated, 1048576 bytes total]"; events[2].Data != want {
+		t.Errorf("line over the limit: got %q, want %q", events[2].Data, want)
+	}
+	if got, want := s.Output(), strings.Join([]string{under, at, over}, "\n"); got != want {
+		t.Errorf("Output: got %d bytes, want %d with the long line whole", len(got), len(want))
+	}
+	res, _ := s.Result()
+	if res.TruncatedLines != 1 || res.OutputLines != 3 {
+		t.Errorf("Result: got TruncatedLines=%d OutputLines=%d, want 1 and 3", res.TruncatedLines, res.OutputLines)
+	}
+}
+
+func TestSession_LongLineDelivered(t *testing.T) {
+	// Longer than bufio.Scanner's 64 KiB default token size.
+	long := strings.Repeat("x", 256<<10)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{long, "after"}, 0, nil), nil,
+		sessionConfig{captureOutput: true})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if len(events) != 3 || events[1].Data != "after" || events[2].Type != EventContainerExited {
+		t.Fatalf("got %d events, want both lines and the exit", len(events))
+	}
+	if !strings.HasPrefix(s.Output(), long) {
+		t.Errorf("Output: got %d bytes, want the long line whole", len(s.Output()))
+	}
+}
+
+func TestSession_MaxLineSize_Exceeded(t *testing.T) {
+	const limit = 128
+	over := strings.Repeat("x", 2*limit)
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"first", over, "after"}, 2, nil), nil,
+		sessionConfig{maxLineSize: limit})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %v", len(events), events)
+	}
+	if events[0].Type != EventOutput || events[0].Data != "first" {
+		t.Errorf("event[0]: got %+v, want the line before the long one", events[0])
+	}
+	if events[1].Type != EventWarning || !strings.Contains(events[1].Data, "rest of the output is discarded") {
+		t.Errorf("event[1]: got %+v, want a warning that output is discarded", events[1])
+	}
+	// The rest of the output is drained, so the container runs to its exit,
+	// but the session ends with the error rather than a clean exit.
+	if events[2].Type != EventError || !errors.Is(events[2].Err, bufio.ErrTooLong) {
+		t.Errorf("event[2]: got %+v, want an error wrapping bufio.ErrTooLong", events[2])
+	}
+	if code, err := waitForDone(t, s, 2*time.Second); code != 2 || !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("Wait: got (%d, %v), want (2, bufio.ErrTooLong)", code, err)
+	}
+}
+
+func TestSession_OutputReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		fmt.Fprintln(pw, "before")
+		// The event goroutine's next read fails.
+		_ = pw.(*io.PipeWriter).CloseWithError(errRead)
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	last := events[len(events)-1]
+	if last.Type != EventError || !errors.Is(last.Err, errRead) {
+		t.Errorf("terminal event: got %+v, want an error wrapping the read error", last)
+	}
+	if code, err := waitForDone(t, s, 2*time.Second); code != 0 || !errors.Is(err, errRead) {
+		t.Errorf("Wait: got (%d, %v), want (0, the read error)", code, err)
+	}
+	if res, _ := s.Result(); !errors.Is(res.Err, errRead) {
+		t.Errorf("Result.Err: got %v, want the read error", res.Err)
+	}
+}
+
+func TestSession_MaxLineLength_ParsesWholeMessage(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"` +
+		strings.Repeat("x", 1024) + `"}]}}`
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{line}, 0, nil), nil,
+		sessionConfig{maxLineLength: 32, parseStream: true})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if len(events) != 2 || events[0].Type != EventMessage || events[0].Message == nil {
+		t.Fatalf("got %v, want a Message and the terminal event", events)
+	}
+	if !strings.HasPrefix(events[0].Data, line[:32]+"… [truncated,") {
+		t.Errorf("Data: got %q, want the line cut at 32 bytes", events[0].Data)
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		limit     int
+		want      string
+		truncated bool
+	}{
+		{"disabled", "abcdef", 0, "abcdef", false},
+		{"under", "abc", 4, "abc", false},
+		{"at", "abcd", 4, "abcd", false},
+		{"over", "abcdef", 4, "abcd… [truncated, 6 bytes total]", true},
+		// "é" is two bytes; cutting after its first byte backs off before it.
+		{"rune boundary", "abcé", 4, "abc… [truncated, 5 bytes total]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateLine(tt.line, tt.limit)
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("truncateLine(%q, %d): got %q, %v; want %q, %v", tt.line, tt.limit, got, truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestSession_RemoveOnExit_BeforeWaitAndTerminalEvent(t *testing.T) {
+	var removed string
+	r := &mockRunner{
+		removeFn: func(_ context.Context, container string, _ bool) error {
+			removed = container
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, writingRunFn([]string{"out"}, 0, nil), nil, sessionConfig{removeOnExit: true})
+
+	// Wait returns only after the container has been removed.
+	waitForDone(t, s, 2*time.Second)
+	if removed != "ctn" {
+		t.Errorf("removed: got %q, want %q", removed, "ctn")
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	if last := events[len(events)-1]; last.Type != EventContainerExited {
+		t.Errorf("last event: got %v, want ContainerExited", last.Type)
+	}
+}
+
+func TestSession_RemoveOnExit_FailureIsNotTerminal(t *testing.T) {
+	r := &mockRunner{
+		removeFn: func(_ context.Context, container string, _ bool) error {
+			return fmt.Errorf("%w: exit code 1: device busy", ErrRemoveFailed)
+		},
+	}
+	s := newSession("sid", "ctn", r, writingRunFn([]string{"out"}, 3, nil), nil, sessionConfig{removeOnExit: true})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	code, err := waitForDone(t, s, 2*time.Second)
+
+	if code != 3 || err != nil {
+		t.Errorf("Wait: got (%d, %v), want (3, nil)", code, err)
+	}
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []EventType{EventOutput, EventError, EventContainerExited}
+	if !slices.Equal(types, want) {
+		t.Fatalf("events: got %v, want %v", types, want)
+	}
+	if !strings.Contains(events[1].Data, "container remove failed") {
+		t.Errorf("EventError.Data: got %q", events[1].Data)
+	}
+	if events[2].Code != 3 {
+		t.Errorf("ContainerExited.Code: got %d, want 3", events[2].Code)
+	}
+}
+
+func TestSession_RemoveOnExit_Skipped(t *testing.T) {
+	tests := []struct {
+		cfg   sessionConfig
+		runFn func(ctx context.Context, pw io.WriteCloser) (int, error)
+		name  string
+	}{
+		{
+			name:  "disabled",
+			cfg:   sessionConfig{},
+			runFn: immediateRunFn(0, nil),
+		},
+		{
+			name:  "prepare failed",
+			cfg:   sessionConfig{removeOnExit: true, prepare: func(func(Event)) error { return ErrBuildFailed }},
+			runFn: immediateRunFn(0, nil),
+		},
+		{
+			name:  "docker run failed",
+			cfg:   sessionConfig{removeOnExit: true},
+			runFn: immediateRunFn(-1, fmt.Errorf("%w: name already in use", ErrDockerRunFailed)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mockRunner{
+				removeFn: func(context.Context, string, bool) error {
+					t.Error("Remove called")
+					return nil
+				},
+			}
+			s := newSession("sid", "ctn", r, tt.runFn, nil, tt.cfg)
+			collectEvents(t, s.Events(), 2*time.Second)
+			waitForDone(t, s, 2*time.Second)
+		})
+	}
+}
+
+func TestSession_Output_JoinsLines(t *testing.T) {
+	lines := []string{"one", "two", "three"}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{captureOutput: true})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	if got, want := s.Output(), strings.Join(lines, "\n"); got != want {
+		t.Errorf("Output: got %q, want %q", got, want)
+	}
+}
+
+func TestSession_Output_DisabledByDefault(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn([]string{"one"}, 0, nil), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	if got := s.Output(); got != "" {
+		t.Errorf("Output without capture: got %q, want empty", got)
+	}
+}
+
+func TestSession_Output_IncludesDroppedLines(t *testing.T) {
+	lines := make([]string, eventChannelBuffer+10)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{captureOutput: true})
+
+	// Nothing consumes Events until the session is done, so lines are dropped.
+	waitForDone(t, s, 5*time.Second)
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	if got, want := s.Output(), strings.Join(lines, "\n"); got != want {
+		t.Errorf("Output: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestSession_CaptureLine_StopsAtLimit(t *testing.T) {
+	s := &Session{output: &strings.Builder{}}
+	s.captureLine(strings.Repeat("x", maxOutputBytes-2))
+	s.captureLine("yy") // does not fit with its separator
+	s.captureLine("z")  // would fit, but capture has stopped
+
+	if got := s.Output(); len(got) != maxOutputBytes-2 || strings.ContainsAny(got, "yz") {
+		t.Errorf("Output: got %d bytes, want only the first line", len(got))
+	}
+}
+
+func TestSession_StopDuringPrepare_SkipsRun(t *testing.T) {
+	stopCalled := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			// The container does not exist yet, as with docker's "No such container".
+			close(stopCalled)
+			return nil
+		},
+	}
+	var runs atomic.Int32
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		runs.Add(1)
+		return 0, nil
+	}
+	prepare := func(func(Event)) error {
+		<-stopCalled
+		return nil
+	}
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{prepare: prepare, removeOnExit: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	code, err := waitForDone(t, s, 2*time.Second)
+	if !errors.Is(err, ErrStoppedBeforeStart) {
+		t.Errorf("Wait: got %v, want ErrStoppedBeforeStart", err)
+	}
+	if code != -1 {
+		t.Errorf("code: got %d, want -1", code)
+	}
+	if runs.Load() != 0 {
+		t.Errorf("runFn called %d times after Stop during prepare, want 0", runs.Load())
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Stop_RetriesWhenContainerStartsLate(t *testing.T) {
+	for _, kill := range []bool{false, true} {
+		name := "Stop"
+		if kill {
+			name = "Kill"
+		}
+		t.Run(name, func(t *testing.T) {
+			var (
+				created atomic.Bool
+				calls   atomic.Int32
+			)
+			unblock := make(chan struct{})
+			signal := func() {
+				// A signal sent before the container exists finds nothing.
+				if calls.Add(1) > 1 && created.Load() {
+					close(unblock)
+				}
+			}
+			r := &mockRunner{
+				stopFn: func(context.Context, string, time.Duration, string) error {
+					signal()
+					return nil
+				},
+				killFn: func(context.Context, string) error {
+					signal()
+					return nil
+				},
+				inspectFn: func(context.Context, string) (ContainerState, error) {
+					if !created.Load() {
+						return ContainerState{}, ErrSessionNotFound
+					}
+					return ContainerState{Running: true}, nil
+				},
+			}
+			runFn := func(context.Context, io.WriteCloser) (int, error) {
+				// docker run takes a while to create the container.
+				time.Sleep(50 * time.Millisecond)
+				created.Store(true)
+				<-unblock
+				return 143, nil
+			}
+			s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			var err error
+			if kill {
+				err = s.Kill(ctx)
+			} else {
+				err = s.Stop(ctx)
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if calls.Load() < 2 {
+				t.Errorf("runner calls: got %d, want the signal repeated once the container started", calls.Load())
+			}
+			if code, _ := waitForDone(t, s, 2*time.Second); code != 143 {
+				t.Errorf("code: got %d, want 143", code)
+			}
+			collectEvents(t, s.Events(), 2*time.Second)
+		})
+	}
+}
+
+// ignoresTerm returns a runner whose Stop and Kill end runFn's container with
+// SIGKILL, as Docker does to an agent that ignores SIGTERM once Stop's timeout
+// runs out, and the runFn for that container.
+func ignoresTerm() (*mockRunner, func(context.Context, io.WriteCloser) (int, error)) {
+	unblock := make(chan struct{})
+	var once sync.Once
+	sigkill := func() { once.Do(func() { close(unblock) }) }
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			sigkill()
+			return nil
+		},
+		killFn: func(context.Context, string) error {
+			sigkill()
+			return nil
+		},
+		inspectFn: func(context.Context, string) (ContainerState, error) {
+			return ContainerState{ExitCode: exitKilled}, nil
+		},
+	}
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		<-unblock
+		return exitKilled, nil
+	}
+	return r, runFn
+}
+
+func TestSession_Stop_EscalatedEmitsContainerKilled(t *testing.T) {
+	r, runFn := ignoresTerm()
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	last := events[len(events)-1]
+	if last.Type != EventContainerKilled {
+		t.Fatalf("terminal event: got %v, want %v", last.Type, EventContainerKilled)
+	}
+	if last.Code != exitKilled {
+		t.Errorf("code: got %d, want %d", last.Code, exitKilled)
+	}
+	if n := countEvents(events, EventContainerExited); n != 0 {
+		t.Errorf("ContainerExited events: got %d, want 0", n)
+	}
+}
+
+func TestSession_Kill_EmitsContainerExited(t *testing.T) {
+	r, runFn := ignoresTerm()
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{})
+
+	if err := s.Kill(context.Background()); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	if last := events[len(events)-1]; last.Type != EventContainerExited {
+		t.Errorf("terminal event: got %v, want %v", last.Type, EventContainerExited)
+	}
+}
+
+func TestSession_Stop_GracefulEmitsContainerExited(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			close(unblock)
+			return nil
+		},
+		inspectFn: func(context.Context, string) (ContainerState, error) {
+			return ContainerState{ExitCode: 143}, nil
+		},
+	}
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		<-unblock
+		return 143, nil
+	}
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	if last := events[len(events)-1]; last.Type != EventContainerExited {
+		t.Errorf("terminal event: got %v, want %v", last.Type, EventContainerExited)
+	}
+}
+
+func TestSession_Stop_LogsRequest(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			close(unblock)
+			return nil
+		},
+	}
+	h := newRecordingHandler()
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{logger: slog.New(h)})
+
+	if err := s.StopWith(context.Background(), StopOptions{Signal: "SIGINT"}); err != nil {
+		t.Fatalf("StopWith: %v", err)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	level, attrs, ok := h.find("stop requested")
+	if !ok {
+		t.Fatal("no stop requested record")
+	}
+	if level != slog.LevelDebug {
+		t.Errorf("level: got %v, want Debug", level)
+	}
+	if attrs["signal"] != "SIGINT" || attrs["timeout"] == "" {
+		t.Errorf("attrs: got %v, want signal SIGINT and a timeout", attrs)
+	}
+}
+
+func TestSession_RunContext_CancelledAfterEnd(t *testing.T) {
+	got := make(chan context.Context, 1)
+	runFn := func(ctx context.Context, _ io.WriteCloser) (int, error) {
+		got <- ctx
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{})
+	waitForDone(t, s, 2*time.Second)
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	select {
+	case <-(<-got).Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("run context not cancelled after the session ended")
+	}
+}
+
+func TestSession_StopAndWait(t *testing.T) {
+	t.Run("honors SIGTERM", func(t *testing.T) {
+		unblock := make(chan struct{})
+		r := &mockRunner{
+			stopFn: func(context.Context, string, time.Duration, string) error {
+				close(unblock)
+				return nil
+			},
+		}
+		s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{})
+
+		code, err := s.StopAndWait(context.Background())
+		if code != 143 || err != nil {
+			t.Errorf("StopAndWait: got (%d, %v), want (143, nil)", code, err)
+		}
+		collectEvents(t, s.Events(), 2*time.Second)
+	})
+
+	t.Run("ignores SIGTERM", func(t *testing.T) {
+		r, runFn := ignoresTerm()
+		s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{})
+
+		code, err := s.StopAndWait(context.Background())
+		if code != exitKilled || err != nil {
+			t.Errorf("StopAndWait: got (%d, %v), want (%d, nil)", code, err, exitKilled)
+		}
+		collectEvents(t, s.Events(), 2*time.Second)
+	})
+
+	t.Run("stop fails", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		r := &mockRunner{
+			stopFn: func(context.Context, string, time.Duration, string) error {
+				return ErrStopFailed
+			},
+		}
+		s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
+
+		code, err := s.StopAndWait(context.Background())
+		if code != -1 || !errors.Is(err, ErrStopFailed) {
+			t.Errorf("StopAndWait: got (%d, %v), want (-1, ErrStopFailed)", code, err)
+		}
+	})
+}
+
+func TestSession_Stop_WaitReturnsImmediately(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("Stop returned before the exit was recorded")
+	}
+	if code, _ := s.Wait(); code != 143 {
+		t.Errorf("code: got %d, want 143", code)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Kill_UnblocksWait(t *testing.T) {
+	unblock := make(chan struct{})
+	var killedContainer string
+	r := &mockRunner{
+		killFn: func(ctx context.Context, container string) error {
+			killedContainer = container
+			close(unblock)
+			return nil
+		},
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
+			t.Error("runner.Stop must not be called by Kill")
+			return nil
+		},
+	}
+	s := newSession("sid", "my-container", r, blockingRunFn(unblock, 137, nil), nil, sessionConfig{})
+
+	if err := s.Kill(context.Background()); err != nil {
+		t.Fatalf("Kill returned error: %v", err)
+	}
+	if killedContainer != "my-container" {
+		t.Errorf("Kill container: got %q, want %q", killedContainer, "my-container")
+	}
+
+	code, err := waitForDone(t, s, 2*time.Second)
+	if err != nil {
+		t.Errorf("Wait after Kill: unexpected error: %v", err)
+	}
+	if code != 137 {
+		t.Errorf("Wait after Kill: code got %d, want 137", code)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Kill_Idempotent(t *testing.T) {
+	killCount := 0
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		killFn: func(ctx context.Context, container string) error {
+			killCount++
+			select {
+			case <-unblock:
+			default:
+				close(unblock)
+			}
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 137, nil), nil, sessionConfig{})
+
+	ctx := context.Background()
+	if err := s.Kill(ctx); err != nil {
+		t.Fatalf("first Kill: %v", err)
+	}
+	if err := s.Kill(ctx); err != nil {
+		t.Fatalf("second Kill: %v", err)
+	}
+	if killCount != 1 {
+		t.Errorf("runner.Kill called %d times, want 1", killCount)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Resume_StreamsThroughSession(t *testing.T) {
+	unblock := make(chan struct{})
+	var gotContainer string
+	var gotCmd []string
+	r := &mockRunner{
+		execFn: func(_ context.Context, container string, cmd []string, stdout io.Writer) (int, error) {
+			gotContainer, gotCmd = container, cmd
+			fmt.Fprint(stdout, "follow-up one\nfollow-up ")
+			fmt.Fprint(stdout, "two")
+			return 3, nil
+		},
+	}
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		fmt.Fprintln(pw, "first run")
+		<-unblock
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{claudeArgs: []string{"--output-format", "text"}, captureOutput: true})
+
+	first := <-s.Events()
+	if first.Type != EventOutput || first.Data != "first run" {
+		t.Fatalf("first event: got %v %q, want the run's output", first.Type, first.Data)
+	}
+	code, err := s.Resume(context.Background(), "keep going")
+	if err != nil || code != 3 {
+		t.Fatalf("Resume: got %d, %v; want 3, nil", code, err)
+	}
+	close(unblock)
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if gotContainer != "ctn" {
+		t.Errorf("exec container: got %q, want ctn", gotContainer)
+	}
+	wantCmd := []string{"claude", "--resume", "-p", "keep going", "--output-format", "text"}
+	if !slices.Equal(gotCmd, wantCmd) {
+		t.Errorf("exec cmd: got %v, want %v", gotCmd, wantCmd)
+	}
+	if len(events) != 3 || events[0].Data != "follow-up one" || events[1].Data != "follow-up two" ||
+		events[2].Type != EventContainerExited {
+		t.Fatalf("events after Resume: got %v, want two output lines then ContainerExited", events)
+	}
+	if got, want := s.Output(), "first run\nfollow-up one\nfollow-up two"; got != want {
+		t.Errorf("Output: got %q, want %q", got, want)
+	}
+	if res, _ := s.Result(); res.OutputLines != 3 {
+		t.Errorf("OutputLines: got %d, want 3", res.OutputLines)
+	}
+}
+
+func TestSession_Resume_AfterEnd(t *testing.T) {
+	r := &mockRunner{
+		execFn: func(context.Context, string, []string, io.Writer) (int, error) {
+			t.Error("Exec called after the session ended")
+			return 0, nil
+		},
+	}
+	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	if _, err := s.Resume(context.Background(), "again"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Resume after end: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSession_Resume_AfterStop(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			close(unblock)
+			return nil
+		},
+		execFn: func(context.Context, string, []string, io.Writer) (int, error) {
+			t.Error("Exec called after Stop")
+			return 0, nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{})
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if _, err := s.Resume(context.Background(), "again"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Resume after Stop: got %v, want ErrSessionNotFound", err)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestLineWriter_WholeLines(t *testing.T) {
+	rec := &writeRecorder{}
+	w := &lineWriter{w: rec}
+	fmt.Fprint(w, "a\nb")
+	fmt.Fprint(w, "c\nd\n")
+	fmt.Fprint(w, "e")
+	if err := w.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if want := []string{"a\n", "bc\n", "d\n", "e\n"}; !slices.Equal(rec.writes, want) {
+		t.Errorf("writes: got %q, want %q", rec.writes, want)
+	}
+}
+
+// writeRecorder records each Write call separately.
+type writeRecorder struct{ writes []string }
+
+func (r *writeRecorder) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func TestSession_IdleTimeout_StopsSilentContainer(t *testing.T) {
+	unblock := make(chan struct{})
+	var stopCalls atomic.Int32
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			if stopCalls.Add(1) == 1 {
+				close(unblock)
+			}
+			return nil
+		},
+	}
+	start := time.Now()
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 143, nil), nil, sessionConfig{idleTimeout: 50 * time.Millisecond})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if stopCalls.Load() != 1 {
+		t.Fatalf("Stop calls: got %d, want 1", stopCalls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("stopped after %v, before the idle window", elapsed)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want EventError and the terminal event: %v", len(events), events)
+	}
+	if events[0].Type != EventError || !errors.Is(events[0].Err, ErrIdleTimeout) {
+		t.Errorf("event 0: got %v %v, want EventError wrapping ErrIdleTimeout", events[0].Type, events[0].Err)
+	}
+	if events[1].Type != EventContainerExited {
+		t.Errorf("event 1: got %v, want ContainerExited", events[1].Type)
+	}
+	if res, _ := s.Result(); !res.Stopped {
+		t.Error("Result.Stopped: got false, want true")
+	}
+}
+
+func TestSession_IdleTimeout_ResetByOutput(t *testing.T) {
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			t.Error("Stop called while the container was writing output")
+			return nil
+		},
+	}
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		// Ten lines 20ms apart outlast the 100ms window several times over.
+		for i := range 10 {
+			fmt.Fprintf(pw, "line %d\n", i)
+			time.Sleep(20 * time.Millisecond)
+		}
+		return 0, nil
+	}
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{idleTimeout: 100 * time.Millisecond})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	for _, e := range events {
+		if e.Type == EventError {
+			t.Errorf("unexpected EventError: %v", e.Err)
+		}
+	}
+}
+
+func TestSession_IdleTimeout_NotAfterEnd(t *testing.T) {
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			t.Error("Stop called after the session ended")
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil, sessionConfig{idleTimeout: 20 * time.Millisecond})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	// Give a monitor that failed to notice the end time to fire.
+	time.Sleep(60 * time.Millisecond)
+}
+
+func TestSession_MaxRuntime_StopsContainer(t *testing.T) {
+	unblock := make(chan struct{})
+	var stopCalls atomic.Int32
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			if stopCalls.Add(1) == 1 {
+				close(unblock)
+			}
+			return nil
+		},
+	}
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		// Output does not extend the runtime, unlike the idle timeout.
+		for {
+			select {
+			case <-unblock:
+				return 143, nil
+			case <-time.After(10 * time.Millisecond):
+				fmt.Fprintln(pw, "working")
+			}
+		}
+	}
+	start := time.Now()
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{maxRuntime: 50 * time.Millisecond})
+
+	code, err := waitForDone(t, s, 2*time.Second)
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if code != 143 || err != nil {
+		t.Errorf("Wait: got %d, %v; want 143, nil", code, err)
+	}
+	if stopCalls.Load() != 1 {
+		t.Fatalf("Stop calls: got %d, want 1", stopCalls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("stopped after %v, before the max runtime", elapsed)
+	}
+	var exceeded bool
+	for _, e := range events {
+		if e.Type == EventError && errors.Is(e.Err, ErrMaxRuntimeExceeded) {
+			exceeded = true
+			if !strings.Contains(e.Data, "max runtime exceeded") {
+				t.Errorf("Data: got %q, want it to mention max runtime exceeded", e.Data)
+			}
+		}
+	}
+	if !exceeded {
+		t.Errorf("events: got %v, want an EventError wrapping ErrMaxRuntimeExceeded", events)
+	}
+	if last := events[len(events)-1]; last.Type != EventContainerExited {
+		t.Errorf("terminal event: got %v, want ContainerExited", last.Type)
+	}
+}
+
+func TestSession_MaxRuntime_NotAfterEnd(t *testing.T) {
+	r := &mockRunner{
+		stopFn: func(context.Context, string, time.Duration, string) error {
+			t.Error("Stop called after the session ended")
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, immediateRunFn(0, nil), nil, sessionConfig{maxRuntime: 20 * time.Millisecond})
+	collectEvents(t, s.Events(), 2*time.Second)
+	waitForDone(t, s, 2*time.Second)
+
+	// Give a timer that failed to notice the end time to fire.
+	time.Sleep(60 * time.Millisecond)
+}
+
+func TestSession_Kill_RunnerError(t *testing.T) {
+	unblock := make(chan struct{})
+	r := &mockRunner{
+		killFn: func(ctx context.Context, container string) error {
+			return fmt.Errorf("%w: exit code 1", ErrKillFailed)
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
+
+	err := s.Kill(context.Background())
+	if !errors.Is(err, ErrKillFailed) {
+		t.Errorf("Kill: got %v, want ErrKillFailed", err)
+	}
+
+	close(unblock)
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Annotations_SetAndGet(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	defer collectEvents(t, s.Events(), 2*time.Second)
+
+	if got := s.Annotations(); len(got) != 0 {
+		t.Errorf("Annotations on new session: got %v, want empty", got)
+	}
+	if err := s.SetAnnotation("checkRun", "123"); err != nil {
+		t.Fatalf("SetAnnotation: %v", err)
+	}
+	if err := s.SetAnnotation("checkRun", "456"); err != nil {
+		t.Fatalf("SetAnnotation replace: %v", err)
+	}
+	got := s.Annotations()
+	if got["checkRun"] != "456" {
+		t.Errorf("checkRun: got %q, want %q", got["checkRun"], "456")
+	}
+
+	// The returned map is a copy.
+	got["checkRun"] = "mutated"
+	if s.Annotations()["checkRun"] != "456" {
+		t.Error("mutating the returned map affected the session")
+	}
+}
+
+func TestSession_Annotations_Bounds(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	defer collectEvents(t, s.Events(), 2*time.Second)
+
+	if err := s.SetAnnotation("", "v"); !errors.Is(err, ErrAnnotationLimit) {
+		t.Errorf("empty key: got %v, want ErrAnnotationLimit", err)
+	}
+	if err := s.SetAnnotation(strings.Repeat("k", maxAnnotationKeyLen+1), "v"); !errors.Is(err, ErrAnnotationLimit) {
+		t.Errorf("oversized key: got %v, want ErrAnnotationLimit", err)
+	}
+	if err := s.SetAnnotation("k", strings.Repeat("v", maxAnnotationValueLen+1)); !errors.Is(err, ErrAnnotationLimit) {
+		t.Errorf("oversized value: got %v, want ErrAnnotationLimit", err)
+	}
+	if err := s.SetAnnotation(strings.Repeat("k", maxAnnotationKeyLen), strings.Repeat("v", maxAnnotationValueLen)); err != nil {
+		t.Errorf("key and value at the bound: got %v, want nil", err)
+	}
+
+	s2 := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	defer collectEvents(t, s2.Events(), 2*time.Second)
+	for i := 0; i < maxAnnotations; i++ {
+		if err := s2.SetAnnotation(fmt.Sprintf("key-%d", i), "v"); err != nil {
+			t.Fatalf("SetAnnotation %d: %v", i, err)
+		}
+	}
+	if err := s2.SetAnnotation("one-too-many", "v"); !errors.Is(err, ErrAnnotationLimit) {
+		t.Errorf("count over bound: got %v, want ErrAnnotationLimit", err)
+	}
+	// Replacing an existing key is allowed at the bound.
+	if err := s2.SetAnnotation("key-0", "updated"); err != nil {
+		t.Errorf("replace at bound: got %v, want nil", err)
+	}
+}
+
+func TestSession_Annotations_Concurrent(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	defer collectEvents(t, s.Events(), 2*time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			for j := 0; j < 100; j++ {
+				if err := s.SetAnnotation(key, fmt.Sprintf("%d", j)); err != nil {
+					t.Errorf("SetAnnotation: %v", err)
+					return
+				}
+				_ = s.Annotations()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got := s.Annotations()
+	if len(got) != 16 {
+		t.Errorf("annotation count: got %d, want 16", len(got))
+	}
+	for k, v := range got {
+		if v != "99" {
+			t.Errorf("%s: got %q, want %q", k, v, "99")
+		}
+	}
+}
+
+func TestSession_HealthMonitor_EmitsOncePerChange(t *testing.T) {
+	statuses := []string{"starting", "starting", "healthy", "healthy", "unhealthy"}
+	unblock := make(chan struct{})
+	var mu sync.Mutex
+	polls := 0
+	r := &mockRunner{
+		healthFn: func(_ context.Context, container string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if container != "ctn" {
+				t.Errorf("Health container: got %q, want %q", container, "ctn")
+			}
+			if polls >= len(statuses) {
+				select {
+				case <-unblock:
+				default:
+					close(unblock)
+				}
+				return statuses[len(statuses)-1], nil
+			}
+			status := statuses[polls]
+			polls++
+			return status, nil
+		},
+	}
+	cfg := sessionConfig{healthInterval: 5 * time.Millisecond}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, cfg)
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	var got []string
+	for _, e := range events {
+		if e.Type == EventHealthChanged {
+			got = append(got, e.Data)
+		}
+	}
+	want := []string{"starting", "healthy", "unhealthy"}
+	if len(got) != len(want) {
+		t.Fatalf("health events: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("health event %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if events[len(events)-1].Type != EventContainerExited {
+		t.Errorf("last event: got %d, want EventContainerExited", events[len(events)-1].Type)
+	}
+}
+
+func TestSession_HealthMonitor_NoHealthcheckEmitsNothing(t *testing.T) {
+	unblock := make(chan struct{})
+	var polls int
+	var mu sync.Mutex
+	r := &mockRunner{
+		healthFn: func(_ context.Context, _ string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			polls++
+			if polls == 3 {
+				close(unblock)
+			}
+			return "", nil
+		},
+	}
+	cfg := sessionConfig{healthInterval: 5 * time.Millisecond}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, cfg)
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	for _, e := range events {
+		if e.Type == EventHealthChanged {
+			t.Errorf("unexpected health event: %+v", e)
+		}
+	}
+}
+
+func TestSession_HealthMonitor_DisabledByDefault(t *testing.T) {
+	r := &mockRunner{
+		healthFn: func(_ context.Context, _ string) (string, error) {
+			t.Error("Health must not be polled when monitoring is disabled")
+			return "healthy", nil
+		},
+	}
+	s := newSession("sid", "ctn", r, writingRunFn([]string{"a", "b"}, 0, nil), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_StopWith_PassesSignalAndTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	var gotTimeout time.Duration
+	var gotSignal string
+	r := &mockRunner{
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
+			gotTimeout = timeout
+			gotSignal = signal
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
+
+	opts := StopOptions{Signal: "SIGINT", Timeout: 45 * time.Second}
+	if err := s.StopWith(context.Background(), opts); err != nil {
+		t.Fatalf("StopWith: %v", err)
+	}
+	if gotSignal != "SIGINT" {
+		t.Errorf("signal: got %q, want %q", gotSignal, "SIGINT")
+	}
+	if gotTimeout != 45*time.Second {
+		t.Errorf("timeout: got %v, want 45s", gotTimeout)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Stop_UsesDefaults(t *testing.T) {
+	unblock := make(chan struct{})
+	var gotTimeout time.Duration
+	gotSignal := "unset"
+	r := &mockRunner{
+		stopFn: func(ctx context.Context, container string, timeout time.Duration, signal string) error {
+			gotTimeout = timeout
+			gotSignal = signal
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if gotSignal != "" {
+		t.Errorf("signal: got %q, want empty", gotSignal)
+	}
+	if gotTimeout != sessionStopTimeout {
+		t.Errorf("timeout: got %v, want %v", gotTimeout, sessionStopTimeout)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Stop_UsesConfiguredTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	var gotTimeout time.Duration
+	r := &mockRunner{
+		stopFn: func(_ context.Context, _ string, timeout time.Duration, _ string) error {
+			gotTimeout = timeout
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{stopTimeout: 45 * time.Second})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if gotTimeout != 45*time.Second {
+		t.Errorf("timeout: got %v, want 45s", gotTimeout)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_StopWithTimeout_OverridesConfigured(t *testing.T) {
+	unblock := make(chan struct{})
+	var gotTimeout time.Duration
+	r := &mockRunner{
+		stopFn: func(_ context.Context, _ string, timeout time.Duration, _ string) error {
+			gotTimeout = timeout
+			close(unblock)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, blockingRunFn(unblock, 0, nil), nil, sessionConfig{stopTimeout: 45 * time.Second})
+
+	if err := s.StopWithTimeout(context.Background(), time.Minute); err != nil {
+		t.Fatalf("StopWithTimeout: %v", err)
+	}
+	if gotTimeout != time.Minute {
+		t.Errorf("timeout: got %v, want 1m", gotTimeout)
+	}
+	collectEvents(t, s.Events(), 2*time.Second)
+}
+
+func TestSession_Subscribe_ConcurrentSubscribers(t *testing.T) {
+	unblock := make(chan struct{})
+	lines := []string{"one", "two", "three"}
+	runFn := func(_ context.Context, pw io.WriteCloser) (int, error) {
+		<-unblock
+		for _, line := range lines {
+			fmt.Fprintln(pw, line)
+		}
+		return 3, nil
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{})
+
+	subs := []<-chan Event{s.Subscribe(), s.Subscribe()}
+	results := make([][]Event, len(subs))
+	var wg sync.WaitGroup
+	for i, ch := range subs {
+		wg.Add(1)
+		go func(i int, ch <-chan Event) {
+			defer wg.Done()
+			results[i] = collectEvents(t, ch, 2*time.Second)
+		}(i, ch)
+	}
+	close(unblock)
+	primary := collectEvents(t, s.Events(), 2*time.Second)
+	wg.Wait()
+
+	for i, got := range append(results, primary) {
+		if len(got) != len(lines)+1 {
+			t.Fatalf("consumer %d: got %d events, want %d: %v", i, len(got), len(lines)+1, got)
+		}
+		for j, line := range lines {
+			if got[j].Type != EventOutput || got[j].Data != line {
+				t.Errorf("consumer %d event %d: got %v, want Output %q", i, j, got[j], line)
+			}
+		}
+		last := got[len(got)-1]
+		if last.Type != EventContainerExited || last.Code != 3 {
+			t.Errorf("consumer %d terminal: got %v, want ContainerExited code 3", i, last)
+		}
+	}
+}
+
+func TestSession_Subscribe_NoReplay(t *testing.T) {
+	preamble := []Event{{Type: EventContainerStarted, Data: "ctn", Time: time.Now()}}
+	unblock := make(chan struct{})
+	s := newSession("sid", "ctn", &mockRunner{}, blockingRunFn(unblock, 0, nil), preamble, sessionConfig{})
+
+	sub := s.Subscribe()
+	close(unblock)
+	got := collectEvents(t, sub, 2*time.Second)
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	if len(got) != 1 || got[0].Type != EventContainerExited {
+		t.Errorf("subscriber events: got %v, want only ContainerExited", got)
+	}
+}
+
+func TestSession_Subscribe_AfterFinishReturnsClosed(t *testing.T) {
+	s := newSession("sid", "ctn", &mockRunner{}, immediateRunFn(0, nil), nil, sessionConfig{})
+	collectEvents(t, s.Events(), 2*time.Second)
+
+	select {
+	case _, ok := <-s.Subscribe():
+		if ok {
+			t.Error("expected closed channel from Subscribe after session finished")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe after finish returned an open channel")
+	}
+}
+
+func TestSession_ParseStream_EmitsMessages(t *testing.T) {
+	lines := []string{
+		`{"type":"system","subtype":"init","session_id":"abc"}`,
+		"npm warn deprecated",
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","name":"Edit"}]}}`,
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{parseStream: true})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %v", len(events), events)
+	}
+	if events[0].Type != EventMessage || events[0].Message == nil || events[0].Message.Subtype != "init" {
+		t.Errorf("event 0: got %+v, want init Message", events[0])
+	}
+	if events[0].Data != lines[0] {
+		t.Errorf("event 0 Data: got %q, want raw line", events[0].Data)
+	}
+	if events[1].Type != EventOutput || events[1].Message != nil {
+		t.Errorf("event 1: got %+v, want plain Output", events[1])
+	}
+	if events[2].Type != EventMessage || len(events[2].Message.ToolNames) != 1 {
+		t.Errorf("event 2: got %+v, want Message with one tool", events[2])
+	}
+}
+
+func TestSession_ParseStreamDisabled_JSONIsOutput(t *testing.T) {
+	lines := []string{`{"type":"system","subtype":"init"}`}
+	s := newSession("sid", "ctn", &mockRunner{}, writingRunFn(lines, 0, nil), nil, sessionConfig{})
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	if events[0].Type != EventOutput {
+		t.Errorf("got %v, want Output when parsing is disabled", events[0].Type)
+	}
+}
+
+// failingRunFn returns a runFn that exits with code 1 the first failures
+// times it is called and with 0 after that, counting its calls in runs.
+func failingRunFn(failures int, runs *atomic.Int32) func(ctx context.Context, pw io.WriteCloser) (int, error) {
+	return func(_ context.Context, pw io.WriteCloser) (int, error) {
+		n := runs.Add(1)
+		fmt.Fprintf(pw, "run %d\n", n)
+		if int(n) <= failures {
+			return 1, nil
+		}
+		return 0, nil
+	}
+}
+
+func countEvents(events []Event, typ EventType) int {
+	n := 0
+	for _, e := range events {
+		if e.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSession_Restart_SucceedsAfterFailures(t *testing.T) {
+	var runs atomic.Int32
+	s := newSession("sid", "ctn", &mockRunner{}, failingRunFn(2, &runs), nil, sessionConfig{restartMax: 3})
+
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	code, err := waitForDone(t, s, 2*time.Second)
+
+	if code != 0 || err != nil {
+		t.Errorf("Wait: got (%d, %v), want (0, nil)", code, err)
+	}
+	if runs.Load() != 3 {
+		t.Errorf("runs: got %d, want 3", runs.Load())
+	}
+	if n := countEvents(events, EventRestart); n != 2 {
+		t.Errorf("restart events: got %d, want 2 in %v", n, events)
+	}
+	if last := events[len(events)-1]; last.Type != EventContainerExited || last.Code != 0 {
+		t.Errorf("terminal event: got %+v, want ContainerExited code 0", last)
+	}
+	for _, e := range events {
+		if e.Type == EventRestart && (e.Code != 1 || e.Data != "ctn") {
+			t.Errorf("restart event: got %+v, want code 1 for ctn", e)
+		}
+	}
+}
+
+func TestSession_Restart_Exhausted(t *testing.T) {
+	var runs atomic.Int32
+	s := newSession("sid", "ctn", &mockRunner{}, failingRunFn(10, &runs), nil, sessionConfig{restartMax: 2})
+
+	events := collectEvents(t, s.Events(), 2*time.Second)
+	code, _ := waitForDone(t, s, 2*time.Second)
+
+	if code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if runs.Load() != 3 {
+		t.Errorf("runs: got %d, want 3 (one run and two restarts)", runs.Load())
+	}
+	if n := countEvents(events, EventRestart); n != 2 {
+		t.Errorf("restart events: got %d, want 2", n)
+	}
+}
+
+func TestSession_Restart_NotAfterError(t *testing.T) {
+	var runs atomic.Int32
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		runs.Add(1)
+		return -1, errors.New("docker run failed")
+	}
+	s := newSession("sid", "ctn", &mockRunner{}, runFn, nil, sessionConfig{restartMax: 3})
+
+	if _, err := waitForDone(t, s, 2*time.Second); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if runs.Load() != 1 {
+		t.Errorf("runs: got %d, want 1", runs.Load())
+	}
+}
+
+func TestSession_Restart_NotAfterStop(t *testing.T) {
+	var runs atomic.Int32
+	stopped := make(chan struct{})
+	runFn := func(context.Context, io.WriteCloser) (int, error) {
+		runs.Add(1)
+		<-stopped
+		return 143, nil
+	}
+	r := &mockRunner{
+		stopFn: func(_ context.Context, _ string, _ time.Duration, _ string) error {
+			close(stopped)
+			return nil
+		},
+	}
+	s := newSession("sid", "ctn", r, runFn, nil, sessionConfig{restartMax: 3})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	events := collectEvents(t, s.Events(), 2*time.Second)
+
+	if runs.Load() != 1 {
+		t.Errorf("runs: got %d, want 1", runs.Load())
+	}
+	if n := countEvents(events, EventRestart); n != 0 {
+		t.Errorf("restart events: got %d, want 0", n)
+	}
+}
+
+func TestSession_Restart_StopDuringBackoff(t *testing.T) {
+	var runs atomic.Int32
+	s := newSession("sid", "ctn", &mockRunner{}, failingRunFn(10, &runs), nil, sessionConfig{
+		restartMax:     3,
+		restartBackoff: time.Hour,
+	})
+	for runs.Load() == 0 {
+		runtime.Gosched()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if code, _ := waitForDone(t, s, 2*time.Second); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+	if runs.Load() != 1 {
+		t.Errorf("runs: got %d, want 1", runs.Load())
+	}
+}
@@ -0,0 +1,145 @@
+package cldpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionRecordExt is the file extension of a session record.
+const sessionRecordExt = ".json"
+
+// SessionRecord is what a SessionStore keeps on disk about a session started
+// by Dispatcher.Start, so an orchestrator restarted after a crash can find the
+// containers it launched.
+type SessionRecord struct {
+	StartedAt time.Time `json:"startedAt"` // when Start was called
+	ID        string    `json:"id"`        // session ID, as returned by Session.ID
+	Pod       string    `json:"pod"`       // pod name
+	Container string    `json:"container"` // container name, cldpd-<pod>
+	IssueURL  string    `json:"issueURL"`  // canonical URL of the issue or pull request; empty for StartTask
+
+	// Annotations are the session's annotations: StartOptions.Annotations
+	// at first, then as changed by Session.SetAnnotation.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SessionStore keeps one JSON file per session, named for the session ID, in
+// a directory. A Dispatcher created with WithSessionStore saves a record when
+// Start creates a session and removes it once the container has exited, so
+// the records left after a crash name the sessions that never finished.
+type SessionStore struct {
+	dir string
+}
+
+// NewSessionStore returns a SessionStore that keeps its records in dir. The
+// directory is created when the first record is saved.
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{dir: dir}
+}
+
+// DefaultSessionsDir returns the conventional session record directory:
+// ~/.cldpd/sessions/.
+func DefaultSessionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".cldpd", "sessions"), nil
+}
+
+// Dir returns the directory the store keeps its records in.
+func (st *SessionStore) Dir() string {
+	return st.dir
+}
+
+// Save writes rec to the store, replacing any record with the same ID. The
+// file is written to a temporary name and renamed into place, so a crash
+// never leaves a partial record.
+func (st *SessionStore) Save(rec SessionRecord) error {
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	tmp, err := os.CreateTemp(st.dir, "."+rec.ID+"-*")
+	if err != nil {
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	_, werr := tmp.Write(append(data, '\n'))
+	cerr := tmp.Close()
+	if err := errors.Join(werr, cerr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), st.path(rec.ID)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// Remove deletes the record for the session id. Removing a record that does
+// not exist is not an error.
+func (st *SessionStore) Remove(id string) error {
+	if err := os.Remove(st.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove session %s: %w", id, err)
+	}
+	return nil
+}
+
+// path returns the file holding the record for the session id.
+func (st *SessionStore) path(id string) string {
+	return filepath.Join(st.dir, id+sessionRecordExt)
+}
+
+// LoadSessions reads the session records in dir, oldest first. A directory
+// that does not exist holds no records. Records that cannot be read or parsed
+// are skipped, and reported together in the returned error alongside the
+// records that could be read, so one damaged file does not hide the rest.
+//
+// A record names a session whose process did not see it end: compare the
+// containers with Runner.List (docker ps) to tell those still running, which
+// Dispatcher.Attach can follow, from those that have exited or been removed.
+func LoadSessions(dir string) ([]SessionRecord, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("load sessions: %w", err)
+	}
+
+	var records []SessionRecord
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != sessionRecordExt {
+			continue
+		}
+		//nolint:gosec // path is built from the caller's sessions directory and its own entries
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load session %s: %w", name, err))
+			continue
+		}
+		var rec SessionRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			errs = append(errs, fmt.Errorf("load session %s: %w", name, err))
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+	return records, errors.Join(errs...)
+}
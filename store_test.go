@@ -0,0 +1,124 @@
+//go:build testing
+
+package cldpd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionStore_SaveLoadRemove(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	st := NewSessionStore(dir)
+	now := time.Now().UTC().Truncate(time.Second)
+	older := SessionRecord{StartedAt: now.Add(-time.Hour), ID: "a-00000001", Pod: "a", Container: "cldpd-a", IssueURL: "https://github.com/org/repo/issues/1"}
+	newer := SessionRecord{
+		StartedAt:   now,
+		ID:          "b-00000002",
+		Pod:         "b",
+		Container:   "cldpd-b",
+		IssueURL:    "https://github.com/org/repo/issues/2",
+		Annotations: map[string]string{"check-run": "42"},
+	}
+
+	for _, rec := range []SessionRecord{newer, older} {
+		if err := st.Save(rec); err != nil {
+			t.Fatalf("Save %s: %v", rec.ID, err)
+		}
+	}
+	got, err := LoadSessions(dir)
+	if err != nil {
+		t.Fatalf("LoadSessions: %v", err)
+	}
+	if len(got) != 2 || !reflect.DeepEqual(got[0], older) || !reflect.DeepEqual(got[1], newer) {
+		t.Fatalf("LoadSessions: got %+v, want the two records oldest first", got)
+	}
+
+	if err := st.Remove(older.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := st.Remove(older.ID); err != nil {
+		t.Errorf("Remove of a missing record: got %v, want nil", err)
+	}
+	got, err = LoadSessions(dir)
+	if err != nil {
+		t.Fatalf("LoadSessions: %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], newer) {
+		t.Errorf("LoadSessions after Remove: got %+v, want only %s", got, newer.ID)
+	}
+}
+
+func TestSessionStore_SaveReplaces(t *testing.T) {
+	st := NewSessionStore(t.TempDir())
+	rec := SessionRecord{ID: "a-00000001", Pod: "a", Container: "cldpd-a"}
+	if err := st.Save(rec); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	rec.IssueURL = "https://github.com/org/repo/issues/9"
+	if err := st.Save(rec); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	entries, err := os.ReadDir(st.Dir())
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a-00000001.json" {
+		t.Errorf("files: got %v, want only a-00000001.json", entries)
+	}
+	got, err := LoadSessions(st.Dir())
+	if err != nil || len(got) != 1 || got[0].IssueURL != rec.IssueURL {
+		t.Errorf("LoadSessions: got %+v, %v; want the replaced record", got, err)
+	}
+}
+
+func TestLoadSessions_MissingDir(t *testing.T) {
+	got, err := LoadSessions(filepath.Join(t.TempDir(), "absent"))
+	if err != nil || got != nil {
+		t.Errorf("LoadSessions: got %v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestLoadSessions_SkipsDamagedRecords(t *testing.T) {
+	dir := t.TempDir()
+	st := NewSessionStore(dir)
+	good := SessionRecord{ID: "a-00000001", Pod: "a", Container: "cldpd-a"}
+	if err := st.Save(good); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b-00000002.json"), []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write damaged record: %v", err)
+	}
+	// Neither a leftover temporary file nor an unrelated file is a record.
+	if err := os.WriteFile(filepath.Join(dir, ".c-00000003-123"), []byte("{"), 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("write notes: %v", err)
+	}
+
+	got, err := LoadSessions(dir)
+	if err == nil {
+		t.Error("LoadSessions: got nil error, want one naming the damaged record")
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], good) {
+		t.Errorf("LoadSessions: got %+v, want the readable record", got)
+	}
+}
+
+func TestSessionStore_SaveFails(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	// A directory cannot be created under a regular file.
+	err := NewSessionStore(filepath.Join(file, "sessions")).Save(SessionRecord{ID: "a-00000001"})
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Save: got %v, want a create error", err)
+	}
+}
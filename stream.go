@@ -0,0 +1,80 @@
+package cldpd
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Output formats for PodConfig.OutputFormat and StartOptions.OutputFormat.
+const (
+	// OutputFormatText runs Claude Code with --output-format text, its plain
+	// output, emitted as EventOutput. It is also the behavior when no format is set.
+	OutputFormatText = "text"
+
+	// OutputFormatStreamJSON runs Claude Code with --output-format stream-json
+	// and parses its output into EventMessage.
+	OutputFormatStreamJSON = "stream-json"
+)
+
+// StreamMessage holds the fields cldpd extracts from one line of Claude Code's
+// stream-json output. The full line is available in Event.Data.
+type StreamMessage struct {
+	Type      string   // message type: system, assistant, user, or result
+	Subtype   string   // e.g. init for system messages, success for results
+	Role      string   // role of the enclosed message, if any
+	SessionID string   // Claude Code session ID
+	Text      string   // concatenated text content, or the final result text
+	ToolNames []string // names of tools invoked by tool_use content blocks
+}
+
+// streamLine mirrors the subset of the stream-json schema that cldpd reads.
+type streamLine struct {
+	Message *struct {
+		Role    string `json:"role"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+			Name string `json:"name"`
+		} `json:"content"`
+	} `json:"message"`
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	SessionID string `json:"session_id"`
+	Result    string `json:"result"`
+}
+
+// parseStreamLine parses a line of stream-json output. It reports false for
+// lines that are not JSON objects with a type field, which callers should
+// treat as plain output.
+func parseStreamLine(line string) (StreamMessage, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return StreamMessage{}, false
+	}
+	var raw streamLine
+	if err := json.Unmarshal([]byte(line), &raw); err != nil || raw.Type == "" {
+		return StreamMessage{}, false
+	}
+
+	msg := StreamMessage{
+		Type:      raw.Type,
+		Subtype:   raw.Subtype,
+		SessionID: raw.SessionID,
+		Text:      raw.Result,
+	}
+	if raw.Message != nil {
+		msg.Role = raw.Message.Role
+		var text []string
+		for _, block := range raw.Message.Content {
+			switch block.Type {
+			case "text":
+				text = append(text, block.Text)
+			case "tool_use":
+				msg.ToolNames = append(msg.ToolNames, block.Name)
+			}
+		}
+		if len(text) > 0 {
+			msg.Text = strings.Join(text, "\n")
+		}
+	}
+	return msg, true
+}
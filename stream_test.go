@@ -0,0 +1,48 @@
+//go:build testing
+
+package cldpd
+
+import "testing"
+
+func TestParseStreamLine_Assistant(t *testing.T) {
+	line := `{"type":"assistant","session_id":"abc","message":{"role":"assistant","content":[` +
+		`{"type":"text","text":"Running tests."},{"type":"tool_use","name":"Bash","input":{"command":"go test"}}]}}`
+	msg, ok := parseStreamLine(line)
+	if !ok {
+		t.Fatal("expected line to parse")
+	}
+	if msg.Type != "assistant" || msg.Role != "assistant" || msg.SessionID != "abc" {
+		t.Errorf("got %+v", msg)
+	}
+	if msg.Text != "Running tests." {
+		t.Errorf("Text: got %q", msg.Text)
+	}
+	if len(msg.ToolNames) != 1 || msg.ToolNames[0] != "Bash" {
+		t.Errorf("ToolNames: got %v, want [Bash]", msg.ToolNames)
+	}
+}
+
+func TestParseStreamLine_SystemAndResult(t *testing.T) {
+	msg, ok := parseStreamLine(`{"type":"system","subtype":"init","session_id":"abc"}`)
+	if !ok || msg.Type != "system" || msg.Subtype != "init" {
+		t.Errorf("system: got (%+v, %v)", msg, ok)
+	}
+	msg, ok = parseStreamLine(`{"type":"result","subtype":"success","result":"Opened PR #12."}`)
+	if !ok || msg.Type != "result" || msg.Text != "Opened PR #12." {
+		t.Errorf("result: got (%+v, %v)", msg, ok)
+	}
+}
+
+func TestParseStreamLine_FallsBack(t *testing.T) {
+	for _, line := range []string{
+		"plain text",
+		"",
+		"{not json",
+		`{"role":"assistant"}`,
+		`["type","assistant"]`,
+	} {
+		if _, ok := parseStreamLine(line); ok {
+			t.Errorf("parseStreamLine(%q): expected fallback", line)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//go:build testing
+
+package testing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock_AdvanceFiresDueWaiters(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	early := c.After(time.Second)
+	late := c.After(time.Minute)
+
+	c.Advance(2 * time.Second)
+	select {
+	case got := <-early:
+		if !got.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("fired at %v, want %v", got, start.Add(2*time.Second))
+		}
+	default:
+		t.Fatal("waiter due at 1s did not fire after advancing 2s")
+	}
+	select {
+	case <-late:
+		t.Fatal("waiter due at 1m fired after advancing 2s")
+	default:
+	}
+	if n := c.Waiters(); n != 1 {
+		t.Errorf("Waiters: got %d, want 1", n)
+	}
+}
+
+func TestFakeClock_NonPositiveFiresImmediately(t *testing.T) {
+	c := NewFakeClock(time.Time{})
+	select {
+	case <-c.After(0):
+	default:
+		t.Fatal("After(0) did not fire immediately")
+	}
+	if n := c.Waiters(); n != 0 {
+		t.Errorf("Waiters: got %d, want 0", n)
+	}
+}
+
+func TestFakeClock_Now(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	c.Advance(time.Hour)
+	if got := c.Now(); !got.Equal(start.Add(time.Hour)) {
+		t.Errorf("Now: got %v, want %v", got, start.Add(time.Hour))
+	}
+}
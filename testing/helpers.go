@@ -1,6 +1,7 @@
 //go:build testing
 
-// Package testing provides test helpers for cldpd.
+// Package testing provides test helpers for cldpd, including a simulated
+// Runner for exercising consumers without a Docker daemon.
 package testing
 
 import "testing"
@@ -8,7 +8,9 @@ import (
 	"errors"
 	"io"
 	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/zoobzio/cldpd"
 )
@@ -63,7 +65,7 @@ func TestDockerRunner_Build_InvalidDir(t *testing.T) {
 	}
 
 	r := &cldpd.DockerRunner{}
-	err := r.Build(context.Background(), "cldpd-test-build-invalid", "/nonexistent/path", nil)
+	err := r.Build(context.Background(), "cldpd-test-build-invalid", "/nonexistent/path", cldpd.BuildOptions{})
 	if err == nil {
 		t.Error("expected error building from nonexistent dir, got nil")
 	}
@@ -96,6 +98,59 @@ func TestDockerRunner_Run_HelloWorld(t *testing.T) {
 	exec.Command("docker", "rm", "-f", "cldpd-test-run-hello").Run() //nolint:errcheck
 }
 
+func TestDockerRunner_Run_MissingCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	r := &cldpd.DockerRunner{}
+	opts := cldpd.RunOptions{
+		Image:  "alpine:latest",
+		Name:   "cldpd-test-run-missing",
+		Cmd:    []string{"cldpd-no-such-binary"},
+		Remove: true,
+	}
+	code, err := r.Run(context.Background(), opts, io.Discard)
+	exec.Command("docker", "rm", "-f", "cldpd-test-run-missing").Run() //nolint:errcheck
+	if !errors.Is(err, cldpd.ErrCommandNotFound) {
+		t.Fatalf("got (%d, %v), want ErrCommandNotFound", code, err)
+	}
+	if code != -1 {
+		t.Errorf("exit code: got %d, want -1", code)
+	}
+}
+
+func TestDockerRunner_Inspect_OOMKilled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	// RunOptions has no memory limit, so the container is started directly.
+	const name = "cldpd-test-oom"
+	exec.Command("docker", "rm", "-f", name).Run()       //nolint:errcheck
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	run := exec.Command("docker", "run", "--name", name, "--memory", "6m", "--memory-swap", "6m",
+		"alpine:latest", "sh", "-c", "x=a; while true; do x=$x$x; done")
+	if err := run.Run(); err == nil {
+		t.Fatal("expected the container to be killed, got a clean exit")
+	}
+
+	r := &cldpd.DockerRunner{}
+	state, err := r.Inspect(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if !state.OOMKilled || state.ExitCode != 137 {
+		t.Errorf("got %+v, want OOMKilled with exit 137", state)
+	}
+}
+
 func TestDockerRunner_Run_NonZeroExit(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -137,3 +192,240 @@ func TestDockerRunner_Exec_NotRunning(t *testing.T) {
 		t.Errorf("got %v, want ErrSessionNotFound", err)
 	}
 }
+
+func TestDockerRunner_Inspect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	const name = "cldpd-test-inspect"
+	exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	if err := exec.Command("docker", "run", "-d", "--name", name, "alpine:latest", "sh", "-c", "exit 4").Run(); err != nil {
+		t.Fatalf("start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	exec.Command("docker", "wait", name).Run()           //nolint:errcheck
+
+	r := &cldpd.DockerRunner{}
+	st, err := r.Inspect(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if st.Running || st.ExitCode != 4 || st.Image != "alpine:latest" {
+		t.Errorf("got %+v, want exited alpine:latest with code 4", st)
+	}
+
+	_, err = r.Inspect(context.Background(), "cldpd-test-nonexistent-container")
+	if !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("missing container: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestDispatcher_Attach_SurvivingContainer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	// Stands in for a container left running by a process that has since exited.
+	const name = "cldpd-attachtest"
+	exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	run := exec.Command("docker", "run", "-d", "--rm", "--name", name, "alpine:latest",
+		"sh", "-c", "sleep 2; echo after-attach; sleep 1; exit 5")
+	if err := run.Run(); err != nil {
+		t.Fatalf("start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+
+	d := cldpd.NewDispatcher(t.TempDir(), &cldpd.DockerRunner{})
+	s, err := d.Attach(context.Background(), "attachtest")
+	if err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+
+	var out []string
+	var first cldpd.EventType = -1
+	for e := range s.Events() {
+		if first == -1 {
+			first = e.Type
+		}
+		if e.Type == cldpd.EventOutput {
+			out = append(out, e.Data)
+		}
+	}
+	code, err := s.Wait()
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if first != cldpd.EventContainerAttached {
+		t.Errorf("first event: got %d, want EventContainerAttached", first)
+	}
+	if code != 5 {
+		t.Errorf("exit code: got %d, want 5", code)
+	}
+	if !strings.Contains(strings.Join(out, "\n"), "after-attach") {
+		t.Errorf("output %q missing line written after attach", out)
+	}
+}
+
+func TestDockerRunner_RunDetached_WaitContainer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	const name = "cldpd-detachtest"
+	exec.Command("docker", "rm", "-f", name).Run()       //nolint:errcheck
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+
+	r := &cldpd.DockerRunner{}
+	ctx, cancel := context.WithCancel(context.Background())
+	begin := time.Now()
+	id, err := r.RunDetached(ctx, cldpd.RunOptions{
+		Image: "alpine:latest",
+		Name:  name,
+		Cmd:   []string{"sh", "-c", "sleep 2; exit 3"},
+	})
+	if err != nil {
+		t.Fatalf("RunDetached: %v", err)
+	}
+	if id == "" {
+		t.Error("RunDetached returned an empty container ID")
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("RunDetached blocked for %v; it should return once the container starts", elapsed)
+	}
+	// The container does not depend on the context that started it.
+	cancel()
+
+	state, err := r.Inspect(context.Background(), name)
+	if err != nil || !state.Running {
+		t.Fatalf("after cancel: got (%+v, %v), want running", state, err)
+	}
+	code, err := r.WaitContainer(context.Background(), name)
+	if err != nil || code != 3 {
+		t.Errorf("WaitContainer: got (%d, %v), want (3, nil)", code, err)
+	}
+	// An exited container reports its code at once.
+	if code, err := r.WaitContainer(context.Background(), name); err != nil || code != 3 {
+		t.Errorf("WaitContainer after exit: got (%d, %v), want (3, nil)", code, err)
+	}
+}
+
+func TestDockerRunner_ExecInteractive_RoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	const name = "cldpd-shelltest"
+	exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	if err := exec.Command("docker", "run", "-d", "--rm", "--name", name, "alpine:latest", "sleep", "30").Run(); err != nil {
+		t.Fatalf("start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+
+	input := "line one\n\x00binary\xff\nlast line without newline"
+	var stdout, stderr bytes.Buffer
+	d := cldpd.NewDispatcher(t.TempDir(), &cldpd.DockerRunner{})
+	code, err := d.Shell(context.Background(), "shelltest", []string{"cat"}, strings.NewReader(input), &stdout, &stderr)
+	if err != nil || code != 0 {
+		t.Fatalf("Shell: got (%d, %v), want (0, nil); stderr %q", code, err, stderr.String())
+	}
+	if stdout.String() != input {
+		t.Errorf("round trip: got %q, want %q", stdout.String(), input)
+	}
+}
+
+func TestDockerRunner_WaitContainer_NotFound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	r := &cldpd.DockerRunner{}
+	_, err := r.WaitContainer(context.Background(), "cldpd-nonexistent-wait-test")
+	if !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestDispatcher_Attach_Stop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	const name = "cldpd-attachstoptest"
+	exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	if err := exec.Command("docker", "run", "-d", "--rm", "--name", name, "alpine:latest", "sleep", "60").Run(); err != nil {
+		t.Fatalf("start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+
+	d := cldpd.NewDispatcher(t.TempDir(), &cldpd.DockerRunner{})
+	s, err := d.Attach(context.Background(), "attachstoptest")
+	if err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.StopWith(ctx, cldpd.StopOptions{Timeout: time.Second}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if code, _ := s.Wait(); code == 0 {
+		t.Error("exit code: got 0, want non-zero after stop")
+	}
+}
+
+func TestDispatcher_Attach_StopEscalatesToKill(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	if !dockerAvailable() {
+		t.Skip("Docker not available")
+	}
+
+	// PID 1 ignores SIGTERM, so Stop has to escalate to SIGKILL. No --rm: the
+	// session inspects the container before removing it.
+	const name = "cldpd-stopkilltest"
+	exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+	if err := exec.Command("docker", "run", "-d", "--name", name, "alpine:latest",
+		"sh", "-c", `trap "" TERM; sleep 60`).Run(); err != nil {
+		t.Fatalf("start container: %v", err)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run() //nolint:errcheck
+
+	d := cldpd.NewDispatcher(t.TempDir(), &cldpd.DockerRunner{})
+	s, err := d.Attach(context.Background(), "stopkilltest")
+	if err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.StopWith(ctx, cldpd.StopOptions{Timeout: time.Second}); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	var last cldpd.Event
+	for e := range s.Events() {
+		last = e
+	}
+	if last.Type != cldpd.EventContainerKilled {
+		t.Errorf("terminal event: got %v (%q), want %v", last.Type, last.Data, cldpd.EventContainerKilled)
+	}
+}
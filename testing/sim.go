@@ -0,0 +1,443 @@
+//go:build testing
+
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoobzio/cldpd"
+)
+
+// Exit codes reported by a simulated container that is stopped or killed,
+// matching what docker reports for SIGTERM and SIGKILL.
+const (
+	ExitStopped = 143
+	ExitKilled  = 137
+)
+
+// errNameInUse mirrors docker's conflict error for a duplicate container name.
+var errNameInUse = errors.New("container name already in use")
+
+// Script describes the simulated behavior of one pod.
+//
+// Build waits BuildTime, varied uniformly by up to ±BuildJitter, then fails
+// with cldpd.ErrBuildFailed if BuildFail is set. Run and Exec emit Lines lines
+// of output, one every LineInterval, then exit with ExitCode — or, when Hang is
+// set, block until the container is stopped, killed, or the context ends.
+type Script struct {
+	Health       string // status returned by Health; empty means no healthcheck
+	BuildTime    time.Duration
+	BuildJitter  time.Duration
+	LineInterval time.Duration
+	Lines        int
+	ExitCode     int
+	BuildFail    bool
+	Hang         bool
+}
+
+// SimStats counts the calls a SimRunner has served.
+type SimStats struct {
+	Builds   int // Build calls
+	Pulls    int // Pull calls
+	Runs     int // Run calls that started a container
+	Execs    int // Exec calls against a running container
+	Attaches int // Attach calls against a running container
+	Stops    int // Stop calls
+	Kills    int // Kill calls
+	Running  int // containers currently running
+}
+
+// SimRunner is a cldpd.Runner that simulates Docker from per-pod scripts on a
+// controllable Clock. It is safe for concurrent use by many sessions.
+//
+// Scripts are keyed by pod name and matched against the default image tag and
+// container name (cldpd-<pod>). Pods without a script, including pods whose
+// pod.json overrides the image tag at build time, use the default script.
+// Stop and Kill ignore their timeout and signal: the container exits at once
+// with ExitStopped or ExitKilled.
+type SimRunner struct {
+	clock      Clock
+	rng        *rand.Rand
+	scripts    map[string]Script
+	containers map[string]*simContainer
+	images     map[string]time.Time // creation time of each built tag
+	dflt       Script
+	stats      SimStats
+	mu         sync.Mutex
+}
+
+var _ cldpd.Runner = (*SimRunner)(nil)
+
+// simContainer is a running simulated container.
+type simContainer struct {
+	startedAt time.Time
+	stopped   chan struct{}
+	image     string
+	once      sync.Once
+	code      int
+}
+
+// terminate ends the container with code. Later calls are no-ops.
+func (c *simContainer) terminate(code int) {
+	c.once.Do(func() {
+		c.code = code
+		close(c.stopped)
+	})
+}
+
+// NewSimRunner returns a SimRunner driven by clock, using seed for build jitter
+// so runs are reproducible. A nil clock uses RealClock.
+func NewSimRunner(clock Clock, seed uint64) *SimRunner {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return &SimRunner{
+		clock: clock,
+		//nolint:gosec // jitter is simulated timing, not security sensitive
+		rng:        rand.New(rand.NewPCG(seed, seed)),
+		scripts:    make(map[string]Script),
+		containers: make(map[string]*simContainer),
+		images:     make(map[string]time.Time),
+	}
+}
+
+// SetScript sets the script for the named pod.
+func (r *SimRunner) SetScript(pod string, s Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts[pod] = s
+}
+
+// SetDefaultScript sets the script used by pods without their own.
+func (r *SimRunner) SetDefaultScript(s Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dflt = s
+}
+
+// Stats returns a snapshot of the runner's call counts.
+func (r *SimRunner) Stats() SimStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// script returns the script for an image tag or container name. Must be called with mu held.
+func (r *SimRunner) script(name string) Script {
+	if s, ok := r.scripts[strings.TrimPrefix(name, "cldpd-")]; ok {
+		return s
+	}
+	return r.dflt
+}
+
+// Preflight always succeeds.
+func (r *SimRunner) Preflight(_ context.Context) error {
+	return nil
+}
+
+// Build waits for the scripted build time and fails if the script says so.
+func (r *SimRunner) Build(ctx context.Context, tag string, _ string, _ cldpd.BuildOptions) error {
+	r.mu.Lock()
+	s := r.script(tag)
+	d := s.BuildTime
+	if s.BuildJitter > 0 {
+		d += time.Duration(r.rng.Int64N(int64(2*s.BuildJitter)+1)) - s.BuildJitter
+	}
+	r.stats.Builds++
+	r.mu.Unlock()
+
+	if d > 0 {
+		select {
+		case <-r.clock.After(d):
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", cldpd.ErrBuildFailed, ctx.Err())
+		}
+	}
+	if s.BuildFail {
+		return fmt.Errorf("%w: simulated failure for %s", cldpd.ErrBuildFailed, tag)
+	}
+	r.mu.Lock()
+	r.images[tag] = r.clock.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Run starts a simulated container named opts.Name and plays its script.
+func (r *SimRunner) Run(ctx context.Context, opts cldpd.RunOptions, stdout io.Writer) (int, error) {
+	c, s, err := r.create(opts)
+	if err != nil {
+		return -1, err
+	}
+	return r.runContainer(ctx, opts.Name, s, c, stdout)
+}
+
+// RunDetached starts a simulated container named opts.Name and plays its
+// script in the background, outliving ctx. The container's name serves as its
+// ID. Its output goes only to Attach, which the simulation does not stream.
+func (r *SimRunner) RunDetached(ctx context.Context, opts cldpd.RunOptions) (string, error) {
+	c, s, err := r.create(opts)
+	if err != nil {
+		return "", err
+	}
+	go r.runContainer(context.WithoutCancel(ctx), opts.Name, s, c, io.Discard) //nolint:errcheck
+	return opts.Name, nil
+}
+
+// WaitContainer blocks until the named simulated container exits and returns
+// its exit code. Exited containers are removed, so it returns
+// cldpd.ErrSessionNotFound if no container with that name is running.
+func (r *SimRunner) WaitContainer(ctx context.Context, container string) (int, error) {
+	r.mu.Lock()
+	c, ok := r.containers[container]
+	r.mu.Unlock()
+	if !ok {
+		return -1, fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+	}
+	select {
+	case <-c.stopped:
+		return c.code, nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+// create registers a running simulated container for opts.
+func (r *SimRunner) create(opts cldpd.RunOptions) (*simContainer, Script, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.containers[opts.Name]; ok {
+		return nil, Script{}, fmt.Errorf("docker run: %s: %w", opts.Name, errNameInUse)
+	}
+	c := &simContainer{
+		startedAt: r.clock.Now(),
+		stopped:   make(chan struct{}),
+		image:     opts.Image,
+	}
+	r.containers[opts.Name] = c
+	r.stats.Runs++
+	r.stats.Running++
+	return c, r.script(opts.Name), nil
+}
+
+// runContainer plays s on c until it exits, then removes c.
+func (r *SimRunner) runContainer(ctx context.Context, name string, s Script, c *simContainer, stdout io.Writer) (int, error) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.containers, name)
+		r.stats.Running--
+		r.mu.Unlock()
+	}()
+
+	code, err := r.play(ctx, name, s, c, stdout)
+	// Release any Attach waiting on this container with the final exit code.
+	c.terminate(code)
+	return code, err
+}
+
+// Exec plays the container's script against a running simulated container.
+// Returns cldpd.ErrSessionNotFound if no container with that name is running.
+func (r *SimRunner) Exec(ctx context.Context, container string, _ []string, stdout io.Writer) (int, error) {
+	r.mu.Lock()
+	c, ok := r.containers[container]
+	if !ok {
+		r.mu.Unlock()
+		return -1, fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+	}
+	s := r.script(container)
+	r.stats.Execs++
+	r.mu.Unlock()
+
+	return r.play(ctx, container, s, c, stdout)
+}
+
+// ExecInteractive plays the container's script to stdout as Exec does; stdin
+// and stderr are unused. Returns cldpd.ErrSessionNotFound if no container with
+// that name is running.
+func (r *SimRunner) ExecInteractive(ctx context.Context, container string, cmd []string, _ io.Reader, stdout, _ io.Writer) (int, error) {
+	return r.Exec(ctx, container, cmd, stdout)
+}
+
+// Attach blocks until the named simulated container exits and returns its exit
+// code. Scripted output goes only to the Run that started the container, so
+// nothing is written to stdout. Returns cldpd.ErrSessionNotFound if no
+// container with that name is running.
+func (r *SimRunner) Attach(ctx context.Context, container string, _ io.Writer) (int, error) {
+	r.mu.Lock()
+	c, ok := r.containers[container]
+	if !ok {
+		r.mu.Unlock()
+		return -1, fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+	}
+	r.stats.Attaches++
+	r.mu.Unlock()
+
+	select {
+	case <-c.stopped:
+		return c.code, nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+// play emits the script's output and returns its exit code, ending early if
+// the container is terminated or ctx is cancelled.
+func (r *SimRunner) play(ctx context.Context, name string, s Script, c *simContainer, stdout io.Writer) (int, error) {
+	for i := 1; i <= s.Lines; i++ {
+		select {
+		case <-r.clock.After(s.LineInterval):
+		case <-c.stopped:
+			return c.code, nil
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+		if _, err := fmt.Fprintf(stdout, "%s line %d\n", name, i); err != nil {
+			return -1, err
+		}
+	}
+	if s.Hang {
+		select {
+		case <-c.stopped:
+			return c.code, nil
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+	return s.ExitCode, nil
+}
+
+// Stop terminates the named container with ExitStopped. Stopping a container
+// that is not running returns nil, as DockerRunner does for a removed container.
+func (r *SimRunner) Stop(_ context.Context, container string, _ time.Duration, _ string) error {
+	r.terminate(container, ExitStopped, &r.stats.Stops)
+	return nil
+}
+
+// Kill terminates the named container with ExitKilled. Killing a container
+// that is not running returns nil, as DockerRunner does for a removed container.
+func (r *SimRunner) Kill(_ context.Context, container string) error {
+	r.terminate(container, ExitKilled, &r.stats.Kills)
+	return nil
+}
+
+// Remove returns nil: simulated containers are removed as soon as they exit.
+func (r *SimRunner) Remove(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+// terminate ends the named container, if running, and increments counter.
+func (r *SimRunner) terminate(container string, code int, counter *int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*counter++
+	if c, ok := r.containers[container]; ok {
+		c.terminate(code)
+	}
+}
+
+// Health returns the scripted health status of a running container.
+// Returns cldpd.ErrSessionNotFound if no container with that name is running.
+func (r *SimRunner) Health(_ context.Context, container string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.containers[container]; !ok {
+		return "", fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+	}
+	return r.script(container).Health, nil
+}
+
+// Inspect reports a running simulated container. Exited containers are
+// removed, as with docker run --rm, so Inspect returns cldpd.ErrSessionNotFound
+// for them and for names that never ran.
+func (r *SimRunner) Inspect(_ context.Context, container string) (cldpd.ContainerState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[container]
+	if !ok {
+		return cldpd.ContainerState{}, fmt.Errorf("%s: %w", container, cldpd.ErrSessionNotFound)
+	}
+	return cldpd.ContainerState{
+		StartedAt: c.startedAt,
+		Image:     c.image,
+		Running:   true,
+	}, nil
+}
+
+// List returns the running simulated containers, sorted by name. Exited
+// containers are removed, so all has no effect.
+func (r *SimRunner) List(_ context.Context, _ bool) ([]cldpd.ContainerSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]cldpd.ContainerSummary, 0, len(r.containers))
+	for name, c := range r.containers {
+		list = append(list, cldpd.ContainerSummary{
+			Name:    name,
+			Pod:     strings.TrimPrefix(name, "cldpd-"),
+			Image:   c.image,
+			Status:  "Up " + r.clock.Now().Sub(c.startedAt).String(),
+			Running: true,
+		})
+	}
+	slices.SortFunc(list, func(a, b cldpd.ContainerSummary) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+// DataRoot returns an empty string: simulated images occupy no disk.
+func (r *SimRunner) DataRoot(_ context.Context) (string, error) {
+	return "", nil
+}
+
+// Runtimes returns runc, the only runtime of the simulated daemon.
+func (r *SimRunner) Runtimes(_ context.Context) ([]string, error) {
+	return []string{"runc"}, nil
+}
+
+// Pull records image as present, created now by the simulation clock. Every
+// pull succeeds at once.
+func (r *SimRunner) Pull(_ context.Context, image string, _ io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Pulls++
+	r.images[image] = r.clock.Now()
+	return nil
+}
+
+// ImageCreated returns when tag was last built, by the simulation clock.
+func (r *SimRunner) ImageCreated(_ context.Context, tag string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created, ok := r.images[tag]
+	if !ok {
+		return time.Time{}, fmt.Errorf("no such image: %s", tag)
+	}
+	return created, nil
+}
+
+// RemoveImage forgets tag. Removing an image that was never built returns nil.
+func (r *SimRunner) RemoveImage(_ context.Context, tag string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.images, tag)
+	return nil
+}
+
+// Images returns the built cldpd-<pod> tags, sorted.
+func (r *SimRunner) Images(_ context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tags []string
+	for tag := range r.images {
+		if strings.HasPrefix(tag, "cldpd-") {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
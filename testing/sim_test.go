@@ -0,0 +1,425 @@
+//go:build testing
+
+package testing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zoobzio/cldpd"
+)
+
+// fastForward advances clock in small steps until the returned stop function is called.
+func fastForward(clock *FakeClock) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			clock.Advance(100 * time.Millisecond)
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func TestSimRunner_RunEmitsScriptedLines(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	r := NewSimRunner(clock, 1)
+	r.SetScript("app", Script{Lines: 3, LineInterval: time.Second, ExitCode: 2})
+	stop := fastForward(clock)
+	defer stop()
+
+	var out bytes.Buffer
+	code, err := r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app"}, &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code != 2 {
+		t.Errorf("exit code: got %d, want 2", code)
+	}
+	if got := strings.Count(out.String(), "\n"); got != 3 {
+		t.Errorf("lines: got %d, want 3", got)
+	}
+	if s := r.Stats(); s.Runs != 1 || s.Running != 0 {
+		t.Errorf("stats: got %+v, want Runs=1 Running=0", s)
+	}
+}
+
+func TestSimRunner_BuildFail(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	r.SetScript("app", Script{BuildFail: true})
+	err := r.Build(context.Background(), "cldpd-app", "", cldpd.BuildOptions{})
+	if !errors.Is(err, cldpd.ErrBuildFailed) {
+		t.Errorf("got %v, want ErrBuildFailed", err)
+	}
+}
+
+func TestSimRunner_ImageCreated(t *testing.T) {
+	built := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewSimRunner(NewFakeClock(built), 1)
+	if _, err := r.ImageCreated(context.Background(), "cldpd-app"); err == nil {
+		t.Error("ImageCreated before Build: expected error, got nil")
+	}
+	if err := r.Build(context.Background(), "cldpd-app", "", cldpd.BuildOptions{}); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	created, err := r.ImageCreated(context.Background(), "cldpd-app")
+	if err != nil {
+		t.Fatalf("ImageCreated: %v", err)
+	}
+	if !created.Equal(built) {
+		t.Errorf("created: got %v, want %v", created, built)
+	}
+}
+
+func TestSimRunner_Images(t *testing.T) {
+	r := NewSimRunner(NewFakeClock(time.Time{}), 1)
+	for _, tag := range []string{"cldpd-web", "custom:v1", "cldpd-api"} {
+		if err := r.Build(context.Background(), tag, "", cldpd.BuildOptions{}); err != nil {
+			t.Fatalf("Build %s: %v", tag, err)
+		}
+	}
+	tags, err := r.Images(context.Background())
+	if err != nil {
+		t.Fatalf("Images: %v", err)
+	}
+	if strings.Join(tags, ",") != "cldpd-api,cldpd-web" {
+		t.Errorf("Images: got %v, want [cldpd-api cldpd-web]", tags)
+	}
+
+	if err := r.RemoveImage(context.Background(), "cldpd-api"); err != nil {
+		t.Fatalf("RemoveImage: %v", err)
+	}
+	if _, err := r.ImageCreated(context.Background(), "cldpd-api"); err == nil {
+		t.Error("ImageCreated after RemoveImage: expected error, got nil")
+	}
+}
+
+func TestSimRunner_BuildWaitsForClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	r := NewSimRunner(clock, 1)
+	r.SetDefaultScript(Script{BuildTime: time.Minute, BuildJitter: 10 * time.Second})
+
+	done := make(chan error, 1)
+	go func() { done <- r.Build(context.Background(), "cldpd-app", "", cldpd.BuildOptions{}) }()
+
+	for clock.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(49 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("build finished before its minimum duration")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(21 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("build did not finish after its maximum duration")
+	}
+}
+
+func TestSimRunner_HangUntilStopped(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	r.SetScript("app", Script{Hang: true})
+
+	type result struct {
+		code int
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		code, err := r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app"}, &bytes.Buffer{})
+		done <- result{code, err}
+	}()
+	for r.Stats().Running == 0 {
+		runtime.Gosched()
+	}
+
+	if err := r.Stop(context.Background(), "cldpd-app", time.Second, ""); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	res := <-done
+	if res.err != nil || res.code != ExitStopped {
+		t.Errorf("got (%d, %v), want (%d, nil)", res.code, res.err, ExitStopped)
+	}
+}
+
+func TestSimRunner_DuplicateName(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	r.SetDefaultScript(Script{Hang: true})
+	go func() {
+		_, _ = r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app"}, &bytes.Buffer{})
+	}()
+	for r.Stats().Running == 0 {
+		runtime.Gosched()
+	}
+	defer func() { _ = r.Kill(context.Background(), "cldpd-app") }()
+
+	if _, err := r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for duplicate container name, got nil")
+	}
+}
+
+func TestSimRunner_InspectRunningContainer(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := NewSimRunner(clock, 1)
+	r.SetDefaultScript(Script{Hang: true})
+	go func() {
+		_, _ = r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app", Image: "cldpd-app"}, &bytes.Buffer{})
+	}()
+	for r.Stats().Running == 0 {
+		runtime.Gosched()
+	}
+
+	st, err := r.Inspect(context.Background(), "cldpd-app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !st.Running || st.Image != "cldpd-app" || !st.StartedAt.Equal(clock.Now()) {
+		t.Errorf("got %+v, want running cldpd-app started at %v", st, clock.Now())
+	}
+
+	_ = r.Kill(context.Background(), "cldpd-app")
+	for r.Stats().Running != 0 {
+		runtime.Gosched()
+	}
+	if _, err := r.Inspect(context.Background(), "cldpd-app"); !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("after exit: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSimRunner_List(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := NewSimRunner(clock, 1)
+	r.SetDefaultScript(Script{Hang: true})
+	for _, name := range []string{"cldpd-web", "cldpd-api"} {
+		go func() {
+			_, _ = r.Run(context.Background(), cldpd.RunOptions{Name: name, Image: name}, &bytes.Buffer{})
+		}()
+	}
+	for r.Stats().Running != 2 {
+		runtime.Gosched()
+	}
+
+	list, err := r.List(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 || list[0].Pod != "api" || list[1].Pod != "web" || !list[0].Running {
+		t.Errorf("got %+v, want running api and web in name order", list)
+	}
+
+	_ = r.Kill(context.Background(), "cldpd-api")
+	_ = r.Kill(context.Background(), "cldpd-web")
+	for r.Stats().Running != 0 {
+		runtime.Gosched()
+	}
+	if list, _ := r.List(context.Background(), true); len(list) != 0 {
+		t.Errorf("after exit: got %+v, want none", list)
+	}
+}
+
+func TestSimRunner_AttachWaitsForExit(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	r.SetDefaultScript(Script{Hang: true})
+	go func() {
+		_, _ = r.Run(context.Background(), cldpd.RunOptions{Name: "cldpd-app"}, &bytes.Buffer{})
+	}()
+	for r.Stats().Running == 0 {
+		runtime.Gosched()
+	}
+
+	d := cldpd.NewDispatcher(t.TempDir(), r)
+	s, err := d.Attach(context.Background(), "app")
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	for r.Stats().Attaches == 0 {
+		runtime.Gosched()
+	}
+	if err := r.Kill(context.Background(), "cldpd-app"); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	if code, err := s.Wait(); err != nil || code != ExitKilled {
+		t.Errorf("got (%d, %v), want (%d, nil)", code, err, ExitKilled)
+	}
+	for r.Stats().Running != 0 {
+		runtime.Gosched()
+	}
+	if _, err := r.Attach(context.Background(), "cldpd-app", &bytes.Buffer{}); !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("after exit: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSimRunner_DetachedRunOutlivesContext(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	r.SetDefaultScript(Script{Hang: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id, err := r.RunDetached(ctx, cldpd.RunOptions{Name: "cldpd-app"})
+	if err != nil || id == "" {
+		t.Fatalf("RunDetached: got (%q, %v), want an ID", id, err)
+	}
+	cancel()
+	if state, err := r.Inspect(context.Background(), "cldpd-app"); err != nil || !state.Running {
+		t.Fatalf("after cancel: got (%+v, %v), want running", state, err)
+	}
+
+	stopErr := make(chan error, 1)
+	go func() {
+		// Give WaitContainer time to find the running container.
+		time.Sleep(20 * time.Millisecond)
+		stopErr <- r.Stop(context.Background(), "cldpd-app", time.Second, "")
+	}()
+	if code, err := r.WaitContainer(context.Background(), "cldpd-app"); err != nil || code != ExitStopped {
+		t.Errorf("WaitContainer: got (%d, %v), want (%d, nil)", code, err, ExitStopped)
+	}
+	if err := <-stopErr; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	for r.Stats().Running != 0 {
+		runtime.Gosched()
+	}
+	if _, err := r.WaitContainer(context.Background(), "cldpd-app"); !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("after exit: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSimRunner_ExecRequiresRunningContainer(t *testing.T) {
+	r := NewSimRunner(nil, 1)
+	_, err := r.Exec(context.Background(), "cldpd-app", nil, &bytes.Buffer{})
+	if !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("Exec: got %v, want ErrSessionNotFound", err)
+	}
+	_, err = r.Health(context.Background(), "cldpd-app")
+	if !errors.Is(err, cldpd.ErrSessionNotFound) {
+		t.Errorf("Health: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+// TestSimRunner_LoadThroughDispatcher runs 200 simulated sessions through a real
+// Dispatcher: a quarter hang until stopped, the rest emit output and exit.
+func TestSimRunner_LoadThroughDispatcher(t *testing.T) {
+	const (
+		pods  = 200
+		lines = 5
+	)
+	baseline := runtime.NumGoroutine()
+
+	podsDir := t.TempDir()
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := NewSimRunner(clock, 42)
+	for i := 0; i < pods; i++ {
+		name := fmt.Sprintf("pod%03d", i)
+		dir := filepath.Join(podsDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("create pod dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+			t.Fatalf("write Dockerfile: %v", err)
+		}
+		r.SetScript(name, Script{
+			BuildTime:    30 * time.Second,
+			BuildJitter:  20 * time.Second,
+			Lines:        lines,
+			LineInterval: time.Second,
+			ExitCode:     i % 2,
+			Hang:         i%4 == 0,
+		})
+	}
+	d := cldpd.NewDispatcher(podsDir, r)
+	stopClock := fastForward(clock)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		counts = map[cldpd.EventType]int{}
+	)
+	for i := 0; i < pods; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			s, err := d.Start(ctx, fmt.Sprintf("pod%03d", i), "https://github.com/org/repo/issues/1")
+			if err != nil {
+				t.Errorf("Start: %v", err)
+				return
+			}
+			local := map[cldpd.EventType]int{}
+			for ev := range s.Events() {
+				local[ev.Type]++
+				if ev.Type == cldpd.EventOutput && local[cldpd.EventOutput] == lines && i%4 == 0 {
+					if err := s.Stop(ctx); err != nil {
+						t.Errorf("Stop: %v", err)
+					}
+				}
+			}
+			code, _ := s.Wait()
+			want := i % 2
+			if i%4 == 0 {
+				want = ExitStopped
+			}
+			if code != want {
+				t.Errorf("pod%03d exit code: got %d, want %d", i, code, want)
+			}
+			mu.Lock()
+			for k, v := range local {
+				counts[k] += v
+			}
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	stopClock()
+
+	stats := r.Stats()
+	if stats.Builds != pods || stats.Runs != pods || stats.Running != 0 {
+		t.Errorf("stats: got %+v, want Builds=Runs=%d Running=0", stats, pods)
+	}
+	if stats.Stops != pods/4 {
+		t.Errorf("Stops: got %d, want %d", stats.Stops, pods/4)
+	}
+	for _, typ := range []cldpd.EventType{cldpd.EventBuildStarted, cldpd.EventBuildComplete, cldpd.EventContainerStarted, cldpd.EventContainerExited} {
+		if counts[typ] != pods {
+			t.Errorf("event %d: got %d, want %d", typ, counts[typ], pods)
+		}
+	}
+	if counts[cldpd.EventOutput] != pods*lines {
+		t.Errorf("output events: got %d, want %d", counts[cldpd.EventOutput], pods*lines)
+	}
+	if counts[cldpd.EventError] != 0 {
+		t.Errorf("error events: got %d, want 0", counts[cldpd.EventError])
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("goroutines: got %d after all sessions ended, want <= %d", n, baseline)
+	}
+}